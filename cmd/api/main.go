@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
 	"flag"
 	"fmt"
 	"net/http"
@@ -11,16 +10,31 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/g3offrey/idiomapi/internal/audit"
+	"github.com/g3offrey/idiomapi/internal/auth"
 	"github.com/g3offrey/idiomapi/internal/config"
 	"github.com/g3offrey/idiomapi/internal/database"
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/events"
+	"github.com/g3offrey/idiomapi/internal/export"
 	"github.com/g3offrey/idiomapi/internal/handler"
 	"github.com/g3offrey/idiomapi/internal/middleware"
+	"github.com/g3offrey/idiomapi/internal/openapi"
+	"github.com/g3offrey/idiomapi/internal/outbox"
 	"github.com/g3offrey/idiomapi/internal/repository"
 	"github.com/g3offrey/idiomapi/internal/service"
+	"github.com/g3offrey/idiomapi/pkg/lifecycle"
 	"github.com/g3offrey/idiomapi/pkg/logger"
+	"github.com/g3offrey/idiomapi/pkg/tracing"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 )
 
+// oidcTimeout bounds each request to the OIDC provider
+const oidcTimeout = 10 * time.Second
+
 func main() {
 	// Parse command line flags
 	configPath := flag.String("config", "configs/config.toml", "path to config file")
@@ -34,29 +48,177 @@ func main() {
 	}
 
 	// Initialize logger
-	log := logger.New(cfg.Logging)
+	log, logLevel, err := logger.NewWithLevel(cfg.Logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create logger: %v\n", err)
+		os.Exit(1)
+	}
 	log.Info("starting application",
 		"config", *configPath,
 		"server_address", cfg.Server.Address())
 
-	// Initialize database
+	if _, err := cfg.Todos.Location(); err != nil {
+		log.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	if _, err := cfg.Todos.TitleRegexp(); err != nil {
+		log.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
+	if err := handler.RegisterValidators(); err != nil {
+		log.Error("failed to register validators", "error", err)
+		os.Exit(1)
+	}
+
 	ctx := context.Background()
-	db, err := database.New(ctx, &cfg.Database, log)
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.New(ctx, cfg.Tracing)
 	if err != nil {
-		log.Error("failed to initialize database", "error", err)
+		log.Error("failed to initialize tracing", "error", err)
 		os.Exit(1)
 	}
-	defer db.Close()
+
+	// Components are stopped in reverse order: the HTTP server first and
+	// the database once nothing uses it anymore, then pending spans are
+	// flushed
+	app := lifecycle.New(log)
+	app.Add("tracing", lifecycle.Hook{OnStop: shutdownTracing})
 
 	// Initialize repositories
-	todoRepo := repository.NewTodoRepository(db.Pool)
+	var (
+		todoRepo    repository.TodoRepository
+		recordAudit func(repository.Auditor)
+		userStore   auth.UserStore
+		sessions    auth.SessionStore
+		apiKeyStore auth.APIKeyStore
+		auditStore  audit.Store
+		dbHealth    handler.HealthChecker
+		maintenance *database.Maintenance
+	)
+	if cfg.Database.InMemory() {
+		log.Warn("using in-memory todo repository, data will not be persisted")
+		memRepo := repository.NewInMemoryTodoRepository()
+		if cfg.Todos.UniqueTitles {
+			memRepo.EnableUniqueTitles()
+		}
+		todoRepo = memRepo
+		recordAudit = memRepo.RecordAudit
+		memSessions := auth.NewInMemorySessionStore()
+		memAPIKeys := auth.NewInMemoryAPIKeyStore()
+		userStore = auth.NewInMemoryUserStoreWithCredentials(memSessions, memAPIKeys)
+		sessions = memSessions
+		apiKeyStore = memAPIKeys
+		auditStore = audit.NewInMemoryStore()
+		dbHealth = memRepo
+	} else {
+		// Initialize database
+		db, err := database.New(ctx, &cfg.Database, log)
+		if err != nil {
+			log.Error("failed to initialize database", "error", err)
+			os.Exit(1)
+		}
+		app.Add("database", lifecycle.Hook{OnStop: func(context.Context) error {
+			db.Close()
+			return nil
+		}})
+
+		// Apply pending migrations
+		if cfg.Database.AutoMigrate {
+			if err := database.Migrate(ctx, db.Pool); err != nil {
+				log.Error("failed to apply database migrations", "error", err)
+				os.Exit(1)
+			}
+			log.Info("database migrations applied")
+		}
+
+		pgRepo := repository.NewPostgresTodoRepositoryWithReadPool(db.Pool, db.ReadPool, repository.RetryPolicy{
+			MaxAttempts: cfg.Database.RetryAttempts,
+			Backoff:     cfg.Database.RetryBackoff,
+		})
+		if cfg.Todos.UniqueTitles {
+			pgRepo.EnableUniqueTitles()
+		}
+		todoRepo = pgRepo
+		recordAudit = pgRepo.RecordAudit
+		userStore = auth.NewPostgresUserStore(db.Pool)
+		sessions = auth.NewPostgresSessionStore(db.Pool)
+		apiKeyStore = auth.NewPostgresAPIKeyStore(db.Pool)
+		auditStore = audit.NewPostgresStore(db.Pool)
+		dbHealth = db
+		maintenance = database.NewMaintenance(db.Pool, cfg.Database.MaintenanceVacuum, cfg.Database.MaintenanceInterval, log)
+
+		// Publish the todo events written by the repository
+		app.Add("outbox", outbox.NewPoller(db.Pool, outbox.NewLogPublisher(log), cfg.Outbox.PollInterval, cfg.Outbox.BatchSize, cfg.Outbox.Retention, log))
+	}
+
+	if cfg.Database.SlowQueryThreshold > 0 {
+		todoRepo = repository.NewSlowQueryRepository(todoRepo, cfg.Database.SlowQueryThreshold, log)
+	}
 
 	// Initialize services
-	todoService := service.NewTodoService(todoRepo, log)
+	todoService := service.NewTodoService(todoRepo, cfg.Todos, cfg.Pagination, cfg.Limits, log)
+	eventHub := events.NewHub(cfg.Events.BufferSize)
+	todoService.PublishEvents(eventHub)
+	var auditHandler *handler.AuditHandler
+	var activity export.ActivitySource
+	if cfg.Audit.Enabled {
+		// The repository records each change in the transaction making it
+		auditLog := audit.NewLog(auditStore)
+		recordAudit(auditLog)
+		auditHandler = handler.NewAuditHandler(auditLog)
+		activity = auditLog
+	}
+
+	// Large data exports are built in the background, until shutdown
+	exporter := export.NewExporter(todoService, activity)
+	exportJobs := export.NewJobs(exporter, cfg.Export.JobTTL, cfg.Export.MaxPendingJobs, log)
+	app.Add("exports", exportJobs)
+
+	// Authenticate todo requests with tokens when enabled, by X-User-ID
+	// otherwise
+	requireOwner := middleware.RequireOwner()
+	var authHandler *handler.AuthHandler
+	if cfg.Auth.Enabled {
+		authService, err := auth.NewService(userStore, sessions, auth.NewTokens([]byte(cfg.Auth.JWTSecret), cfg.Auth.TokenTTL), cfg.Auth.RefreshTokenTTL)
+		if err != nil {
+			log.Error("failed to initialize authentication", "error", err)
+			os.Exit(1)
+		}
+		var oidc *auth.OIDC
+		if cfg.Auth.OIDC.Enabled {
+			oidc = auth.NewOIDC(cfg.Auth.OIDC, &http.Client{Timeout: oidcTimeout})
+		}
+		var cookies *auth.Cookies
+		if cfg.Auth.CookieSessions {
+			cookies = auth.NewCookies(cfg.Server.TLS.Enabled || cfg.Security.ForceHTTPS)
+		}
+		requireOwner = auth.RequireToken(authService, cookies)
+		authHandler = handler.NewAuthHandler(authService, oidc, cookies)
+	}
+
+	// Machine clients may use API keys instead on the todo routes
+	apiKeys := auth.NewAPIKeys(apiKeyStore)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeys)
 
 	// Initialize handlers
-	todoHandler := handler.NewTodoHandler(todoService)
-	healthHandler := handler.NewHealthHandler(db)
+	todoHandler := handler.NewTodoHandler(todoService, cfg.Server.RejectEmptyUpdate, cfg.Server.BasePath, dto.Naming(cfg.Server.JSONNaming))
+	eventsHandler := handler.NewEventsHandler(eventHub, cfg.Events.KeepAlive, dto.Naming(cfg.Server.JSONNaming))
+	healthHandler := handler.NewHealthHandler(dbHealth)
+	docsHandler := handler.NewDocsHandler(openapi.Spec())
+	exportHandler := handler.NewExportHandler(exporter, exportJobs, todoService, cfg.Export.AsyncThreshold, cfg.Server.BasePath)
+	var maintenanceHandler *handler.MaintenanceHandler
+	if maintenance != nil {
+		maintenanceHandler = handler.NewMaintenanceHandler(maintenance)
+	}
+	logLevelHandler := handler.NewLogLevelHandler(logLevel)
+	if cfg.Admin.Token == "" {
+		log.Info("admin routes disabled, admin.token is not set")
+		if cfg.Audit.Enabled {
+			log.Warn("audit trail recorded but not served, admin.token is not set")
+		}
+	}
 
 	// Setup Gin
 	if cfg.Logging.Level != "debug" {
@@ -64,13 +226,44 @@ func main() {
 	}
 
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Error("invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
 
 	// Add middleware
-	router.Use(middleware.Recovery(log))
-	router.Use(middleware.Logger(log))
+	router.Use(middleware.Recovery(log, cfg.Logging.PanicStack || gin.Mode() != gin.ReleaseMode))
+	router.Use(otelgin.Middleware(cfg.Tracing.ServiceName))
+	forwarded, err := middleware.ForwardedHeaders(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Error("invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
+	router.Use(forwarded)
+	router.Use(middleware.Logger(log, cfg.Logging.RedactKeys))
+	if cfg.Audit.Enabled {
+		router.Use(middleware.RecordClientIP())
+	}
+	if cfg.Security.ForceHTTPS {
+		router.Use(middleware.ForceHTTPS(cfg.Security.HSTSMaxAge, "/health"))
+	}
+	if cfg.Server.Compression.Enabled {
+		router.Use(middleware.Compress(cfg.Server.Compression.MinLength, cfg.Server.Compression.Level))
+	}
+	router.Use(middleware.MaxBodySize(cfg.Server.MaxBodySize))
+	if cfg.Logging.LogBodies {
+		router.Use(middleware.LogBodies(log, cfg.Logging.MaxBodyLogSize, cfg.Logging.RedactKeys))
+	}
+	// Event streams, CSV listings and archive downloads outlive the request
+	// deadline
+	streams := middleware.Paths("/api/v1/todos/events", "/api/v1/users/me/export", "/api/v1/users/me/exports/:id/download")
+	listing := middleware.Paths("/api/v1/todos")
+	router.Use(middleware.Timeout(cfg.Server.RequestTimeout, cfg.Server.MaxClientTimeout, func(c *gin.Context) bool {
+		return streams(c) || (listing(c) && handler.StreamsCSV(c))
+	}))
 
 	// Setup routes
-	setupRoutes(router, todoHandler, healthHandler)
+	setupRoutes(router, cfg, requireOwner, auth.AcceptAPIKey(apiKeys, requireOwner), todoHandler, eventsHandler, authHandler, apiKeyHandler, exportHandler, healthHandler, docsHandler, maintenanceHandler, logLevelHandler, auditHandler)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -80,45 +273,140 @@ func main() {
 		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
+	// Shutdown waits for active requests, which event streams never finish
+	// on their own
+	srv.RegisterOnShutdown(eventHub.Close)
 
-	// Start server in a goroutine
-	go func() {
-		log.Info("server starting", "address", cfg.Server.Address())
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Error("server failed to start", "error", err)
-			os.Exit(1)
-		}
-	}()
-
-	// Wait for interrupt signal to gracefully shutdown the server
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Run until interrupted, or until the server fails
+	runCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	log.Info("shutting down server...")
-
-	// Graceful shutdown with timeout
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	tls := cfg.Server.TLS
+	if !tls.Enabled {
+		tls.CertFile, tls.KeyFile = "", ""
+	}
+	redirect := middleware.RedirectToHTTPS(cfg.Server.Port)
+	if tls.Enabled && tls.Autocert.Enabled {
+		// Certificates are obtained on the first handshake for each host,
+		// and renewed in the background
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tls.Autocert.Hosts...),
+			Cache:      autocert.DirCache(tls.Autocert.CacheDir),
+			Email:      tls.Autocert.Email,
+		}
+		if tls.Autocert.DirectoryURL != "" {
+			manager.Client = &acme.Client{DirectoryURL: tls.Autocert.DirectoryURL}
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		redirect = manager.HTTPHandler(redirect)
+	}
+	app.Add("http", lifecycle.NewHTTPServer(srv, tls.CertFile, tls.KeyFile, func(err error) {
+		log.Error("server failed", "error", err)
+		stop()
+	}))
+	if tls.Enabled && tls.RedirectAddr != "" {
+		redirectSrv := &http.Server{
+			Addr:         tls.RedirectAddr,
+			Handler:      redirect,
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			IdleTimeout:  cfg.Server.IdleTimeout,
+		}
+		app.Add("http-redirect", lifecycle.NewHTTPServer(redirectSrv, "", "", func(err error) {
+			log.Error("redirect server failed", "error", err)
+			stop()
+		}))
+	}
 
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Error("server forced to shutdown", "error", err)
+	log.Info("server starting", "address", cfg.Server.Address(), "tls", cfg.Server.TLS.Enabled, "autocert", tls.Autocert.Enabled, "redirect_address", tls.RedirectAddr)
+	if err := app.Run(runCtx, cfg.Server.ShutdownTimeout); err != nil {
+		log.Error("server stopped with errors", "error", err)
+		os.Exit(1)
 	}
 
 	log.Info("server stopped")
 }
 
-// setupRoutes configures all API routes
-func setupRoutes(router *gin.Engine, todoHandler *handler.TodoHandler, healthHandler *handler.HealthHandler) {
+// setupRoutes configures all API routes, todo routes identifying their user
+// with requireTodoOwner, which also accepts API keys, and API key and
+// export routes with requireOwner. Auth routes are only registered when
+// authHandler is not nil, that is with auth.enabled, and admin routes when
+// admin.token is set and their handler is not nil.
+func setupRoutes(router *gin.Engine, cfg *config.Config, requireOwner, requireTodoOwner gin.HandlerFunc, todoHandler *handler.TodoHandler, eventsHandler *handler.EventsHandler, authHandler *handler.AuthHandler, apiKeyHandler *handler.APIKeyHandler, exportHandler *handler.ExportHandler, healthHandler *handler.HealthHandler, docsHandler *handler.DocsHandler, maintenanceHandler *handler.MaintenanceHandler, logLevelHandler *handler.LogLevelHandler, auditHandler *handler.AuditHandler) {
 	// Health check
 	router.GET("/health", healthHandler.Health)
 
+	// API documentation
+	router.GET("/openapi.json", docsHandler.OpenAPI)
+	router.GET("/docs", docsHandler.SwaggerUI)
+
 	// API v1 routes
 	v1 := router.Group("/api/v1")
-	todos := v1.Group("/todos")
-	todos.POST("", todoHandler.CreateTodo)
-	todos.GET("", todoHandler.ListTodos)
-	todos.GET("/:id", todoHandler.GetTodo)
-	todos.PUT("/:id", todoHandler.UpdateTodo)
-	todos.DELETE("/:id", todoHandler.DeleteTodo)
+	if authHandler != nil {
+		authRoutes := v1.Group("/auth", middleware.RequireJSON())
+		if !cfg.Auth.DisablePasswords {
+			authRoutes.POST("/register", authHandler.Register)
+			authRoutes.POST("/login", authHandler.Login)
+		}
+		authRoutes.POST("/refresh", authHandler.Refresh)
+		authRoutes.POST("/logout", authHandler.Logout)
+		if cfg.Auth.OIDC.Enabled {
+			authRoutes.GET("/oidc/login", authHandler.OIDCLogin)
+			authRoutes.GET("/oidc/callback", authHandler.OIDCCallback)
+		}
+	}
+
+	// API keys cannot manage API keys, only users can
+	apiKeys := v1.Group("/apikeys", requireOwner, middleware.RequireJSON())
+	apiKeys.POST("", apiKeyHandler.CreateAPIKey)
+	apiKeys.GET("", apiKeyHandler.ListAPIKeys)
+	apiKeys.DELETE("/:id", apiKeyHandler.DeleteAPIKey)
+
+	// Exports hold more than todos, which API keys are limited to
+	me := v1.Group("/users/me", requireOwner, middleware.RequireJSON())
+	me.GET("/export", exportHandler.Export)
+	me.GET("/exports/:id", exportHandler.GetExport)
+	me.GET("/exports/:id/download", exportHandler.DownloadExport)
+
+	read, write := auth.RequireScope(auth.ScopeTodosRead), auth.RequireScope(auth.ScopeTodosWrite)
+	todos := v1.Group("/todos", requireTodoOwner, middleware.RequireJSON())
+	todos.POST("", write, middleware.Idempotency(cfg.Todos.IdempotencyTTL, cfg.Todos.IdempotencyMaxKeys), todoHandler.CreateTodo)
+	todos.GET("", read, todoHandler.ListTodos)
+	todos.HEAD("", read, todoHandler.HeadTodos)
+	todos.DELETE("", write, todoHandler.DeleteTodos)
+	todos.POST("/complete-all", write, todoHandler.CompleteAll)
+	todos.POST("/batch-get", read, todoHandler.BatchGetTodos)
+	todos.GET("/version", read, todoHandler.GetVersion)
+	todos.GET("/events", read, eventsHandler.Stream)
+	todos.GET("/stats/dow", read, todoHandler.GetWeekdayStats)
+	todos.GET("/stats/completion-time", read, todoHandler.GetCompletionTimeStats)
+	todos.GET("/:id", read, todoHandler.GetTodo)
+	todos.HEAD("/:id", read, todoHandler.HeadTodo)
+	todos.PUT("/reorder", write, todoHandler.ReorderTodos)
+	todos.PUT("/by-external/:externalID", write, todoHandler.UpsertTodo)
+	todos.PUT("/:id", write, todoHandler.UpdateTodo)
+	todos.POST("/:id/archive", write, todoHandler.ArchiveTodo)
+	todos.POST("/:id/unarchive", write, todoHandler.UnarchiveTodo)
+	todos.DELETE("/:id", write, todoHandler.DeleteTodo)
+
+	if cfg.Todos.ExposeOptions {
+		// Describing the validation rules does not touch any user's todos
+		v1.OPTIONS("/todos", todoHandler.Options)
+	}
+
+	// Admin routes act on every user, so they are left out without a token
+	// to authenticate them
+	if cfg.Admin.Token == "" {
+		return
+	}
+	admin := v1.Group("/admin", middleware.RequireAdminToken(cfg.Admin.Token), middleware.RequireJSON())
+	if maintenanceHandler != nil {
+		admin.POST("/db/maintenance", maintenanceHandler.RunMaintenance)
+	}
+	admin.POST("/log-level", logLevelHandler.SetLogLevel)
+	if auditHandler != nil {
+		admin.GET("/audit", auditHandler.ListEvents)
+		admin.GET("/audit/verify", auditHandler.VerifyEvents)
+	}
 }
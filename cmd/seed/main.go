@@ -0,0 +1,122 @@
+// Command seed fills the database configured for the server with randomly
+// generated todos, for demos and load tests.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+
+	"github.com/g3offrey/idiomapi/internal/config"
+	"github.com/g3offrey/idiomapi/internal/database"
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/g3offrey/idiomapi/internal/repository"
+	"github.com/g3offrey/idiomapi/pkg/logger"
+)
+
+var (
+	verbs = []string{"Buy", "Call", "Clean", "Fix", "Plan", "Read", "Review", "Write"}
+	nouns = []string{"the report", "groceries", "the garage", "mom", "the invoice", "a book", "the roadmap", "the slides"}
+)
+
+func main() {
+	// Parse command line flags
+	configPath := flag.String("config", "configs/config.toml", "path to config file")
+	count := flag.Int("count", 100, "number of todos to create")
+	batchSize := flag.Int("batch", 1000, "todos inserted per batch")
+	ownerID := flag.String("owner", "demo", "user the todos belong to")
+	reset := flag.Bool("reset", false, "delete every todo first")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Database.InMemory() {
+		fmt.Fprintln(os.Stderr, "seeding requires a database, set database.host")
+		os.Exit(1)
+	}
+	if *count < 0 || *batchSize < 1 {
+		fmt.Fprintln(os.Stderr, "count must not be negative and batch must be positive")
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	log, err := logger.New(cfg.Logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create logger: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	// Initialize database
+	db, err := database.New(ctx, &cfg.Database, log)
+	if err != nil {
+		log.Error("failed to initialize database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if cfg.Database.AutoMigrate {
+		if err := database.Migrate(ctx, db.Pool); err != nil {
+			log.Error("failed to apply database migrations", "error", err)
+			db.Close()
+			os.Exit(1)
+		}
+	}
+
+	repo := repository.NewPostgresTodoRepository(db.Pool, repository.RetryPolicy{
+		MaxAttempts: cfg.Database.RetryAttempts,
+		Backoff:     cfg.Database.RetryBackoff,
+	})
+
+	if *reset {
+		// Every user's todos are deleted
+		deleted, err := repo.DeleteWhere(owner.NewUnscopedContext(ctx), nil, 0)
+		if err != nil {
+			log.Error("failed to delete todos", "error", err)
+			db.Close()
+			os.Exit(1)
+		}
+		log.Info("todos deleted", "count", deleted)
+	}
+
+	ownerCtx := owner.NewContext(ctx, *ownerID)
+	var created int64
+	for created < int64(*count) {
+		reqs := make([]dto.CreateTodoRequest, min(*batchSize, *count-int(created)))
+		for i := range reqs {
+			reqs[i] = randomTodo()
+		}
+
+		n, err := repo.CreateBatch(ownerCtx, reqs)
+		created += n
+		if err != nil {
+			log.Error("failed to create todos", "created", created, "error", err)
+			db.Close()
+			os.Exit(1)
+		}
+	}
+
+	log.Info("todos seeded", "count", created, "owner", *ownerID)
+}
+
+// randomTodo returns a todo with a random title, priority and status
+func randomTodo() dto.CreateTodoRequest {
+	req := dto.CreateTodoRequest{
+		Title:     verbs[rand.IntN(len(verbs))] + " " + nouns[rand.IntN(len(nouns))],
+		Completed: rand.IntN(3) == 0,
+		Priority:  model.Priorities[rand.IntN(len(model.Priorities))],
+	}
+	if rand.IntN(2) == 0 {
+		req.Description = fmt.Sprintf("Sample todo #%d", rand.IntN(10000))
+	}
+	return req
+}
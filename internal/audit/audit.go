@@ -0,0 +1,182 @@
+// Package audit records who changed what, keeping the events in a hash
+// chain: each event hashes its fields with the hash of the event before
+// it, so altering, inserting or removing an event breaks every later hash.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/jackc/pgx/v5"
+)
+
+// Event is a recorded change of an entity. Before is null for creations
+// and After for deletions.
+type Event struct {
+	ID        int64
+	Actor     string
+	Action    string
+	Entity    string
+	EntityID  string
+	Before    json.RawMessage
+	After     json.RawMessage
+	IP        string
+	CreatedAt time.Time
+	PrevHash  []byte
+	Hash      []byte
+}
+
+// hashedEvent is the form of an event its hash is computed from
+type hashedEvent struct {
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	IP        string          `json:"ip"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// sum returns the hash of e, chained to e.PrevHash
+func (e *Event) sum() []byte {
+	fields, err := json.Marshal(hashedEvent{
+		Actor:     e.Actor,
+		Action:    e.Action,
+		Entity:    e.Entity,
+		EntityID:  e.EntityID,
+		Before:    e.Before,
+		After:     e.After,
+		IP:        e.IP,
+		CreatedAt: e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		// Before and After were valid JSON when recorded, so they only fail
+		// to marshal when altered
+		fields = []byte(err.Error())
+	}
+
+	h := sha256.New()
+	h.Write(e.PrevHash)
+	h.Write(fields)
+	return h.Sum(nil)
+}
+
+// Log records events in a Store
+type Log struct {
+	store Store
+	now   func() time.Time
+}
+
+// NewLog creates a new Log recording events in store
+func NewLog(store Store) *Log {
+	return &Log{store: store, now: time.Now}
+}
+
+// Record records that the user in ctx, from the IP in ctx, took action on
+// the entity with entityID, changing it from before to after, either being
+// nil when the entity did not exist
+func (l *Log) Record(ctx context.Context, action, entity, entityID string, before, after any) error {
+	return l.RecordTx(ctx, nil, action, entity, entityID, before, after)
+}
+
+// RecordTx is Record in tx, the transaction making the change, so that
+// either both commit or neither does. A nil tx records the event on its
+// own, as Record does.
+func (l *Log) RecordTx(ctx context.Context, tx pgx.Tx, action, entity, entityID string, before, after any) error {
+	actor, _ := owner.FromContext(ctx)
+	event := Event{
+		Actor:    actor,
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+		IP:       ClientIP(ctx),
+
+		// PostgreSQL keeps microseconds, and the hash must be computed again
+		// from what it keeps
+		CreatedAt: l.now().UTC().Truncate(time.Microsecond),
+	}
+
+	var err error
+	if event.Before, err = marshalState(before); err != nil {
+		return err
+	}
+	if event.After, err = marshalState(after); err != nil {
+		return err
+	}
+	if tx == nil {
+		return l.store.Append(ctx, &event)
+	}
+	txStore, ok := l.store.(TxStore)
+	if !ok {
+		return errors.New("audit store cannot append in a transaction")
+	}
+	return txStore.AppendTx(ctx, tx, &event)
+}
+
+// List returns the events matching filter, oldest first
+func (l *Log) List(ctx context.Context, filter Filter) ([]Event, error) {
+	return l.store.List(ctx, filter)
+}
+
+// Verification is the outcome of checking the hash chain
+type Verification struct {
+	Valid  bool
+	Events int
+
+	// FirstInvalidID is the ID of the first event whose hash does not match
+	// its fields or the event before it, when the chain is broken
+	FirstInvalidID int64
+}
+
+// Verify checks the hash chain of every event, from the first one
+func (l *Log) Verify(ctx context.Context) (*Verification, error) {
+	result := &Verification{Valid: true}
+	var prev []byte
+	err := l.store.Walk(ctx, func(e Event) error {
+		result.Events++
+		if result.Valid && (!bytes.Equal(e.PrevHash, prev) || !bytes.Equal(e.Hash, e.sum())) {
+			result.Valid = false
+			result.FirstInvalidID = e.ID
+		}
+		prev = e.Hash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// marshalState returns the JSON of the state of an entity, nil when state
+// is nil
+func marshalState(state any) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal audit state: %w", err)
+	}
+	return b, nil
+}
+
+// ipCtxKey is the context key of the client IP
+type ipCtxKey struct{}
+
+// NewContext returns a copy of ctx carrying the client IP ip
+func NewContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ipCtxKey{}, ip)
+}
+
+// ClientIP returns the client IP carried by ctx, empty if none
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(ipCtxKey{}).(string)
+	return ip
+}
@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordEvents records three events of alice and bob in a new Log
+func recordEvents(t *testing.T) (*Log, *InMemoryStore) {
+	t.Helper()
+	store := NewInMemoryStore()
+	log := NewLog(store)
+	alice := owner.NewContext(NewContext(context.Background(), "192.0.2.1"), "alice")
+	bob := owner.NewContext(context.Background(), "bob")
+
+	require.NoError(t, log.Record(alice, "create", "todo", "1", nil, map[string]string{"title": "a"}))
+	require.NoError(t, log.Record(bob, "create", "todo", "2", nil, map[string]string{"title": "b"}))
+	require.NoError(t, log.Record(alice, "update", "todo", "1", map[string]string{"title": "a"}, map[string]string{"title": "c"}))
+	return log, store
+}
+
+func TestLog_Record(t *testing.T) {
+	log, _ := recordEvents(t)
+
+	events, err := log.List(context.Background(), Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	e := events[2]
+	assert.Equal(t, int64(3), e.ID)
+	assert.Equal(t, "alice", e.Actor)
+	assert.Equal(t, "192.0.2.1", e.IP)
+	assert.JSONEq(t, `{"title":"a"}`, string(e.Before))
+	assert.JSONEq(t, `{"title":"c"}`, string(e.After))
+	assert.Nil(t, events[0].Before)
+	assert.Nil(t, events[0].PrevHash)
+	assert.Equal(t, events[1].Hash, e.PrevHash)
+	assert.Equal(t, time.UTC, e.CreatedAt.Location())
+}
+
+func TestLog_List(t *testing.T) {
+	log, _ := recordEvents(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []int64
+	}{
+		{"actor", Filter{Actor: "alice"}, []int64{1, 3}},
+		{"action", Filter{Action: "create"}, []int64{1, 2}},
+		{"entity id", Filter{Entity: "todo", EntityID: "2"}, []int64{2}},
+		{"after id", Filter{AfterID: 1}, []int64{2, 3}},
+		{"limit", Filter{Limit: 2}, []int64{1, 2}},
+		{"limit after filter", Filter{Actor: "alice", Limit: 1, AfterID: 1}, []int64{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := log.List(ctx, tt.filter)
+			require.NoError(t, err)
+			ids := make([]int64, 0, len(events))
+			for _, e := range events {
+				ids = append(ids, e.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
+
+func TestLog_Verify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("intact chain", func(t *testing.T) {
+		log, _ := recordEvents(t)
+
+		result, err := log.Verify(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &Verification{Valid: true, Events: 3}, result)
+	})
+
+	t.Run("empty log", func(t *testing.T) {
+		result, err := NewLog(NewInMemoryStore()).Verify(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &Verification{Valid: true}, result)
+	})
+
+	t.Run("altered event", func(t *testing.T) {
+		log, store := recordEvents(t)
+		store.events[1].Actor = "mallory"
+
+		result, err := log.Verify(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &Verification{Valid: false, Events: 3, FirstInvalidID: 2}, result)
+	})
+
+	t.Run("altered and rehashed event", func(t *testing.T) {
+		log, store := recordEvents(t)
+		store.events[0].After = []byte(`{"title":"z"}`)
+		store.events[0].Hash = store.events[0].sum()
+
+		result, err := log.Verify(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &Verification{Valid: false, Events: 3, FirstInvalidID: 2}, result)
+	})
+
+	t.Run("removed event", func(t *testing.T) {
+		log, store := recordEvents(t)
+		store.events = append(store.events[:1], store.events[2:]...)
+
+		result, err := log.Verify(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &Verification{Valid: false, Events: 2, FirstInvalidID: 3}, result)
+	})
+}
@@ -0,0 +1,238 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Filter selects events. Empty fields match every event.
+type Filter struct {
+	Actor    string
+	Action   string
+	Entity   string
+	EntityID string
+
+	// AfterID only matches the events after the one with that ID, to list
+	// the page after an event
+	AfterID int64
+	Limit   int
+}
+
+// matches reports whether e is selected by f, ignoring f.Limit
+func (f Filter) matches(e *Event) bool {
+	return (f.Actor == "" || e.Actor == f.Actor) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Entity == "" || e.Entity == f.Entity) &&
+		(f.EntityID == "" || e.EntityID == f.EntityID) &&
+		e.ID > f.AfterID
+}
+
+// Store handles audit event data operations. Events are only ever
+// appended.
+type Store interface {
+	// Append stores event after the last one, setting its ID, PrevHash and
+	// Hash
+	Append(ctx context.Context, event *Event) error
+	List(ctx context.Context, filter Filter) ([]Event, error)
+
+	// Walk calls fn with every event, oldest first, stopping at the first
+	// error
+	Walk(ctx context.Context, fn func(Event) error) error
+}
+
+// TxStore is a Store that can also append events in the transaction of the
+// change they record
+type TxStore interface {
+	Store
+	AppendTx(ctx context.Context, tx pgx.Tx, event *Event) error
+}
+
+// eventColumns lists the columns scanned by scanEvent
+const eventColumns = "id, actor, action, entity, entity_id, before, after, ip, created_at, prev_hash, hash"
+
+// chainLockKey is the advisory lock serializing appends, so each event
+// chains to the last one committed
+const chainLockKey = 0x61756469 // "audi"
+
+// PostgresStore is a Store backed by PostgreSQL, whose audit_events table
+// rejects updates and deletions
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStore creates a new PostgresStore
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+// Append stores a new event
+func (s *PostgresStore) Append(ctx context.Context, event *Event) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		return s.AppendTx(ctx, tx, event)
+	})
+}
+
+// AppendTx stores a new event in tx, so it is committed along with the
+// change it records. Until tx ends, other appends wait for it.
+func (s *PostgresStore) AppendTx(ctx context.Context, tx pgx.Tx, event *Event) error {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", chainLockKey); err != nil {
+		return fmt.Errorf("failed to append audit event: %w", err)
+	}
+	err := tx.QueryRow(ctx, "SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&event.PrevHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to append audit event: %w", err)
+	}
+	event.Hash = event.sum()
+
+	query := `
+		INSERT INTO audit_events (actor, action, entity, entity_id, before, after, ip, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`
+
+	err = tx.QueryRow(ctx, query, event.Actor, event.Action, event.Entity, event.EntityID,
+		jsonArg(event.Before), jsonArg(event.After), event.IP, event.CreatedAt, event.PrevHash, event.Hash).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to append audit event: %w", err)
+	}
+	return nil
+}
+
+// List retrieves the events matching filter, oldest first
+func (s *PostgresStore) List(ctx context.Context, filter Filter) ([]Event, error) {
+	query := "SELECT " + eventColumns + " FROM audit_events WHERE id > $1"
+	args := []any{filter.AfterID}
+	for _, cond := range []struct{ column, value string }{
+		{"actor", filter.Actor},
+		{"action", filter.Action},
+		{"entity", filter.Entity},
+		{"entity_id", filter.EntityID},
+	} {
+		if cond.value != "" {
+			args = append(args, cond.value)
+			query += " AND " + cond.column + " = $" + strconv.Itoa(len(args))
+		}
+	}
+	query += " ORDER BY id"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, scanEvent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan audit events: %w", err)
+	}
+	return events, nil
+}
+
+// Walk calls fn with every event, oldest first
+func (s *PostgresStore) Walk(ctx context.Context, fn func(Event) error) error {
+	rows, err := s.pool.Query(ctx, "SELECT "+eventColumns+" FROM audit_events ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("failed to walk audit events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// scanEvent scans a row of eventColumns
+func scanEvent(row pgx.CollectableRow) (Event, error) {
+	var e Event
+	var before, after *string
+	err := row.Scan(&e.ID, &e.Actor, &e.Action, &e.Entity, &e.EntityID, &before, &after, &e.IP, &e.CreatedAt, &e.PrevHash, &e.Hash)
+	if before != nil {
+		e.Before = []byte(*before)
+	}
+	if after != nil {
+		e.After = []byte(*after)
+	}
+	return e, err
+}
+
+// jsonArg returns the argument storing state in a JSON column, kept as
+// text so the column holds the very bytes that were hashed
+func jsonArg(state []byte) *string {
+	if state == nil {
+		return nil
+	}
+	s := string(state)
+	return &s
+}
+
+// InMemoryStore is a Store that keeps events in memory, for tests and
+// local development without PostgreSQL
+type InMemoryStore struct {
+	mu     sync.RWMutex
+	events []Event
+}
+
+// NewInMemoryStore creates a new, empty InMemoryStore
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{}
+}
+
+// Append stores a new event
+func (s *InMemoryStore) Append(_ context.Context, event *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.PrevHash = nil
+	if n := len(s.events); n > 0 {
+		event.PrevHash = s.events[n-1].Hash
+	}
+	event.Hash = event.sum()
+	event.ID = int64(len(s.events) + 1)
+	s.events = append(s.events, *event)
+	return nil
+}
+
+// List retrieves the events matching filter, oldest first
+func (s *InMemoryStore) List(_ context.Context, filter Filter) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []Event{}
+	for i := range s.events {
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+		if filter.matches(&s.events[i]) {
+			events = append(events, s.events[i])
+		}
+	}
+	return events, nil
+}
+
+// Walk calls fn with every event, oldest first
+func (s *InMemoryStore) Walk(_ context.Context, fn func(Event) error) error {
+	s.mu.RLock()
+	events := append([]Event(nil), s.events...)
+	s.mu.RUnlock()
+
+	for _, event := range events {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
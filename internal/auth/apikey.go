@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes an API key can be granted
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+)
+
+// apiKeyPrefix starts every API key, telling them apart from tokens
+const apiKeyPrefix = "idk_"
+
+// ErrInvalidAPIKey is returned when verifying a key that does not exist or
+// was deleted
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKey is a key a machine client sends in the X-API-Key header to act on
+// the todos of its owner, within its scopes
+type APIKey struct {
+	ID        int
+	OwnerID   string
+	Name      string
+	Prefix    string
+	Scopes    []string
+	CreatedAt time.Time
+}
+
+// HasScope reports whether the key was granted scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// APIKeys creates, lists, deletes and verifies API keys
+type APIKeys struct {
+	store APIKeyStore
+}
+
+// NewAPIKeys creates a new APIKeys storing keys in store
+func NewAPIKeys(store APIKeyStore) *APIKeys {
+	return &APIKeys{store: store}
+}
+
+// Create generates a key named name for ownerID with scopes. It returns
+// the key, which is not stored and cannot be retrieved later, with its
+// metadata.
+func (k *APIKeys) Create(ctx context.Context, ownerID, name string, scopes []string) (*APIKey, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiKey := &APIKey{
+		OwnerID: ownerID,
+		Name:    name,
+		Prefix:  key[:len(apiKeyPrefix)+8],
+		Scopes:  slices.Compact(slices.Sorted(slices.Values(scopes))),
+	}
+	if err := k.store.CreateAPIKey(ctx, apiKey, hashSecret(key)); err != nil {
+		return nil, "", err
+	}
+	return apiKey, key, nil
+}
+
+// List returns the keys of ownerID, oldest first
+func (k *APIKeys) List(ctx context.Context, ownerID string) ([]APIKey, error) {
+	return k.store.ListAPIKeys(ctx, ownerID)
+}
+
+// Delete revokes the key of ownerID with the ID id
+func (k *APIKeys) Delete(ctx context.Context, ownerID string, id int) error {
+	return k.store.DeleteAPIKey(ctx, ownerID, id)
+}
+
+// Verify returns the API key key, or ErrInvalidAPIKey
+func (k *APIKeys) Verify(ctx context.Context, key string) (*APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	apiKey, err := k.store.GetAPIKeyByHash(ctx, hashSecret(key))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	return apiKey, err
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrAPIKeyNotFound is returned when the owner has no API key with the ID,
+// or no key has the hash
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// APIKeyStore handles API key data operations
+type APIKeyStore interface {
+	// CreateAPIKey stores key with the hash of its secret, setting its ID
+	// and creation time
+	CreateAPIKey(ctx context.Context, key *APIKey, hash []byte) error
+	ListAPIKeys(ctx context.Context, ownerID string) ([]APIKey, error)
+	DeleteAPIKey(ctx context.Context, ownerID string, id int) error
+	GetAPIKeyByHash(ctx context.Context, hash []byte) (*APIKey, error)
+}
+
+// apiKeyColumns lists the columns scanned by scanAPIKey
+const apiKeyColumns = "id, owner_id, name, prefix, scopes, created_at"
+
+// PostgresAPIKeyStore is an APIKeyStore backed by PostgreSQL
+type PostgresAPIKeyStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresAPIKeyStore creates a new PostgresAPIKeyStore
+func NewPostgresAPIKeyStore(pool *pgxpool.Pool) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{pool: pool}
+}
+
+// CreateAPIKey stores a new API key
+func (s *PostgresAPIKeyStore) CreateAPIKey(ctx context.Context, key *APIKey, hash []byte) error {
+	query := `
+		INSERT INTO api_keys (owner_id, name, prefix, key_hash, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err := s.pool.QueryRow(ctx, query, key.OwnerID, key.Name, key.Prefix, hash, key.Scopes).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+// ListAPIKeys retrieves the API keys of an owner
+func (s *PostgresAPIKeyStore) ListAPIKeys(ctx context.Context, ownerID string) ([]APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE owner_id = $1 ORDER BY id"
+
+	rows, err := s.pool.Query(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	keys, err := pgx.CollectRows(rows, scanAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// DeleteAPIKey deletes an API key of an owner
+func (s *PostgresAPIKeyStore) DeleteAPIKey(ctx context.Context, ownerID string, id int) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM api_keys WHERE owner_id = $1 AND id = $2", ownerID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// GetAPIKeyByHash retrieves the API key whose secret has the hash
+func (s *PostgresAPIKeyStore) GetAPIKeyByHash(ctx context.Context, hash []byte) (*APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE key_hash = $1"
+
+	rows, err := s.pool.Query(ctx, query, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	key, err := pgx.CollectExactlyOneRow(rows, scanAPIKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return &key, nil
+}
+
+// scanAPIKey scans a row of apiKeyColumns
+func scanAPIKey(row pgx.CollectableRow) (APIKey, error) {
+	var key APIKey
+	err := row.Scan(&key.ID, &key.OwnerID, &key.Name, &key.Prefix, &key.Scopes, &key.CreatedAt)
+	return key, err
+}
+
+// InMemoryAPIKeyStore is an APIKeyStore that keeps API keys in memory, for
+// tests and local development without PostgreSQL
+type InMemoryAPIKeyStore struct {
+	mu     sync.RWMutex
+	keys   map[string]APIKey
+	nextID int
+}
+
+// NewInMemoryAPIKeyStore creates a new, empty InMemoryAPIKeyStore
+func NewInMemoryAPIKeyStore() *InMemoryAPIKeyStore {
+	return &InMemoryAPIKeyStore{keys: make(map[string]APIKey)}
+}
+
+// CreateAPIKey stores a new API key
+func (s *InMemoryAPIKeyStore) CreateAPIKey(_ context.Context, key *APIKey, hash []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	key.ID = s.nextID
+	key.CreatedAt = time.Now()
+	s.keys[string(hash)] = *key
+	return nil
+}
+
+// ListAPIKeys retrieves the API keys of an owner
+func (s *InMemoryAPIKeyStore) ListAPIKeys(_ context.Context, ownerID string) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []APIKey{}
+	for _, key := range s.keys {
+		if key.OwnerID == ownerID {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b APIKey) int { return a.ID - b.ID })
+	return keys, nil
+}
+
+// DeleteAPIKey deletes an API key of an owner
+func (s *InMemoryAPIKeyStore) DeleteAPIKey(_ context.Context, ownerID string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, key := range s.keys {
+		if key.OwnerID == ownerID && key.ID == id {
+			delete(s.keys, hash)
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// GetAPIKeyByHash retrieves the API key whose secret has the hash
+func (s *InMemoryAPIKeyStore) GetAPIKeyByHash(_ context.Context, hash []byte) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[string(hash)]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+// deleteOwnerKeys deletes the API keys of ownerID
+func (s *InMemoryAPIKeyStore) deleteOwnerKeys(ownerID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, key := range s.keys {
+		if key.OwnerID == ownerID {
+			delete(s.keys, hash)
+		}
+	}
+}
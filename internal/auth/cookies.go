@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cookie and header names of cookie sessions
+const (
+	AccessTokenCookie = "access_token"
+	CSRFCookie        = "csrf_token"
+	CSRFHeader        = "X-CSRF-Token"
+)
+
+// Cookies carries access tokens in cookies, for same-origin web UIs. As
+// browsers send cookies with cross-site requests too, mutating requests
+// authenticated by cookie must repeat the value of the CSRF cookie, which
+// other sites cannot read, in the X-CSRF-Token header.
+type Cookies struct {
+	secure bool
+}
+
+// NewCookies creates a new Cookies, only sent over HTTPS when secure
+func NewCookies(secure bool) *Cookies {
+	return &Cookies{secure: secure}
+}
+
+// Set stores the access token of tokens in an HttpOnly cookie, and a new
+// CSRF token in a cookie scripts can read
+func (k *Cookies) Set(c *gin.Context, tokens *TokenPair) error {
+	csrf, err := newSecret()
+	if err != nil {
+		return err
+	}
+
+	maxAge := int(time.Until(tokens.ExpiresAt).Seconds())
+	k.set(c, AccessTokenCookie, tokens.AccessToken, maxAge, true)
+	k.set(c, CSRFCookie, csrf, maxAge, false)
+	return nil
+}
+
+// Clear removes the cookies set by Set
+func (k *Cookies) Clear(c *gin.Context) {
+	k.set(c, AccessTokenCookie, "", -1, true)
+	k.set(c, CSRFCookie, "", -1, false)
+}
+
+// set sets a strictly same-site cookie on the whole site
+func (k *Cookies) set(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(name, value, maxAge, "/", "", k.secure, httpOnly)
+}
+
+// validCSRF reports whether the X-CSRF-Token header of c repeats its CSRF
+// cookie
+func validCSRF(c *gin.Context) bool {
+	cookie, err := c.Cookie(CSRFCookie)
+	header := c.GetHeader(CSRFHeader)
+	return err == nil && cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+// safeMethod reports whether method only reads, needing no CSRF token
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
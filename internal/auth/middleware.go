@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader is the header machine clients send their API key in
+const APIKeyHeader = "X-API-Key"
+
+// Verifier returns the user ID a token identifies
+type Verifier interface {
+	Verify(token string) (string, error)
+}
+
+// RequireToken returns a gin middleware that rejects requests without a
+// valid bearer token in their Authorization header with 401, and stores
+// the user ID of the token in the request context of the others so
+// repositories only see that user's todos. When cookies is not nil, the
+// token may come from its cookie instead, mutating requests then needing
+// the CSRF token.
+func RequireToken(verifier Verifier, cookies *Cookies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, fromCookie := bearerToken(c), false
+		if token == "" && cookies != nil {
+			token, _ = c.Cookie(AccessTokenCookie)
+			fromCookie = token != ""
+		}
+		if token == "" {
+			unauthorized(c, "missing_token", "A bearer token is required")
+			return
+		}
+
+		userID, err := verifier.Verify(token)
+		if err != nil {
+			unauthorized(c, "invalid_token", "The bearer token is invalid or expired")
+			return
+		}
+		if fromCookie && !safeMethod(c.Request.Method) && !validCSRF(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{Error: "invalid_csrf_token", Message: "The X-CSRF-Token header must repeat the csrf_token cookie"})
+			return
+		}
+
+		c.Request = c.Request.WithContext(owner.NewContext(c.Request.Context(), userID))
+		c.Next()
+	}
+}
+
+// bearerToken returns the token of the Authorization header of c, if any
+func bearerToken(c *gin.Context) string {
+	scheme, token, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// unauthorized aborts c with 401, asking for a bearer token
+func unauthorized(c *gin.Context, code, message string) {
+	c.Header("WWW-Authenticate", "Bearer")
+	c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{Error: code, Message: message})
+}
+
+// APIKeyVerifier returns the API key a client sent
+type APIKeyVerifier interface {
+	Verify(ctx context.Context, key string) (*APIKey, error)
+}
+
+// apiKeyCtxKey is the context key of the API key a request was
+// authenticated with
+type apiKeyCtxKey struct{}
+
+// AcceptAPIKey returns a gin middleware authenticating requests carrying
+// an X-API-Key header with that key, storing its owner and scopes in the
+// request context, and the others with fallback. Invalid keys get 401.
+func AcceptAPIKey(verifier APIKeyVerifier, fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(APIKeyHeader)
+		if key == "" {
+			fallback(c)
+			return
+		}
+
+		apiKey, err := verifier.Verify(c.Request.Context(), key)
+		if errors.Is(err, ErrInvalidAPIKey) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "invalid_api_key", Message: "The API key is invalid or revoked"})
+			return
+		}
+		if err != nil {
+			_ = c.Error(err) //nolint:errcheck // recorded for the request logger
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, dto.ErrorResponse{Error: "service_unavailable", Message: "Service temporarily unavailable"})
+			return
+		}
+
+		ctx := owner.NewContext(c.Request.Context(), apiKey.OwnerID)
+		c.Request = c.Request.WithContext(context.WithValue(ctx, apiKeyCtxKey{}, apiKey))
+		c.Next()
+	}
+}
+
+// RequireScope returns a gin middleware rejecting with 403 the requests
+// authenticated with an API key lacking scope. Requests authenticated
+// otherwise are let through.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey, ok := c.Request.Context().Value(apiKeyCtxKey{}).(*APIKey)
+		if ok && !apiKey.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{Error: "insufficient_scope", Message: "The API key lacks the " + scope + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
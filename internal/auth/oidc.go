@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/g3offrey/idiomapi/internal/config"
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrOIDCLogin is returned when the provider does not authenticate the
+	// user: the code exchange failed or the ID token is invalid
+	ErrOIDCLogin = errors.New("OIDC login failed")
+
+	// ErrIdentityRejected is returned when the provider authenticated a
+	// user that may not log in, outside the allowed domain or without a
+	// verified email
+	ErrIdentityRejected = errors.New("identity rejected")
+)
+
+// Identity is a user authenticated by an OIDC provider
+type Identity struct {
+	Issuer  string
+	Subject string
+	Email   string
+}
+
+// keysRefreshInterval is the least time between two fetches of the keys of
+// the provider, so tokens signed with unknown keys cannot make it refetch
+// them on every login
+const keysRefreshInterval = time.Minute
+
+// idTokenLeeway is the clock skew tolerated on the issue time of an ID
+// token, as the verifier does on its not-before time
+const idTokenLeeway = 5 * time.Minute
+
+// OIDC logs users in with an OpenID Connect provider, using the
+// authorization code flow with PKCE. The provider configuration is fetched
+// on first use, and its keys when verifying an ID token signed with a key
+// not seen yet, at most once per keysRefreshInterval.
+type OIDC struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu       sync.Mutex
+	provider *oidcProvider
+}
+
+// oidcProvider is the discovered provider: the OAuth2 configuration of the
+// client and the verifier of the ID tokens issued to it
+type oidcProvider struct {
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDC creates a new OIDC logging in with the provider of cfg, reached
+// with client
+func NewOIDC(cfg config.OIDCConfig, client *http.Client) *OIDC {
+	return &OIDC{cfg: cfg, client: client, now: time.Now}
+}
+
+// SecureCallback reports whether the provider redirects to an HTTPS
+// callback, so the login cookie can be restricted to HTTPS
+func (o *OIDC) SecureCallback() bool {
+	return strings.HasPrefix(o.cfg.RedirectURL, "https://")
+}
+
+// AuthRequest is a login in progress. The client keeps it, in a cookie,
+// from AuthCodeURL to Exchange.
+type AuthRequest struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewAuthRequest returns an AuthRequest with random values
+func NewAuthRequest() (AuthRequest, error) {
+	var values [2]string
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return AuthRequest{}, fmt.Errorf("failed to generate auth request: %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return AuthRequest{State: values[0], Nonce: values[1], Verifier: oauth2.GenerateVerifier()}, nil
+}
+
+// String encodes r, as ParseAuthRequest reads it
+func (r AuthRequest) String() string {
+	return r.State + "." + r.Nonce + "." + r.Verifier
+}
+
+// ParseAuthRequest decodes an AuthRequest encoded by String
+func ParseAuthRequest(s string) (AuthRequest, bool) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 || slices.Contains(parts, "") {
+		return AuthRequest{}, false
+	}
+	return AuthRequest{State: parts[0], Nonce: parts[1], Verifier: parts[2]}, true
+}
+
+// MatchesState reports whether state is the one r was sent with
+func (r AuthRequest) MatchesState(state string) bool {
+	return subtle.ConstantTimeCompare([]byte(r.State), []byte(state)) == 1
+}
+
+// AuthCodeURL returns the URL of the provider to send the user to for r
+func (o *OIDC) AuthCodeURL(ctx context.Context, r AuthRequest) (string, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	opts := []oauth2.AuthCodeOption{oidc.Nonce(r.Nonce), oauth2.S256ChallengeOption(r.Verifier)}
+	if o.cfg.AllowedDomain != "" {
+		// Only a hint for the account chooser, the hd claim is checked
+		opts = append(opts, oauth2.SetAuthURLParam("hd", o.cfg.AllowedDomain))
+	}
+	return provider.oauth2.AuthCodeURL(r.State, opts...), nil
+}
+
+// idTokenClaims are the claims of an ID token beyond those the verifier
+// checks
+type idTokenClaims struct {
+	AuthorizedBy  string `json:"azp"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	HostedDomain  string `json:"hd"`
+}
+
+// Exchange trades the code the provider redirected back with for the
+// identity of the user, verifying the ID token against r
+func (o *OIDC) Exchange(ctx context.Context, code string, r AuthRequest) (*Identity, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = oidc.ClientContext(ctx, o.client)
+	token, err := provider.oauth2.Exchange(ctx, code, oauth2.VerifierOption(r.Verifier))
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			return nil, fmt.Errorf("%w: token endpoint answered %d %s", ErrOIDCLogin, retrieveErr.Response.StatusCode, retrieveErr.ErrorCode)
+		}
+		return nil, fmt.Errorf("failed to reach OIDC provider: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%w: token endpoint returned no ID token", ErrOIDCLogin)
+	}
+
+	// The verifier checks the signature, issuer, audience, expiry and
+	// not-before time of the token
+	idToken, err := provider.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOIDCLogin, err)
+	}
+	var claims idTokenClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed ID token claims", ErrOIDCLogin)
+	}
+	switch {
+	case len(idToken.Audience) > 1 && claims.AuthorizedBy != o.cfg.ClientID:
+		return nil, fmt.Errorf("%w: ID token authorized another client", ErrOIDCLogin)
+	case subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(r.Nonce)) != 1:
+		return nil, fmt.Errorf("%w: ID token nonce mismatch", ErrOIDCLogin)
+	case idToken.Subject == "":
+		return nil, fmt.Errorf("%w: ID token without subject", ErrOIDCLogin)
+	case idToken.IssuedAt.IsZero() || idToken.IssuedAt.After(o.now().Add(idTokenLeeway)):
+		return nil, fmt.Errorf("%w: ID token issued in the future", ErrOIDCLogin)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, fmt.Errorf("%w: email not verified", ErrIdentityRejected)
+	}
+	if o.cfg.AllowedDomain != "" && claims.HostedDomain != o.cfg.AllowedDomain {
+		return nil, fmt.Errorf("%w: outside domain %s", ErrIdentityRejected, o.cfg.AllowedDomain)
+	}
+
+	return &Identity{Issuer: idToken.Issuer, Subject: idToken.Subject, Email: claims.Email}, nil
+}
+
+// discover returns the provider, fetching its configuration the first
+// time. The fetch runs without holding o.mu, so a slow provider only holds
+// up the logins waiting on it; concurrent first logins each fetch it.
+func (o *OIDC) discover(ctx context.Context) (*oidcProvider, error) {
+	o.mu.Lock()
+	provider := o.provider
+	o.mu.Unlock()
+	if provider != nil {
+		return provider, nil
+	}
+
+	// The provider also checks the issuer it returns is the configured
+	// one, or its tokens could be accepted under another name
+	discovered, err := oidc.NewProvider(oidc.ClientContext(ctx, o.client), o.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	var endpoints struct {
+		JWKSURL string `json:"jwks_uri"`
+	}
+	if err := discovered.Claims(&endpoints); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	// The key set keeps the context to fetch the keys with, beyond this
+	// request
+	keysClient := &http.Client{
+		Transport: &throttledTransport{next: o.client.Transport, interval: keysRefreshInterval, now: o.now},
+		Timeout:   o.client.Timeout,
+	}
+	keys := oidc.NewRemoteKeySet(oidc.ClientContext(context.WithoutCancel(ctx), keysClient), endpoints.JWKSURL)
+	provider = &oidcProvider{
+		oauth2: &oauth2.Config{
+			ClientID:     o.cfg.ClientID,
+			ClientSecret: o.cfg.ClientSecret,
+			Endpoint:     discovered.Endpoint(),
+			RedirectURL:  o.cfg.RedirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: oidc.NewVerifier(o.cfg.Issuer, keys, &oidc.Config{ClientID: o.cfg.ClientID, Now: o.now}),
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider == nil {
+		o.provider = provider
+	}
+	return o.provider, nil
+}
+
+// errKeysThrottled is returned instead of fetching the keys of the
+// provider again within keysRefreshInterval
+var errKeysThrottled = errors.New("keys fetched too recently")
+
+// throttledTransport sends at most one request per interval through next
+type throttledTransport struct {
+	next     http.RoundTripper
+	interval time.Duration
+	now      func() time.Time
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	now := t.now()
+	if !t.last.IsZero() && now.Sub(t.last) < t.interval {
+		t.mu.Unlock()
+		return nil, errKeysThrottled
+	}
+	t.last = now
+	t.mu.Unlock()
+
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidCredentials is returned when logging in with an unknown
+	// email or a wrong password, without telling which
+	ErrInvalidCredentials = errors.New("invalid email or password")
+
+	// ErrInvalidRefreshToken is returned when refreshing with a token that
+	// is malformed, expired, or was already used
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+)
+
+// TokenPair is a short-lived access token, sent with todo requests, and
+// the refresh token getting the next pair, each with when it expires
+type TokenPair struct {
+	AccessToken      string
+	ExpiresAt        time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// Service registers users, logs them in and manages their sessions
+type Service struct {
+	users      UserStore
+	sessions   SessionStore
+	tokens     *Tokens
+	refreshTTL time.Duration
+	now        func() time.Time
+
+	// dummyHash is compared with the passwords of unknown emails, so they
+	// take as long to reject as wrong passwords
+	dummyHash []byte
+}
+
+// NewService creates a new Service storing users in users and logging them
+// in with access tokens from tokens, and refresh tokens valid for
+// refreshTTL in sessions
+func NewService(users UserStore, sessions SessionStore, tokens *Tokens, refreshTTL time.Duration) (*Service, error) {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash dummy password: %w", err)
+	}
+	return &Service{
+		users:      users,
+		sessions:   sessions,
+		tokens:     tokens,
+		refreshTTL: refreshTTL,
+		now:        time.Now,
+		dummyHash:  dummyHash,
+	}, nil
+}
+
+// Register creates a user with email, compared case-insensitively, and
+// password
+func (s *Service) Register(ctx context.Context, email, password string) (*User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	return s.users.CreateUser(ctx, normalizeEmail(email), hash)
+}
+
+// Login starts a session for the user with email and password
+func (s *Service) Login(ctx context.Context, email, password string) (*TokenPair, error) {
+	user, err := s.users.GetUserByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password)) //nolint:errcheck // only spends the time
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Users without a password, logging in with OIDC only, fail the
+	// comparison too
+	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return s.startSession(ctx, user.ID)
+}
+
+// LoginWithIdentity starts a session for the user identity maps to
+func (s *Service) LoginWithIdentity(ctx context.Context, identity Identity) (*TokenPair, error) {
+	identity.Email = normalizeEmail(identity.Email)
+	user, err := s.users.UserForIdentity(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, user.ID)
+}
+
+// Refresh returns the next tokens of the session of refreshToken, which
+// stops working. Using it again ends the session, as only a thief would.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	id, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+	next, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := s.now().Add(s.refreshTTL)
+	userID, err := s.sessions.RotateSession(ctx, id, hashSecret(secret), hashSecret(next), expiresAt)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(userID, id+"."+next, expiresAt)
+}
+
+// Logout ends the session of refreshToken. Unknown tokens are ignored, the
+// session being over either way.
+func (s *Service) Logout(ctx context.Context, refreshToken string) error {
+	id, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok {
+		return nil
+	}
+	err := s.sessions.DeleteSession(ctx, id, hashSecret(secret))
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Verify returns the user ID of token, or ErrInvalidToken
+func (s *Service) Verify(token string) (string, error) {
+	return s.tokens.Verify(token)
+}
+
+// startSession creates a session of userID, returning its first tokens
+func (s *Service) startSession(ctx context.Context, userID string) (*TokenPair, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := s.now().Add(s.refreshTTL)
+	id, err := s.sessions.CreateSession(ctx, userID, hashSecret(secret), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(userID, id+"."+secret, expiresAt)
+}
+
+// issue returns an access token for userID along with refreshToken
+func (s *Service) issue(userID, refreshToken string, refreshExpiresAt time.Time) (*TokenPair, error) {
+	token, expiresAt, err := s.tokens.Issue(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{AccessToken: token, ExpiresAt: expiresAt, RefreshToken: refreshToken, RefreshExpiresAt: refreshExpiresAt}, nil
+}
+
+// newSecret returns the random part of a refresh token
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret returns the hash random secrets, API keys and refresh
+// tokens, are stored and looked up by. Being random, a fast hash is
+// enough.
+func hashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// normalizeEmail returns the form emails are stored and looked up in
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
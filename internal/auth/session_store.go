@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrSessionNotFound is returned when a session does not exist, expired,
+// or was presented with a token it no longer has
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore handles session data operations. Sessions are identified by
+// their random ID and the hash of their current refresh token.
+type SessionStore interface {
+	// CreateSession stores a session of userID, returning its ID
+	CreateSession(ctx context.Context, userID string, hash []byte, expiresAt time.Time) (string, error)
+
+	// RotateSession replaces the token hash of the session id, returning
+	// its user ID. A session presented with its previous hash is deleted,
+	// the token having been stolen or replayed; any other hash is merely
+	// not found, so a guessed ID cannot end a session.
+	RotateSession(ctx context.Context, id string, hash, newHash []byte, expiresAt time.Time) (string, error)
+
+	// DeleteSession deletes the session id if it has the hash
+	DeleteSession(ctx context.Context, id string, hash []byte) error
+}
+
+// PostgresSessionStore is a SessionStore backed by PostgreSQL
+type PostgresSessionStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresSessionStore creates a new PostgresSessionStore
+func NewPostgresSessionStore(pool *pgxpool.Pool) *PostgresSessionStore {
+	return &PostgresSessionStore{pool: pool}
+}
+
+// CreateSession stores a new session, dropping the expired ones of the
+// user
+func (s *PostgresSessionStore) CreateSession(ctx context.Context, userID string, hash []byte, expiresAt time.Time) (string, error) {
+	uid, err := strconv.Atoi(userID)
+	if err != nil {
+		return "", fmt.Errorf("invalid user ID %q: %w", userID, err)
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	err = pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "DELETE FROM sessions WHERE user_id = $1 AND expires_at <= NOW()", uid); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO sessions (id, user_id, token_hash, expires_at)
+			VALUES ($1, $2, $3, $4)`
+
+		_, err := tx.Exec(ctx, query, id, uid, hash, expiresAt)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return id, nil
+}
+
+// RotateSession replaces the token hash of a session
+func (s *PostgresSessionStore) RotateSession(ctx context.Context, id string, hash, newHash []byte, expiresAt time.Time) (string, error) {
+	var userID string
+	var notFound bool
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		query := `
+			UPDATE sessions SET previous_token_hash = token_hash, token_hash = $3, expires_at = $4
+			WHERE id = $1 AND token_hash = $2 AND expires_at > NOW()
+			RETURNING user_id::text`
+
+		err := tx.QueryRow(ctx, query, id, hash, newHash, expiresAt).Scan(&userID)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		// The deletion of a replayed session must be committed, so the
+		// closure does not fail: an error would roll it back
+		notFound = true
+		_, err = tx.Exec(ctx, "DELETE FROM sessions WHERE id = $1 AND previous_token_hash = $2", id, hash)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to rotate session: %w", err)
+	}
+	if notFound {
+		return "", ErrSessionNotFound
+	}
+
+	return userID, nil
+}
+
+// DeleteSession deletes a session
+func (s *PostgresSessionStore) DeleteSession(ctx context.Context, id string, hash []byte) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM sessions WHERE id = $1 AND token_hash = $2", id, hash)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// InMemorySessionStore is a SessionStore that keeps sessions in memory,
+// for tests and local development without PostgreSQL
+type InMemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]session
+	now      func() time.Time
+}
+
+// session is a session kept by InMemorySessionStore
+type session struct {
+	userID       string
+	hash         []byte
+	previousHash []byte
+	expiresAt    time.Time
+}
+
+// NewInMemorySessionStore creates a new, empty InMemorySessionStore
+func NewInMemorySessionStore() *InMemorySessionStore {
+	return &InMemorySessionStore{sessions: make(map[string]session), now: time.Now}
+}
+
+// CreateSession stores a new session
+func (s *InMemorySessionStore) CreateSession(_ context.Context, userID string, hash []byte, expiresAt time.Time) (string, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[id] = session{userID: userID, hash: hash, expiresAt: expiresAt}
+	return id, nil
+}
+
+// RotateSession replaces the token hash of a session
+func (s *InMemorySessionStore) RotateSession(_ context.Context, id string, hash, newHash []byte, expiresAt time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+	if !s.now().Before(sess.expiresAt) {
+		delete(s.sessions, id)
+		return "", ErrSessionNotFound
+	}
+	if subtle.ConstantTimeCompare(sess.hash, hash) != 1 {
+		if subtle.ConstantTimeCompare(sess.previousHash, hash) == 1 {
+			delete(s.sessions, id)
+		}
+		return "", ErrSessionNotFound
+	}
+
+	sess.previousHash, sess.hash, sess.expiresAt = sess.hash, newHash, expiresAt
+	s.sessions[id] = sess
+	return sess.userID, nil
+}
+
+// DeleteSession deletes a session
+func (s *InMemorySessionStore) DeleteSession(_ context.Context, id string, hash []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || subtle.ConstantTimeCompare(sess.hash, hash) != 1 {
+		return ErrSessionNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+// deleteUserSessions deletes the sessions of userID
+func (s *InMemorySessionStore) deleteUserSessions(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, sess := range s.sessions {
+		if sess.userID == userID {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// newSessionID returns a random session ID, which cannot be guessed to
+// act on the sessions of others
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrUserNotFound is returned when no user has the email
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrEmailTaken is returned when registering an email another user has
+	ErrEmailTaken = errors.New("email already registered")
+)
+
+// User is a registered user. Its ID is the owner ID of its todos. Users
+// logging in with OIDC only have no PasswordHash.
+type User struct {
+	ID           string
+	Email        string
+	PasswordHash []byte
+	CreatedAt    time.Time
+}
+
+// UserStore handles user data operations
+type UserStore interface {
+	CreateUser(ctx context.Context, email string, passwordHash []byte) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+
+	// UserForIdentity returns the user the OIDC identity maps to. An
+	// identity seen for the first time is linked to the user with its
+	// email, or to a new user. Nobody proved owning the email when the
+	// existing user signed up, so linking removes its password and ends
+	// its sessions and API keys.
+	UserForIdentity(ctx context.Context, identity Identity) (*User, error)
+}
+
+// PostgresUserStore is a UserStore backed by PostgreSQL
+type PostgresUserStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresUserStore creates a new PostgresUserStore
+func NewPostgresUserStore(pool *pgxpool.Pool) *PostgresUserStore {
+	return &PostgresUserStore{pool: pool}
+}
+
+// CreateUser stores a new user
+func (s *PostgresUserStore) CreateUser(ctx context.Context, email string, passwordHash []byte) (*User, error) {
+	query := `
+		INSERT INTO users (email, password_hash)
+		VALUES ($1, $2)
+		RETURNING id::text, email, password_hash, created_at`
+
+	var user User
+	err := s.pool.QueryRow(ctx, query, email, passwordHash).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrEmailTaken
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *PostgresUserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	query := "SELECT id::text, email, password_hash, created_at FROM users WHERE email = $1"
+
+	var user User
+	err := s.pool.QueryRow(ctx, query, email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// UserForIdentity returns the user an OIDC identity maps to, linking it on
+// first use
+func (s *PostgresUserStore) UserForIdentity(ctx context.Context, identity Identity) (*User, error) {
+	var user User
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		query := `
+			SELECT u.id::text, u.email, u.password_hash, u.created_at
+			FROM users u
+			JOIN user_identities i ON i.user_id = u.id
+			WHERE i.issuer = $1 AND i.subject = $2`
+
+		err := tx.QueryRow(ctx, query, identity.Issuer, identity.Subject).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		// xmax is only set on the rows of existing users
+		query = `
+			INSERT INTO users (email, password_hash)
+			VALUES ($1, NULL)
+			ON CONFLICT (email) DO UPDATE SET password_hash = NULL
+			RETURNING id::text, email, password_hash, created_at, xmax <> 0`
+
+		var existing bool
+		if err := tx.QueryRow(ctx, query, identity.Email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &existing); err != nil {
+			return err
+		}
+		if existing {
+			uid, err := strconv.Atoi(user.ID)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, "DELETE FROM sessions WHERE user_id = $1", uid); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, "DELETE FROM api_keys WHERE owner_id = $1", user.ID); err != nil {
+				return err
+			}
+		}
+
+		query = `
+			INSERT INTO user_identities (issuer, subject, user_id)
+			SELECT $1, $2, id FROM users WHERE email = $3`
+
+		_, err = tx.Exec(ctx, query, identity.Issuer, identity.Subject, identity.Email)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for identity: %w", err)
+	}
+
+	return &user, nil
+}
+
+// InMemoryUserStore is a UserStore that keeps users in memory, for tests
+// and local development without PostgreSQL
+type InMemoryUserStore struct {
+	mu     sync.RWMutex
+	users  map[string]User
+	nextID int
+
+	// identities maps OIDC issuers and subjects to user emails
+	identities map[Identity]string
+
+	// sessions and apiKeys, when not nil, hold the credentials ended when
+	// an identity is linked to an existing user
+	sessions *InMemorySessionStore
+	apiKeys  *InMemoryAPIKeyStore
+}
+
+// NewInMemoryUserStore creates a new, empty InMemoryUserStore
+func NewInMemoryUserStore() *InMemoryUserStore {
+	return &InMemoryUserStore{users: make(map[string]User), identities: make(map[Identity]string)}
+}
+
+// NewInMemoryUserStoreWithCredentials creates a new, empty
+// InMemoryUserStore ending the sessions and API keys of the users it links
+// identities to
+func NewInMemoryUserStoreWithCredentials(sessions *InMemorySessionStore, apiKeys *InMemoryAPIKeyStore) *InMemoryUserStore {
+	s := NewInMemoryUserStore()
+	s.sessions, s.apiKeys = sessions, apiKeys
+	return s
+}
+
+// CreateUser stores a new user
+func (s *InMemoryUserStore) CreateUser(_ context.Context, email string, passwordHash []byte) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[email]; ok {
+		return nil, ErrEmailTaken
+	}
+	s.nextID++
+	user := User{ID: strconv.Itoa(s.nextID), Email: email, PasswordHash: passwordHash, CreatedAt: time.Now()}
+	s.users[email] = user
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *InMemoryUserStore) GetUserByEmail(_ context.Context, email string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[email]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// UserForIdentity returns the user an OIDC identity maps to, linking it on
+// first use
+func (s *InMemoryUserStore) UserForIdentity(_ context.Context, identity Identity) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := Identity{Issuer: identity.Issuer, Subject: identity.Subject}
+	if email, ok := s.identities[key]; ok {
+		user := s.users[email]
+		return &user, nil
+	}
+
+	user, ok := s.users[identity.Email]
+	if ok {
+		if s.sessions != nil {
+			s.sessions.deleteUserSessions(user.ID)
+		}
+		if s.apiKeys != nil {
+			s.apiKeys.deleteOwnerKeys(user.ID)
+		}
+	} else {
+		s.nextID++
+		user = User{ID: strconv.Itoa(s.nextID), Email: identity.Email, CreatedAt: time.Now()}
+	}
+	user.PasswordHash = nil
+	s.users[identity.Email] = user
+	s.identities[key] = identity.Email
+	return &user, nil
+}
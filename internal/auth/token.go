@@ -0,0 +1,65 @@
+// Package auth registers users, logs them in with JWTs, and authenticates
+// the todo requests carrying those tokens.
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned when a token is malformed, not signed with
+// the secret, or expired
+var ErrInvalidToken = errors.New("invalid token")
+
+// tokenLeeway is the clock skew tolerated on the times of a token
+const tokenLeeway = 30 * time.Second
+
+// Tokens issues and verifies JWTs signed with HMAC-SHA256
+type Tokens struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewTokens creates Tokens signing with secret the tokens it issues, valid
+// for ttl
+func NewTokens(secret []byte, ttl time.Duration) *Tokens {
+	return &Tokens{secret: secret, ttl: ttl, now: time.Now}
+}
+
+// Issue returns a token identifying userID and when it expires
+func (t *Tokens) Issue(userID string) (string, time.Time, error) {
+	now := t.now()
+	expiresAt := now.Add(t.ttl)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   userID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+	signed, err := token.SignedString(t.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// Verify returns the user ID of token, or ErrInvalidToken. Only HS256
+// tokens with an expiry are accepted.
+func (t *Tokens) Verify(token string) (string, error) {
+	var c jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &c, func(*jwt.Token) (any, error) {
+		return t.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(tokenLeeway),
+		jwt.WithTimeFunc(t.now),
+	)
+	if err != nil || c.Subject == "" {
+		return "", ErrInvalidToken
+	}
+	return c.Subject, nil
+}
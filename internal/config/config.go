@@ -1,7 +1,13 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -9,18 +15,103 @@ import (
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig   `toml:"server"`
-	Database DatabaseConfig `toml:"database"`
-	Logging  LoggingConfig  `toml:"logging"`
+	Server     ServerConfig     `toml:"server"`
+	Database   DatabaseConfig   `toml:"database"`
+	Logging    LoggingConfig    `toml:"logging"`
+	Todos      TodosConfig      `toml:"todos"`
+	Pagination PaginationConfig `toml:"pagination"`
+	Limits     LimitsConfig     `toml:"limits"`
+	Tracing    TracingConfig    `toml:"tracing"`
+	Security   SecurityConfig   `toml:"security"`
+	Outbox     OutboxConfig     `toml:"outbox"`
+	Events     EventsConfig     `toml:"events"`
+	Auth       AuthConfig       `toml:"auth"`
+	Admin      AdminConfig      `toml:"admin"`
+	Audit      AuditConfig      `toml:"audit"`
+	Export     ExportConfig     `toml:"export"`
 }
 
 // ServerConfig holds server configuration
 type ServerConfig struct {
-	Host         string        `toml:"host"`
-	Port         int           `toml:"port"`
-	ReadTimeout  time.Duration `toml:"read_timeout"`
-	WriteTimeout time.Duration `toml:"write_timeout"`
-	IdleTimeout  time.Duration `toml:"idle_timeout"`
+	Host              string            `toml:"host"`
+	Port              int               `toml:"port"`
+	ReadTimeout       time.Duration     `toml:"read_timeout"`
+	WriteTimeout      time.Duration     `toml:"write_timeout"`
+	IdleTimeout       time.Duration     `toml:"idle_timeout"`
+	ShutdownTimeout   time.Duration     `toml:"shutdown_timeout" env-default:"10s"`
+	RequestTimeout    time.Duration     `toml:"request_timeout"`
+	MaxClientTimeout  time.Duration     `toml:"max_client_timeout"`
+	MaxBodySize       int64             `toml:"max_body_size" env-default:"1048576"`
+	RejectEmptyUpdate bool              `toml:"reject_empty_update"`
+	BasePath          string            `toml:"base_path"`
+	JSONNaming        string            `toml:"json_naming" env-default:"snake"`
+	TrustedProxies    []string          `toml:"trusted_proxies" env-default:"127.0.0.1,::1"`
+	Compression       CompressionConfig `toml:"compression"`
+	TLS               TLSConfig         `toml:"tls"`
+}
+
+// CompressionConfig holds gzip response compression configuration
+type CompressionConfig struct {
+	Enabled   bool `toml:"enabled"`
+	MinLength int  `toml:"min_length"`
+	Level     int  `toml:"level"`
+}
+
+// TLSConfig holds the certificate the server terminates HTTPS with
+type TLSConfig struct {
+	Enabled  bool   `toml:"enabled"`
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+
+	// RedirectAddr, when set, is also listened on, redirecting plain HTTP
+	// to HTTPS and answering the ACME HTTP-01 challenges of autocert
+	RedirectAddr string         `toml:"redirect_addr"`
+	Autocert     AutocertConfig `toml:"autocert"`
+}
+
+// AutocertConfig holds how certificates are obtained and renewed from an
+// ACME certificate authority, Let's Encrypt by default, instead of being
+// read from files
+type AutocertConfig struct {
+	Enabled  bool     `toml:"enabled"`
+	Hosts    []string `toml:"hosts"`
+	Email    string   `toml:"email"`
+	CacheDir string   `toml:"cache_dir" env-default:"autocert-cache"`
+
+	// DirectoryURL is the ACME directory, such as the Let's Encrypt staging
+	// one. Let's Encrypt production is used when empty.
+	DirectoryURL string `toml:"directory_url"`
+}
+
+// validate checks that an enabled TLS configuration has certificate and
+// key files that are set and readable, or uses autocert for some hosts
+func (t TLSConfig) validate() error {
+	if !t.Enabled {
+		if t.Autocert.Enabled || t.RedirectAddr != "" {
+			return errors.New("autocert and redirect_addr require enabled")
+		}
+		return nil
+	}
+	if t.Autocert.Enabled {
+		if t.CertFile != "" || t.KeyFile != "" {
+			return errors.New("cert_file and key_file must be empty with autocert")
+		}
+		if len(t.Autocert.Hosts) == 0 {
+			return errors.New("autocert.hosts is required with autocert")
+		}
+		return nil
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		return errors.New("cert_file and key_file are required when TLS is enabled")
+	}
+	for _, path := range []string{t.CertFile, t.KeyFile} {
+		f, err := os.Open(path) // #nosec G304 -- path comes from the configuration
+		if err != nil {
+			return err
+		}
+		_ = f.Close()
+	}
+	return nil
 }
 
 // Address returns the server address in host:port format
@@ -30,38 +121,394 @@ func (s ServerConfig) Address() string {
 
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
+	Driver          string        `toml:"driver"`
 	Host            string        `toml:"host"`
 	Port            int           `toml:"port"`
 	User            string        `toml:"user"`
 	Password        string        `toml:"password"`
 	DBName          string        `toml:"dbname"`
 	SSLMode         string        `toml:"sslmode"`
-	MaxOpenConns    int           `toml:"max_open_conns"`
-	MaxIdleConns    int           `toml:"max_idle_conns"`
+	MaxOpenConns    int           `toml:"max_open_conns" env-default:"10"`
+	MaxIdleConns    int           `toml:"max_idle_conns" env-default:"2"`
 	ConnMaxLifetime time.Duration `toml:"conn_max_lifetime"`
+	AutoMigrate     bool          `toml:"auto_migrate"`
+	RetryAttempts   int           `toml:"retry_attempts"`
+	RetryBackoff    time.Duration `toml:"retry_backoff"`
+	ReadHost        string        `toml:"read_host"`
+	ReadPort        int           `toml:"read_port"`
+
+	// StartupRetries is how many times connecting is tried again when the
+	// server cannot be reached at startup. Zero fails right away.
+	StartupRetries       int           `toml:"startup_retries"`
+	StartupRetryInterval time.Duration `toml:"startup_retry_interval"`
+
+	// MaintenanceVacuum makes the maintenance endpoint run VACUUM ANALYZE
+	// instead of ANALYZE
+	MaintenanceVacuum   bool          `toml:"maintenance_vacuum"`
+	MaintenanceInterval time.Duration `toml:"maintenance_interval"`
+
+	// LogQueries logs every SQL query and its duration when the log level
+	// is debug
+	LogQueries bool `toml:"log_queries"`
+
+	// SlowQueryThreshold logs a warning for repository calls taking
+	// longer. Zero disables the warning.
+	SlowQueryThreshold time.Duration `toml:"slow_query_threshold"`
+}
+
+// validate checks that the pool sizes are not negative and that the pool
+// keeps no more idle connections than it may open
+func (d DatabaseConfig) validate() error {
+	if d.MaxOpenConns < 0 || d.MaxIdleConns < 0 {
+		return errors.New("max_open_conns and max_idle_conns must not be negative")
+	}
+	if d.MaxOpenConns > 0 && d.MaxIdleConns > d.MaxOpenConns {
+		return fmt.Errorf("max_idle_conns (%d) must not exceed max_open_conns (%d)", d.MaxIdleConns, d.MaxOpenConns)
+	}
+	return nil
+}
+
+// InMemory reports whether todos are kept in memory instead of PostgreSQL
+func (d *DatabaseConfig) InMemory() bool {
+	return d.Driver == "memory"
 }
 
-// DSN returns the PostgreSQL connection string
+// redactedPassword replaces the database password wherever it could be
+// logged
+const redactedPassword = "****"
+
+// DSN returns the PostgreSQL connection string. It contains the password
+// and must never be logged; use RedactedDSN instead.
 func (d *DatabaseConfig) DSN() string {
+	return d.dsn(d.Password)
+}
+
+// HasReadReplica reports whether read-only queries go to a separate replica
+func (d *DatabaseConfig) HasReadReplica() bool {
+	return d.ReadHost != ""
+}
+
+// ReadDSN returns the connection string of the read replica: the primary's
+// settings with ReadHost and, when set, ReadPort. Like DSN it contains the
+// password.
+func (d *DatabaseConfig) ReadDSN() string {
+	replica := *d
+	replica.Host = d.ReadHost
+	if d.ReadPort > 0 {
+		replica.Port = d.ReadPort
+	}
+	return replica.DSN()
+}
+
+// RedactedDSN returns the PostgreSQL connection string with the password
+// masked
+func (d *DatabaseConfig) RedactedDSN() string {
+	return d.dsn(redactedPassword)
+}
+
+func (d *DatabaseConfig) dsn(password string) string {
 	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		d.Host, d.Port, d.User, d.Password, d.DBName, d.SSLMode,
+		d.Host, d.Port, d.User, password, d.DBName, d.SSLMode,
+	)
+}
+
+// String returns the redacted connection string, so formatting the config
+// never prints the password
+func (d DatabaseConfig) String() string {
+	return d.RedactedDSN()
+}
+
+// LogValue implements slog.LogValuer, masking the password when the config
+// is logged
+func (d DatabaseConfig) LogValue() slog.Value {
+	password := ""
+	if d.Password != "" {
+		password = redactedPassword
+	}
+	return slog.GroupValue(
+		slog.String("driver", d.Driver),
+		slog.String("host", d.Host),
+		slog.Int("port", d.Port),
+		slog.String("user", d.User),
+		slog.String("password", password),
+		slog.String("dbname", d.DBName),
+		slog.String("sslmode", d.SSLMode),
+		slog.String("read_host", d.ReadHost),
 	)
 }
 
 // LoggingConfig holds logging configuration
 type LoggingConfig struct {
-	Level     string `toml:"level"`
-	Format    string `toml:"format"`
-	AddSource bool   `toml:"add_source"`
+	Level      string   `toml:"level"`
+	Format     string   `toml:"format"`
+	AddSource  bool     `toml:"add_source"`
+	RedactKeys []string `toml:"redact_keys"`
+	Output     string   `toml:"output"`
+	MaxSize    int      `toml:"max_size"`
+	MaxBackups int      `toml:"max_backups"`
+	MaxAge     int      `toml:"max_age"`
+	PanicStack bool     `toml:"panic_stack"`
+
+	// FallbackToStderr writes records the output fails to write to
+	// standard error instead of dropping them
+	FallbackToStderr bool `toml:"fallback_to_stderr"`
+
+	// LogBodies logs request and response bodies of up to MaxBodyLogSize
+	// bytes, with the RedactKeys fields masked. It requires level debug.
+	LogBodies      bool `toml:"log_bodies"`
+	MaxBodyLogSize int  `toml:"max_body_log_size" env-default:"4096"`
+
+	// ServiceName, Environment and Instance are added to every record as
+	// service, env and instance, when set
+	ServiceName string `toml:"service_name"`
+	Environment string `toml:"environment"`
+	Instance    string `toml:"instance"`
+}
+
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig struct {
+	Enabled     bool    `toml:"enabled"`
+	Endpoint    string  `toml:"endpoint"`
+	Insecure    bool    `toml:"insecure"`
+	SampleRatio float64 `toml:"sample_ratio"`
+	ServiceName string  `toml:"service_name"`
+}
+
+// SecurityConfig holds transport security configuration
+type SecurityConfig struct {
+	ForceHTTPS bool          `toml:"force_https"`
+	HSTSMaxAge time.Duration `toml:"hsts_max_age"`
+}
+
+// OutboxConfig holds how todo events are published from the outbox, with
+// PostgreSQL only
+type OutboxConfig struct {
+	PollInterval time.Duration `toml:"poll_interval" env-default:"5s"`
+	BatchSize    int           `toml:"batch_size" env-default:"100"`
+	Retention    time.Duration `toml:"retention" env-default:"168h"`
+}
+
+// EventsConfig holds how todo changes are streamed to clients of
+// GET /api/v1/todos/events
+type EventsConfig struct {
+	BufferSize int           `toml:"buffer_size" env-default:"16"`
+	KeepAlive  time.Duration `toml:"keep_alive" env-default:"15s"`
+}
+
+// minJWTSecretLength is the shortest secret accepted to sign tokens, as
+// long as the HMAC-SHA256 key it is used as
+const minJWTSecretLength = 32
+
+// AuthConfig holds the built-in authentication. When enabled, todo
+// requests identify their user with a token from /api/v1/auth/login, the
+// OIDC callback or /api/v1/auth/refresh, instead of the X-User-ID header.
+type AuthConfig struct {
+	Enabled         bool          `toml:"enabled"`
+	JWTSecret       string        `toml:"jwt_secret"`
+	TokenTTL        time.Duration `toml:"token_ttl" env-default:"15m"`
+	RefreshTokenTTL time.Duration `toml:"refresh_token_ttl" env-default:"720h"`
+
+	// DisablePasswords drops /api/v1/auth/register and /api/v1/auth/login,
+	// leaving OIDC as the only way to log in
+	DisablePasswords bool `toml:"disable_passwords"`
+
+	// CookieSessions also sets the access token in a cookie at login, for
+	// same-origin web UIs, with a CSRF token mutating requests must repeat
+	CookieSessions bool       `toml:"cookie_sessions"`
+	OIDC           OIDCConfig `toml:"oidc"`
+}
+
+// validate requires a secret long enough to sign tokens, positive token
+// lifetimes and a way to log in when authentication is enabled
+func (a AuthConfig) validate() error {
+	if !a.Enabled {
+		if a.OIDC.Enabled || a.CookieSessions {
+			return errors.New("oidc and cookie_sessions require enabled")
+		}
+		return nil
+	}
+	if len(a.JWTSecret) < minJWTSecretLength {
+		return fmt.Errorf("jwt_secret must be at least %d bytes", minJWTSecretLength)
+	}
+	if a.TokenTTL <= 0 || a.RefreshTokenTTL <= 0 {
+		return errors.New("token_ttl and refresh_token_ttl must be positive")
+	}
+	if a.DisablePasswords && !a.OIDC.Enabled {
+		return errors.New("disable_passwords requires oidc.enabled")
+	}
+	if err := a.OIDC.validate(); err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+	return nil
+}
+
+// minAdminTokenLength is the minimum size of the admin token
+const minAdminTokenLength = 32
+
+// AdminConfig holds the credential of the /api/v1/admin routes, which act
+// on every user. They are not registered without it.
+type AdminConfig struct {
+	// Token is the value admin requests must send in X-Admin-Token
+	Token string `toml:"token"`
+}
+
+// validate rejects admin tokens too short to resist guessing
+func (a AdminConfig) validate() error {
+	if a.Token != "" && len(a.Token) < minAdminTokenLength {
+		return fmt.Errorf("token must be at least %d bytes", minAdminTokenLength)
+	}
+	return nil
 }
 
-// Load reads configuration from the specified file
+// AuditConfig holds the audit trail of the changes made to todos, listed
+// and verified under /api/v1/admin/audit when admin.token is set
+type AuditConfig struct {
+	Enabled bool `toml:"enabled"`
+}
+
+// ExportConfig holds how GET /api/v1/users/me/export archives the data
+// of a user
+type ExportConfig struct {
+	// AsyncThreshold is the number of todos above which the archive is
+	// built in the background instead of streamed in the response
+	AsyncThreshold int `toml:"async_threshold" env-default:"1000"`
+
+	// JobTTL is how long archives built in the background can be
+	// downloaded
+	JobTTL time.Duration `toml:"job_ttl" env-default:"1h"`
+
+	// MaxPendingJobs is how many archives can be built in the background
+	// at once, each user getting at most one per format
+	MaxPendingJobs int `toml:"max_pending_jobs" env-default:"4"`
+}
+
+// OIDCConfig holds the OpenID Connect provider users log in with through
+// /api/v1/auth/oidc/login, such as Google Workspace
+type OIDCConfig struct {
+	Enabled      bool   `toml:"enabled"`
+	Issuer       string `toml:"issuer"`
+	ClientID     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	RedirectURL  string `toml:"redirect_url"`
+
+	// AllowedDomain, when set, only lets in the users of this hosted
+	// domain, per the hd claim of Google Workspace
+	AllowedDomain string `toml:"allowed_domain"`
+}
+
+// validate requires the provider and client settings of an enabled OIDC
+// configuration
+func (o OIDCConfig) validate() error {
+	if !o.Enabled {
+		return nil
+	}
+	if o.Issuer == "" || o.ClientID == "" || o.ClientSecret == "" || o.RedirectURL == "" {
+		return errors.New("issuer, client_id, client_secret and redirect_url are required when enabled")
+	}
+	return nil
+}
+
+// TodosConfig holds configuration for the todos API
+type TodosConfig struct {
+	ListByteBudget     int64          `toml:"list_byte_budget"`
+	ExposeOptions      bool           `toml:"expose_options"`
+	IdempotencyTTL     time.Duration  `toml:"idempotency_ttl"`
+	IdempotencyMaxKeys int            `toml:"idempotency_max_keys"`
+	Timezone           string         `toml:"timezone"`
+	ControlCharacters  string         `toml:"control_characters"`
+	TitlePattern       string         `toml:"title_pattern"`
+	DeleteBatchSize    int            `toml:"delete_batch_size"`
+	UniqueTitles       bool           `toml:"unique_titles"`
+	Timeouts           TimeoutsConfig `toml:"timeouts"`
+}
+
+// TimeoutsConfig bounds the database work of mutating operations, on top of
+// the request timeout. Zero leaves an operation unbounded.
+type TimeoutsConfig struct {
+	Create      time.Duration `toml:"create"`
+	Update      time.Duration `toml:"update"`
+	Delete      time.Duration `toml:"delete"` // per statement for batched deletes
+	CompleteAll time.Duration `toml:"complete_all"`
+}
+
+// Location returns the time zone todo statistics are computed in, UTC when
+// none is configured
+func (t TodosConfig) Location() (*time.Location, error) {
+	if t.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(t.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid todos timezone: %w", err)
+	}
+	return loc, nil
+}
+
+// TitleRegexp returns the pattern todo titles must match, nil when none is
+// configured
+func (t TodosConfig) TitleRegexp() (*regexp.Regexp, error) {
+	if t.TitlePattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(t.TitlePattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid todos title pattern: %w", err)
+	}
+	return re, nil
+}
+
+// PaginationConfig holds the page size applied when listing todos
+type PaginationConfig struct {
+	DefaultPageSize int `toml:"default_page_size" env-default:"10"`
+}
+
+// LimitsConfig caps the size of what a single request may ask for. Zero
+// disables a limit.
+type LimitsConfig struct {
+	// MaxBatchSize caps the todos fetched by one batch request
+	MaxBatchSize int `toml:"max_batch_size" env-default:"100"`
+
+	// MaxIDsPerRequest caps the IDs a bulk delete may list
+	MaxIDsPerRequest int `toml:"max_ids_per_request" env-default:"1000"`
+
+	// MaxPageSize clamps larger page_size values
+	MaxPageSize int `toml:"max_page_size" env-default:"100"`
+}
+
+// Load reads configuration from the specified file, reading the secrets
+// its passwords and keys refer to from Vault or AWS Secrets Manager
 func Load(configPath string) (*Config, error) {
 	var cfg Config
 	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
+	if err := newSecretResolver().resolveSecrets(context.Background(), &cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Server.TLS.validate(); err != nil {
+		return nil, fmt.Errorf("invalid server.tls config: %w", err)
+	}
+	if cfg.Logging.LogBodies && !strings.EqualFold(cfg.Logging.Level, "debug") {
+		return nil, errors.New("invalid logging config: log_bodies requires level debug")
+	}
+	if err := cfg.Database.validate(); err != nil {
+		return nil, fmt.Errorf("invalid database config: %w", err)
+	}
+	if err := cfg.Auth.validate(); err != nil {
+		return nil, fmt.Errorf("invalid auth config: %w", err)
+	}
+	if err := cfg.Admin.validate(); err != nil {
+		return nil, fmt.Errorf("invalid admin config: %w", err)
+	}
+	if naming := cfg.Server.JSONNaming; naming != "snake" && naming != "camel" {
+		return nil, fmt.Errorf("invalid server.json_naming %q: must be snake or camel", naming)
+	}
+	switch policy := cfg.Todos.ControlCharacters; policy {
+	case "", "allow", "reject", "strip":
+	default:
+		return nil, fmt.Errorf("invalid todos.control_characters %q: must be allow, reject, strip or empty", policy)
+	}
 	return &cfg, nil
 }
 
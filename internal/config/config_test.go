@@ -1,7 +1,16 @@
 package config
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,6 +26,14 @@ port = 8080
 read_timeout = "15s"
 write_timeout = "15s"
 idle_timeout = "60s"
+request_timeout = "10s"
+max_body_size = 1048576
+reject_empty_update = true
+
+[server.compression]
+enabled = true
+min_length = 1024
+level = 5
 
 [database]
 host = "localhost"
@@ -33,6 +50,14 @@ conn_max_lifetime = "5m"
 level = "info"
 format = "json"
 add_source = false
+redact_keys = ["password", "token"]
+
+[todos]
+idempotency_ttl = "24h"
+idempotency_max_keys = 10000
+
+[limits]
+max_page_size = 50
 `
 	tmpfile, err := os.CreateTemp("", "config-*.toml")
 	assert.NoError(t, err)
@@ -51,6 +76,13 @@ add_source = false
 	assert.Equal(t, "localhost", cfg.Server.Host)
 	assert.Equal(t, 8080, cfg.Server.Port)
 	assert.Equal(t, 15*time.Second, cfg.Server.ReadTimeout)
+	assert.Equal(t, 10*time.Second, cfg.Server.RequestTimeout)
+	assert.Equal(t, int64(1048576), cfg.Server.MaxBodySize)
+	assert.True(t, cfg.Server.RejectEmptyUpdate)
+	assert.True(t, cfg.Server.Compression.Enabled)
+	assert.Equal(t, 1024, cfg.Server.Compression.MinLength)
+	assert.Equal(t, 5, cfg.Server.Compression.Level)
+	assert.Equal(t, []string{"127.0.0.1", "::1"}, cfg.Server.TrustedProxies)
 
 	// Verify database config
 	assert.Equal(t, "testuser", cfg.Database.User)
@@ -59,6 +91,18 @@ add_source = false
 	// Verify logging config
 	assert.Equal(t, "info", cfg.Logging.Level)
 	assert.Equal(t, "json", cfg.Logging.Format)
+	assert.Equal(t, []string{"password", "token"}, cfg.Logging.RedactKeys)
+
+	// Verify todos config
+	assert.Equal(t, 24*time.Hour, cfg.Todos.IdempotencyTTL)
+	assert.Equal(t, 10000, cfg.Todos.IdempotencyMaxKeys)
+
+	// Verify pagination and limits config, falling back to defaults for
+	// missing keys
+	assert.Equal(t, 10, cfg.Pagination.DefaultPageSize)
+	assert.Equal(t, 50, cfg.Limits.MaxPageSize)
+	assert.Equal(t, 100, cfg.Limits.MaxBatchSize)
+	assert.Equal(t, 1000, cfg.Limits.MaxIDsPerRequest)
 }
 
 func TestServerConfig_Address(t *testing.T) {
@@ -82,7 +126,334 @@ func TestDatabaseConfig_DSN(t *testing.T) {
 	assert.Equal(t, expected, cfg.DSN())
 }
 
+func TestDatabaseConfig_ReadDSN(t *testing.T) {
+	cfg := DatabaseConfig{
+		Host:     "primary",
+		Port:     5432,
+		User:     "testuser",
+		Password: "testpass",
+		DBName:   "testdb",
+		SSLMode:  "disable",
+	}
+	assert.False(t, cfg.HasReadReplica())
+
+	cfg.ReadHost = "replica"
+	assert.True(t, cfg.HasReadReplica())
+	assert.Equal(t, "host=replica port=5432 user=testuser password=testpass dbname=testdb sslmode=disable", cfg.ReadDSN())
+
+	cfg.ReadPort = 5433
+	assert.Equal(t, "host=replica port=5433 user=testuser password=testpass dbname=testdb sslmode=disable", cfg.ReadDSN())
+	assert.Equal(t, "host=primary port=5432 user=testuser password=testpass dbname=testdb sslmode=disable", cfg.DSN())
+}
+
+func TestTodosConfig_Location(t *testing.T) {
+	loc, err := TodosConfig{}.Location()
+	assert.NoError(t, err)
+	assert.Equal(t, time.UTC, loc)
+
+	loc, err = TodosConfig{Timezone: "Europe/Paris"}.Location()
+	assert.NoError(t, err)
+	assert.Equal(t, "Europe/Paris", loc.String())
+
+	_, err = TodosConfig{Timezone: "Mars/Olympus"}.Location()
+	assert.Error(t, err)
+}
+
+func TestTodosConfig_TitleRegexp(t *testing.T) {
+	re, err := TodosConfig{}.TitleRegexp()
+	assert.NoError(t, err)
+	assert.Nil(t, re)
+
+	re, err = TodosConfig{TitlePattern: "^[A-Z]"}.TitleRegexp()
+	assert.NoError(t, err)
+	assert.True(t, re.MatchString("Buy milk"))
+
+	_, err = TodosConfig{TitlePattern: "["}.TitleRegexp()
+	assert.Error(t, err)
+}
+
+func TestDatabaseConfig_Redaction(t *testing.T) {
+	cfg := DatabaseConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "testuser",
+		Password: "s3cret",
+		DBName:   "testdb",
+		SSLMode:  "disable",
+	}
+	expected := "host=localhost port=5432 user=testuser password=**** dbname=testdb sslmode=disable"
+	assert.Equal(t, expected, cfg.RedactedDSN())
+	assert.Equal(t, expected, cfg.String())
+	assert.Equal(t, expected, fmt.Sprint(&cfg))
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	logger.Info("config", "database", cfg, "database_ptr", &cfg)
+	assert.NotContains(t, buf.String(), "s3cret")
+	assert.Contains(t, buf.String(), `"password":"****"`)
+	assert.Contains(t, buf.String(), `"host":"localhost"`)
+}
+
+func TestTLSConfig_Validate(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	key := filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(cert, []byte("cert"), 0o600))
+	assert.NoError(t, os.WriteFile(key, []byte("key"), 0o600))
+
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		wantErr bool
+	}{
+		{name: "disabled", tls: TLSConfig{}, wantErr: false},
+		{name: "enabled with readable files", tls: TLSConfig{Enabled: true, CertFile: cert, KeyFile: key}, wantErr: false},
+		{name: "enabled without key", tls: TLSConfig{Enabled: true, CertFile: cert}, wantErr: true},
+		{name: "enabled with missing cert", tls: TLSConfig{Enabled: true, CertFile: filepath.Join(dir, "missing.pem"), KeyFile: key}, wantErr: true},
+		{name: "autocert", tls: TLSConfig{Enabled: true, RedirectAddr: ":80", Autocert: AutocertConfig{Enabled: true, Hosts: []string{"todo.example.com"}}}, wantErr: false},
+		{name: "autocert without hosts", tls: TLSConfig{Enabled: true, Autocert: AutocertConfig{Enabled: true}}, wantErr: true},
+		{name: "autocert with files", tls: TLSConfig{Enabled: true, CertFile: cert, KeyFile: key, Autocert: AutocertConfig{Enabled: true, Hosts: []string{"todo.example.com"}}}, wantErr: true},
+		{name: "autocert without TLS", tls: TLSConfig{Autocert: AutocertConfig{Enabled: true, Hosts: []string{"todo.example.com"}}}, wantErr: true},
+		{name: "redirect without TLS", tls: TLSConfig{RedirectAddr: ":80"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tls.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLoad_InvalidTLS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, os.WriteFile(path, []byte("[server.tls]\nenabled = true\n"), 0o600))
+
+	_, err := Load(path)
+	assert.ErrorContains(t, err, "server.tls")
+}
+
+func TestLoad_InvalidJSONNaming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, os.WriteFile(path, []byte("[server]\njson_naming = \"kebab\"\n"), 0o600))
+
+	_, err := Load(path)
+	assert.ErrorContains(t, err, "server.json_naming")
+}
+
+func TestLoad_ControlCharacters(t *testing.T) {
+	for _, policy := range []string{"", "allow", "reject", "strip"} {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		assert.NoError(t, os.WriteFile(path, []byte("[todos]\ncontrol_characters = \""+policy+"\"\n"), 0o600))
+
+		cfg, err := Load(path)
+		if assert.NoError(t, err, policy) {
+			assert.Equal(t, policy, cfg.Todos.ControlCharacters)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, os.WriteFile(path, []byte("[todos]\ncontrol_characters = \"Reject\"\n"), 0o600))
+
+	_, err := Load(path)
+	assert.ErrorContains(t, err, "todos.control_characters")
+}
+
+func TestLoad_PoolSizes(t *testing.T) {
+	t.Run("defaults when unset", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		assert.NoError(t, os.WriteFile(path, []byte("[database]\nhost = \"localhost\"\n"), 0o600))
+
+		cfg, err := Load(path)
+		assert.NoError(t, err)
+		assert.Equal(t, 10, cfg.Database.MaxOpenConns)
+		assert.Equal(t, 2, cfg.Database.MaxIdleConns)
+		assert.Equal(t, int64(1<<20), cfg.Server.MaxBodySize, "bodies are bounded without max_body_size")
+	})
+
+	t.Run("more idle than open connections", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		assert.NoError(t, os.WriteFile(path, []byte("[database]\nmax_open_conns = 5\nmax_idle_conns = 6\n"), 0o600))
+
+		_, err := Load(path)
+		assert.ErrorContains(t, err, "max_idle_conns (6) must not exceed max_open_conns (5)")
+	})
+
+	t.Run("negative size", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		assert.NoError(t, os.WriteFile(path, []byte("[database]\nmax_open_conns = -1\n"), 0o600))
+
+		_, err := Load(path)
+		assert.ErrorContains(t, err, "invalid database config")
+	})
+}
+
+func TestLoad_LogBodiesRequiresDebug(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, os.WriteFile(path, []byte("[logging]\nlevel = \"info\"\nlog_bodies = true\n"), 0o600))
+
+	_, err := Load(path)
+	assert.ErrorContains(t, err, "log_bodies requires level debug")
+
+	assert.NoError(t, os.WriteFile(path, []byte("[logging]\nlevel = \"debug\"\nlog_bodies = true\n"), 0o600))
+	cfg, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 4096, cfg.Logging.MaxBodyLogSize)
+}
+
+func TestLoad_AuthRequiresSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, os.WriteFile(path, []byte("[auth]\nenabled = true\njwt_secret = \"short\"\n"), 0o600))
+
+	_, err := Load(path)
+	assert.ErrorContains(t, err, "jwt_secret must be at least 32 bytes")
+
+	assert.NoError(t, os.WriteFile(path, []byte("[auth]\nenabled = true\njwt_secret = \"0123456789abcdef0123456789abcdef\"\n"), 0o600))
+	cfg, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, cfg.Auth.TokenTTL)
+	assert.Equal(t, 720*time.Hour, cfg.Auth.RefreshTokenTTL)
+}
+
+func TestLoad_AdminToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, os.WriteFile(path, []byte("[admin]\ntoken = \"short\"\n"), 0o600))
+
+	_, err := Load(path)
+	assert.ErrorContains(t, err, "invalid admin config: token must be at least 32 bytes")
+
+	assert.NoError(t, os.WriteFile(path, []byte("[admin]\ntoken = \"0123456789abcdef0123456789abcdef\"\n"), 0o600))
+	cfg, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", cfg.Admin.Token)
+}
+
+func TestAuthConfig_Validate(t *testing.T) {
+	secret := "0123456789abcdef0123456789abcdef"
+	oidc := OIDCConfig{Enabled: true, Issuer: "https://accounts.google.com", ClientID: "id", ClientSecret: "secret", RedirectURL: "https://example.com/callback"}
+
+	tests := []struct {
+		name    string
+		auth    AuthConfig
+		wantErr string
+	}{
+		{name: "disabled", auth: AuthConfig{}},
+		{name: "passwords", auth: AuthConfig{Enabled: true, JWTSecret: secret, TokenTTL: time.Hour, RefreshTokenTTL: 24 * time.Hour}},
+		{name: "oidc only", auth: AuthConfig{Enabled: true, JWTSecret: secret, TokenTTL: time.Hour, RefreshTokenTTL: 24 * time.Hour, DisablePasswords: true, OIDC: oidc}},
+		{name: "no way to log in", auth: AuthConfig{Enabled: true, JWTSecret: secret, TokenTTL: time.Hour, RefreshTokenTTL: 24 * time.Hour, DisablePasswords: true}, wantErr: "disable_passwords requires oidc.enabled"},
+		{name: "no session lifetime", auth: AuthConfig{Enabled: true, JWTSecret: secret, TokenTTL: time.Hour}, wantErr: "refresh_token_ttl must be positive"},
+		{name: "oidc without auth", auth: AuthConfig{OIDC: oidc}, wantErr: "oidc and cookie_sessions require enabled"},
+		{name: "cookies without auth", auth: AuthConfig{CookieSessions: true}, wantErr: "cookie_sessions require enabled"},
+		{name: "oidc without client", auth: AuthConfig{Enabled: true, JWTSecret: secret, TokenTTL: time.Hour, RefreshTokenTTL: 24 * time.Hour, OIDC: OIDCConfig{Enabled: true, Issuer: oidc.Issuer}}, wantErr: "oidc: issuer, client_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.auth.validate()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestLoad_InvalidFile(t *testing.T) {
 	_, err := Load("nonexistent.toml")
 	assert.Error(t, err)
 }
+
+func TestSecretResolver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/secret/data/idiomapi" && r.Header.Get("X-Vault-Token") == "root":
+			_, _ = w.Write([]byte(`{"data":{"data":{"db_password":"from-vault"},"metadata":{"version":1}}}`))
+		case r.Header.Get("X-Amz-Target") == "secretsmanager.GetSecretValue" &&
+			strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"):
+			var body struct{ SecretId string }
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+			switch body.SecretId {
+			case "prod/jwt":
+				_, _ = w.Write([]byte(`{"SecretString":"from-secrets-manager"}`))
+			case "arn:aws:secretsmanager:eu-west-3:123456789012:secret:oidc":
+				assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-3/secretsmanager/")
+				_, _ = w.Write([]byte(`{"SecretString":"{\"client_secret\":\"from-json\"}"}`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+			}
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	for name, value := range map[string]string{
+		"VAULT_ADDR":                  srv.URL,
+		"VAULT_TOKEN":                 "root",
+		"VAULT_NAMESPACE":             "",
+		"AWS_ACCESS_KEY_ID":           "AKID",
+		"AWS_SECRET_ACCESS_KEY":       "secret",
+		"AWS_SESSION_TOKEN":           "",
+		"AWS_PROFILE":                 "",
+		"AWS_REGION":                  "us-east-1",
+		"AWS_ENDPOINT_URL":            srv.URL,
+		"AWS_CONFIG_FILE":             filepath.Join(t.TempDir(), "config"),
+		"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(t.TempDir(), "credentials"),
+		"AWS_EC2_METADATA_DISABLED":   "true",
+	} {
+		t.Setenv(name, value)
+	}
+	r := newSecretResolver()
+
+	cfg := Config{
+		Database: DatabaseConfig{Password: "vault://secret/idiomapi#db_password"},
+		Auth: AuthConfig{
+			JWTSecret: "awssm://prod/jwt",
+			OIDC:      OIDCConfig{ClientSecret: "awssm://arn:aws:secretsmanager:eu-west-3:123456789012:secret:oidc#client_secret"},
+		},
+	}
+	assert.NoError(t, r.resolveSecrets(context.Background(), &cfg))
+	assert.Equal(t, "from-vault", cfg.Database.Password)
+	assert.Equal(t, "from-secrets-manager", cfg.Auth.JWTSecret)
+	assert.Equal(t, "from-json", cfg.Auth.OIDC.ClientSecret)
+
+	plain := Config{Database: DatabaseConfig{Password: "plain"}}
+	assert.NoError(t, r.resolveSecrets(context.Background(), &plain))
+	assert.Equal(t, "plain", plain.Database.Password)
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{"missing vault key", "vault://secret/idiomapi#missing", `no string key "missing"`},
+		{"vault reference without key", "vault://secret/idiomapi", "reference must be vault://<mount>/<path>#<key>"},
+		{"unknown secret", "awssm://unknown", "ResourceNotFoundException"},
+		{"missing JSON key", "awssm://arn:aws:secretsmanager:eu-west-3:123456789012:secret:oidc#missing", `no string key "missing"`},
+		{"secret not JSON", "awssm://prod/jwt#key", "is not a JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Database: DatabaseConfig{Password: tt.value}}
+			err := r.resolveSecrets(context.Background(), &cfg)
+			assert.ErrorContains(t, err, "failed to resolve database.password")
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoad_SecretReferenceWithoutBackend(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, os.WriteFile(path, []byte("[database]\npassword = \"vault://secret/idiomapi#db_password\"\n"), 0o600))
+
+	_, err := Load(path)
+	assert.ErrorContains(t, err, "VAULT_ADDR and VAULT_TOKEN must be set")
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	vault "github.com/hashicorp/vault/api"
+)
+
+// Prefixes of the configuration values naming a secret to read instead of
+// holding it
+const (
+	vaultPrefix          = "vault://"
+	secretsManagerPrefix = "awssm://"
+)
+
+// secretTimeout bounds reading each secret at startup
+const secretTimeout = 10 * time.Second
+
+// secretResolver reads the secrets configuration values refer to:
+//
+//   - vault://<mount>/<path>#<key>, the key of a Vault KV version 2 secret,
+//     from VAULT_ADDR with VAULT_TOKEN, and VAULT_NAMESPACE if set
+//   - awssm://<name or ARN>[#<key>], an AWS Secrets Manager secret or the key
+//     of its JSON, with the credentials and region the AWS SDK finds: the
+//     AWS_ environment variables, shared profiles, SSO, or the role of the
+//     ECS task or EC2 instance
+//
+// The clients are created on first use, and shared by the secrets read.
+type secretResolver struct {
+	vault *vault.Client
+	aws   *aws.Config
+}
+
+// newSecretResolver creates a secretResolver reading the environment
+func newSecretResolver() *secretResolver {
+	return &secretResolver{}
+}
+
+// resolveSecrets replaces the secret references among the passwords and
+// keys of cfg with the secrets they name. Other values are kept as they are.
+func (r *secretResolver) resolveSecrets(ctx context.Context, cfg *Config) error {
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"database.password", &cfg.Database.Password},
+		{"auth.jwt_secret", &cfg.Auth.JWTSecret},
+		{"auth.oidc.client_secret", &cfg.Auth.OIDC.ClientSecret},
+		{"admin.token", &cfg.Admin.Token},
+	} {
+		secret, err := r.resolve(ctx, *field.value)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", field.name, err)
+		}
+		*field.value = secret
+	}
+	return nil
+}
+
+// resolve returns the secret value refers to, or value when it is not a
+// reference
+func (r *secretResolver) resolve(ctx context.Context, value string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, secretTimeout)
+	defer cancel()
+
+	switch {
+	case strings.HasPrefix(value, vaultPrefix):
+		path, key, _ := strings.Cut(strings.TrimPrefix(value, vaultPrefix), "#")
+		return r.vaultSecret(ctx, path, key)
+	case strings.HasPrefix(value, secretsManagerPrefix):
+		id, key, _ := strings.Cut(strings.TrimPrefix(value, secretsManagerPrefix), "#")
+		return r.secretsManagerSecret(ctx, id, key)
+	default:
+		return value, nil
+	}
+}
+
+// vaultSecret reads the key of the KV version 2 secret at path, starting
+// with the mount of the secrets engine
+func (r *secretResolver) vaultSecret(ctx context.Context, path, key string) (string, error) {
+	mount, secretPath, ok := strings.Cut(path, "/")
+	if !ok || secretPath == "" || key == "" {
+		return "", fmt.Errorf("vault: reference must be %s<mount>/<path>#<key>", vaultPrefix)
+	}
+	client, err := r.vaultClient()
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+
+	secret, err := client.KVv2(mount).Get(ctx, secretPath)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	value, ok := secret.Data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("vault: secret %s has no string key %q", path, key)
+	}
+	return value, nil
+}
+
+// vaultClient returns the Vault client, configured from the environment
+func (r *secretResolver) vaultClient() (*vault.Client, error) {
+	if r.vault != nil {
+		return r.vault, nil
+	}
+	// The client would otherwise fall back to a local agent
+	if os.Getenv(vault.EnvVaultAddress) == "" || os.Getenv(vault.EnvVaultToken) == "" {
+		return nil, errors.New("VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+
+	client, err := vault.NewClient(vault.DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+	r.vault = client
+	return client, nil
+}
+
+// secretsManagerSecret reads the secret id, or the key of its JSON when
+// key is not empty. Secrets named by ARN are read in the region of the ARN.
+func (r *secretResolver) secretsManagerSecret(ctx context.Context, id, key string) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("aws secrets manager: reference must be %s<name or ARN>[#<key>]", secretsManagerPrefix)
+	}
+	cfg, err := r.awsConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("aws secrets manager: %w", err)
+	}
+	region := cfg.Region
+	if parsed, err := arn.Parse(id); err == nil {
+		region = parsed.Region
+	}
+	if region == "" {
+		return "", errors.New("aws secrets manager: AWS_REGION must be set, or the secret named by ARN")
+	}
+
+	client := secretsmanager.NewFromConfig(*cfg, func(o *secretsmanager.Options) {
+		o.Region = region
+	})
+	out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", fmt.Errorf("aws secrets manager: %w", err)
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("aws secrets manager: secret %s is binary", id)
+	}
+	if key == "" {
+		return *out.SecretString, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(*out.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("aws secrets manager: secret %s is not a JSON object", id)
+	}
+	secret, ok := fields[key].(string)
+	if !ok {
+		return "", fmt.Errorf("aws secrets manager: secret %s has no string key %q", id, key)
+	}
+	return secret, nil
+}
+
+// awsConfig returns the AWS configuration, loaded from the environment,
+// shared files and instance metadata the way every AWS SDK does
+func (r *secretResolver) awsConfig(ctx context.Context) (*aws.Config, error) {
+	if r.aws != nil {
+		return r.aws, nil
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.aws = &cfg
+	return r.aws, nil
+}
@@ -7,18 +7,66 @@ import (
 	"time"
 
 	"github.com/g3offrey/idiomapi/internal/config"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// Database wraps the pgx connection pool
+// Database wraps the pgx connection pools
 type Database struct {
-	Pool   *pgxpool.Pool
+	Pool *pgxpool.Pool
+
+	// ReadPool serves read-only queries. It is Pool itself when no read
+	// replica is configured.
+	ReadPool *pgxpool.Pool
+
 	logger *slog.Logger
 }
 
-// New creates a new Database instance with a connection pool
+// New creates a new Database instance with a connection pool, and a second
+// one for the read replica when cfg has one. Queries are logged when
+// cfg.LogQueries is set and logger is enabled at debug level.
 func New(ctx context.Context, cfg *config.DatabaseConfig, logger *slog.Logger) (*Database, error) {
-	poolConfig, err := pgxpool.ParseConfig(cfg.DSN())
+	var tracer pgx.QueryTracer
+	if cfg.LogQueries && logger.Enabled(ctx, slog.LevelDebug) {
+		tracer = NewQueryLogger(logger)
+	}
+
+	pool, err := newPool(ctx, cfg, cfg.DSN(), tracer, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("database connection established",
+		"host", cfg.Host,
+		"port", cfg.Port,
+		"database", cfg.DBName)
+
+	readPool := pool
+	if cfg.HasReadReplica() {
+		readPool, err = newPool(ctx, cfg, cfg.ReadDSN(), tracer, logger)
+		if err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("read replica: %w", err)
+		}
+
+		logger.Info("read replica connection established",
+			"host", cfg.ReadHost,
+			"port", readPool.Config().ConnConfig.Port,
+			"database", cfg.DBName)
+	}
+
+	return &Database{
+		Pool:     pool,
+		ReadPool: readPool,
+		logger:   logger,
+	}, nil
+}
+
+// newPool creates a connection pool for dsn, sized from cfg, and checks
+// that it can reach the server, waiting for it as configured by
+// cfg.StartupRetries. tracer, when not nil, traces every query.
+func newPool(ctx context.Context, cfg *config.DatabaseConfig, dsn string, tracer pgx.QueryTracer, logger *slog.Logger) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse database config: %w", err)
 	}
@@ -33,6 +81,7 @@ func New(ctx context.Context, cfg *config.DatabaseConfig, logger *slog.Logger) (
 	poolConfig.MaxConnLifetime = cfg.ConnMaxLifetime
 	poolConfig.MaxConnIdleTime = 30 * time.Minute
 	poolConfig.HealthCheckPeriod = 1 * time.Minute
+	poolConfig.ConnConfig.Tracer = tracer
 
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
@@ -40,29 +89,64 @@ func New(ctx context.Context, cfg *config.DatabaseConfig, logger *slog.Logger) (
 	}
 
 	// Test the connection
-	if err := pool.Ping(ctx); err != nil {
+	if err := ping(ctx, pool, cfg.StartupRetries, cfg.StartupRetryInterval, logger); err != nil {
 		pool.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	logger.Info("database connection established",
-		"host", cfg.Host,
-		"port", cfg.Port,
-		"database", cfg.DBName)
+	return pool, nil
+}
 
-	return &Database{
-		Pool:   pool,
-		logger: logger,
-	}, nil
+// pinger checks that a server can be reached
+type pinger interface {
+	Ping(ctx context.Context) error
 }
 
-// Close closes the database connection pool
+// ping pings p, trying again up to retries times while it fails. The wait
+// before the first retry is interval and doubles after each one.
+func ping(ctx context.Context, p pinger, retries int, interval time.Duration, logger *slog.Logger) error {
+	wait := interval
+	for attempt := 1; ; attempt++ {
+		err := p.Ping(ctx)
+		if err == nil || attempt > retries {
+			return err
+		}
+
+		logger.Warn("database not reachable, retrying",
+			"attempt", attempt,
+			"retries", retries,
+			"wait", wait,
+			"error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
+
+// Close closes the database connection pools
 func (db *Database) Close() {
 	db.logger.Info("closing database connection")
+	if db.ReadPool != db.Pool {
+		db.ReadPool.Close()
+	}
 	db.Pool.Close()
 }
 
-// Health checks the database connection health
+// Health checks the health of the primary and read replica connections
 func (db *Database) Health(ctx context.Context) error {
-	return db.Pool.Ping(ctx)
+	if err := db.Pool.Ping(ctx); err != nil {
+		return err
+	}
+	if db.ReadPool != db.Pool {
+		if err := db.ReadPool.Ping(ctx); err != nil {
+			return fmt.Errorf("read replica: %w", err)
+		}
+	}
+	return nil
 }
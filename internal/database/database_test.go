@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePinger fails until it has been pinged more than failures times
+type fakePinger struct {
+	failures int
+	calls    int
+}
+
+func (p *fakePinger) Ping(context.Context) error {
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int
+		retries       int
+		expectedCalls int
+		expectError   bool
+	}{
+		{name: "reachable", failures: 0, retries: 0, expectedCalls: 1},
+		{name: "fails fast without retries", failures: 1, retries: 0, expectedCalls: 1, expectError: true},
+		{name: "reachable after retries", failures: 2, retries: 3, expectedCalls: 3},
+		{name: "retries exhausted", failures: 5, retries: 2, expectedCalls: 3, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakePinger{failures: tt.failures}
+
+			err := ping(context.Background(), p, tt.retries, time.Millisecond, slog.New(slog.DiscardHandler))
+
+			assert.Equal(t, tt.expectError, err != nil)
+			assert.Equal(t, tt.expectedCalls, p.calls)
+		})
+	}
+}
+
+func TestPingStopsWhenContextEnds(t *testing.T) {
+	p := &fakePinger{failures: 5}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := ping(ctx, p, 3, time.Hour, slog.New(slog.DiscardHandler))
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, p.calls)
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrMaintenanceTooSoon is returned when maintenance is requested before
+// the minimum interval since the previous run has elapsed
+var ErrMaintenanceTooSoon = errors.New("maintenance ran too recently")
+
+// Execer runs SQL statements; *pgxpool.Pool implements it
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// Maintenance refreshes the planner statistics of the todos table, and
+// optionally reclaims dead rows, no more than once per interval
+type Maintenance struct {
+	db       Execer
+	vacuum   bool
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	lastRun time.Time
+}
+
+// NewMaintenance creates a Maintenance running VACUUM ANALYZE when vacuum
+// is true and ANALYZE otherwise. A zero interval allows back to back runs.
+func NewMaintenance(db Execer, vacuum bool, interval time.Duration, logger *slog.Logger) *Maintenance {
+	return &Maintenance{db: db, vacuum: vacuum, interval: interval, logger: logger}
+}
+
+// Run runs the maintenance command and returns it along with how long it
+// took. Concurrent calls wait for each other, so the interval also applies
+// to them.
+func (m *Maintenance) Run(ctx context.Context) (string, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.lastRun.IsZero() && time.Since(m.lastRun) < m.interval {
+		return "", 0, ErrMaintenanceTooSoon
+	}
+
+	command := "ANALYZE"
+	if m.vacuum {
+		command = "VACUUM ANALYZE"
+	}
+
+	start := time.Now()
+	if _, err := m.db.Exec(ctx, command+" todos"); err != nil {
+		return "", 0, fmt.Errorf("failed to run %s: %w", command, err)
+	}
+	duration := time.Since(start)
+	m.lastRun = time.Now()
+
+	m.logger.Info("database maintenance completed", "command", command, "duration", duration)
+	return command, duration, nil
+}
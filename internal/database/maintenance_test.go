@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingExecer records the statements it is asked to run
+type recordingExecer struct {
+	statements []string
+	err        error
+}
+
+func (e *recordingExecer) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	e.statements = append(e.statements, sql)
+	return pgconn.CommandTag{}, e.err
+}
+
+func TestMaintenance(t *testing.T) {
+	tests := []struct {
+		name              string
+		vacuum            bool
+		expectedCommand   string
+		expectedStatement string
+	}{
+		{name: "analyze only", vacuum: false, expectedCommand: "ANALYZE", expectedStatement: "ANALYZE todos"},
+		{name: "vacuum analyze", vacuum: true, expectedCommand: "VACUUM ANALYZE", expectedStatement: "VACUUM ANALYZE todos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &recordingExecer{}
+			m := NewMaintenance(db, tt.vacuum, 0, slog.New(slog.DiscardHandler))
+
+			command, _, err := m.Run(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCommand, command)
+			assert.Equal(t, []string{tt.expectedStatement}, db.statements)
+		})
+	}
+}
+
+func TestMaintenanceInterval(t *testing.T) {
+	db := &recordingExecer{}
+	m := NewMaintenance(db, false, time.Hour, slog.New(slog.DiscardHandler))
+
+	_, _, err := m.Run(context.Background())
+	require.NoError(t, err)
+
+	_, _, err = m.Run(context.Background())
+	assert.ErrorIs(t, err, ErrMaintenanceTooSoon)
+	assert.Len(t, db.statements, 1)
+}
+
+func TestMaintenanceFailureDoesNotStartInterval(t *testing.T) {
+	db := &recordingExecer{err: errors.New("connection refused")}
+	m := NewMaintenance(db, false, time.Hour, slog.New(slog.DiscardHandler))
+
+	_, _, err := m.Run(context.Background())
+	assert.Error(t, err)
+
+	db.err = nil
+	_, _, err = m.Run(context.Background())
+	assert.NoError(t, err)
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// queryStartKey is the context key of the queryStart of a traced query
+type queryStartKey struct{}
+
+// queryStart records a query until it ends
+type queryStart struct {
+	sql   string
+	args  int
+	start time.Time
+}
+
+// QueryLogger is a pgx.QueryTracer logging every SQL query with its
+// duration at debug level. Only the number of arguments is logged, never
+// their values, which may hold user data.
+type QueryLogger struct {
+	logger *slog.Logger
+}
+
+// NewQueryLogger creates a QueryLogger writing to logger
+func NewQueryLogger(logger *slog.Logger) *QueryLogger {
+	return &QueryLogger{logger: logger}
+}
+
+// TraceQueryStart remembers the query and when it started
+func (l *QueryLogger) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{
+		sql:   data.SQL,
+		args:  len(data.Args),
+		start: time.Now(),
+	})
+}
+
+// TraceQueryEnd logs the query started in ctx and how long it took
+func (l *QueryLogger) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	query, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("sql", query.sql),
+		slog.Int("args", query.args),
+		slog.Duration("duration", time.Since(query.start)),
+	}
+	if data.Err != nil {
+		attrs = append(attrs, slog.String("error", data.Err.Error()))
+	}
+	l.logger.LogAttrs(ctx, slog.LevelDebug, "sql query", attrs...)
+}
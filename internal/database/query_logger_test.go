@@ -0,0 +1,43 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	queryLogger := NewQueryLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	ctx := queryLogger.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+		SQL:  "SELECT * FROM todos WHERE owner_id = $1 AND title = $2",
+		Args: []any{"alice", "secret title"},
+	})
+	queryLogger.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "DEBUG", record["level"])
+	assert.Equal(t, "sql query", record["msg"])
+	assert.Equal(t, "SELECT * FROM todos WHERE owner_id = $1 AND title = $2", record["sql"])
+	assert.InDelta(t, 2, record["args"], 0)
+	assert.Contains(t, record, "duration")
+	assert.Equal(t, "boom", record["error"])
+	assert.NotContains(t, buf.String(), "secret title")
+}
+
+func TestQueryLogger_WithoutStart(t *testing.T) {
+	var buf bytes.Buffer
+	queryLogger := NewQueryLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	queryLogger.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{})
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,99 @@
+package dto
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/g3offrey/idiomapi/internal/model"
+)
+
+// FieldConstraint describes the validation rules of a request field
+type FieldConstraint struct {
+	Field    string   `json:"field"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Min      *int     `json:"min,omitempty"`
+	Max      *int     `json:"max,omitempty"`
+	Enum     []string `json:"enum,omitempty"`
+}
+
+// OptionsResponse describes the methods and request constraints of a resource
+type OptionsResponse struct {
+	Methods []string          `json:"methods"`
+	Create  []FieldConstraint `json:"create"`
+	Update  []FieldConstraint `json:"update"`
+}
+
+// Constraints derives field constraints from the json and binding tags of
+// the request struct obj
+func Constraints(obj any) []FieldConstraint {
+	t := reflect.TypeOf(obj)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	constraints := make([]FieldConstraint, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		constraint := FieldConstraint{
+			Field: name,
+			Type:  jsonType(field.Type),
+		}
+		for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+			key, value, _ := strings.Cut(rule, "=")
+			switch key {
+			case "required":
+				constraint.Required = true
+			case "min":
+				constraint.Min = parseLimit(value)
+			case "max":
+				constraint.Max = parseLimit(value)
+			case "priority":
+				for _, p := range model.Priorities {
+					constraint.Enum = append(constraint.Enum, string(p))
+				}
+			}
+		}
+		constraints = append(constraints, constraint)
+	}
+
+	return constraints
+}
+
+// jsonType returns the JSON type name for a Go type
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// parseLimit parses a numeric binding parameter, returning nil if invalid
+func parseLimit(value string) *int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"testing"
+
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstraints(t *testing.T) {
+	constraints := Constraints(&CreateTodoRequest{})
+
+	assert.Len(t, constraints, 4)
+
+	assert.Equal(t, "title", constraints[0].Field)
+	assert.Equal(t, "string", constraints[0].Type)
+	assert.True(t, constraints[0].Required)
+	assert.Equal(t, 1, *constraints[0].Min)
+	assert.Equal(t, 255, *constraints[0].Max)
+
+	assert.Equal(t, "description", constraints[1].Field)
+	assert.False(t, constraints[1].Required)
+	assert.Nil(t, constraints[1].Min)
+	assert.Equal(t, 1000, *constraints[1].Max)
+
+	assert.Equal(t, "completed", constraints[2].Field)
+	assert.Equal(t, "boolean", constraints[2].Type)
+	assert.False(t, constraints[2].Required)
+
+	assert.Equal(t, "priority", constraints[3].Field)
+	assert.False(t, constraints[3].Required)
+	assert.Equal(t, []string{"low", "medium", "high"}, constraints[3].Enum)
+}
+
+func TestConstraintsMatchModelLengths(t *testing.T) {
+	// Struct tags cannot reference constants, so this keeps both in sync
+	for _, req := range []any{&CreateTodoRequest{}, &UpdateTodoRequest{}} {
+		constraints := Constraints(req)
+		assert.Equal(t, model.MaxTitleLength, *constraints[0].Max)
+		assert.Equal(t, model.MaxDescriptionLength, *constraints[1].Max)
+	}
+}
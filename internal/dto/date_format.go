@@ -0,0 +1,66 @@
+package dto
+
+import "time"
+
+// DateFormats lists the layouts clients may request through date_format.
+// Only these names are accepted so callers cannot inject arbitrary layouts.
+var DateFormats = map[string]string{
+	"rfc3339":  time.RFC3339,
+	"rfc1123":  time.RFC1123,
+	"date":     time.DateOnly,
+	"datetime": time.DateTime,
+	"us":       "01/02/2006 03:04 PM",
+	"eu":       "02/01/2006 15:04",
+}
+
+// DateFormat renders timestamps with a layout in a time zone
+type DateFormat struct {
+	Layout   string
+	Location *time.Location
+}
+
+// Format renders t in the layout and time zone of f
+func (f DateFormat) Format(t time.Time) string {
+	return t.In(f.Location).Format(f.Layout)
+}
+
+// LocalizedTodoResponse is a TodoResponse whose timestamps are rendered as
+// formatted strings
+type LocalizedTodoResponse struct {
+	TodoResponse
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+
+	// ArchivedAt shadows the archive time of TodoResponse, empty while
+	// the todo is not archived
+	ArchivedAt string `json:"archived_at,omitempty"`
+}
+
+// LocalizedTodoListResponse is a TodoListResponse whose todos have
+// formatted timestamps
+type LocalizedTodoListResponse struct {
+	TodoListResponse
+	Todos []LocalizedTodoResponse `json:"todos"`
+}
+
+// Localize renders the timestamps of r with format
+func (r TodoResponse) Localize(format DateFormat) LocalizedTodoResponse {
+	localized := LocalizedTodoResponse{
+		TodoResponse: r,
+		CreatedAt:    format.Format(r.CreatedAt),
+		UpdatedAt:    format.Format(r.UpdatedAt),
+	}
+	if r.ArchivedAt != nil {
+		localized.ArchivedAt = format.Format(*r.ArchivedAt)
+	}
+	return localized
+}
+
+// Localize renders the timestamps of every todo in r with format
+func (r TodoListResponse) Localize(format DateFormat) LocalizedTodoListResponse {
+	todos := make([]LocalizedTodoResponse, len(r.Todos))
+	for i, todo := range r.Todos {
+		todos[i] = todo.Localize(format)
+	}
+	return LocalizedTodoListResponse{TodoListResponse: r, Todos: todos}
+}
@@ -0,0 +1,68 @@
+package dto
+
+import "encoding/json"
+
+// TodoFields lists the todo fields clients may select through fields
+var TodoFields = []string{"id", "title", "description", "completed", "priority", "position", "created_at", "updated_at", "external_id", "archived_at"}
+
+// linksField is kept by FieldSet.Select since links are requested on
+// their own with ?links=true
+const linksField = "_links"
+
+// FieldSet is the set of todo fields a client selected, nil when it did not
+// restrict them
+type FieldSet map[string]bool
+
+// Select returns todo, a TodoResponse or LocalizedTodoResponse, as a JSON
+// object holding only the fields of s
+func (s FieldSet) Select(todo any) (map[string]json.RawMessage, error) {
+	object, err := toObject(todo)
+	if err != nil {
+		return nil, err
+	}
+	for name := range object {
+		if !s[name] && name != linksField {
+			delete(object, name)
+		}
+	}
+	return object, nil
+}
+
+// SelectList returns list, a TodoListResponse or LocalizedTodoListResponse,
+// as a JSON object whose todos hold only the fields of s
+func (s FieldSet) SelectList(list any) (map[string]json.RawMessage, error) {
+	object, err := toObject(list)
+	if err != nil {
+		return nil, err
+	}
+
+	var todos []json.RawMessage
+	if err := json.Unmarshal(object["todos"], &todos); err != nil {
+		return nil, err
+	}
+	selected := make([]map[string]json.RawMessage, len(todos))
+	for i, todo := range todos {
+		if selected[i], err = s.Select(todo); err != nil {
+			return nil, err
+		}
+	}
+
+	if object["todos"], err = json.Marshal(selected); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// toObject encodes v, which must encode as a JSON object, and decodes it
+// back keyed by field name
+func toObject(v any) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
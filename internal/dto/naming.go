@@ -0,0 +1,79 @@
+package dto
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Naming is the case of the keys of JSON responses
+type Naming string
+
+const (
+	// NamingSnake keeps the snake_case keys of the json tags
+	NamingSnake Naming = "snake"
+
+	// NamingCamel renames keys to camelCase, created_at becoming createdAt
+	NamingCamel Naming = "camel"
+)
+
+// Apply returns v with its keys, at any depth, in the case of n. Snake case
+// returns v untouched since the json tags already use it.
+func (n Naming) Apply(v any) (any, error) {
+	if n != NamingCamel {
+		return v, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return camelKeys(data)
+}
+
+// camelKeys renames the keys of the objects in data to camelCase
+func camelKeys(data json.RawMessage) (json.RawMessage, error) {
+	switch trimmed := bytes.TrimSpace(data); {
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &object); err != nil {
+			return nil, err
+		}
+		renamed := make(map[string]json.RawMessage, len(object))
+		for key, value := range object {
+			value, err := camelKeys(value)
+			if err != nil {
+				return nil, err
+			}
+			renamed[camelCase(key)] = value
+		}
+		return json.Marshal(renamed)
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+		for i, item := range items {
+			var err error
+			if items[i], err = camelKeys(item); err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(items)
+	default:
+		return data, nil
+	}
+}
+
+// camelCase converts a snake_case key. Leading underscores are kept, so
+// _links stays as is.
+func camelCase(key string) string {
+	name := strings.TrimLeft(key, "_")
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return key[:len(key)-len(name)] + strings.Join(parts, "")
+}
@@ -1,29 +1,115 @@
 package dto
 
-import "time"
+import (
+	"strings"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/model"
+)
 
 // CreateTodoRequest represents the request body for creating a todo
 type CreateTodoRequest struct {
-	Title       string `json:"title" binding:"required,min=1,max=255"`
-	Description string `json:"description" binding:"max=1000"`
-	Completed   bool   `json:"completed"`
+	Title       string         `json:"title" binding:"required,min=1,max=255"`
+	Description string         `json:"description" binding:"max=1000"`
+	Completed   bool           `json:"completed"`
+	Priority    model.Priority `json:"priority" binding:"omitempty,priority"`
 }
 
 // UpdateTodoRequest represents the request body for updating a todo
 type UpdateTodoRequest struct {
-	Title       *string `json:"title" binding:"omitempty,min=1,max=255"`
-	Description *string `json:"description" binding:"omitempty,max=1000"`
-	Completed   *bool   `json:"completed"`
+	Title       *string         `json:"title" binding:"omitempty,min=1,max=255"`
+	Description *string         `json:"description" binding:"omitempty,max=1000"`
+	Completed   *bool           `json:"completed"`
+	Priority    *model.Priority `json:"priority" binding:"omitempty,priority"`
+}
+
+// IsEmpty reports whether the request sets none of the updatable fields
+func (r UpdateTodoRequest) IsEmpty() bool {
+	return r.Title == nil && r.Description == nil && r.Completed == nil && r.Priority == nil
+}
+
+// Validate checks the business rules binding tags cannot express and
+// returns a field error for each one the request breaks
+func (r CreateTodoRequest) Validate() []FieldError {
+	return validateTexts(r.Title, r.Description)
+}
+
+// Validate checks the business rules binding tags cannot express and
+// returns a field error for each one the request breaks. Rules spanning
+// several fields only apply when the request sets all of them.
+func (r UpdateTodoRequest) Validate() []FieldError {
+	if r.Title == nil || r.Description == nil {
+		return nil
+	}
+	return validateTexts(*r.Title, *r.Description)
+}
+
+// validateTexts requires a description that does more than repeat the title
+func validateTexts(title, description string) []FieldError {
+	if description != "" && strings.EqualFold(strings.TrimSpace(title), strings.TrimSpace(description)) {
+		return []FieldError{{Field: "description", Rule: "nefield", Message: "description must differ from title"}}
+	}
+	return nil
+}
+
+// BulkDeleteRequest represents the optional request body for deleting todos
+// by ID. The number of IDs is capped by limits.max_ids_per_request.
+type BulkDeleteRequest struct {
+	IDs []int `json:"ids" binding:"required,min=1"`
+}
+
+// BatchGetRequest lists the IDs of the todos to fetch at once. Their number
+// is capped by limits.max_batch_size.
+type BatchGetRequest struct {
+	IDs []int `json:"ids" binding:"required,min=1"`
+}
+
+// ReorderTodosRequest lists todo IDs in the manual order to give them. Its
+// size is capped by limits.max_ids_per_request.
+type ReorderTodosRequest struct {
+	IDs []int `json:"ids" binding:"required,min=1,unique"`
+}
+
+// BatchGetResponse holds the requested todos that were found, in the order
+// of their IDs in the request
+type BatchGetResponse struct {
+	Todos []TodoResponse `json:"todos"`
+}
+
+// BulkDeleteResponse reports how many todos a bulk delete removed
+type BulkDeleteResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// BulkUpdateResponse reports how many todos a bulk update changed
+type BulkUpdateResponse struct {
+	Updated int64 `json:"updated"`
+}
+
+// DryRunResponse reports how many todos a bulk operation run with
+// dry_run=true would have changed
+type DryRunResponse struct {
+	WouldAffect int64 `json:"would_affect"`
 }
 
 // TodoResponse represents a todo item in API responses
 type TodoResponse struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Completed   bool      `json:"completed"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Completed   bool       `json:"completed"`
+	Priority    string     `json:"priority"`
+	Position    int        `json:"position"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	ExternalID  string     `json:"external_id,omitempty"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
+	Links       *TodoLinks `json:"_links,omitempty"`
+}
+
+// TodoLinks holds the URLs of a todo and the resources related to it
+type TodoLinks struct {
+	Self string `json:"self"`
 }
 
 // TodoListResponse represents a paginated list of todos
@@ -35,8 +121,195 @@ type TodoListResponse struct {
 	TotalPages int            `json:"total_pages"`
 }
 
+// CompactTodoResponse carries only the fields list pollers need, for
+// GET /api/v1/todos?view=compact
+type CompactTodoResponse struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Completed bool      `json:"completed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CompactTodoListResponse is a TodoListResponse of compact todos
+type CompactTodoListResponse struct {
+	Todos      []CompactTodoResponse `json:"todos"`
+	Total      int                   `json:"total"`
+	Page       int                   `json:"page"`
+	PageSize   int                   `json:"page_size"`
+	TotalPages int                   `json:"total_pages"`
+}
+
+// VersionResponse carries the token clients poll to detect changes to the
+// todo collection
+type VersionResponse struct {
+	Version string `json:"version"`
+}
+
+// WeekdayCount is the number of todos created on one day of the week
+type WeekdayCount struct {
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+// WeekdayStatsResponse breaks down todo creation by day of the week, from
+// Sunday to Saturday
+type WeekdayStatsResponse struct {
+	Timezone string         `json:"timezone"`
+	Days     []WeekdayCount `json:"days"`
+}
+
+// CompletionTimeResponse reports the average time completed todos took
+// from creation to completion. AverageSeconds is null when no todo was
+// completed.
+type CompletionTimeResponse struct {
+	Count          int      `json:"count"`
+	AverageSeconds *float64 `json:"average_seconds"`
+}
+
+// MaintenanceResponse reports the database maintenance command that ran
+// and how long it took
+type MaintenanceResponse struct {
+	Command    string `json:"command"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// LogLevelRequest is the level to switch logging to
+type LogLevelRequest struct {
+	Level string `json:"level" binding:"required"`
+}
+
+// LogLevelResponse reports the current logging level
+type LogLevelResponse struct {
+	Level string `json:"level"`
+}
+
+// RegisterRequest is the email and password of a new user. Passwords are
+// capped at 72 bytes, the most bcrypt hashes.
+type RegisterRequest struct {
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// LoginRequest is the email and password of a registered user
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// UserResponse represents a registered user in API responses
+type UserResponse struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TokenResponse holds a short-lived bearer token to send in the
+// Authorization header of todo requests, and the refresh token getting the
+// next one
+type TokenResponse struct {
+	AccessToken      string    `json:"access_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// RefreshRequest holds the refresh token of a session, to refresh or end
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// CreateAPIKeyRequest names a new API key and lists the scopes it grants
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=255"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=todos:read todos:write"`
+}
+
+// APIKeyResponse represents an API key in API responses, without its
+// secret
+type APIKeyResponse struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreatedAPIKeyResponse is an API key along with its secret, only returned
+// when the key is created
+type CreatedAPIKeyResponse struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	Key       string    `json:"key"`
+}
+
+// APIKeyListResponse lists the API keys of a user
+type APIKeyListResponse struct {
+	APIKeys []APIKeyResponse `json:"api_keys"`
+}
+
+// AuditEventResponse is a recorded change. Before is null for creations
+// and after for deletions; hash covers the event and prev_hash, the hash
+// of the event before it.
+type AuditEventResponse struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Entity    string    `json:"entity"`
+	EntityID  string    `json:"entity_id"`
+	Before    any       `json:"before"`
+	After     any       `json:"after"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// AuditEventListResponse is a page of audit events, oldest first.
+// NextAfterID is the after_id of the next page when this one is full.
+type AuditEventListResponse struct {
+	Events      []AuditEventResponse `json:"events"`
+	NextAfterID *int64               `json:"next_after_id,omitempty"`
+}
+
+// AuditVerificationResponse reports whether the hash chain of the audit
+// events is intact, or the first event that breaks it
+type AuditVerificationResponse struct {
+	Valid          bool   `json:"valid"`
+	Events         int    `json:"events"`
+	FirstInvalidID *int64 `json:"first_invalid_id,omitempty"`
+}
+
+// ExportJobResponse is an archive of the data of a user being built in
+// the background. DownloadURL is set once its status is ready.
+type ExportJobResponse struct {
+	ID          string    `json:"id"`
+	Status      string    `json:"status"`
+	Format      string    `json:"format"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	DownloadURL string    `json:"download_url,omitempty"`
+}
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message,omitempty"`
 }
+
+// FieldError describes a single request field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse represents a validation error with field-level detail
+type ValidationErrorResponse struct {
+	Error   string       `json:"error"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields"`
+}
@@ -3,6 +3,7 @@ package dto
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -48,6 +49,18 @@ func TestUpdateTodoRequestJSON(t *testing.T) {
 	assert.Equal(t, completed, *decoded.Completed)
 }
 
+func TestTodoRequestValidate(t *testing.T) {
+	assert.Empty(t, CreateTodoRequest{Title: "Buy milk", Description: "Two liters"}.Validate())
+	assert.Empty(t, CreateTodoRequest{Title: "Buy milk"}.Validate())
+
+	fields := CreateTodoRequest{Title: "Buy milk", Description: " buy MILK "}.Validate()
+	assert.Equal(t, []FieldError{{Field: "description", Rule: "nefield", Message: "description must differ from title"}}, fields)
+
+	title, description := "Buy milk", "Buy milk"
+	assert.Len(t, UpdateTodoRequest{Title: &title, Description: &description}.Validate(), 1)
+	assert.Empty(t, UpdateTodoRequest{Description: &description}.Validate())
+}
+
 func TestTodoResponseJSON(t *testing.T) {
 	response := TodoResponse{
 		ID:          1,
@@ -109,3 +122,107 @@ func TestErrorResponseJSON(t *testing.T) {
 	assert.Equal(t, response.Error, decoded.Error)
 	assert.Equal(t, response.Message, decoded.Message)
 }
+
+func TestTodoResponseOmitsEmptyDescription(t *testing.T) {
+	data, err := json.Marshal(TodoResponse{ID: 1, Title: "Test"})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "description")
+}
+
+func TestNamingApply(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	list := TodoListResponse{
+		Todos: []TodoResponse{{
+			ID:        1,
+			Title:     "Test",
+			Priority:  "medium",
+			Position:  1,
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+			Links:     &TodoLinks{Self: "/api/v1/todos/1"},
+		}},
+		Total:      1,
+		Page:       1,
+		PageSize:   10,
+		TotalPages: 1,
+	}
+
+	tests := []struct {
+		name     string
+		naming   Naming
+		body     any
+		expected string
+	}{
+		{
+			name:     "snake list",
+			naming:   NamingSnake,
+			body:     list,
+			expected: `{"todos":[{"id":1,"title":"Test","completed":false,"priority":"medium","position":1,"created_at":"2024-01-02T03:04:05Z","updated_at":"2024-01-02T03:04:05Z","_links":{"self":"/api/v1/todos/1"}}],"total":1,"page":1,"page_size":10,"total_pages":1}`,
+		},
+		{
+			name:     "camel list",
+			naming:   NamingCamel,
+			body:     list,
+			expected: `{"todos":[{"id":1,"title":"Test","completed":false,"priority":"medium","position":1,"createdAt":"2024-01-02T03:04:05Z","updatedAt":"2024-01-02T03:04:05Z","_links":{"self":"/api/v1/todos/1"}}],"total":1,"page":1,"pageSize":10,"totalPages":1}`,
+		},
+		{
+			name:     "camel todo",
+			naming:   NamingCamel,
+			body:     list.Todos[0],
+			expected: `{"id":1,"title":"Test","completed":false,"priority":"medium","position":1,"createdAt":"2024-01-02T03:04:05Z","updatedAt":"2024-01-02T03:04:05Z","_links":{"self":"/api/v1/todos/1"}}`,
+		},
+		{
+			name:     "snake error",
+			naming:   NamingSnake,
+			body:     ErrorResponse{Error: "not_found", Message: "Todo not found"},
+			expected: `{"error":"not_found","message":"Todo not found"}`,
+		},
+		{
+			name:     "camel error",
+			naming:   NamingCamel,
+			body:     ErrorResponse{Error: "not_found", Message: "Todo not found"},
+			expected: `{"error":"not_found","message":"Todo not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := tt.naming.Apply(tt.body)
+			assert.NoError(t, err)
+
+			data, err := json.Marshal(body)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(data))
+		})
+	}
+}
+
+func TestFieldSetSelect(t *testing.T) {
+	set := FieldSet{"id": true, "title": true}
+
+	todo, err := set.Select(TodoResponse{ID: 1, Title: "Test", Description: "Skipped", Links: &TodoLinks{Self: "/api/v1/todos/1"}})
+	assert.NoError(t, err)
+	data, err := json.Marshal(todo)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":1,"title":"Test","_links":{"self":"/api/v1/todos/1"}}`, string(data))
+
+	list, err := set.SelectList(TodoListResponse{Todos: []TodoResponse{{ID: 1, Title: "Test", Description: "Skipped"}}, Total: 1, Page: 1, PageSize: 10, TotalPages: 1})
+	assert.NoError(t, err)
+	data, err = json.Marshal(list)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"todos":[{"id":1,"title":"Test"}],"total":1,"page":1,"page_size":10,"total_pages":1}`, string(data))
+}
+
+func TestTodoFieldsMatchTodoResponse(t *testing.T) {
+	// Empty descriptions, external IDs and archive times are omitted
+	archivedAt := time.Now()
+	data, err := json.Marshal(TodoResponse{Description: "Test", ExternalID: "ext-1", ArchivedAt: &archivedAt})
+	assert.NoError(t, err)
+
+	var object map[string]any
+	assert.NoError(t, json.Unmarshal(data, &object))
+	for _, name := range TodoFields {
+		assert.Contains(t, object, name)
+	}
+	assert.Len(t, object, len(TodoFields))
+}
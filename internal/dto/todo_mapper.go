@@ -1,17 +1,29 @@
 package dto
 
-import "github.com/g3offrey/idiomapi/internal/model"
+import (
+	"strings"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/model"
+)
 
 // ToTodoResponse converts a domain Todo to a TodoResponse DTO
 func ToTodoResponse(todo *model.Todo) TodoResponse {
-	return TodoResponse{
+	response := TodoResponse{
 		ID:          todo.ID,
 		Title:       todo.Title,
 		Description: todo.Description,
 		Completed:   todo.Completed,
+		Priority:    string(todo.Priority),
+		Position:    todo.Position,
 		CreatedAt:   todo.CreatedAt,
 		UpdatedAt:   todo.UpdatedAt,
+		ArchivedAt:  todo.ArchivedAt,
+	}
+	if todo.ExternalID != nil {
+		response.ExternalID = *todo.ExternalID
 	}
+	return response
 }
 
 // ToTodoResponseList converts a slice of domain Todos to TodoResponse DTOs
@@ -38,3 +50,55 @@ func ToTodoListResponse(todos []model.Todo, total, page, pageSize int) TodoListR
 		TotalPages: totalPages,
 	}
 }
+
+// ToCompletionTimeResponse converts the average completion time of count
+// todos to a CompletionTimeResponse DTO
+func ToCompletionTimeResponse(average time.Duration, count int) CompletionTimeResponse {
+	response := CompletionTimeResponse{Count: count}
+	if count > 0 {
+		seconds := average.Seconds()
+		response.AverageSeconds = &seconds
+	}
+	return response
+}
+
+// ToCompactTodoListResponse converts domain data to a
+// CompactTodoListResponse DTO
+func ToCompactTodoListResponse(todos []model.Todo, total, page, pageSize int) CompactTodoListResponse {
+	list := ToTodoListResponse(nil, total, page, pageSize)
+
+	compact := make([]CompactTodoResponse, len(todos))
+	for i, todo := range todos {
+		compact[i] = CompactTodoResponse{
+			ID:        todo.ID,
+			Title:     todo.Title,
+			Completed: todo.Completed,
+			UpdatedAt: todo.UpdatedAt,
+		}
+	}
+
+	return CompactTodoListResponse{
+		Todos:      compact,
+		Total:      list.Total,
+		Page:       list.Page,
+		PageSize:   list.PageSize,
+		TotalPages: list.TotalPages,
+	}
+}
+
+// ToWeekdayStatsResponse converts per weekday counts, indexed by
+// time.Weekday, to a WeekdayStatsResponse DTO
+func ToWeekdayStatsResponse(counts [7]int, loc *time.Location) WeekdayStatsResponse {
+	days := make([]WeekdayCount, len(counts))
+	for day, count := range counts {
+		days[day] = WeekdayCount{
+			Day:   strings.ToLower(time.Weekday(day).String()),
+			Count: count,
+		}
+	}
+
+	return WeekdayStatsResponse{
+		Timezone: loc.String(),
+		Days:     days,
+	}
+}
@@ -0,0 +1,140 @@
+// Package events fans out todo changes, in process, to the clients
+// streaming them.
+package events
+
+import (
+	"sync"
+
+	"github.com/g3offrey/idiomapi/internal/model"
+)
+
+// Types of the events published for todo changes
+const (
+	TodoCreated = "todo.created"
+	TodoUpdated = "todo.updated"
+	TodoDeleted = "todo.deleted"
+
+	// TodosChanged is published once for a bulk operation changing several
+	// todos at once. Subscribers should refetch the todos they show.
+	TodosChanged = "todos.changed"
+)
+
+// Bulk operations reported by TodosChanged events
+const (
+	OperationCompleteAll = "complete_all"
+	OperationReorder     = "reorder"
+	OperationDelete      = "delete"
+)
+
+// defaultBufferSize is used when NewHub is given a size below 1
+const defaultBufferSize = 16
+
+// Event is a change to a todo
+type Event struct {
+	Type    string
+	OwnerID string
+	TodoID  int
+
+	// Todo is the todo after the change, nil for deletions and bulk
+	// changes
+	Todo *model.Todo
+
+	// Operation and Count are the bulk operation of a TodosChanged event
+	// and how many todos it changed
+	Operation string
+	Count     int64
+}
+
+// subscriber receives the events of one owner
+type subscriber struct {
+	ownerID string
+	ch      chan Event
+}
+
+// Hub delivers published events to the subscribers of their owner. A nil
+// Hub discards every event.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	bufferSize  int
+	closed      bool
+}
+
+// NewHub creates a Hub buffering up to bufferSize events per subscriber
+func NewHub(bufferSize int) *Hub {
+	if bufferSize < 1 {
+		bufferSize = defaultBufferSize
+	}
+	return &Hub{subscribers: make(map[*subscriber]struct{}), bufferSize: bufferSize}
+}
+
+// Subscribe returns a channel receiving the events of the todos of ownerID
+// and a function ending the subscription. The channel is closed when the
+// subscription ends, which also happens when the subscriber falls a whole
+// buffer behind, or when the Hub is closed.
+func (h *Hub) Subscribe(ownerID string) (<-chan Event, func()) {
+	s := &subscriber{ownerID: ownerID, ch: make(chan Event, h.bufferSize)}
+
+	h.mu.Lock()
+	if h.closed {
+		close(s.ch)
+	} else {
+		h.subscribers[s] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	return s.ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(s)
+	}
+}
+
+// Publish delivers e to the subscribers of its owner without blocking.
+// Subscribers whose buffer is full are dropped.
+func (h *Hub) Publish(e Event) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subscribers {
+		if s.ownerID != e.OwnerID {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Close ends every subscription, and those made afterwards right away, so
+// the streams reading them finish
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for s := range h.subscribers {
+		h.remove(s)
+	}
+}
+
+// Subscribers returns the number of active subscriptions
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// remove ends the subscription of s once. h.mu must be held.
+func (h *Hub) remove(s *subscriber) {
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.ch)
+	}
+}
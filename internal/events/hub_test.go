@@ -0,0 +1,84 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub_Publish(t *testing.T) {
+	t.Run("delivers to the subscribers of the owner", func(t *testing.T) {
+		h := NewHub(4)
+		alice, unsubscribeAlice := h.Subscribe("alice")
+		defer unsubscribeAlice()
+		bob, unsubscribeBob := h.Subscribe("bob")
+		defer unsubscribeBob()
+
+		h.Publish(Event{Type: TodoDeleted, OwnerID: "alice", TodoID: 1})
+
+		assert.Equal(t, Event{Type: TodoDeleted, OwnerID: "alice", TodoID: 1}, <-alice)
+		assert.Empty(t, bob)
+	})
+
+	t.Run("delivers bulk changes to the subscribers of the owner", func(t *testing.T) {
+		h := NewHub(4)
+		alice, unsubscribeAlice := h.Subscribe("alice")
+		defer unsubscribeAlice()
+		bob, unsubscribeBob := h.Subscribe("bob")
+		defer unsubscribeBob()
+
+		e := Event{Type: TodosChanged, OwnerID: "alice", Operation: OperationDelete, Count: 3}
+		h.Publish(e)
+
+		assert.Equal(t, e, <-alice)
+		assert.Empty(t, bob)
+	})
+
+	t.Run("unsubscribe closes the channel", func(t *testing.T) {
+		h := NewHub(4)
+		ch, unsubscribe := h.Subscribe("alice")
+
+		unsubscribe()
+		unsubscribe()
+
+		_, ok := <-ch
+		assert.False(t, ok)
+		assert.Equal(t, 0, h.Subscribers())
+		h.Publish(Event{Type: TodoDeleted, OwnerID: "alice", TodoID: 1})
+	})
+
+	t.Run("drops subscribers with a full buffer", func(t *testing.T) {
+		h := NewHub(1)
+		ch, unsubscribe := h.Subscribe("alice")
+		defer unsubscribe()
+
+		h.Publish(Event{Type: TodoDeleted, OwnerID: "alice", TodoID: 1})
+		h.Publish(Event{Type: TodoDeleted, OwnerID: "alice", TodoID: 2})
+
+		assert.Equal(t, 1, (<-ch).TodoID)
+		_, ok := <-ch
+		assert.False(t, ok)
+		assert.Equal(t, 0, h.Subscribers())
+	})
+
+	t.Run("close ends every subscription", func(t *testing.T) {
+		h := NewHub(4)
+		ch, unsubscribe := h.Subscribe("alice")
+		defer unsubscribe()
+
+		h.Close()
+
+		_, ok := <-ch
+		assert.False(t, ok)
+		late, unsubscribeLate := h.Subscribe("alice")
+		defer unsubscribeLate()
+		_, ok = <-late
+		assert.False(t, ok)
+		assert.Equal(t, 0, h.Subscribers())
+	})
+
+	t.Run("nil hub discards events", func(t *testing.T) {
+		var h *Hub
+		h.Publish(Event{Type: TodoDeleted, OwnerID: "alice", TodoID: 1})
+	})
+}
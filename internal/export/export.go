@@ -0,0 +1,213 @@
+// Package export builds the archive of every piece of data a user has, for
+// data portability requests, as a JSON document or a ZIP of JSON files.
+// Archives are written as the data is read, so they are never held in
+// memory.
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/audit"
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/g3offrey/idiomapi/internal/repository"
+)
+
+// Archive formats
+const (
+	FormatJSON = "json"
+	FormatZIP  = "zip"
+)
+
+// activityPageSize is how many audit events are read at a time
+const activityPageSize = 1000
+
+// TodoSource streams the todos of the user in the context
+type TodoSource interface {
+	ExportTodos(ctx context.Context, filter repository.ListFilter, fn func(model.Todo) error) error
+}
+
+// ActivitySource lists the recorded changes
+type ActivitySource interface {
+	List(ctx context.Context, filter audit.Filter) ([]audit.Event, error)
+}
+
+// Exporter writes the archive of the user in the context
+type Exporter struct {
+	todos    TodoSource
+	activity ActivitySource
+	now      func() time.Time
+}
+
+// NewExporter creates a new Exporter archiving the todos of todos and, when
+// activity is not nil, the changes the user made
+func NewExporter(todos TodoSource, activity ActivitySource) *Exporter {
+	return &Exporter{todos: todos, activity: activity, now: time.Now}
+}
+
+// account is the part of an archive describing the user
+type account struct {
+	UserID     string    `json:"user_id"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// Write writes the archive of the user in ctx to w in format, FormatJSON
+// or FormatZIP
+func (e *Exporter) Write(ctx context.Context, w io.Writer, format string) error {
+	userID, _ := owner.FromContext(ctx)
+	acct := account{UserID: userID, ExportedAt: e.now().UTC()}
+
+	switch format {
+	case FormatJSON:
+		return e.writeJSON(ctx, w, acct)
+	case FormatZIP:
+		return e.writeZIP(ctx, w, acct)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// writeJSON writes a single document with the account fields along with
+// the todos and activity arrays
+func (e *Exporter) writeJSON(ctx context.Context, w io.Writer, acct account) error {
+	head, err := json.Marshal(acct)
+	if err != nil {
+		return err
+	}
+	// Reopen the account object to append the arrays to it
+	if _, err := w.Write(head[:len(head)-1]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"todos":`); err != nil {
+		return err
+	}
+	if err := e.writeTodos(ctx, w); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"activity":`); err != nil {
+		return err
+	}
+	if err := e.writeActivity(ctx, w, acct.UserID); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
+
+// writeZIP writes account.json, todos.json and activity.json in a ZIP
+func (e *Exporter) writeZIP(ctx context.Context, w io.Writer, acct account) error {
+	zw := zip.NewWriter(w)
+	entries := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"account.json", func(w io.Writer) error { return json.NewEncoder(w).Encode(acct) }},
+		{"todos.json", func(w io.Writer) error { return e.writeTodos(ctx, w) }},
+		{"activity.json", func(w io.Writer) error { return e.writeActivity(ctx, w, acct.UserID) }},
+	}
+	for _, entry := range entries {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: acct.ExportedAt})
+		if err != nil {
+			return err
+		}
+		if err := entry.write(f); err != nil {
+			return fmt.Errorf("failed to write %s: %w", entry.name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// writeTodos writes every todo of the user in ctx, archived ones
+// included, as a JSON array
+func (e *Exporter) writeTodos(ctx context.Context, w io.Writer) error {
+	array := newArrayWriter(w)
+	err := e.todos.ExportTodos(ctx, repository.ListFilter{IncludeArchived: true}, func(todo model.Todo) error {
+		return array.write(dto.ToTodoResponse(&todo))
+	})
+	if err != nil {
+		return err
+	}
+	return array.close()
+}
+
+// writeActivity writes the changes userID made as a JSON array, empty
+// without an ActivitySource
+func (e *Exporter) writeActivity(ctx context.Context, w io.Writer, userID string) error {
+	array := newArrayWriter(w)
+	filter := audit.Filter{Actor: userID, Limit: activityPageSize}
+	for e.activity != nil {
+		events, err := e.activity.List(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			err := array.write(dto.AuditEventResponse{
+				ID:        event.ID,
+				Actor:     event.Actor,
+				Action:    event.Action,
+				Entity:    event.Entity,
+				EntityID:  event.EntityID,
+				Before:    event.Before,
+				After:     event.After,
+				IP:        event.IP,
+				CreatedAt: event.CreatedAt,
+				PrevHash:  hex.EncodeToString(event.PrevHash),
+				Hash:      hex.EncodeToString(event.Hash),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(events) < filter.Limit {
+			break
+		}
+		filter.AfterID = events[len(events)-1].ID
+	}
+	return array.close()
+}
+
+// arrayWriter writes a JSON array an element at a time
+type arrayWriter struct {
+	w     io.Writer
+	count int
+}
+
+// newArrayWriter creates an arrayWriter writing to w
+func newArrayWriter(w io.Writer) *arrayWriter {
+	return &arrayWriter{w: w}
+}
+
+// write appends v to the array
+func (a *arrayWriter) write(v any) error {
+	sep := ","
+	if a.count == 0 {
+		sep = "["
+	}
+	a.count++
+	if _, err := io.WriteString(a.w, sep); err != nil {
+		return err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = a.w.Write(b)
+	return err
+}
+
+// close ends the array, writing an empty one when nothing was written
+func (a *arrayWriter) close() error {
+	end := "]"
+	if a.count == 0 {
+		end = "[]"
+	}
+	_, err := io.WriteString(a.w, end)
+	return err
+}
@@ -0,0 +1,172 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/audit"
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/g3offrey/idiomapi/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestExporter returns an Exporter of two todos of alice, one archived,
+// and a todo of bob, along with alice's context
+func newTestExporter(t *testing.T) (*Exporter, context.Context) {
+	t.Helper()
+	repo := repository.NewInMemoryTodoRepository()
+	log := audit.NewLog(audit.NewInMemoryStore())
+	alice := owner.NewContext(context.Background(), "alice")
+	bob := owner.NewContext(context.Background(), "bob")
+
+	todo, err := repo.Create(alice, dto.CreateTodoRequest{Title: "write report"})
+	require.NoError(t, err)
+	require.NoError(t, log.Record(alice, "create", "todo", "1", nil, todo))
+	archived, err := repo.Create(alice, dto.CreateTodoRequest{Title: "old"})
+	require.NoError(t, err)
+	_, _, err = repo.Archive(alice, archived.ID)
+	require.NoError(t, err)
+	_, err = repo.Create(bob, dto.CreateTodoRequest{Title: "bob's"})
+	require.NoError(t, err)
+	require.NoError(t, log.Record(bob, "create", "todo", "3", nil, nil))
+
+	e := NewExporter(todoSource{repo}, log)
+	e.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return e, alice
+}
+
+// todoSource adapts a repository to TodoSource
+type todoSource struct {
+	repo repository.TodoRepository
+}
+
+func (s todoSource) ExportTodos(ctx context.Context, filter repository.ListFilter, fn func(model.Todo) error) error {
+	return s.repo.Each(ctx, filter, fn)
+}
+
+// archive is the JSON export of a user
+type archive struct {
+	UserID     string                   `json:"user_id"`
+	ExportedAt time.Time                `json:"exported_at"`
+	Todos      []dto.TodoResponse       `json:"todos"`
+	Activity   []dto.AuditEventResponse `json:"activity"`
+}
+
+func TestExporter_WriteJSON(t *testing.T) {
+	e, ctx := newTestExporter(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, e.Write(ctx, &buf, FormatJSON))
+
+	var got archive
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "alice", got.UserID)
+	assert.Equal(t, "2026-01-02T03:04:05Z", got.ExportedAt.Format(time.RFC3339))
+	titles := make([]string, 0, len(got.Todos))
+	for _, todo := range got.Todos {
+		titles = append(titles, todo.Title)
+	}
+	assert.ElementsMatch(t, []string{"write report", "old"}, titles, "archived todos are exported, not those of bob")
+	if assert.Len(t, got.Activity, 1) {
+		assert.Equal(t, "create", got.Activity[0].Action)
+	}
+}
+
+func TestExporter_WriteWithoutActivity(t *testing.T) {
+	e := NewExporter(todoSource{repository.NewInMemoryTodoRepository()}, nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, e.Write(owner.NewContext(context.Background(), "alice"), &buf, FormatJSON))
+	assert.Contains(t, buf.String(), `"todos":[],"activity":[]}`)
+}
+
+func TestExporter_WriteZIP(t *testing.T) {
+	e, ctx := newTestExporter(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, e.Write(ctx, &buf, FormatZIP))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		b, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		files[f.Name] = string(b)
+	}
+
+	assert.JSONEq(t, `{"user_id":"alice","exported_at":"2026-01-02T03:04:05Z"}`, files["account.json"])
+	var todos []dto.TodoResponse
+	require.NoError(t, json.Unmarshal([]byte(files["todos.json"]), &todos))
+	assert.Len(t, todos, 2)
+	var activity []dto.AuditEventResponse
+	require.NoError(t, json.Unmarshal([]byte(files["activity.json"]), &activity))
+	assert.Len(t, activity, 1)
+}
+
+func TestExporter_WriteUnknownFormat(t *testing.T) {
+	e, ctx := newTestExporter(t)
+	assert.ErrorContains(t, e.Write(ctx, io.Discard, "xml"), `unknown export format "xml"`)
+}
+
+func TestJobs(t *testing.T) {
+	e, ctx := newTestExporter(t)
+	jobs := NewJobs(e, time.Hour, 0, slog.New(slog.DiscardHandler))
+	require.NoError(t, jobs.Start(context.Background()))
+
+	job, err := jobs.Create(ctx, FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, job.Status)
+
+	assert.Eventually(t, func() bool {
+		job, err = jobs.Get("alice", job.ID)
+		return err == nil && job.Status == StatusReady
+	}, time.Second, 10*time.Millisecond)
+
+	f, err := jobs.Open(job)
+	require.NoError(t, err)
+	var got archive
+	assert.NoError(t, json.NewDecoder(f).Decode(&got))
+	assert.NoError(t, f.Close())
+	assert.Len(t, got.Todos, 2)
+
+	_, err = jobs.Get("bob", job.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+
+	jobs.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = jobs.Get("alice", job.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound, "expired")
+	_, err = jobs.Open(job)
+	assert.Error(t, err, "the archive is removed")
+
+	assert.NoError(t, jobs.Stop(context.Background()))
+}
+
+func TestJobsLimits(t *testing.T) {
+	e, ctx := newTestExporter(t)
+	jobs := NewJobs(e, time.Hour, 1, slog.New(slog.DiscardHandler))
+	require.NoError(t, jobs.Start(context.Background()))
+	t.Cleanup(func() { assert.NoError(t, jobs.Stop(context.Background())) })
+
+	// An archive of alice still being built
+	busy := &Job{ID: "busy", OwnerID: "alice", Format: FormatZIP, Status: StatusPending, ExpiresAt: time.Now().Add(time.Hour)}
+	jobs.jobs[busy.ID] = busy
+
+	job, err := jobs.Create(ctx, FormatZIP)
+	require.NoError(t, err)
+	assert.Equal(t, busy.ID, job.ID, "the pending job is returned again")
+
+	_, err = jobs.Create(ctx, FormatJSON)
+	assert.ErrorIs(t, err, ErrTooManyJobs)
+}
@@ -0,0 +1,225 @@
+package export
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/owner"
+)
+
+var (
+	// ErrJobNotFound is returned when the user has no export job with the
+	// ID, or it expired
+	ErrJobNotFound = errors.New("export job not found")
+
+	// ErrTooManyJobs is returned when as many jobs as allowed are already
+	// building archives
+	ErrTooManyJobs = errors.New("too many export jobs running")
+)
+
+// Status is the state of an export job
+type Status string
+
+// Export job states
+const (
+	StatusPending Status = "pending"
+	StatusReady   Status = "ready"
+	StatusFailed  Status = "failed"
+)
+
+// Job is an archive built in the background, downloadable until it
+// expires
+type Job struct {
+	ID        string
+	OwnerID   string
+	Format    string
+	Status    Status
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	// path is the file the archive is written to
+	path string
+}
+
+// Jobs builds archives in the background for large accounts, keeping them
+// in a temporary directory of this instance until ttl after they were
+// requested. At most maxPending archives are built at once.
+type Jobs struct {
+	exporter   *Exporter
+	ttl        time.Duration
+	maxPending int
+	logger     *slog.Logger
+	now        func() time.Time
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+	dir  string
+
+	// ctx ends with Stop, canceling the jobs running in wg
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewJobs creates a new Jobs writing archives with exporter, building up
+// to maxPending of them at once, without limit when not positive
+func NewJobs(exporter *Exporter, ttl time.Duration, maxPending int, logger *slog.Logger) *Jobs {
+	return &Jobs{exporter: exporter, ttl: ttl, maxPending: maxPending, logger: logger, now: time.Now, jobs: make(map[string]*Job)}
+}
+
+// Start creates the directory the archives are written to
+func (j *Jobs) Start(ctx context.Context) error {
+	dir, err := os.MkdirTemp("", "idiomapi-exports-")
+	if err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+	j.dir = dir
+	j.ctx, j.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	return nil
+}
+
+// Stop cancels the running jobs, waits for them until ctx ends, and
+// removes the archives
+func (j *Jobs) Stop(ctx context.Context) error {
+	if j.cancel == nil {
+		return nil
+	}
+	j.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		j.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return os.RemoveAll(j.dir)
+}
+
+// Create starts building the archive of the user in ctx in format, and
+// returns its job. A user already waiting for an archive in format gets
+// the job building it rather than a new one, and ErrTooManyJobs is
+// returned when maxPending archives are being built.
+func (j *Jobs) Create(ctx context.Context, format string) (Job, error) {
+	ownerID, _ := owner.FromContext(ctx)
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.removeExpired()
+	pending := 0
+	for _, job := range j.jobs {
+		if job.Status != StatusPending {
+			continue
+		}
+		if job.OwnerID == ownerID && job.Format == format {
+			return *job, nil
+		}
+		pending++
+	}
+	if j.maxPending > 0 && pending >= j.maxPending {
+		return Job{}, ErrTooManyJobs
+	}
+
+	now := j.now()
+	job := &Job{
+		ID:        id,
+		OwnerID:   ownerID,
+		Format:    format,
+		Status:    StatusPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(j.ttl),
+		path:      filepath.Join(j.dir, id+"."+format),
+	}
+	j.jobs[id] = job
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.run(owner.NewContext(j.ctx, ownerID), job)
+	}()
+	return *job, nil
+}
+
+// Get returns the export job id of ownerID
+func (j *Jobs) Get(ownerID, id string) (Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.removeExpired()
+	job, ok := j.jobs[id]
+	if !ok || job.OwnerID != ownerID {
+		return Job{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// Open opens the archive of a ready job
+func (j *Jobs) Open(job Job) (*os.File, error) {
+	return os.Open(job.path)
+}
+
+// run writes the archive of job
+func (j *Jobs) run(ctx context.Context, job *Job) {
+	status := StatusReady
+	if err := j.write(ctx, job); err != nil {
+		j.logger.Error("failed to export user data", "job", job.ID, "error", err)
+		_ = os.Remove(job.path)
+		status = StatusFailed
+	} else {
+		j.logger.Info("user data exported", "job", job.ID)
+	}
+
+	j.mu.Lock()
+	job.Status = status
+	j.mu.Unlock()
+}
+
+// write writes the archive of job to its file
+func (j *Jobs) write(ctx context.Context, job *Job) error {
+	f, err := os.OpenFile(job.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := j.exporter.Write(ctx, f, job.Format); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// removeExpired forgets the expired jobs and removes their archives. The
+// caller holds j.mu.
+func (j *Jobs) removeExpired() {
+	now := j.now()
+	for id, job := range j.jobs {
+		if now.After(job.ExpiresAt) && job.Status != StatusPending {
+			delete(j.jobs, id)
+			_ = os.Remove(job.path)
+		}
+	}
+}
+
+// newJobID returns a random job ID, which cannot be guessed
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate export job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/g3offrey/idiomapi/internal/auth"
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/g3offrey/idiomapi/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler handles the requests managing the API keys of a user
+type APIKeyHandler struct {
+	keys *auth.APIKeys
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler
+func NewAPIKeyHandler(keys *auth.APIKeys) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+// CreateAPIKey handles POST /api/v1/apikeys. The response holds the key,
+// which cannot be retrieved later.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req dto.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, &req)
+		return
+	}
+
+	ownerID, _ := owner.FromContext(c.Request.Context())
+	apiKey, key, err := h.keys.Create(c.Request.Context(), ownerID, req.Name, req.Scopes)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.CreatedAPIKeyResponse{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    apiKey.Scopes,
+		CreatedAt: apiKey.CreatedAt,
+		Key:       key,
+	})
+}
+
+// ListAPIKeys handles GET /api/v1/apikeys
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	ownerID, _ := owner.FromContext(c.Request.Context())
+	keys, err := h.keys.List(c.Request.Context(), ownerID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response := dto.APIKeyListResponse{APIKeys: make([]dto.APIKeyResponse, 0, len(keys))}
+	for _, key := range keys {
+		response.APIKeys = append(response.APIKeys, dto.APIKeyResponse{
+			ID:        key.ID,
+			Name:      key.Name,
+			Prefix:    key.Prefix,
+			Scopes:    key.Scopes,
+			CreatedAt: key.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteAPIKey handles DELETE /api/v1/apikeys/:id, revoking the key
+func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		// No key has an ID that is not an integer
+		respondError(c, service.ErrAPIKeyNotFound)
+		return
+	}
+
+	ownerID, _ := owner.FromContext(c.Request.Context())
+	err = h.keys.Delete(c.Request.Context(), ownerID, id)
+	if errors.Is(err, auth.ErrAPIKeyNotFound) {
+		err = service.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"github.com/g3offrey/idiomapi/internal/audit"
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// Audit event page sizes
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditHandler handles the requests reading the audit trail
+type AuditHandler struct {
+	log *audit.Log
+}
+
+// NewAuditHandler creates a new AuditHandler
+func NewAuditHandler(log *audit.Log) *AuditHandler {
+	return &AuditHandler{log: log}
+}
+
+// ListEvents handles GET /api/v1/admin/audit, filtered by the actor,
+// action, entity and entity_id query parameters and paged with after_id
+// and limit
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	filter := audit.Filter{
+		Actor:    c.Query("actor"),
+		Action:   c.Query("action"),
+		Entity:   c.Query("entity"),
+		EntityID: c.Query("entity_id"),
+		Limit:    defaultAuditLimit,
+	}
+	var fields []dto.FieldError
+	if afterStr := c.Query("after_id"); afterStr != "" {
+		after, err := strconv.ParseInt(afterStr, 10, 64)
+		if err != nil || after < 0 {
+			fields = append(fields, dto.FieldError{
+				Field:   "after_id",
+				Rule:    "min",
+				Message: "after_id must be a non-negative integer",
+			})
+		}
+		filter.AfterID = after
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			fields = append(fields, dto.FieldError{
+				Field:   "limit",
+				Rule:    "range",
+				Message: "limit must be between 1 and " + strconv.Itoa(maxAuditLimit),
+			})
+		}
+		filter.Limit = limit
+	}
+	if len(fields) > 0 {
+		respondFieldErrors(c, fields)
+		return
+	}
+
+	events, err := h.log.List(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response := dto.AuditEventListResponse{Events: make([]dto.AuditEventResponse, 0, len(events))}
+	for _, e := range events {
+		response.Events = append(response.Events, dto.AuditEventResponse{
+			ID:        e.ID,
+			Actor:     e.Actor,
+			Action:    e.Action,
+			Entity:    e.Entity,
+			EntityID:  e.EntityID,
+			Before:    e.Before,
+			After:     e.After,
+			IP:        e.IP,
+			CreatedAt: e.CreatedAt,
+			PrevHash:  hex.EncodeToString(e.PrevHash),
+			Hash:      hex.EncodeToString(e.Hash),
+		})
+	}
+	if len(events) == filter.Limit {
+		next := events[len(events)-1].ID
+		response.NextAfterID = &next
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// VerifyEvents handles GET /api/v1/admin/audit/verify, checking the hash
+// chain of every event
+func (h *AuditHandler) VerifyEvents(c *gin.Context) {
+	result, err := h.log.Verify(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response := dto.AuditVerificationResponse{Valid: result.Valid, Events: result.Events}
+	if !result.Valid {
+		response.FirstInvalidID = &result.FirstInvalidID
+	}
+	c.JSON(http.StatusOK, response)
+}
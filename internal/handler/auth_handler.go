@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/auth"
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// oidcCookie holds the OIDC login in progress, from OIDCLogin to
+// OIDCCallback
+const (
+	oidcCookie     = "oidc_login"
+	oidcCookiePath = "/api/v1/auth/oidc"
+	oidcCookieAge  = 10 * time.Minute
+)
+
+// AuthHandler handles the requests registering and logging in users
+type AuthHandler struct {
+	auth    *auth.Service
+	oidc    *auth.OIDC
+	cookies *auth.Cookies
+}
+
+// NewAuthHandler creates a new AuthHandler, logging in with oidc too when
+// it is not nil, and setting the access token in cookies when they are not
+// nil
+func NewAuthHandler(svc *auth.Service, oidc *auth.OIDC, cookies *auth.Cookies) *AuthHandler {
+	return &AuthHandler{auth: svc, oidc: oidc, cookies: cookies}
+}
+
+// Register handles POST /api/v1/auth/register
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req dto.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, &req)
+		return
+	}
+
+	user, err := h.auth.Register(c.Request.Context(), req.Email, req.Password)
+	if err != nil {
+		respondError(c, authError(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.UserResponse{ID: user.ID, Email: user.Email, CreatedAt: user.CreatedAt})
+}
+
+// Login handles POST /api/v1/auth/login
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req dto.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, &req)
+		return
+	}
+
+	tokens, err := h.auth.Login(c.Request.Context(), req.Email, req.Password)
+	if err != nil {
+		respondError(c, authError(err))
+		return
+	}
+
+	h.respondTokens(c, tokens)
+}
+
+// Refresh handles POST /api/v1/auth/refresh, exchanging a refresh token
+// for new tokens
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req dto.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, &req)
+		return
+	}
+
+	tokens, err := h.auth.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		respondError(c, authError(err))
+		return
+	}
+
+	h.respondTokens(c, tokens)
+}
+
+// Logout handles POST /api/v1/auth/logout, ending the session of a
+// refresh token
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req dto.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, &req)
+		return
+	}
+
+	if err := h.auth.Logout(c.Request.Context(), req.RefreshToken); err != nil {
+		respondError(c, err)
+		return
+	}
+	if h.cookies != nil {
+		h.cookies.Clear(c)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// OIDCLogin handles GET /api/v1/auth/oidc/login, redirecting to the OIDC
+// provider
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	req, err := auth.NewAuthRequest()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	redirect, err := h.oidc.AuthCodeURL(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, req.String(), int(oidcCookieAge.Seconds()), oidcCookiePath, "", h.oidc.SecureCallback(), true)
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// OIDCCallback handles GET /api/v1/auth/oidc/callback, where the OIDC
+// provider sends the user back, answering with a token like Login
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	cookie, _ := c.Cookie(oidcCookie)
+	c.SetCookie(oidcCookie, "", -1, oidcCookiePath, "", h.oidc.SecureCallback(), true)
+
+	req, ok := auth.ParseAuthRequest(cookie)
+	if !ok || !req.MatchesState(c.Query("state")) {
+		respondError(c, service.ErrLoginState)
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		// The provider sends an error parameter instead when the user
+		// declined or could not be authenticated
+		respondError(c, service.ErrOIDCLogin)
+		return
+	}
+
+	identity, err := h.oidc.Exchange(c.Request.Context(), code, req)
+	if err != nil {
+		respondError(c, authError(err))
+		return
+	}
+	tokens, err := h.auth.LoginWithIdentity(c.Request.Context(), *identity)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	h.respondTokens(c, tokens)
+}
+
+// respondTokens writes tokens, also setting them in cookies with
+// auth.cookie_sessions
+func (h *AuthHandler) respondTokens(c *gin.Context, tokens *auth.TokenPair) {
+	if h.cookies != nil {
+		if err := h.cookies.Set(c, tokens); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, dto.TokenResponse{
+		AccessToken:      tokens.AccessToken,
+		TokenType:        "Bearer",
+		ExpiresAt:        tokens.ExpiresAt,
+		RefreshToken:     tokens.RefreshToken,
+		RefreshExpiresAt: tokens.RefreshExpiresAt,
+	})
+}
+
+// authError maps the errors of the auth package to AppErrors, leaving
+// unknown errors untouched
+func authError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrEmailTaken):
+		return service.ErrEmailTaken
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return service.ErrInvalidCredentials
+	case errors.Is(err, auth.ErrInvalidRefreshToken):
+		return service.ErrInvalidRefreshToken
+	case errors.Is(err, auth.ErrOIDCLogin):
+		return service.ErrOIDCLogin
+	case errors.Is(err, auth.ErrIdentityRejected):
+		return service.ErrIdentityRejected
+	default:
+		return err
+	}
+}
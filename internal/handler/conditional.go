@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/g3offrey/idiomapi/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// etagMatches reports whether header, an If-Match or If-None-Match value,
+// lists etag or is "*". Tags are compared weakly, ignoring any W/ prefix,
+// since the todo ETags are weak.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchContext returns the request context, carrying the If-Match
+// header, if any, as a precondition the repository checks on the todo it
+// locks to modify, so the todo cannot change between the check and the
+// change. Todos changed since the client read them are not modified and
+// get 412.
+func ifMatchContext(c *gin.Context) context.Context {
+	ctx := c.Request.Context()
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		return ctx
+	}
+	return repository.WithPrecondition(ctx, func(todo *model.Todo) bool {
+		return etagMatches(ifMatch, todo.ETag())
+	})
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// parseDateFormat reads the date_format and timezone query parameters. It
+// returns nil when no date_format is requested, in which case timestamps
+// keep their RFC 3339 encoding. The time zone defaults to the configured
+// one. Invalid values are reported by appending to fields.
+func (h *TodoHandler) parseDateFormat(c *gin.Context, fields []dto.FieldError) (*dto.DateFormat, []dto.FieldError, error) {
+	name := c.Query("date_format")
+	if name == "" {
+		return nil, fields, nil
+	}
+
+	layout, ok := dto.DateFormats[name]
+	if !ok {
+		names := make([]string, 0, len(dto.DateFormats))
+		for n := range dto.DateFormats {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		fields = append(fields, dto.FieldError{
+			Field:   "date_format",
+			Rule:    "oneof",
+			Message: "date_format must be one of: " + strings.Join(names, ", "),
+		})
+	}
+
+	var loc *time.Location
+	if tz := c.Query("timezone"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			fields = append(fields, dto.FieldError{
+				Field:   "timezone",
+				Rule:    "timezone",
+				Message: fmt.Sprintf("timezone %q is not a known IANA time zone", tz),
+			})
+		}
+	} else {
+		var err error
+		if loc, err = h.service.Location(); err != nil {
+			return nil, fields, err
+		}
+	}
+
+	if !ok || loc == nil {
+		return nil, fields, nil
+	}
+	return &dto.DateFormat{Layout: layout, Location: loc}, fields, nil
+}
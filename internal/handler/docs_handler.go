@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/g3offrey/idiomapi/internal/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// DocsHandler serves the API description
+type DocsHandler struct {
+	spec *openapi.Document
+}
+
+// NewDocsHandler creates a new DocsHandler
+func NewDocsHandler(spec *openapi.Document) *DocsHandler {
+	return &DocsHandler{spec: spec}
+}
+
+// OpenAPI handles GET /openapi.json
+func (h *DocsHandler) OpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, h.spec)
+}
+
+// SwaggerUI handles GET /docs
+func (h *DocsHandler) SwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", openapi.SwaggerUI)
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/i18n"
+	"github.com/g3offrey/idiomapi/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// respondError writes the error response for err. A service.AppError
+// anywhere in the chain decides the status, code and message, and lists
+// its fields when it has any; any other error is reported as a generic 500.
+// The message is translated to the language the client asks for with
+// Accept-Language.
+func respondError(c *gin.Context, err error) {
+	var appErr *service.AppError
+	if errors.As(err, &appErr) && len(appErr.Fields) > 0 {
+		c.JSON(errorStatus(err), dto.ValidationErrorResponse{
+			Error:   appErr.Code,
+			Message: localize(c, appErr.Code, appErr.Message),
+			Fields:  appErr.Fields,
+		})
+		return
+	}
+	if appErr != nil {
+		c.JSON(errorStatus(err), dto.ErrorResponse{
+			Error:   appErr.Code,
+			Message: localize(c, appErr.Code, appErr.Message),
+		})
+		return
+	}
+
+	_ = c.Error(err) //nolint:errcheck // recorded for the request logger
+	c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+		Error:   "internal_error",
+		Message: localize(c, "internal_error", "Internal server error"),
+	})
+}
+
+// respondErrorStatus answers err with the status respondError would use,
+// without a body, as HEAD requests are answered
+func respondErrorStatus(c *gin.Context, err error) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		_ = c.Error(err) //nolint:errcheck // recorded for the request logger
+	}
+	c.Status(status)
+}
+
+// errorStatus returns the status code of err: that of the service.AppError
+// in its chain, 500 without one
+func errorStatus(err error) int {
+	var appErr *service.AppError
+	if errors.As(err, &appErr) {
+		return appErr.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// localize returns the message for code in the language of the request,
+// message when there is no translation
+func localize(c *gin.Context, code, message string) string {
+	return i18n.Message(c.GetHeader("Accept-Language"), code, message)
+}
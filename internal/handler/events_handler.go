@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/events"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/gin-gonic/gin"
+)
+
+// EventsHandler streams todo changes as server-sent events
+type EventsHandler struct {
+	hub       *events.Hub
+	keepAlive time.Duration
+	naming    dto.Naming
+}
+
+// NewEventsHandler creates a new EventsHandler. Idle streams receive a
+// comment every keepAlive, none when it is zero.
+func NewEventsHandler(hub *events.Hub, keepAlive time.Duration, naming dto.Naming) *EventsHandler {
+	return &EventsHandler{hub: hub, keepAlive: keepAlive, naming: naming}
+}
+
+// DeletedTodoEvent is the data of a todo.deleted event
+type DeletedTodoEvent struct {
+	ID int `json:"id"`
+}
+
+// TodosChangedEvent is the data of a todos.changed event
+type TodosChangedEvent struct {
+	Operation string `json:"operation"`
+	Count     int64  `json:"count"`
+}
+
+// Stream handles GET /api/v1/todos/events
+func (h *EventsHandler) Stream(c *gin.Context) {
+	ownerID, _ := owner.FromContext(c.Request.Context())
+	stream, unsubscribe := h.hub.Subscribe(ownerID)
+	defer unsubscribe()
+
+	// The stream outlives the server write timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}) //nolint:errcheck // not every writer supports deadlines
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	var keepAlive <-chan time.Time
+	if h.keepAlive > 0 {
+		ticker := time.NewTicker(h.keepAlive)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e, ok := <-stream:
+			if !ok {
+				// Dropped by the hub for falling behind
+				return
+			}
+			data, err := h.naming.Apply(eventData(e))
+			if err != nil {
+				return
+			}
+			c.SSEvent(e.Type, data)
+		case <-keepAlive:
+			if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// eventData returns the payload sent for e
+func eventData(e events.Event) any {
+	if e.Type == events.TodosChanged {
+		return TodosChangedEvent{Operation: e.Operation, Count: e.Count}
+	}
+	if e.Todo == nil {
+		return DeletedTodoEvent{ID: e.TodoID}
+	}
+	return dto.ToTodoResponse(e.Todo)
+}
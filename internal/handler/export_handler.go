@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/export"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/g3offrey/idiomapi/internal/repository"
+	"github.com/g3offrey/idiomapi/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// exportsPath is the path of the export jobs below the base path
+const exportsPath = "/api/v1/users/me/exports"
+
+// mimeZIP is the media type of ZIP archives
+const mimeZIP = "application/zip"
+
+// TodoCounter counts the todos of the user in the context
+type TodoCounter interface {
+	CountTodos(ctx context.Context, filter repository.ListFilter) (int, error)
+}
+
+// ExportHandler handles the requests exporting every piece of data of a
+// user
+type ExportHandler struct {
+	exporter       *export.Exporter
+	jobs           *export.Jobs
+	todos          TodoCounter
+	asyncThreshold int
+	basePath       string
+}
+
+// NewExportHandler creates a new ExportHandler, building the archives of
+// users with more than asyncThreshold todos with jobs. basePath prefixes
+// the URLs of the jobs.
+func NewExportHandler(exporter *export.Exporter, jobs *export.Jobs, todos TodoCounter, asyncThreshold int, basePath string) *ExportHandler {
+	return &ExportHandler{
+		exporter:       exporter,
+		jobs:           jobs,
+		todos:          todos,
+		asyncThreshold: asyncThreshold,
+		basePath:       strings.TrimSuffix(basePath, "/"),
+	}
+}
+
+// Export handles GET /api/v1/users/me/export, streaming the archive in the
+// format of ?format=json|zip, or answering 202 with a job building it with
+// ?async=true or for large accounts
+func (h *ExportHandler) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", export.FormatJSON)
+	var fields []dto.FieldError
+	if format != export.FormatJSON && format != export.FormatZIP {
+		fields = append(fields, dto.FieldError{
+			Field:   "format",
+			Rule:    "oneof",
+			Message: "format must be one of json, zip",
+		})
+	}
+	async := false
+	if asyncStr := c.Query("async"); asyncStr != "" {
+		var err error
+		if async, err = strconv.ParseBool(asyncStr); err != nil {
+			fields = append(fields, dto.FieldError{
+				Field:   "async",
+				Rule:    "boolean",
+				Message: "async must be true or false",
+			})
+		}
+	}
+	if len(fields) > 0 {
+		respondFieldErrors(c, fields)
+		return
+	}
+
+	if !async {
+		count, err := h.todos.CountTodos(c.Request.Context(), repository.ListFilter{IncludeArchived: true})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		async = count > h.asyncThreshold
+	}
+	if async {
+		job, err := h.jobs.Create(c.Request.Context(), format)
+		if err != nil {
+			respondError(c, exportError(err))
+			return
+		}
+		c.Header("Location", baseURL(c.Request)+h.basePath+exportsPath+"/"+job.ID)
+		c.JSON(http.StatusAccepted, h.jobResponse(job))
+		return
+	}
+
+	// Large archives outlive the server write timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}) //nolint:errcheck // not every writer supports deadlines
+
+	h.setAttachmentHeaders(c, format)
+	c.Status(http.StatusOK)
+	if err := h.exporter.Write(c.Request.Context(), c.Writer, format); err != nil {
+		// Until the first bytes are flushed the failure can still be
+		// reported as an error response
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			respondError(c, err)
+			return
+		}
+		_ = c.Error(err) //nolint:errcheck // recorded for the request logger
+	}
+}
+
+// GetExport handles GET /api/v1/users/me/exports/:id, reporting the status
+// of an export job
+func (h *ExportHandler) GetExport(c *gin.Context) {
+	ownerID, _ := owner.FromContext(c.Request.Context())
+	job, err := h.jobs.Get(ownerID, c.Param("id"))
+	if err != nil {
+		respondError(c, exportError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, h.jobResponse(job))
+}
+
+// DownloadExport handles GET /api/v1/users/me/exports/:id/download,
+// sending the archive of a ready export job
+func (h *ExportHandler) DownloadExport(c *gin.Context) {
+	ownerID, _ := owner.FromContext(c.Request.Context())
+	job, err := h.jobs.Get(ownerID, c.Param("id"))
+	if err != nil {
+		respondError(c, exportError(err))
+		return
+	}
+	if job.Status != export.StatusReady {
+		respondError(c, service.ErrExportNotReady)
+		return
+	}
+
+	f, err := h.jobs.Open(job)
+	if err != nil {
+		// The archive expired since
+		respondError(c, service.ErrExportNotFound)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	// Large archives outlive the server write timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}) //nolint:errcheck // not every writer supports deadlines
+
+	h.setAttachmentHeaders(c, job.Format)
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, f); err != nil {
+		_ = c.Error(err) //nolint:errcheck // recorded for the request logger
+	}
+}
+
+// setAttachmentHeaders sets the headers of an archive in format
+func (h *ExportHandler) setAttachmentHeaders(c *gin.Context, format string) {
+	contentType := gin.MIMEJSON + "; charset=utf-8"
+	if format == export.FormatZIP {
+		contentType = mimeZIP
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="export.`+format+`"`)
+}
+
+// jobResponse returns the response describing job
+func (h *ExportHandler) jobResponse(job export.Job) dto.ExportJobResponse {
+	response := dto.ExportJobResponse{
+		ID:        job.ID,
+		Status:    string(job.Status),
+		Format:    job.Format,
+		CreatedAt: job.CreatedAt,
+		ExpiresAt: job.ExpiresAt,
+	}
+	if job.Status == export.StatusReady {
+		response.DownloadURL = h.basePath + exportsPath + "/" + job.ID + "/download"
+	}
+	return response
+}
+
+// exportError maps the errors of the export package to AppErrors, leaving
+// unknown errors untouched
+func exportError(err error) error {
+	switch {
+	case errors.Is(err, export.ErrJobNotFound):
+		return service.ErrExportNotFound
+	case errors.Is(err, export.ErrTooManyJobs):
+		return service.ErrExportBusy
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// parseFieldSet reads the comma separated fields query parameter. It
+// returns nil when fields is absent, in which case every field is
+// returned. Unknown fields are reported by appending to fields.
+func parseFieldSet(c *gin.Context, fields []dto.FieldError) (dto.FieldSet, []dto.FieldError) {
+	value := c.Query("fields")
+	if value == "" {
+		return nil, fields
+	}
+
+	set := make(dto.FieldSet)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(dto.TodoFields, name) {
+			return nil, append(fields, dto.FieldError{
+				Field:   "fields",
+				Rule:    "oneof",
+				Message: "fields must be a comma separated list of: " + strings.Join(dto.TodoFields, ", "),
+			})
+		}
+		set[name] = true
+	}
+	return set, fields
+}
@@ -1,17 +1,50 @@
 package handler
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/g3offrey/idiomapi/internal/audit"
+	"github.com/g3offrey/idiomapi/internal/auth"
+	"github.com/g3offrey/idiomapi/internal/config"
+	"github.com/g3offrey/idiomapi/internal/database"
 	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/events"
+	"github.com/g3offrey/idiomapi/internal/export"
+	"github.com/g3offrey/idiomapi/internal/middleware"
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/g3offrey/idiomapi/internal/repository"
+	"github.com/g3offrey/idiomapi/internal/service"
+	"github.com/g3offrey/idiomapi/pkg/lifecycle"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
 )
 
+func TestMain(m *testing.M) {
+	if err := RegisterValidators(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
 // TestHealthHandlerIntegration tests the health endpoint
 func TestHealthHandlerIntegration(t *testing.T) {
 	gin.SetMode(gin.TestMode)
@@ -37,6 +70,43 @@ func TestHealthHandlerIntegration(t *testing.T) {
 	assert.Equal(t, "ok", response.Status)
 }
 
+// TestMaintenanceHandler tests the database maintenance endpoint
+func TestMaintenanceHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	execer := &recordingExecer{}
+	maintenance := database.NewMaintenance(execer, true, time.Hour, slog.New(slog.DiscardHandler))
+	router.POST("/api/v1/admin/db/maintenance", NewMaintenanceHandler(maintenance).RunMaintenance)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/admin/db/maintenance", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response dto.MaintenanceResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "VACUUM ANALYZE", response.Command)
+	assert.Equal(t, []string{"VACUUM ANALYZE todos"}, execer.statements)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/admin/db/maintenance", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Len(t, execer.statements, 1)
+}
+
+// recordingExecer records the statements it is asked to run
+type recordingExecer struct {
+	statements []string
+}
+
+func (e *recordingExecer) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	e.statements = append(e.statements, sql)
+	return pgconn.CommandTag{}, nil
+}
+
 // TestTodoHandlerValidation tests request validation
 func TestTodoHandlerValidation(t *testing.T) {
 	gin.SetMode(gin.TestMode)
@@ -116,3 +186,2094 @@ func TestTodoHandlerErrorResponses(t *testing.T) {
 	assert.Equal(t, "not_found", response.Error)
 	assert.Equal(t, "Todo not found", response.Message)
 }
+
+// TestTodoHandlerLocalizedErrors tests error messages in the language asked
+// for with Accept-Language
+func TestTodoHandlerLocalizedErrors(t *testing.T) {
+	router, _ := newTestTodoRouter(t)
+
+	tests := []struct {
+		name            string
+		acceptLanguage  string
+		expectedMessage string
+	}{
+		{name: "french", acceptLanguage: "fr-FR,fr;q=0.9,en;q=0.8", expectedMessage: "Tâche introuvable"},
+		{name: "preferred english", acceptLanguage: "en;q=0.9, fr;q=0.1", expectedMessage: "Todo not found"},
+		{name: "unsupported language", acceptLanguage: "ja", expectedMessage: "Todo not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/todos/999", http.NoBody)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			var response dto.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "not_found", response.Error)
+			assert.Equal(t, tt.expectedMessage, response.Message)
+		})
+	}
+}
+
+// TestRespondError tests the mapping of service errors to responses
+func TestRespondError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "app error", err: service.ErrInvalidID, expectedStatus: http.StatusBadRequest, expectedCode: "invalid_id"},
+		{name: "wrapped app error", err: fmt.Errorf("update: %w", service.ErrTodoNotFound), expectedStatus: http.StatusNotFound, expectedCode: "not_found"},
+		{name: "version conflict", err: service.ErrVersionConflict, expectedStatus: http.StatusPreconditionFailed, expectedCode: "precondition_failed"},
+		{name: "unknown error", err: errors.New("connection refused"), expectedStatus: http.StatusInternalServerError, expectedCode: "internal_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/", http.NoBody)
+
+			respondError(c, tt.err)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			var response dto.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedCode, response.Error)
+			assert.NotContains(t, response.Message, "connection refused")
+		})
+	}
+}
+
+// TestRespondBindErrorFields tests field-level validation error responses
+func TestRespondBindErrorFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	router.POST("/api/v1/todos", func(c *gin.Context) {
+		var req dto.CreateTodoRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err, &req)
+			return
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	tests := []struct {
+		name           string
+		payload        string
+		expectedStatus int
+		expectedFields []dto.FieldError
+	}{
+		{
+			name:           "missing title",
+			payload:        `{"description":"Test Description"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedFields: []dto.FieldError{
+				{Field: "title", Rule: "required", Message: "title is required"},
+			},
+		},
+		{
+			name:           "description too long",
+			payload:        `{"title":"Test","description":"` + strings.Repeat("a", 1001) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedFields: []dto.FieldError{
+				{Field: "description", Rule: "max", Message: "description must be at most 1000 characters"},
+			},
+		},
+		{
+			name:           "wrong type",
+			payload:        `{"title":"Test","completed":"yes"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedFields: []dto.FieldError{
+				{Field: "completed", Rule: "type", Message: "completed must be of type bool"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/todos", bytes.NewBufferString(tt.payload))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response dto.ValidationErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, "validation_error", response.Error)
+			assert.Equal(t, tt.expectedFields, response.Fields)
+		})
+	}
+}
+
+// TestTodoHandlerOptions tests the OPTIONS discovery response
+func TestTodoHandlerOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	h := NewTodoHandler(nil, false, "", dto.NamingSnake)
+	router.OPTIONS("/api/v1/todos", h.Options)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "/api/v1/todos", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "GET, HEAD, POST, DELETE, OPTIONS", w.Header().Get("Allow"))
+
+	var response dto.OptionsResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET", "HEAD", "POST", "DELETE", "OPTIONS"}, response.Methods)
+
+	assert.Len(t, response.Create, 4)
+	title := response.Create[0]
+	assert.Equal(t, "title", title.Field)
+	assert.Equal(t, "string", title.Type)
+	assert.True(t, title.Required)
+	assert.Equal(t, 1, *title.Min)
+	assert.Equal(t, 255, *title.Max)
+
+	assert.Len(t, response.Update, 4)
+	assert.False(t, response.Update[0].Required)
+	assert.Equal(t, "boolean", response.Update[2].Type)
+	assert.Equal(t, []string{"low", "medium", "high"}, response.Update[3].Enum)
+}
+
+// newTestTodoRouter wires the todo routes to an in-memory repository
+func newTestTodoRouter(t *testing.T) (*gin.Engine, *repository.InMemoryTodoRepository) {
+	t.Helper()
+	return newTestTodoRouterWith(t, false)
+}
+
+// testOwner owns the todos of the test routers
+const testOwner = "tester"
+
+// ownerContext returns a context acting for testOwner, to reach the todos
+// of the test routers
+func ownerContext() context.Context {
+	return owner.NewContext(context.Background(), testOwner)
+}
+
+// asTestOwner acts for testOwner, as authentication does for its user
+func asTestOwner(c *gin.Context) {
+	c.Request = c.Request.WithContext(owner.NewContext(c.Request.Context(), testOwner))
+	c.Next()
+}
+
+// newTestTodoRouterWith is newTestTodoRouter with empty updates rejected
+// when rejectEmptyUpdate is set
+func newTestTodoRouterWith(t *testing.T, rejectEmptyUpdate bool) (*gin.Engine, *repository.InMemoryTodoRepository) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	repo := repository.NewInMemoryTodoRepository()
+	h := NewTodoHandler(service.NewTodoService(repo, config.TodosConfig{}, config.PaginationConfig{DefaultPageSize: 10}, config.LimitsConfig{MaxPageSize: 100, MaxBatchSize: 100, MaxIDsPerRequest: 1000}, slog.New(slog.DiscardHandler)), rejectEmptyUpdate, "", dto.NamingSnake)
+
+	router := gin.New()
+	todos := router.Group("/api/v1/todos", asTestOwner)
+	todos.POST("", h.CreateTodo)
+	todos.GET("", h.ListTodos)
+	todos.HEAD("", h.HeadTodos)
+	todos.DELETE("", h.DeleteTodos)
+	todos.POST("/complete-all", h.CompleteAll)
+	todos.POST("/batch-get", h.BatchGetTodos)
+	todos.GET("/version", h.GetVersion)
+	todos.GET("/stats/dow", h.GetWeekdayStats)
+	todos.GET("/stats/completion-time", h.GetCompletionTimeStats)
+	todos.GET("/:id", h.GetTodo)
+	todos.HEAD("/:id", h.HeadTodo)
+	todos.PUT("/reorder", h.ReorderTodos)
+	todos.PUT("/by-external/:externalID", h.UpsertTodo)
+	todos.PUT("/:id", h.UpdateTodo)
+	todos.POST("/:id/archive", h.ArchiveTodo)
+	todos.POST("/:id/unarchive", h.UnarchiveTodo)
+	todos.DELETE("/:id", h.DeleteTodo)
+
+	return router, repo
+}
+
+// TestTodoHandlerLinks tests the _links requested with ?links=true
+func TestTodoHandlerLinks(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test"})
+	assert.NoError(t, err)
+	path := "/api/v1/todos/" + strconv.Itoa(todo.ID)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path+"?links=true", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response dto.TodoResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if assert.NotNil(t, response.Links) {
+		assert.Equal(t, path, response.Links.Self)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/todos?links=true", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	var list dto.TodoListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Todos, 1) && assert.NotNil(t, list.Todos[0].Links) {
+		assert.Equal(t, path, list.Todos[0].Links.Self)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", path, http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.NotContains(t, w.Body.String(), "_links")
+}
+
+// TestTodoHandlerLinksBasePath tests that links are prefixed with the base path
+func TestTodoHandlerLinksBasePath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := repository.NewInMemoryTodoRepository()
+	h := NewTodoHandler(service.NewTodoService(repo, config.TodosConfig{}, config.PaginationConfig{}, config.LimitsConfig{}, slog.New(slog.DiscardHandler)), false, "/svc/", dto.NamingSnake)
+
+	router := gin.New()
+	router.Use(asTestOwner)
+	router.POST("/api/v1/todos", h.CreateTodo)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/todos?links=true", strings.NewReader(`{"title":"Test"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response dto.TodoResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if assert.NotNil(t, response.Links) {
+		assert.Equal(t, "/svc/api/v1/todos/"+strconv.Itoa(response.ID), response.Links.Self)
+	}
+}
+
+// TestTodoHandlerCamelNaming tests that camel naming renames the keys of
+// todo responses
+func TestTodoHandlerCamelNaming(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := repository.NewInMemoryTodoRepository()
+	h := NewTodoHandler(service.NewTodoService(repo, config.TodosConfig{}, config.PaginationConfig{}, config.LimitsConfig{}, slog.New(slog.DiscardHandler)), false, "", dto.NamingCamel)
+
+	router := gin.New()
+	router.Use(asTestOwner)
+	router.POST("/api/v1/todos", h.CreateTodo)
+	router.GET("/api/v1/todos", h.ListTodos)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/todos", strings.NewReader(`{"title":"Test"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var todo map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &todo))
+	assert.Contains(t, todo, "createdAt")
+	assert.NotContains(t, todo, "created_at")
+	assert.NotContains(t, todo, "description")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/todos", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Contains(t, list, "pageSize")
+	assert.Contains(t, list, "totalPages")
+}
+
+// TestTodoHandlerCompactList tests the shape of ?view=compact lists
+func TestTodoHandlerCompactList(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+	_, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test", Description: "Left out", Priority: model.PriorityHigh})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/todos?view=compact&links=true", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+
+	var response struct {
+		Todos []map[string]any `json:"todos"`
+		Total int              `json:"total"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.Total)
+	if assert.Len(t, response.Todos, 1) {
+		keys := make([]string, 0, len(response.Todos[0]))
+		for key := range response.Todos[0] {
+			keys = append(keys, key)
+		}
+		assert.ElementsMatch(t, []string{"id", "title", "completed", "updated_at"}, keys)
+		assert.Equal(t, "Test", response.Todos[0]["title"])
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/todos?view=full", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestTodoHandlerSparseFields tests restricting responses with ?fields=
+func TestTodoHandlerSparseFields(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+	todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test", Description: "Left out"})
+	assert.NoError(t, err)
+	path := "/api/v1/todos/" + strconv.Itoa(todo.ID)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedKeys   []string
+	}{
+		{name: "get", url: path + "?fields=id,title", expectedStatus: http.StatusOK, expectedKeys: []string{"id", "title"}},
+		{name: "get with links", url: path + "?fields=completed&links=true", expectedStatus: http.StatusOK, expectedKeys: []string{"completed", "_links"}},
+		{name: "get with date format", url: path + "?fields=created_at&date_format=date", expectedStatus: http.StatusOK, expectedKeys: []string{"created_at"}},
+		{name: "list", url: "/api/v1/todos?fields=id,%20completed", expectedStatus: http.StatusOK, expectedKeys: []string{"id", "completed"}},
+		{name: "unknown field", url: path + "?fields=id,secret", expectedStatus: http.StatusBadRequest},
+		{name: "list unknown field", url: "/api/v1/todos?fields=owner_id", expectedStatus: http.StatusBadRequest},
+		{name: "list with compact view", url: "/api/v1/todos?fields=id&view=compact", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, http.NoBody)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var object map[string]any
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &object))
+			if todos, ok := object["todos"].([]any); ok {
+				assert.Equal(t, float64(1), object["total"])
+				if !assert.Len(t, todos, 1) {
+					return
+				}
+				object = todos[0].(map[string]any)
+			}
+			keys := make([]string, 0, len(object))
+			for key := range object {
+				keys = append(keys, key)
+			}
+			assert.ElementsMatch(t, tt.expectedKeys, keys)
+		})
+	}
+}
+
+// TestTodoHandlerUniqueTitles tests the 409 answered for a duplicate title
+// when unique titles are enabled
+func TestTodoHandlerUniqueTitles(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+	repo.EnableUniqueTitles()
+
+	create := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/todos", strings.NewReader(`{"title":"Groceries"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, create().Code)
+
+	w := create()
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var response dto.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "conflict", response.Error)
+}
+
+// TestTodoHandlerCSVExport tests exporting the todo list as CSV
+func TestTodoHandlerCSVExport(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	for i := range 15 {
+		_, err := repo.Create(ownerContext(), dto.CreateTodoRequest{
+			Title:       fmt.Sprintf("todo %d", i),
+			Description: "milk, eggs",
+			Completed:   i%2 == 0,
+			Priority:    model.PriorityHigh,
+		})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		rows   int
+	}{
+		{name: "format query parameter", query: "?format=csv", rows: 15},
+		{name: "accept header", accept: "text/csv", rows: 15},
+		{name: "filters apply", query: "?format=csv&completed=true", rows: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/todos"+tt.query, http.NoBody)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Equal(t, `attachment; filename="todos.csv"`, w.Header().Get("Content-Disposition"))
+
+			records, err := csv.NewReader(w.Body).ReadAll()
+			assert.NoError(t, err)
+			if assert.Len(t, records, tt.rows+1) {
+				assert.Equal(t, []string{"id", "title", "description", "completed", "priority", "created_at", "updated_at"}, records[0])
+				assert.Equal(t, "milk, eggs", records[1][2])
+				assert.Equal(t, "high", records[1][4])
+			}
+		})
+	}
+}
+
+// TestTodoHandlerCSVFormulas tests that exported cells are never read as
+// formulas
+func TestTodoHandlerCSVFormulas(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	_, err := repo.Create(ownerContext(), dto.CreateTodoRequest{
+		Title:       "=HYPERLINK(\"http://example.com\")",
+		Description: "@SUM(1+1)",
+	})
+	assert.NoError(t, err)
+	_, err = repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "buy milk", Description: "-"})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/todos?format=csv&sort=position", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, []string{"'=HYPERLINK(\"http://example.com\")", "'@SUM(1+1)"}, records[1][1:3])
+		assert.Equal(t, []string{"buy milk", "'-"}, records[2][1:3])
+	}
+}
+
+// TestStreamsCSV tests which listing requests stream CSV
+func TestStreamsCSV(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		accept string
+		want   bool
+	}{
+		{name: "format query parameter", method: "GET", query: "?format=csv", want: true},
+		{name: "accept header", method: "GET", accept: "text/csv", want: true},
+		{name: "JSON listing", method: "GET", accept: "application/json", want: false},
+		{name: "creation", method: "POST", accept: "text/csv", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request, _ = http.NewRequest(tt.method, "/api/v1/todos"+tt.query, http.NoBody)
+			if tt.accept != "" {
+				c.Request.Header.Set("Accept", tt.accept)
+			}
+			assert.Equal(t, tt.want, StreamsCSV(c))
+		})
+	}
+}
+
+// TestTodoHandlerConditionalRequests tests ETag, If-None-Match and If-Match handling
+func TestTodoHandlerConditionalRequests(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test"})
+	assert.NoError(t, err)
+	path := "/api/v1/todos/" + strconv.Itoa(todo.ID)
+
+	send := func(method, body string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	get := send("GET", "", nil)
+	assert.Equal(t, http.StatusOK, get.Code)
+	etag := get.Header().Get("ETag")
+	assert.Equal(t, todo.ETag(), etag)
+
+	t.Run("matching If-None-Match returns 304", func(t *testing.T) {
+		w := send("GET", "", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+		assert.Contains(t, w.Header().Values("Vary"), "Accept")
+	})
+
+	t.Run("partial or localized representations are not revalidated", func(t *testing.T) {
+		for _, query := range []string{"?fields=id,title", "?date_format=rfc1123"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path+query, http.NoBody)
+			req.Header.Set("If-None-Match", etag)
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code, query)
+			assert.NotEmpty(t, w.Body.String(), query)
+		}
+	})
+
+	t.Run("stale If-None-Match returns the todo", func(t *testing.T) {
+		w := send("GET", "", map[string]string{"If-None-Match": `W/"stale"`})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("stale If-Match rejects the update", func(t *testing.T) {
+		w := send("PUT", `{"completed":true}`, map[string]string{"If-Match": `W/"stale"`})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+		current, err := repo.GetByID(ownerContext(), todo.ID)
+		assert.NoError(t, err)
+		assert.False(t, current.Completed)
+	})
+
+	t.Run("matching If-Match allows the update", func(t *testing.T) {
+		w := send("PUT", `{"completed":true}`, map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	})
+
+	t.Run("old ETag no longer allows delete", func(t *testing.T) {
+		w := send("DELETE", "", map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+		w = send("DELETE", "", map[string]string{"If-Match": "*"})
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+}
+
+// TestTodoHandlerHead tests existence checks via HEAD
+func TestTodoHandlerHead(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "existing todo", path: "/api/v1/todos/" + strconv.Itoa(todo.ID), expectedStatus: http.StatusOK},
+		{name: "missing todo", path: "/api/v1/todos/999", expectedStatus: http.StatusNotFound},
+		{name: "invalid id", path: "/api/v1/todos/abc", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("HEAD", tt.path, http.NoBody)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Empty(t, w.Body.String())
+		})
+	}
+}
+
+// unavailableRepository is a repository whose database cannot be reached
+type unavailableRepository struct {
+	*repository.InMemoryTodoRepository
+}
+
+func (unavailableRepository) Exists(context.Context, int) (bool, error) {
+	return false, repository.ErrUnavailable
+}
+
+func (unavailableRepository) Count(context.Context, repository.ListFilter) (int, error) {
+	return 0, repository.ErrUnavailable
+}
+
+// TestTodoHandlerHeadErrors tests that HEAD requests answer failures with
+// the status GET would use
+func TestTodoHandlerHeadErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := unavailableRepository{repository.NewInMemoryTodoRepository()}
+	h := NewTodoHandler(service.NewTodoService(repo, config.TodosConfig{}, config.PaginationConfig{DefaultPageSize: 10}, config.LimitsConfig{}, slog.New(slog.DiscardHandler)), false, "", dto.NamingSnake)
+	router := gin.New()
+	router.HEAD("/api/v1/todos", h.HeadTodos)
+	router.HEAD("/api/v1/todos/:id", h.HeadTodo)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "database unavailable", path: "/api/v1/todos/1", expectedStatus: http.StatusServiceUnavailable},
+		{name: "collection with database unavailable", path: "/api/v1/todos", expectedStatus: http.StatusServiceUnavailable},
+		{name: "collection with invalid filter", path: "/api/v1/todos?completed=maybe", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("HEAD", tt.path, http.NoBody)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Empty(t, w.Body.String())
+		})
+	}
+}
+
+// TestTodoHandlerCompletedFilter tests the strict parsing of ?completed=
+func TestTodoHandlerCompletedFilter(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	ctx := ownerContext()
+	for _, completed := range []bool{true, false, false} {
+		_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "Test", Completed: completed})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedTotal  int
+	}{
+		{name: "true", query: "?completed=true", expectedStatus: http.StatusOK, expectedTotal: 1},
+		{name: "false", query: "?completed=false", expectedStatus: http.StatusOK, expectedTotal: 2},
+		{name: "one", query: "?completed=1", expectedStatus: http.StatusOK, expectedTotal: 1},
+		{name: "zero", query: "?completed=0", expectedStatus: http.StatusOK, expectedTotal: 2},
+		{name: "unset", query: "", expectedStatus: http.StatusOK, expectedTotal: 3},
+		{name: "garbage", query: "?completed=foo", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/todos"+tt.query, http.NoBody)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				var response dto.ValidationErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, "validation_error", response.Error)
+				if assert.Len(t, response.Fields, 1) {
+					assert.Equal(t, "completed", response.Fields[0].Field)
+				}
+				return
+			}
+			var response dto.TodoListResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedTotal, response.Total)
+		})
+	}
+}
+
+// TestTodoHandlerHeadCollection tests counting todos via HEAD
+func TestTodoHandlerHeadCollection(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	ctx := ownerContext()
+	for _, completed := range []bool{true, false, false} {
+		_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "Test", Completed: completed})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedTotal  string
+	}{
+		{name: "all todos", expectedStatus: http.StatusOK, expectedTotal: "3"},
+		{name: "completed filter", query: "?completed=false", expectedStatus: http.StatusOK, expectedTotal: "2"},
+		{name: "invalid priority", query: "?priority=urgent", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("HEAD", "/api/v1/todos"+tt.query, http.NoBody)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedTotal, w.Header().Get("X-Total-Count"))
+			assert.Empty(t, w.Body.String())
+		})
+	}
+}
+
+// TestTodoHandlerUpdatedFields tests the X-Updated-Fields header of updates
+func TestTodoHandlerUpdatedFields(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test", Priority: model.PriorityLow})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedFields string
+	}{
+		{name: "partial update", body: `{"title":"Test","completed":true,"priority":"high"}`, expectedFields: "completed,priority"},
+		{name: "no-op update", body: `{"title":"Test","completed":true}`, expectedFields: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/api/v1/todos/"+strconv.Itoa(todo.ID), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Header(), "X-Updated-Fields")
+			assert.Equal(t, tt.expectedFields, w.Header().Get("X-Updated-Fields"))
+		})
+	}
+}
+
+// TestTodoHandlerBatchGet tests fetching several todos by ID
+func TestTodoHandlerBatchGet(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	ctx := ownerContext()
+	first, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "First"})
+	assert.NoError(t, err)
+	second, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "Second"})
+	assert.NoError(t, err)
+
+	tooMany := make([]string, 101)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i + 1)
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedTitles []string
+	}{
+		{
+			name:           "request order without missing todos",
+			body:           fmt.Sprintf(`{"ids":[%d,999,%d]}`, second.ID, first.ID),
+			expectedStatus: http.StatusOK,
+			expectedTitles: []string{"Second", "First"},
+		},
+		{name: "no ids", body: `{"ids":[]}`, expectedStatus: http.StatusBadRequest},
+		{name: "too many ids", body: `{"ids":[` + strings.Join(tooMany, ",") + `]}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/todos/batch-get", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var response dto.BatchGetResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			titles := make([]string, len(response.Todos))
+			for i, todo := range response.Todos {
+				titles[i] = todo.Title
+			}
+			assert.Equal(t, tt.expectedTitles, titles)
+		})
+	}
+}
+
+// TestTodoHandlerLimits tests that exceeding a limit reports the limit and
+// the received value
+func TestTodoHandlerLimits(t *testing.T) {
+	router, _ := newTestTodoRouter(t)
+
+	ids := func(n int) string {
+		values := make([]string, n)
+		for i := range values {
+			values[i] = strconv.Itoa(i + 1)
+		}
+		return `{"ids":[` + strings.Join(values, ",") + `]}`
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		body            string
+		expectedMessage string
+	}{
+		{name: "batch get", method: "POST", path: "/api/v1/todos/batch-get", body: ids(101), expectedMessage: "batch size 101 exceeds maximum 100"},
+		{name: "bulk delete", method: "DELETE", path: "/api/v1/todos", body: ids(1001), expectedMessage: "ids count 1001 exceeds maximum 1000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var response dto.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "limit_exceeded", response.Error)
+			assert.Equal(t, tt.expectedMessage, response.Message)
+		})
+	}
+}
+
+// TestTodoHandlerBulkDelete tests DELETE /api/v1/todos
+func TestTodoHandlerBulkDelete(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		body            string
+		expectedStatus  int
+		expectedDeleted int64
+		expectedLeft    int
+		expectedField   string
+	}{
+		{name: "completed filter", query: "?completed=true", expectedStatus: http.StatusOK, expectedDeleted: 2, expectedLeft: 1},
+		{name: "ids in body", body: `{"ids":[1,3,99]}`, expectedStatus: http.StatusOK, expectedDeleted: 2, expectedLeft: 1},
+		{name: "explicit all", query: "?all=true", expectedStatus: http.StatusOK, expectedDeleted: 3, expectedLeft: 0},
+		{name: "explicit all spelled 1", query: "?all=1", expectedStatus: http.StatusOK, expectedDeleted: 3, expectedLeft: 0},
+		{name: "all=false is no filter", query: "?all=false", expectedStatus: http.StatusBadRequest, expectedLeft: 3, expectedField: "ids"},
+		{name: "invalid all is rejected", query: "?all=yes", expectedStatus: http.StatusBadRequest, expectedLeft: 3, expectedField: "all"},
+		{name: "no filter is rejected", expectedStatus: http.StatusBadRequest, expectedLeft: 3, expectedField: "ids"},
+		{name: "invalid filter is rejected", query: "?completed=maybe", expectedStatus: http.StatusBadRequest, expectedLeft: 3, expectedField: "completed"},
+		{name: "ids with a filter are rejected", query: "?completed=true", body: `{"ids":[1]}`, expectedStatus: http.StatusBadRequest, expectedLeft: 3, expectedField: "ids"},
+		{name: "empty ids are rejected", body: `{"ids":[]}`, expectedStatus: http.StatusBadRequest, expectedLeft: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, repo := newTestTodoRouter(t)
+			ctx := ownerContext()
+			for _, completed := range []bool{true, false, true} {
+				_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "todo", Completed: completed})
+				assert.NoError(t, err)
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("DELETE", "/api/v1/todos"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var response dto.BulkDeleteResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedDeleted, response.Deleted)
+			}
+			if tt.expectedField != "" {
+				var response dto.ValidationErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, "validation_error", response.Error)
+				if assert.Len(t, response.Fields, 1) {
+					assert.Equal(t, tt.expectedField, response.Fields[0].Field)
+				}
+			}
+
+			_, total, err := repo.List(ctx, 1, 10, repository.ListFilter{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedLeft, total)
+		})
+	}
+}
+
+// TestTodoHandlerVersion tests the collection version token
+func TestTodoHandlerVersion(t *testing.T) {
+	router, _ := newTestTodoRouter(t)
+
+	version := func() string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/todos/version", http.NoBody)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response dto.VersionResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.NotEmpty(t, response.Version)
+		return response.Version
+	}
+
+	initial := version()
+	assert.Equal(t, initial, version())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/todos", strings.NewReader(`{"title":"Test"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	created := version()
+	assert.NotEqual(t, initial, created)
+	assert.Equal(t, created, version())
+}
+
+// TestTodoHandlerEmptyUpdate tests both modes of server.reject_empty_update
+func TestTodoHandlerEmptyUpdate(t *testing.T) {
+	tests := []struct {
+		name           string
+		reject         bool
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "no-op by default", reject: false, body: `{}`, expectedStatus: http.StatusOK},
+		{name: "rejected when enabled", reject: true, body: `{}`, expectedStatus: http.StatusBadRequest, expectedError: "empty_update"},
+		{name: "non-empty update when enabled", reject: true, body: `{"completed":true}`, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, repo := newTestTodoRouterWith(t, tt.reject)
+			todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test"})
+			assert.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/api/v1/todos/"+strconv.Itoa(todo.ID), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var response dto.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedError, response.Error)
+				assert.Equal(t, "no updatable fields provided", response.Message)
+			}
+		})
+	}
+}
+
+// TestTodoHandlerPaginationHeaders tests the Link and X-Total-Count headers
+func TestTodoHandlerPaginationHeaders(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+	for i := 0; i < 25; i++ {
+		_, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test"})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedLink string
+	}{
+		{
+			name:  "first page",
+			query: "page=1&page_size=10",
+			expectedLink: `</api/v1/todos?page=1&page_size=10>; rel="first", ` +
+				`</api/v1/todos?page=2&page_size=10>; rel="next", ` +
+				`</api/v1/todos?page=3&page_size=10>; rel="last"`,
+		},
+		{
+			name:  "middle page keeps other parameters",
+			query: "completed=false&page=2&page_size=10",
+			expectedLink: `</api/v1/todos?completed=false&page=1&page_size=10>; rel="first", ` +
+				`</api/v1/todos?completed=false&page=1&page_size=10>; rel="prev", ` +
+				`</api/v1/todos?completed=false&page=3&page_size=10>; rel="next", ` +
+				`</api/v1/todos?completed=false&page=3&page_size=10>; rel="last"`,
+		},
+		{
+			name:  "last page",
+			query: "page=3&page_size=10",
+			expectedLink: `</api/v1/todos?page=1&page_size=10>; rel="first", ` +
+				`</api/v1/todos?page=2&page_size=10>; rel="prev", ` +
+				`</api/v1/todos?page=3&page_size=10>; rel="last"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/todos?"+tt.query, http.NoBody)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "25", w.Header().Get("X-Total-Count"))
+			assert.Equal(t, tt.expectedLink, w.Header().Get("Link"))
+		})
+	}
+}
+
+// TestTodoHandlerCompletionTimeStats tests the average completion time and
+// its null value when no todo was completed
+func TestTodoHandlerCompletionTimeStats(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/todos/stats/completion-time", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"count":0,"average_seconds":null}`, w.Body.String())
+
+	_, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test", Completed: true})
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/todos/stats/completion-time", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response dto.CompletionTimeResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.Count)
+	if assert.NotNil(t, response.AverageSeconds) {
+		assert.InDelta(t, 0, *response.AverageSeconds, 1)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/todos/stats/completion-time?from=yesterday", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestTodoHandlerWeekdayStats tests the zero-filled day of week breakdown
+func TestTodoHandlerWeekdayStats(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+	todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test"})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/todos/stats/dow", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response dto.WeekdayStatsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "UTC", response.Timezone)
+	if assert.Len(t, response.Days, 7) {
+		assert.Equal(t, "sunday", response.Days[0].Day)
+		assert.Equal(t, "saturday", response.Days[6].Day)
+	}
+
+	today := strings.ToLower(todo.CreatedAt.UTC().Weekday().String())
+	for _, day := range response.Days {
+		if day.Day == today {
+			assert.Equal(t, 1, day.Count)
+		} else {
+			assert.Zero(t, day.Count)
+		}
+	}
+}
+
+// TestTodoHandlerCreatedRange tests the created_after and created_before filters
+func TestTodoHandlerCreatedRange(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+	_, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedTotal  int
+		expectedField  string
+	}{
+		{name: "range including now", query: "created_after=2000-01-01T00:00:00Z&created_before=2999-01-01T00:00:00Z", expectedStatus: http.StatusOK, expectedTotal: 1},
+		{name: "range in the past", query: "created_before=2000-01-01T00:00:00%2B02:00", expectedStatus: http.StatusOK, expectedTotal: 0},
+		{name: "invalid created_after", query: "created_after=yesterday", expectedStatus: http.StatusBadRequest, expectedField: "created_after"},
+		{name: "invalid created_before", query: "created_before=2024-13-01", expectedStatus: http.StatusBadRequest, expectedField: "created_before"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/todos?"+tt.query, http.NoBody)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedField != "" {
+				var response dto.ValidationErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, "validation_error", response.Error)
+				if assert.Len(t, response.Fields, 1) {
+					assert.Equal(t, tt.expectedField, response.Fields[0].Field)
+				}
+				return
+			}
+
+			var response dto.TodoListResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedTotal, response.Total)
+		})
+	}
+}
+
+// TestTodoHandlerCompleteAll tests POST /api/v1/todos/complete-all
+func TestTodoHandlerCompleteAll(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+	for _, completed := range []bool{true, false, false} {
+		_, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test", Completed: completed})
+		assert.NoError(t, err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/todos/complete-all", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response dto.BulkUpdateResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, int64(2), response.Updated)
+}
+
+func TestTodoHandlerDryRun(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+	var ids []string
+	for _, completed := range []bool{true, false, false} {
+		todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test", Completed: completed})
+		assert.NoError(t, err)
+		ids = append(ids, strconv.Itoa(todo.ID))
+	}
+	archived, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Archived"})
+	assert.NoError(t, err)
+	_, _, err = repo.Archive(ownerContext(), archived.ID)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		expected int64
+	}{
+		{"complete all", "POST", "/api/v1/todos/complete-all?dry_run=true", "", 3},
+		{"delete completed", "DELETE", "/api/v1/todos?completed=true&dry_run=true", "", 1},
+		{"delete all", "DELETE", "/api/v1/todos?all=true&dry_run=true", "", 4},
+		{"delete by ids", "DELETE", "/api/v1/todos?dry_run=true", `{"ids":[` + ids[0] + `,` + ids[1] + `,999]}`, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `{"would_affect":`+strconv.FormatInt(tt.expected, 10)+`}`, w.Body.String())
+		})
+	}
+
+	// Nothing was deleted nor completed
+	all := repository.ListFilter{IncludeArchived: true}
+	total, err := repo.Count(ownerContext(), all)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, total)
+	all.Completed = new(bool)
+	incomplete, err := repo.Count(ownerContext(), all)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, incomplete)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/todos/complete-all?dry_run=yes", http.NoBody)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	incomplete, err = repo.Count(ownerContext(), all)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, incomplete)
+}
+
+// TestTodoHandlerDateFormat tests the date_format and timezone parameters
+func TestTodoHandlerDateFormat(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+	todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Test"})
+	assert.NoError(t, err)
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	assert.NoError(t, err)
+
+	path := "/api/v1/todos/" + strconv.Itoa(todo.ID)
+	tests := []struct {
+		name            string
+		path            string
+		expectedStatus  int
+		expectedCreated string
+	}{
+		{name: "date in the configured zone", path: path + "?date_format=date", expectedStatus: http.StatusOK, expectedCreated: todo.CreatedAt.UTC().Format(time.DateOnly)},
+		{name: "datetime in a requested zone", path: path + "?date_format=datetime&timezone=Asia/Tokyo", expectedStatus: http.StatusOK, expectedCreated: todo.CreatedAt.In(tokyo).Format(time.DateTime)},
+		{name: "list with us format", path: "/api/v1/todos?date_format=us", expectedStatus: http.StatusOK, expectedCreated: todo.CreatedAt.UTC().Format("01/02/2006 03:04 PM")},
+		{name: "unknown format", path: path + "?date_format=2006", expectedStatus: http.StatusBadRequest},
+		{name: "unknown timezone", path: path + "?date_format=date&timezone=Mars/Olympus", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, http.NoBody)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedCreated == "" {
+				return
+			}
+
+			var response struct {
+				CreatedAt string `json:"created_at"`
+				Todos     []struct {
+					CreatedAt string `json:"created_at"`
+				} `json:"todos"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if len(response.Todos) > 0 {
+				assert.Equal(t, tt.expectedCreated, response.Todos[0].CreatedAt)
+			} else {
+				assert.Equal(t, tt.expectedCreated, response.CreatedAt)
+			}
+		})
+	}
+}
+
+// TestTodoHandlerPriority tests priority validation, filtering and sorting
+func TestTodoHandlerPriority(t *testing.T) {
+	router, _ := newTestTodoRouter(t)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/api/v1/todos", `{"title":"default"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created dto.TodoResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "medium", created.Priority)
+
+	w = send("POST", "/api/v1/todos", `{"title":"urgent","priority":"high"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	t.Run("unknown priority on create", func(t *testing.T) {
+		w := send("POST", "/api/v1/todos", `{"title":"bad","priority":"urgent"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var response dto.ValidationErrorResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		if assert.Len(t, response.Fields, 1) {
+			assert.Equal(t, "priority", response.Fields[0].Field)
+			assert.Equal(t, "priority must be one of: low, medium, high", response.Fields[0].Message)
+		}
+	})
+
+	t.Run("unknown priority on update", func(t *testing.T) {
+		w := send("PUT", "/api/v1/todos/"+strconv.Itoa(created.ID), `{"priority":"urgent"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("update priority", func(t *testing.T) {
+		w := send("PUT", "/api/v1/todos/"+strconv.Itoa(created.ID), `{"priority":"low"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var updated dto.TodoResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+		assert.Equal(t, "low", updated.Priority)
+	})
+
+	t.Run("filter and sort", func(t *testing.T) {
+		w := send("GET", "/api/v1/todos?priority=high", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var filtered dto.TodoListResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &filtered))
+		assert.Equal(t, 1, filtered.Total)
+
+		w = send("GET", "/api/v1/todos?sort=priority", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var sorted dto.TodoListResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sorted))
+		if assert.Len(t, sorted.Todos, 2) {
+			assert.Equal(t, "high", sorted.Todos[0].Priority)
+			assert.Equal(t, "low", sorted.Todos[1].Priority)
+		}
+	})
+
+	t.Run("invalid list parameters", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, send("GET", "/api/v1/todos?priority=urgent", "").Code)
+		assert.Equal(t, http.StatusBadRequest, send("GET", "/api/v1/todos?sort=title", "").Code)
+	})
+}
+
+// TestEventsHandlerStream tests that todo changes reach an open event stream
+func TestEventsHandlerStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hub := events.NewHub(4)
+	svc := service.NewTodoService(repository.NewInMemoryTodoRepository(), config.TodosConfig{}, config.PaginationConfig{DefaultPageSize: 10}, config.LimitsConfig{}, slog.New(slog.DiscardHandler))
+	svc.PublishEvents(hub)
+
+	router := gin.New()
+	router.GET("/api/v1/todos/events", asTestOwner, NewEventsHandler(hub, time.Hour, dto.NamingSnake).Stream)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/v1/todos/events", http.NoBody)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// The headers are flushed once subscribed, so the event is not missed
+	todo, err := svc.CreateTodo(ownerContext(), dto.CreateTodoRequest{Title: "Streamed"})
+	assert.NoError(t, err)
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "event:todo.created\n", line)
+	line, err = reader.ReadString('\n')
+	assert.NoError(t, err)
+	var data dto.TodoResponse
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &data))
+	assert.Equal(t, todo.ID, data.ID)
+	assert.Equal(t, "Streamed", data.Title)
+
+	// Disconnecting ends the subscription
+	cancel()
+	assert.Eventually(t, func() bool { return hub.Subscribers() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+// TestEventsHandlerShutdown tests that closing the hub on shutdown ends
+// open streams, so the server stops without waiting for them
+func TestEventsHandlerShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hub := events.NewHub(4)
+	router := gin.New()
+	router.GET("/api/v1/todos/events", NewEventsHandler(hub, time.Hour, dto.NamingSnake).Stream)
+
+	// Reserve a free port, released for the server to listen on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	assert.NoError(t, ln.Close())
+
+	srv := &http.Server{Addr: addr, Handler: router}
+	srv.RegisterOnShutdown(hub.Close)
+	server := lifecycle.NewHTTPServer(srv, "", "", func(err error) {
+		t.Errorf("unexpected serve error: %v", err)
+	})
+	assert.NoError(t, server.Start(context.Background()))
+
+	resp, err := http.Get("http://" + addr + "/api/v1/todos/events")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 1, hub.Subscribers())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	assert.NoError(t, server.Stop(ctx))
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Equal(t, 0, hub.Subscribers())
+}
+
+// TestTodoHandlerCreateLocation tests the absolute URL of a created todo
+func TestTodoHandlerCreateLocation(t *testing.T) {
+	router, _ := newTestTodoRouter(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/todos", strings.NewReader(`{"title":"Located"}`))
+	req.Host = "localhost:8080"
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response dto.TodoResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "http://localhost:8080/api/v1/todos/"+strconv.Itoa(response.ID), w.Header().Get("Location"))
+
+	// Headers let through from a trusted proxy describe the external URL
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/todos", strings.NewReader(`{"title":"Proxied"}`))
+	req.Host = "10.0.0.5:8080"
+	req.Header.Set(middleware.ForwardedProtoHeader, "https")
+	req.Header.Set(middleware.ForwardedHostHeader, "api.example.com")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "https://api.example.com/api/v1/todos/"+strconv.Itoa(response.ID), w.Header().Get("Location"))
+}
+
+// TestTodoHandlerCreateLocationResolves tests that the Location of a created
+// todo, base path included, leads back to it
+func TestTodoHandlerCreateLocationResolves(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := repository.NewInMemoryTodoRepository()
+	h := NewTodoHandler(service.NewTodoService(repo, config.TodosConfig{}, config.PaginationConfig{DefaultPageSize: 10}, config.LimitsConfig{}, slog.New(slog.DiscardHandler)), false, "/todo-api", dto.NamingSnake)
+
+	// The proxy strips /todo-api before forwarding
+	router := gin.New()
+	router.Use(asTestOwner)
+	router.POST("/api/v1/todos", h.CreateTodo)
+	router.GET("/api/v1/todos/:id", h.GetTodo)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/todos", strings.NewReader(`{"title":"Follow me"}`))
+	req.Host = "example.com"
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", location.Host)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", strings.TrimPrefix(location.Path, "/todo-api"), http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response dto.TodoResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Follow me", response.Title)
+}
+
+// TestTodoHandlerBusinessRules tests that well formed requests breaking a
+// business rule get 422 with the fields at fault, not 400
+func TestTodoHandlerBusinessRules(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/todos", strings.NewReader(`{"title":"Same","description":"same"}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var response dto.ValidationErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "unprocessable_entity", response.Error)
+	assert.Equal(t, []dto.FieldError{{Field: "description", Rule: "nefield", Message: "description must differ from title"}}, response.Fields)
+
+	todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Original"})
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/v1/todos/"+strconv.Itoa(todo.ID), strings.NewReader(`{"title":"Both","description":"Both"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Malformed JSON is still a 400
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/todos", strings.NewReader(`{"title":`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestTodoHandlerUpsert tests creating then replacing a todo by external ID
+func TestTodoHandlerUpsert(t *testing.T) {
+	router, _ := newTestTodoRouter(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/v1/todos/by-external/crm-42", strings.NewReader(`{"title":"Call back"}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created dto.TodoResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "crm-42", created.ExternalID)
+	assert.Equal(t, "medium", created.Priority)
+	assert.True(t, strings.HasSuffix(w.Header().Get("Location"), "/api/v1/todos/"+strconv.Itoa(created.ID)))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/v1/todos/by-external/crm-42", strings.NewReader(`{"title":"Called back","completed":true}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var updated dto.TodoResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, created.ID, updated.ID)
+	assert.Equal(t, "Called back", updated.Title)
+	assert.True(t, updated.Completed)
+	assert.Empty(t, w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/v1/todos/by-external/"+strings.Repeat("x", 256), strings.NewReader(`{"title":"Too long"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTodoHandlerTextLengths(t *testing.T) {
+	router, _ := newTestTodoRouter(t)
+
+	tests := []struct {
+		name        string
+		title       string
+		description string
+		expected    int
+	}{
+		{"longest title", strings.Repeat("é", model.MaxTitleLength), "", http.StatusCreated},
+		{"title too long", strings.Repeat("é", model.MaxTitleLength+1), "", http.StatusBadRequest},
+		{"longest description", "Title", strings.Repeat("é", model.MaxDescriptionLength), http.StatusCreated},
+		{"description too long", "Title", strings.Repeat("é", model.MaxDescriptionLength+1), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(dto.CreateTodoRequest{Title: tt.title, Description: tt.description})
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/todos", bytes.NewReader(body))
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+func TestTodoHandlerReorder(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+	var ids []string
+	for _, title := range []string{"first", "second"} {
+		todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: title})
+		assert.NoError(t, err)
+		ids = append(ids, strconv.Itoa(todo.ID))
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/v1/todos/reorder", strings.NewReader(`{"ids":[`+ids[1]+`,`+ids[0]+`]}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/todos?sort=position", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response dto.TodoListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if assert.Len(t, response.Todos, 2) {
+		assert.Equal(t, "second", response.Todos[0].Title)
+		assert.Equal(t, 1, response.Todos[0].Position)
+		assert.Equal(t, "first", response.Todos[1].Title)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/v1/todos/reorder", strings.NewReader(`{"ids":[`+ids[0]+`,`+ids[0]+`]}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "ids must not contain duplicates")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/v1/todos/reorder", strings.NewReader(`{"ids":[999]}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTodoHandlerArchive(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+	todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Old news"})
+	assert.NoError(t, err)
+	path := "/api/v1/todos/" + strconv.Itoa(todo.ID)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path+"/archive", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var archived dto.TodoResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &archived))
+	assert.NotNil(t, archived.ArchivedAt)
+
+	list := func(query string) dto.TodoListResponse {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/todos"+query, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response dto.TodoListResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	assert.Equal(t, 0, list("").Total)
+	assert.Equal(t, 1, list("?include_archived=true").Total)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/todos?include_archived=maybe", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", path+"/unarchive", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var unarchived dto.TodoResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &unarchived))
+	assert.Nil(t, unarchived.ArchivedAt)
+	assert.Equal(t, 1, list("").Total)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/todos/999/archive", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// fakeLevel is a LevelSetter accepting debug and info
+type fakeLevel struct {
+	name string
+}
+
+func (l *fakeLevel) Set(name string) error {
+	if name != "debug" && name != "info" {
+		return errors.New("unknown level")
+	}
+	l.name = name
+	return nil
+}
+
+func (l *fakeLevel) String() string { return l.name }
+
+// TestLogLevelHandler tests changing the logging level
+func TestLogLevelHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	level := &fakeLevel{name: "info"}
+	router := gin.New()
+	router.POST("/api/v1/admin/log-level", NewLogLevelHandler(level).SetLogLevel)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/admin/log-level", strings.NewReader(`{"level":"debug"}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level":"debug"}`, w.Body.String())
+	assert.Equal(t, "debug", level.name)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/admin/log-level", strings.NewReader(`{"level":"verbose"}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"level"`)
+	assert.Equal(t, "debug", level.name)
+}
+
+// TestTodoHandlerMsgPack tests that responses follow the Accept header
+func TestTodoHandlerMsgPack(t *testing.T) {
+	router, repo := newTestTodoRouter(t)
+
+	todo, err := repo.Create(ownerContext(), dto.CreateTodoRequest{Title: "Binary", Description: "Packed", Priority: model.PriorityHigh})
+	assert.NoError(t, err)
+	path := "/api/v1/todos/" + strconv.Itoa(todo.ID)
+
+	for _, accept := range []string{"application/msgpack", "application/x-msgpack"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, http.NoBody)
+		req.Header.Set("Accept", accept)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "msgpack")
+		var response dto.TodoResponse
+		assert.NoError(t, codec.NewDecoderBytes(w.Body.Bytes(), &codec.MsgpackHandle{}).Decode(&response))
+		assert.Equal(t, todo.ID, response.ID)
+		assert.Equal(t, "Binary", response.Title)
+		assert.Equal(t, "Packed", response.Description)
+		assert.Equal(t, "high", response.Priority)
+		assert.True(t, response.CreatedAt.Equal(todo.CreatedAt))
+	}
+
+	for _, accept := range []string{"", "*/*", "application/json", "text/html"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, http.NoBody)
+		req.Header.Set("Accept", accept)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/json", "Accept %q", accept)
+		var response dto.TodoResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Binary", response.Title)
+	}
+}
+
+func TestAuthHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc, err := auth.NewService(auth.NewInMemoryUserStore(), auth.NewInMemorySessionStore(), auth.NewTokens([]byte("0123456789abcdef0123456789abcdef"), time.Hour), 24*time.Hour)
+	assert.NoError(t, err)
+	authHandler := NewAuthHandler(svc, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/auth/register", authHandler.Register)
+	router.POST("/api/v1/auth/login", authHandler.Login)
+	router.POST("/api/v1/auth/refresh", authHandler.Refresh)
+	router.POST("/api/v1/auth/logout", authHandler.Logout)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/api/v1/auth/register", `{"email":"alice@example.com","password":"correct horse"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var user dto.UserResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, "alice@example.com", user.Email)
+	assert.NotContains(t, w.Body.String(), "password")
+
+	w = post("/api/v1/auth/register", `{"email":"alice@example.com","password":"correct horse"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "email_taken")
+
+	w = post("/api/v1/auth/register", `{"email":"not an email","password":"short"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = post("/api/v1/auth/login", `{"email":"alice@example.com","password":"wrong horse"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_credentials")
+
+	w = post("/api/v1/auth/login", `{"email":"alice@example.com","password":"correct horse"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var token dto.TokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+	assert.Equal(t, "Bearer", token.TokenType)
+	userID, err := svc.Verify(token.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+
+	w = post("/api/v1/auth/refresh", `{"refresh_token":"`+token.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var refreshed dto.TokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+	assert.NotEqual(t, token.RefreshToken, refreshed.RefreshToken)
+
+	w = post("/api/v1/auth/logout", `{"refresh_token":"`+refreshed.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = post("/api/v1/auth/refresh", `{"refresh_token":"`+refreshed.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_refresh_token")
+}
+
+func TestAPIKeyHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	apiKeyHandler := NewAPIKeyHandler(auth.NewAPIKeys(auth.NewInMemoryAPIKeyStore()))
+	router := gin.New()
+	apiKeys := router.Group("/api/v1/apikeys", middleware.RequireOwner())
+	apiKeys.POST("", apiKeyHandler.CreateAPIKey)
+	apiKeys.GET("", apiKeyHandler.ListAPIKeys)
+	apiKeys.DELETE("/:id", apiKeyHandler.DeleteAPIKey)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(middleware.UserIDHeader, "alice")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/api/v1/apikeys", `{"name":"backup","scopes":["todos:read"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created dto.CreatedAPIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Key)
+	assert.Equal(t, []string{"todos:read"}, created.Scopes)
+
+	w = do("POST", "/api/v1/apikeys", `{"name":"backup","scopes":["todos:admin"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var invalid dto.ValidationErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &invalid))
+	if assert.Len(t, invalid.Fields, 1) {
+		assert.Equal(t, "scopes[0]", invalid.Fields[0].Field)
+	}
+
+	w = do("GET", "/api/v1/apikeys", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+	var list dto.APIKeyListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.APIKeys, 1)
+
+	w = do("DELETE", "/api/v1/apikeys/"+strconv.Itoa(created.ID), "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = do("DELETE", "/api/v1/apikeys/"+strconv.Itoa(created.ID), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "api_key_not_found")
+}
+
+// TestAPIKeyHandlerLogBodies tests the shipped redact_keys mask the secret
+// of a created API key in logged bodies
+func TestAPIKeyHandlerLogBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg, err := config.Load("../../configs/config.toml")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	apiKeyHandler := NewAPIKeyHandler(auth.NewAPIKeys(auth.NewInMemoryAPIKeyStore()))
+	router := gin.New()
+	router.Use(middleware.LogBodies(log, cfg.Logging.MaxBodyLogSize, cfg.Logging.RedactKeys))
+	router.POST("/api/v1/apikeys", middleware.RequireOwner(), apiKeyHandler.CreateAPIKey)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/apikeys", strings.NewReader(`{"name":"backup","scopes":["todos:read"]}`))
+	req.Header.Set(middleware.UserIDHeader, "alice")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created dto.CreatedAPIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	if !assert.NotEmpty(t, created.Key) {
+		return
+	}
+	assert.NotContains(t, buf.String(), created.Key)
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	body, _ := record["response_body"].(string)
+	var logged map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(body), &logged))
+	assert.Equal(t, "****", logged["key"])
+	assert.Equal(t, "backup", logged["name"])
+}
+
+func TestAuthHandlerOIDC(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issuer := "http://" + r.Host
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "authorization_endpoint": issuer + "/authorize"})
+	}))
+	defer provider.Close()
+
+	svc, err := auth.NewService(auth.NewInMemoryUserStore(), auth.NewInMemorySessionStore(), auth.NewTokens([]byte("0123456789abcdef0123456789abcdef"), time.Hour), 24*time.Hour)
+	assert.NoError(t, err)
+	oidc := auth.NewOIDC(config.OIDCConfig{Issuer: provider.URL, ClientID: "client", ClientSecret: "secret", RedirectURL: "http://localhost/callback"}, provider.Client())
+	authHandler := NewAuthHandler(svc, oidc, nil)
+	router := gin.New()
+	router.GET("/api/v1/auth/oidc/login", authHandler.OIDCLogin)
+	router.GET("/api/v1/auth/oidc/callback", authHandler.OIDCCallback)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/auth/oidc/login", http.NoBody)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Location"), provider.URL+"/authorize?"))
+	cookies := w.Result().Cookies()
+	if !assert.Len(t, cookies, 1) {
+		return
+	}
+	assert.True(t, cookies[0].HttpOnly)
+	loginRequest, ok := auth.ParseAuthRequest(cookies[0].Value)
+	assert.True(t, ok)
+
+	t.Run("state mismatch", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/auth/oidc/callback?code=code&state=forged", http.NoBody)
+		req.AddCookie(cookies[0])
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid_login_state")
+	})
+
+	t.Run("missing cookie", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/auth/oidc/callback?code=code&state="+loginRequest.State, http.NoBody)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/auth/oidc/callback?error=access_denied&state="+loginRequest.State, http.NoBody)
+		req.AddCookie(cookies[0])
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "oidc_login_failed")
+	})
+}
+
+func TestAuthHandlerCookieSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc, err := auth.NewService(auth.NewInMemoryUserStore(), auth.NewInMemorySessionStore(), auth.NewTokens([]byte("0123456789abcdef0123456789abcdef"), time.Hour), 24*time.Hour)
+	assert.NoError(t, err)
+	_, err = svc.Register(context.Background(), "alice@example.com", "correct horse")
+	assert.NoError(t, err)
+	authHandler := NewAuthHandler(svc, nil, auth.NewCookies(true))
+	router := gin.New()
+	router.POST("/api/v1/auth/login", authHandler.Login)
+	router.POST("/api/v1/auth/logout", authHandler.Logout)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/auth/login", strings.NewReader(`{"email":"alice@example.com","password":"correct horse"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	if assert.Contains(t, cookies, auth.AccessTokenCookie) && assert.Contains(t, cookies, auth.CSRFCookie) {
+		assert.True(t, cookies[auth.AccessTokenCookie].HttpOnly)
+		assert.True(t, cookies[auth.AccessTokenCookie].Secure)
+		assert.False(t, cookies[auth.CSRFCookie].HttpOnly, "read by the web UI")
+		assert.NotEmpty(t, cookies[auth.CSRFCookie].Value)
+	}
+
+	var token dto.TokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/auth/logout", strings.NewReader(`{"refresh_token":"`+token.RefreshToken+`"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	for _, cookie := range w.Result().Cookies() {
+		assert.Empty(t, cookie.Value, cookie.Name)
+		assert.Negative(t, cookie.MaxAge, cookie.Name)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	log := audit.NewLog(audit.NewInMemoryStore())
+	repo := repository.NewInMemoryTodoRepository()
+	repo.RecordAudit(log)
+	svc := service.NewTodoService(repo, config.TodosConfig{}, config.PaginationConfig{DefaultPageSize: 10}, config.LimitsConfig{MaxPageSize: 100}, slog.New(slog.DiscardHandler))
+	todoHandler := NewTodoHandler(svc, false, "", dto.NamingSnake)
+	auditHandler := NewAuditHandler(log)
+
+	router := gin.New()
+	router.Use(middleware.RecordClientIP())
+	todos := router.Group("/api/v1/todos", middleware.RequireOwner())
+	todos.POST("", todoHandler.CreateTodo)
+	todos.PUT("/:id", todoHandler.UpdateTodo)
+	router.GET("/api/v1/admin/audit", auditHandler.ListEvents)
+	router.GET("/api/v1/admin/audit/verify", auditHandler.VerifyEvents)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(middleware.UserIDHeader, "alice")
+		req.RemoteAddr = "192.0.2.1:1234"
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, do("POST", "/api/v1/todos", `{"title":"a"}`).Code)
+	assert.Equal(t, http.StatusOK, do("PUT", "/api/v1/todos/1", `{"completed":true}`).Code)
+
+	w := do("GET", "/api/v1/admin/audit?actor=alice&limit=1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page dto.AuditEventListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	if assert.Len(t, page.Events, 1) && assert.NotNil(t, page.NextAfterID) {
+		assert.Equal(t, "create", page.Events[0].Action)
+		assert.Equal(t, "192.0.2.1", page.Events[0].IP)
+		assert.Nil(t, page.Events[0].Before)
+		assert.Empty(t, page.Events[0].PrevHash)
+
+		w = do("GET", "/api/v1/admin/audit?after_id="+strconv.FormatInt(*page.NextAfterID, 10), "")
+		assert.Contains(t, w.Body.String(), `"action":"update"`)
+		assert.Contains(t, w.Body.String(), `"prev_hash":"`+page.Events[0].Hash+`"`)
+		assert.NotContains(t, w.Body.String(), "next_after_id")
+	}
+
+	w = do("GET", "/api/v1/admin/audit?limit=0", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"limit"`)
+
+	w = do("GET", "/api/v1/admin/audit/verify", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"valid":true,"events":2}`, w.Body.String())
+}
+
+func TestExportHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := service.NewTodoService(repository.NewInMemoryTodoRepository(), config.TodosConfig{}, config.PaginationConfig{DefaultPageSize: 10}, config.LimitsConfig{MaxPageSize: 100}, slog.New(slog.DiscardHandler))
+	exporter := export.NewExporter(svc, nil)
+	jobs := export.NewJobs(exporter, time.Hour, 0, slog.New(slog.DiscardHandler))
+	assert.NoError(t, jobs.Start(context.Background()))
+	t.Cleanup(func() { _ = jobs.Stop(context.Background()) })
+	todoHandler := NewTodoHandler(svc, false, "", dto.NamingSnake)
+	exportHandler := NewExportHandler(exporter, jobs, svc, 1, "")
+
+	router := gin.New()
+	router.POST("/api/v1/todos", middleware.RequireOwner(), todoHandler.CreateTodo)
+	me := router.Group("/api/v1/users/me", middleware.RequireOwner())
+	me.GET("/export", exportHandler.Export)
+	me.GET("/exports/:id", exportHandler.GetExport)
+	me.GET("/exports/:id/download", exportHandler.DownloadExport)
+
+	do := func(userID, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(middleware.UserIDHeader, userID)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, do("alice", "POST", "/api/v1/todos", `{"title":"a"}`).Code)
+
+	w := do("alice", "GET", "/api/v1/users/me/export", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="export.json"`, w.Header().Get("Content-Disposition"))
+	assert.Contains(t, w.Body.String(), `"user_id":"alice"`)
+	assert.Contains(t, w.Body.String(), `"title":"a"`)
+
+	w = do("alice", "GET", "/api/v1/users/me/export?format=xml&async=maybe", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"format"`)
+	assert.Contains(t, w.Body.String(), `"field":"async"`)
+
+	// Accounts above the threshold are exported in the background
+	assert.Equal(t, http.StatusCreated, do("alice", "POST", "/api/v1/todos", `{"title":"b"}`).Code)
+	w = do("alice", "GET", "/api/v1/users/me/export?format=zip", "")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var job dto.ExportJobResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, "zip", job.Format)
+	assert.True(t, strings.HasSuffix(w.Header().Get("Location"), "/api/v1/users/me/exports/"+job.ID))
+
+	assert.Equal(t, http.StatusNotFound, do("bob", "GET", "/api/v1/users/me/exports/"+job.ID, "").Code)
+	assert.Eventually(t, func() bool {
+		w = do("alice", "GET", "/api/v1/users/me/exports/"+job.ID, "")
+		return strings.Contains(w.Body.String(), `"status":"ready"`)
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, w.Body.String(), `"download_url":"/api/v1/users/me/exports/`+job.ID+`/download"`)
+
+	w = do("alice", "GET", "/api/v1/users/me/exports/"+job.ID+"/download", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("PK")))
+
+	w = do("alice", "GET", "/api/v1/users/me/exports/unknown", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "export_not_found")
+}
@@ -1,19 +1,24 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 
-	"github.com/g3offrey/idiomapi/internal/database"
 	"github.com/gin-gonic/gin"
 )
 
+// HealthChecker reports whether the backing data store is reachable
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
 // HealthHandler handles health check requests
 type HealthHandler struct {
-	db *database.Database
+	db HealthChecker
 }
 
 // NewHealthHandler creates a new HealthHandler
-func NewHealthHandler(db *database.Database) *HealthHandler {
+func NewHealthHandler(db HealthChecker) *HealthHandler {
 	return &HealthHandler{db: db}
 }
 
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// todosPath is the path of the todos collection below the base path
+const todosPath = "/api/v1/todos"
+
+// addLinks fills in the links of response when the request asked for them
+// with ?links=true
+func (h *TodoHandler) addLinks(c *gin.Context, response *dto.TodoResponse) {
+	if c.Query("links") != "true" {
+		return
+	}
+	response.Links = &dto.TodoLinks{
+		Self: h.basePath + todosPath + "/" + strconv.Itoa(response.ID),
+	}
+}
+
+// todoURL returns the absolute URL of the todo id, as the client sees it
+func (h *TodoHandler) todoURL(c *gin.Context, id int) string {
+	return baseURL(c.Request) + h.basePath + todosPath + "/" + strconv.Itoa(id)
+}
+
+// baseURL returns the scheme and host the client sent r to. The forwarded
+// headers are only present when middleware.ForwardedHeaders let a trusted
+// proxy set them.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get(middleware.ForwardedProtoHeader); proto != "" {
+		scheme = proto
+	}
+
+	host := r.Host
+	if forwarded := r.Header.Get(middleware.ForwardedHostHeader); forwarded != "" {
+		host = forwarded
+	}
+	return scheme + "://" + host
+}
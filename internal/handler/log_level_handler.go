@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// LevelSetter changes the level of the running logger
+type LevelSetter interface {
+	Set(name string) error
+	String() string
+}
+
+// LogLevelHandler handles requests changing the logging level
+type LogLevelHandler struct {
+	level LevelSetter
+}
+
+// NewLogLevelHandler creates a new LogLevelHandler
+func NewLogLevelHandler(level LevelSetter) *LogLevelHandler {
+	return &LogLevelHandler{level: level}
+}
+
+// SetLogLevel handles POST /api/v1/admin/log-level
+func (h *LogLevelHandler) SetLogLevel(c *gin.Context) {
+	var req dto.LogLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, &req)
+		return
+	}
+
+	if err := h.level.Set(req.Level); err != nil {
+		respondFieldErrors(c, []dto.FieldError{{
+			Field:   "level",
+			Rule:    "oneof",
+			Message: "level must be one of debug, info, warn, error",
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.LogLevelResponse{Level: h.level.String()})
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/database"
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// Maintainer runs database maintenance on the todos table
+type Maintainer interface {
+	Run(ctx context.Context) (string, time.Duration, error)
+}
+
+// MaintenanceHandler handles database administration requests
+type MaintenanceHandler struct {
+	maintenance Maintainer
+}
+
+// NewMaintenanceHandler creates a new MaintenanceHandler
+func NewMaintenanceHandler(maintenance Maintainer) *MaintenanceHandler {
+	return &MaintenanceHandler{maintenance: maintenance}
+}
+
+// RunMaintenance handles POST /api/v1/admin/db/maintenance
+func (h *MaintenanceHandler) RunMaintenance(c *gin.Context) {
+	command, duration, err := h.maintenance.Run(c.Request.Context())
+	if errors.Is(err, database.ErrMaintenanceTooSoon) {
+		c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{
+			Error:   "too_many_requests",
+			Message: "Maintenance ran too recently, try again later",
+		})
+		return
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MaintenanceResponse{
+		Command:    command,
+		DurationMs: duration.Milliseconds(),
+	})
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setPaginationHeaders writes an RFC 5988 Link header pointing at the
+// first, previous, next and last pages, and an X-Total-Count header. Page
+// URLs keep every other query parameter of the request.
+func setPaginationHeaders(c *gin.Context, page, pageSize, totalPages, total int) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+
+	links := []string{pageLink(c.Request.URL, 1, pageSize, "first")}
+	if page > 1 {
+		links = append(links, pageLink(c.Request.URL, min(page-1, totalPages), pageSize, "prev"))
+	}
+	if page < totalPages {
+		links = append(links, pageLink(c.Request.URL, page+1, pageSize, "next"))
+	}
+	links = append(links, pageLink(c.Request.URL, totalPages, pageSize, "last"))
+
+	c.Header("Link", strings.Join(links, ", "))
+}
+
+// pageLink formats a Link header entry for the given page of the listing
+// at u
+func pageLink(u *url.URL, page, pageSize int, rel string) string {
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("page_size", strconv.Itoa(pageSize))
+
+	target := url.URL{Path: u.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", target.String(), rel)
+}
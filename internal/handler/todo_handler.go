@@ -1,79 +1,252 @@
 package handler
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/model"
 	"github.com/g3offrey/idiomapi/internal/repository"
 	"github.com/g3offrey/idiomapi/internal/service"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
 )
 
+// collectionMethods lists the methods supported on /api/v1/todos
+var collectionMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodDelete, http.MethodOptions}
+
 // TodoHandler handles HTTP requests for todos
 type TodoHandler struct {
-	service *service.TodoService
+	service           *service.TodoService
+	rejectEmptyUpdate bool
+	basePath          string
+	naming            dto.Naming
 }
 
-// NewTodoHandler creates a new TodoHandler
-func NewTodoHandler(service *service.TodoService) *TodoHandler {
-	return &TodoHandler{service: service}
+// NewTodoHandler creates a new TodoHandler. When rejectEmptyUpdate is set,
+// updates that set no field are answered with 400 instead of returning the
+// todo unchanged. basePath prefixes the URLs of the links requested with
+// ?links=true. naming sets the case of the keys of JSON responses.
+func NewTodoHandler(service *service.TodoService, rejectEmptyUpdate bool, basePath string, naming dto.Naming) *TodoHandler {
+	return &TodoHandler{
+		service:           service,
+		rejectEmptyUpdate: rejectEmptyUpdate,
+		basePath:          strings.TrimSuffix(basePath, "/"),
+		naming:            naming,
+	}
+}
+
+// respond writes body with the configured key naming, as MessagePack when
+// the Accept header prefers it and as JSON otherwise. Error responses need
+// no renaming since their keys are single words.
+func (h *TodoHandler) respond(c *gin.Context, status int, body any) {
+	body, err := h.naming.Apply(body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	switch c.NegotiateFormat(gin.MIMEJSON, binding.MIMEMSGPACK2, binding.MIMEMSGPACK) {
+	case binding.MIMEMSGPACK2, binding.MIMEMSGPACK:
+		// Renamed keys come back as JSON, which MessagePack would encode
+		// as a byte string
+		if raw, ok := body.(json.RawMessage); ok {
+			var decoded any
+			if err := json.Unmarshal(raw, &decoded); err != nil {
+				respondError(c, err)
+				return
+			}
+			body = decoded
+		}
+		c.Render(status, render.MsgPack{Data: body})
+	default:
+		c.JSON(status, body)
+	}
 }
 
 // CreateTodo handles POST /api/v1/todos
 func (h *TodoHandler) CreateTodo(c *gin.Context) {
 	var req dto.CreateTodoRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "validation_error",
-			Message: err.Error(),
-		})
+		respondBindError(c, err, &req)
 		return
 	}
 
 	todo, err := h.service.CreateTodo(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error:   "internal_error",
-			Message: "Failed to create todo",
-		})
+		respondError(c, err)
 		return
 	}
 
 	response := dto.ToTodoResponse(todo)
-	c.JSON(http.StatusCreated, response)
+	h.addLinks(c, &response)
+	c.Header("Location", h.todoURL(c, todo.ID))
+	h.respond(c, http.StatusCreated, response)
 }
 
 // GetTodo handles GET /api/v1/todos/:id
 func (h *TodoHandler) GetTodo(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid todo ID",
-		})
+		respondError(c, service.ErrInvalidID)
+		return
+	}
+
+	format, fields, err := h.parseDateFormat(c, nil)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	fieldSet, fields := parseFieldSet(c, fields)
+	if len(fields) > 0 {
+		respondFieldErrors(c, fields)
 		return
 	}
 
 	todo, err := h.service.GetTodo(c.Request.Context(), id)
 	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			c.JSON(http.StatusNotFound, dto.ErrorResponse{
-				Error:   "not_found",
-				Message: "Todo not found",
-			})
+		respondError(c, err)
+		return
+	}
+
+	// The ETag identifies the todo's state, not its representation: it is
+	// shared by the JSON and MessagePack bodies, and a partial or localized
+	// body is never revalidated
+	etag := todo.ETag()
+	c.Header("ETag", etag)
+	c.Writer.Header().Add("Vary", "Accept")
+	ifNoneMatch := c.GetHeader("If-None-Match")
+	if ifNoneMatch != "" && fieldSet == nil && format == nil && etagMatches(ifNoneMatch, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	response := dto.ToTodoResponse(todo)
+	h.addLinks(c, &response)
+	var body any = response
+	if format != nil {
+		body = response.Localize(*format)
+	}
+	if fieldSet != nil {
+		if body, err = fieldSet.Select(body); err != nil {
+			respondError(c, err)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error:   "internal_error",
-			Message: "Failed to get todo",
-		})
+	}
+	h.respond(c, http.StatusOK, body)
+}
+
+// BatchGetTodos handles POST /api/v1/todos/batch-get. Todos are returned in
+// the order of the requested IDs; missing ones are left out.
+func (h *TodoHandler) BatchGetTodos(c *gin.Context) {
+	var req dto.BatchGetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, &req)
 		return
 	}
 
-	response := dto.ToTodoResponse(todo)
-	c.JSON(http.StatusOK, response)
+	todos, err := h.service.GetTodos(c.Request.Context(), req.IDs)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response := dto.BatchGetResponse{Todos: dto.ToTodoResponseList(todos)}
+	for i := range response.Todos {
+		h.addLinks(c, &response.Todos[i])
+	}
+	h.respond(c, http.StatusOK, response)
+}
+
+// HeadTodo handles HEAD /api/v1/todos/:id
+func (h *TodoHandler) HeadTodo(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	exists, err := h.service.TodoExists(c.Request.Context(), id)
+	if err != nil {
+		respondErrorStatus(c, err)
+		return
+	}
+	if !exists {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// HeadTodos handles HEAD /api/v1/todos, reporting the number of todos
+// matching the list filters in X-Total-Count
+func (h *TodoHandler) HeadTodos(c *gin.Context) {
+	filter, fields := parseListFilter(c)
+	if len(fields) > 0 {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	total, err := h.service.CountTodos(c.Request.Context(), filter)
+	if err != nil {
+		respondErrorStatus(c, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.Status(http.StatusOK)
+}
+
+// parseListFilter reads the completed, priority, created_after,
+// created_before and include_archived query parameters shared by the list
+// and count endpoints
+func parseListFilter(c *gin.Context) (repository.ListFilter, []dto.FieldError) {
+	var filter repository.ListFilter
+	var fields []dto.FieldError
+	if completedStr := c.Query("completed"); completedStr != "" {
+		completedVal, err := strconv.ParseBool(completedStr)
+		if err != nil {
+			fields = append(fields, dto.FieldError{
+				Field:   "completed",
+				Rule:    "boolean",
+				Message: "completed must be true or false",
+			})
+		} else {
+			filter.Completed = &completedVal
+		}
+	}
+	if priority := c.Query("priority"); priority != "" {
+		filter.Priority = model.Priority(priority)
+		if !filter.Priority.Valid() {
+			fields = append(fields, dto.FieldError{
+				Field:   "priority",
+				Rule:    "priority",
+				Message: "priority must be one of: " + strings.Join(priorityNames(), ", "),
+			})
+		}
+	}
+	filter.CreatedAfter, fields = parseTimeQuery(c, "created_after", fields)
+	filter.CreatedBefore, fields = parseTimeQuery(c, "created_before", fields)
+	if includeStr := c.Query("include_archived"); includeStr != "" {
+		include, err := strconv.ParseBool(includeStr)
+		if err != nil {
+			fields = append(fields, dto.FieldError{
+				Field:   "include_archived",
+				Rule:    "boolean",
+				Message: "include_archived must be true or false",
+			})
+		} else {
+			filter.IncludeArchived = include
+		}
+	}
+	return filter, fields
 }
 
 // ListTodos handles GET /api/v1/todos
@@ -85,98 +258,425 @@ func (h *TodoHandler) ListTodos(c *gin.Context) {
 		}
 	}
 
-	pageSize := 10
-	if pageSizeStr := c.DefaultQuery("page_size", "10"); pageSizeStr != "" {
+	// Zero lets the service apply the configured default page size
+	pageSize := 0
+	if pageSizeStr := c.Query("page_size"); pageSizeStr != "" {
 		if ps, err := strconv.Atoi(pageSizeStr); err == nil {
 			pageSize = ps
 		}
 	}
 
-	var completed *bool
-	if completedStr := c.Query("completed"); completedStr != "" {
-		completedVal := completedStr == "true"
-		completed = &completedVal
+	filter, fields := parseListFilter(c)
+	switch sort := c.Query("sort"); sort {
+	case "":
+	case "priority":
+		filter.SortByPriority = true
+	case "position":
+		filter.SortByPosition = true
+	default:
+		fields = append(fields, dto.FieldError{
+			Field:   "sort",
+			Rule:    "oneof",
+			Message: "sort must be one of: priority, position",
+		})
+	}
+	switch view := c.Query("view"); view {
+	case "":
+	case "compact":
+		filter.Compact = true
+	default:
+		fields = append(fields, dto.FieldError{
+			Field:   "view",
+			Rule:    "oneof",
+			Message: "view must be one of: compact",
+		})
+	}
+	format, fields, err := h.parseDateFormat(c, fields)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	fieldSet, fields := parseFieldSet(c, fields)
+	if fieldSet != nil && filter.Compact {
+		fields = append(fields, dto.FieldError{
+			Field:   "fields",
+			Rule:    "excluded_with",
+			Message: "fields cannot be combined with view=compact",
+		})
+	}
+	if len(fields) > 0 {
+		respondFieldErrors(c, fields)
+		return
+	}
+
+	if wantsCSV(c) {
+		h.exportCSV(c, filter, format)
+		return
 	}
 
-	todos, total, err := h.service.ListTodos(c.Request.Context(), page, pageSize, completed)
+	result, err := h.service.ListTodos(c.Request.Context(), page, pageSize, filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error:   "internal_error",
-			Message: "Failed to list todos",
+		respondError(c, err)
+		return
+	}
+
+	if result.PageSizeReduced {
+		c.Header("X-Page-Size-Reduced", strconv.Itoa(result.PageSize))
+	}
+
+	// The compact view is meant for polling: no links nor date formatting
+	if filter.Compact {
+		compact := dto.ToCompactTodoListResponse(result.Todos, result.Total, result.Page, result.PageSize)
+		setPaginationHeaders(c, compact.Page, compact.PageSize, compact.TotalPages, compact.Total)
+		h.respond(c, http.StatusOK, compact)
+		return
+	}
+
+	response := dto.ToTodoListResponse(result.Todos, result.Total, result.Page, result.PageSize)
+	for i := range response.Todos {
+		h.addLinks(c, &response.Todos[i])
+	}
+	setPaginationHeaders(c, response.Page, response.PageSize, response.TotalPages, response.Total)
+	var body any = response
+	if format != nil {
+		body = response.Localize(*format)
+	}
+	if fieldSet != nil {
+		if body, err = fieldSet.SelectList(body); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	h.respond(c, http.StatusOK, body)
+}
+
+// GetVersion handles GET /api/v1/todos/version
+func (h *TodoHandler) GetVersion(c *gin.Context) {
+	version, err := h.service.CollectionVersion(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	h.respond(c, http.StatusOK, dto.VersionResponse{Version: version})
+}
+
+// GetWeekdayStats handles GET /api/v1/todos/stats/dow
+func (h *TodoHandler) GetWeekdayStats(c *gin.Context) {
+	counts, loc, err := h.service.WeekdayStats(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	h.respond(c, http.StatusOK, dto.ToWeekdayStatsResponse(counts, loc))
+}
+
+// GetCompletionTimeStats handles GET /api/v1/todos/stats/completion-time
+func (h *TodoHandler) GetCompletionTimeStats(c *gin.Context) {
+	from, fields := parseTimeQuery(c, "from", nil)
+	to, fields := parseTimeQuery(c, "to", fields)
+	if len(fields) > 0 {
+		respondFieldErrors(c, fields)
+		return
+	}
+
+	average, count, err := h.service.CompletionTimeStats(c.Request.Context(), from, to)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	h.respond(c, http.StatusOK, dto.ToCompletionTimeResponse(average, count))
+}
+
+// parseTimeQuery parses the RFC 3339 query parameter name, returning nil
+// when it is absent. A malformed value is reported by appending to fields.
+func parseTimeQuery(c *gin.Context, name string, fields []dto.FieldError) (*time.Time, []dto.FieldError) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, fields
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, append(fields, dto.FieldError{
+			Field:   name,
+			Rule:    "datetime",
+			Message: fmt.Sprintf("%s must be an RFC 3339 timestamp", name),
 		})
+	}
+	return &t, fields
+}
+
+// UpsertTodo handles PUT /api/v1/todos/by-external/:externalID, answering
+// 201 when the todo was created and 200 when it was replaced
+func (h *TodoHandler) UpsertTodo(c *gin.Context) {
+	var req dto.CreateTodoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, &req)
 		return
 	}
 
-	response := dto.ToTodoListResponse(todos, total, page, pageSize)
-	c.JSON(http.StatusOK, response)
+	todo, created, err := h.service.UpsertTodo(c.Request.Context(), c.Param("externalID"), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response := dto.ToTodoResponse(todo)
+	h.addLinks(c, &response)
+	if created {
+		c.Header("Location", h.todoURL(c, todo.ID))
+		h.respond(c, http.StatusCreated, response)
+		return
+	}
+	h.respond(c, http.StatusOK, response)
 }
 
 // UpdateTodo handles PUT /api/v1/todos/:id
 func (h *TodoHandler) UpdateTodo(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid todo ID",
-		})
+		respondError(c, service.ErrInvalidID)
 		return
 	}
 
 	var req dto.UpdateTodoRequest
 	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "validation_error",
-			Message: bindErr.Error(),
-		})
+		respondBindError(c, bindErr, &req)
+		return
+	}
+	if h.rejectEmptyUpdate && req.IsEmpty() {
+		respondError(c, service.ErrEmptyUpdate)
 		return
 	}
 
-	todo, err := h.service.UpdateTodo(c.Request.Context(), id, req)
+	todo, changed, err := h.service.UpdateTodo(ifMatchContext(c), id, req)
 	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			c.JSON(http.StatusNotFound, dto.ErrorResponse{
-				Error:   "not_found",
-				Message: "Todo not found",
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error:   "internal_error",
-			Message: "Failed to update todo",
-		})
+		respondError(c, err)
 		return
 	}
 
+	if len(changed) > 0 {
+		c.Header("X-Updated-Fields", strings.Join(changed, ","))
+	} else {
+		// Sent empty to tell the update changed nothing, which c.Header
+		// would drop instead
+		c.Writer.Header().Set("X-Updated-Fields", "")
+	}
+	c.Header("ETag", todo.ETag())
 	response := dto.ToTodoResponse(todo)
-	c.JSON(http.StatusOK, response)
+	h.addLinks(c, &response)
+	h.respond(c, http.StatusOK, response)
+}
+
+// ReorderTodos handles PUT /api/v1/todos/reorder
+func (h *TodoHandler) ReorderTodos(c *gin.Context) {
+	var req dto.ReorderTodosRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, &req)
+		return
+	}
+
+	if err := h.service.ReorderTodos(c.Request.Context(), req.IDs); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ArchiveTodo handles POST /api/v1/todos/:id/archive
+func (h *TodoHandler) ArchiveTodo(c *gin.Context) {
+	h.setArchived(c, h.service.ArchiveTodo)
+}
+
+// UnarchiveTodo handles POST /api/v1/todos/:id/unarchive
+func (h *TodoHandler) UnarchiveTodo(c *gin.Context) {
+	h.setArchived(c, h.service.UnarchiveTodo)
+}
+
+// setArchived responds with the todo of the id parameter once set archives
+// or unarchives it
+func (h *TodoHandler) setArchived(c *gin.Context, set func(context.Context, int) (*model.Todo, error)) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, service.ErrInvalidID)
+		return
+	}
+
+	todo, err := set(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("ETag", todo.ETag())
+	response := dto.ToTodoResponse(todo)
+	h.addLinks(c, &response)
+	h.respond(c, http.StatusOK, response)
 }
 
 // DeleteTodo handles DELETE /api/v1/todos/:id
 func (h *TodoHandler) DeleteTodo(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid todo ID",
-		})
+		respondError(c, service.ErrInvalidID)
 		return
 	}
 
-	err = h.service.DeleteTodo(c.Request.Context(), id)
+	err = h.service.DeleteTodo(ifMatchContext(c), id)
 	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			c.JSON(http.StatusNotFound, dto.ErrorResponse{
-				Error:   "not_found",
-				Message: "Todo not found",
-			})
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteTodos handles DELETE /api/v1/todos. It deletes either the todos
+// listed in the request body, those matching the completed filter, or all
+// todos when all=true is passed explicitly. With dry_run=true it only
+// reports how many todos would be deleted.
+func (h *TodoHandler) DeleteTodos(c *gin.Context) {
+	dryRun, ok := parseDryRun(c)
+	if !ok {
+		return
+	}
+
+	var completed *bool
+	if completedStr := c.Query("completed"); completedStr != "" {
+		completedVal, err := strconv.ParseBool(completedStr)
+		if err != nil {
+			respondFieldErrors(c, []dto.FieldError{{
+				Field:   "completed",
+				Rule:    "boolean",
+				Message: "completed must be true or false",
+			}})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error:   "internal_error",
-			Message: "Failed to delete todo",
-		})
+		completed = &completedVal
+	}
+
+	all := false
+	if allStr := c.Query("all"); allStr != "" {
+		var err error
+		if all, err = strconv.ParseBool(allStr); err != nil {
+			respondFieldErrors(c, []dto.FieldError{{
+				Field:   "all",
+				Rule:    "boolean",
+				Message: "all must be true or false",
+			}})
+			return
+		}
+	}
+
+	var (
+		deleted int64
+		err     error
+	)
+	switch {
+	case c.Request.ContentLength != 0:
+		if completed != nil {
+			respondFieldErrors(c, []dto.FieldError{{
+				Field:   "ids",
+				Rule:    "excluded_with",
+				Message: "delete by ids or by the completed filter, not both",
+			}})
+			return
+		}
+
+		var req dto.BulkDeleteRequest
+		if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+			respondBindError(c, bindErr, &req)
+			return
+		}
+		if dryRun {
+			deleted, err = h.service.PreviewDeleteTodos(c.Request.Context(), req.IDs)
+		} else {
+			deleted, err = h.service.DeleteTodos(c.Request.Context(), req.IDs)
+		}
+	case completed != nil || all:
+		if dryRun {
+			deleted, err = h.service.PreviewDeleteTodosWhere(c.Request.Context(), completed)
+		} else {
+			deleted, err = h.service.DeleteTodosWhere(c.Request.Context(), completed)
+		}
+	default:
+		respondFieldErrors(c, []dto.FieldError{{
+			Field:   "ids",
+			Rule:    "required_without",
+			Message: "ids are required without a completed filter or all=true",
+		}})
 		return
 	}
 
-	c.Status(http.StatusNoContent)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if dryRun {
+		h.respond(c, http.StatusOK, dto.DryRunResponse{WouldAffect: deleted})
+		return
+	}
+	h.respond(c, http.StatusOK, dto.BulkDeleteResponse{Deleted: deleted})
+}
+
+// CompleteAll handles POST /api/v1/todos/complete-all. With dry_run=true
+// it only reports how many todos would be completed.
+func (h *TodoHandler) CompleteAll(c *gin.Context) {
+	dryRun, ok := parseDryRun(c)
+	if !ok {
+		return
+	}
+
+	if dryRun {
+		count, err := h.service.PreviewCompleteAll(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		h.respond(c, http.StatusOK, dto.DryRunResponse{WouldAffect: count})
+		return
+	}
+
+	updated, err := h.service.CompleteAll(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	h.respond(c, http.StatusOK, dto.BulkUpdateResponse{Updated: updated})
+}
+
+// parseDryRun reads the dry_run query parameter. It responds 400 and
+// reports false when the value is neither true nor false, so a mistyped
+// preview never runs the operation for real.
+func parseDryRun(c *gin.Context) (bool, bool) {
+	value := c.Query("dry_run")
+	if value == "" {
+		return false, true
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		respondFieldErrors(c, []dto.FieldError{{
+			Field:   "dry_run",
+			Rule:    "boolean",
+			Message: "dry_run must be true or false",
+		}})
+		return false, false
+	}
+	return dryRun, true
+}
+
+// Options handles OPTIONS /api/v1/todos
+func (h *TodoHandler) Options(c *gin.Context) {
+	c.Header("Allow", strings.Join(collectionMethods, ", "))
+	h.respond(c, http.StatusOK, dto.OptionsResponse{
+		Methods: collectionMethods,
+		Create:  dto.Constraints(dto.CreateTodoRequest{}),
+		Update:  dto.Constraints(dto.UpdateTodoRequest{}),
+	})
 }
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/g3offrey/idiomapi/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// RegisterValidators registers the custom binding rules used by the request
+// DTOs with gin's validator. It must be called before serving requests.
+func RegisterValidators() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("unexpected validator engine")
+	}
+	if err := v.RegisterValidation("priority", validatePriority); err != nil {
+		return fmt.Errorf("failed to register priority validator: %w", err)
+	}
+	return nil
+}
+
+// validatePriority accepts the known todo priority levels
+func validatePriority(fl validator.FieldLevel) bool {
+	return model.Priority(fl.Field().String()).Valid()
+}
+
+// priorityNames returns the valid priority levels as strings
+func priorityNames() []string {
+	names := make([]string, len(model.Priorities))
+	for i, p := range model.Priorities {
+		names[i] = string(p)
+	}
+	return names
+}
+
+// respondBindError writes the error response for a request body that failed
+// to bind into obj. Validator failures are reported per field using the
+// JSON names declared on obj.
+func respondBindError(c *gin.Context, err error, obj any) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, dto.ErrorResponse{
+			Error:   "request_too_large",
+			Message: "Request body too large",
+		})
+		return
+	}
+
+	fields := toFieldErrors(err, obj)
+	if len(fields) == 0 {
+		c.JSON(service.ErrValidation.Status, dto.ErrorResponse{
+			Error:   service.ErrValidation.Code,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	respondFieldErrors(c, fields)
+}
+
+// respondFieldErrors writes a validation error response listing fields
+func respondFieldErrors(c *gin.Context, fields []dto.FieldError) {
+	c.JSON(service.ErrValidation.Status, dto.ValidationErrorResponse{
+		Error:   service.ErrValidation.Code,
+		Message: localize(c, service.ErrValidation.Code, service.ErrValidation.Message),
+		Fields:  fields,
+	})
+}
+
+// toFieldErrors converts validator and JSON type errors into field errors.
+// It returns nil for errors that cannot be attributed to a field.
+func toFieldErrors(err error, obj any) []dto.FieldError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]dto.FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			name := jsonFieldName(obj, fe.StructField())
+			fields = append(fields, dto.FieldError{
+				Field:   name,
+				Rule:    fe.Tag(),
+				Message: fieldErrorMessage(name, fe),
+			})
+		}
+		return fields
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []dto.FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be of type %s", typeErr.Field, typeErr.Type.String()),
+		}}
+	}
+
+	return nil
+}
+
+// fieldErrorMessage builds a human readable message for a failed rule
+func fieldErrorMessage(name string, fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", name)
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", name, fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", name, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", name, strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "priority":
+		return fmt.Sprintf("%s must be one of: %s", name, strings.Join(priorityNames(), ", "))
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", name)
+	case "unique":
+		return fmt.Sprintf("%s must not contain duplicates", name)
+	default:
+		return fmt.Sprintf("%s failed the %s rule", name, fe.Tag())
+	}
+}
+
+// jsonFieldName returns the JSON name of the named struct field of obj,
+// falling back to the Go field name when no json tag is present. The index
+// of slice elements, as in Scopes[1], is kept.
+func jsonFieldName(obj any, structField string) string {
+	if field, index, ok := strings.Cut(structField, "["); ok {
+		return jsonFieldName(obj, field) + "[" + index
+	}
+
+	t := reflect.TypeOf(obj)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return structField
+	}
+
+	field, ok := t.FieldByName(structField)
+	if !ok {
+		return structField
+	}
+
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return structField
+	}
+	return name
+}
@@ -0,0 +1,103 @@
+// Package i18n translates the messages of API errors. Messages are looked
+// up by error code in catalogs embedded from locales/<language>.json, in
+// the languages the client prefers according to Accept-Language.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// locales holds one JSON object per language mapping error codes to
+// messages
+//
+//go:embed locales/*.json
+var locales embed.FS
+
+// DefaultLanguage is used when the client accepts none of the catalog
+// languages
+const DefaultLanguage = "en"
+
+// catalog maps languages to their messages, keyed by error code
+var catalog = mustLoad(locales)
+
+// mustLoad reads every catalog in fsys. The catalogs are embedded, so a
+// malformed one is a build defect.
+func mustLoad(fsys fs.FS) map[string]map[string]string {
+	files, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		panic(err)
+	}
+
+	catalog := make(map[string]map[string]string, len(files))
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog %s: %v", file, err))
+		}
+		catalog[strings.TrimSuffix(path.Base(file), ".json")] = messages
+	}
+	return catalog
+}
+
+// Message returns the message for code in the language acceptLanguage, an
+// Accept-Language header, prefers, falling back to DefaultLanguage and
+// then to fallback. Codes whose message carries request details, such as
+// invalid_title, are left out of the catalogs so fallback is kept.
+func Message(acceptLanguage, code, fallback string) string {
+	for _, lang := range append(Languages(acceptLanguage), DefaultLanguage) {
+		if message, ok := catalog[lang][code]; ok {
+			return message
+		}
+	}
+	return fallback
+}
+
+// Languages returns the primary language subtags listed in an
+// Accept-Language header, lower case and most preferred first. Languages
+// with a zero or malformed quality, and the * wildcard, are left out.
+func Languages(acceptLanguage string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	var accepted []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if lang == "" || lang == "*" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		accepted = append(accepted, weighted{lang, q})
+	}
+
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+
+	langs := make([]string, len(accepted))
+	for i, a := range accepted {
+		langs[i] = a.lang
+	}
+	return langs
+}
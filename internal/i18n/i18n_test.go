@@ -0,0 +1,44 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguages(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		expected       []string
+	}{
+		{name: "empty", acceptLanguage: "", expected: []string{}},
+		{name: "single tag", acceptLanguage: "fr-CA", expected: []string{"fr"}},
+		{name: "ordered by quality", acceptLanguage: "en;q=0.5, fr;q=0.9, de", expected: []string{"de", "fr", "en"}},
+		{name: "skips wildcard and zero quality", acceptLanguage: "*, es;q=0, FR", expected: []string{"fr"}},
+		{name: "skips malformed quality", acceptLanguage: "es;q=high, fr", expected: []string{"fr"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Languages(tt.acceptLanguage))
+		})
+	}
+}
+
+func TestMessage(t *testing.T) {
+	assert.Equal(t, "Tâche introuvable", Message("fr-FR,fr;q=0.9", "not_found", "Todo not found"))
+	assert.Equal(t, "Todo not found", Message("", "not_found", "fallback"))
+	assert.Equal(t, "Todo not found", Message("de", "not_found", "fallback"), "unknown languages fall back to English")
+	assert.Equal(t, "Tâche introuvable", Message("de, fr;q=0.5", "not_found", "fallback"))
+	assert.Equal(t, "Title must match ^a", Message("fr", "invalid_title", "Title must match ^a"))
+	assert.Equal(t, "Une tâche avec ce titre existe déjà", Message("fr", "conflict", "fallback"))
+}
+
+func TestCatalogsAreComplete(t *testing.T) {
+	for lang, messages := range catalog {
+		for code := range catalog[DefaultLanguage] {
+			assert.NotEmpty(t, messages[code], "%s has no message for %s", lang, code)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminTokenHeader is the request header carrying the admin token
+const AdminTokenHeader = "X-Admin-Token"
+
+// RequireAdminToken returns a gin middleware that rejects with 401 the
+// requests whose X-Admin-Token header is not token. An empty token
+// rejects every request.
+func RequireAdminToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := c.GetHeader(AdminTokenHeader)
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
+				Error:   "invalid_admin_token",
+				Message: "A valid X-Admin-Token header is required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
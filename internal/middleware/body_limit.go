@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBodySize returns a gin middleware that limits request bodies to n bytes.
+// Requests declaring a larger Content-Length are rejected up front with 413;
+// bodies without a declared length are capped with http.MaxBytesReader so
+// reads past the limit fail during binding.
+func MaxBodySize(n int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if n <= 0 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > n {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, dto.ErrorResponse{
+				Error:   "request_too_large",
+				Message: "Request body too large",
+			})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, n)
+		c.Next()
+	}
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/g3offrey/idiomapi/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// LogBodies returns a gin middleware that logs, at debug level, the request
+// body the handler read and the response body it wrote. Bodies are only
+// logged when they are complete JSON documents of at most maxSize bytes,
+// with the values of the fields named by redactKeys, at any depth and
+// case-insensitively, masked. Other bodies are logged as their size, so
+// truncated documents cannot leak sensitive fields.
+func LogBodies(log *slog.Logger, maxSize int, redactKeys []string) gin.HandlerFunc {
+	keys := make(map[string]struct{}, len(redactKeys))
+	for _, key := range redactKeys {
+		keys[strings.ToLower(key)] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		request := &cappedBuffer{max: maxSize}
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			c.Request.Body = teeReadCloser{Reader: io.TeeReader(c.Request.Body, request), Closer: c.Request.Body}
+		}
+
+		response := &bodyRecorder{ResponseWriter: c.Writer, body: cappedBuffer{max: maxSize}}
+		c.Writer = response
+
+		c.Next()
+
+		c.Writer = response.ResponseWriter
+
+		log.Debug("request bodies",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", response.Status(),
+			"request_body", loggableBody(request, keys),
+			"response_body", loggableBody(&response.body, keys),
+		)
+	}
+}
+
+// teeReadCloser reads through a TeeReader and closes the original body
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// cappedBuffer keeps the first max bytes written to it and counts the rest
+type cappedBuffer struct {
+	bytes.Buffer
+	max   int
+	total int
+}
+
+// Write records what fits below the cap and never fails
+func (b *cappedBuffer) Write(data []byte) (int, error) {
+	b.total += len(data)
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(data[:min(room, len(data))])
+	}
+	return len(data), nil
+}
+
+// bodyRecorder copies the start of the response body while writing it
+// through
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body cappedBuffer
+}
+
+// Write writes data to the client and records it
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	_, _ = w.body.Write(data) //nolint:errcheck // cappedBuffer never fails
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString writes s to the client and records it
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (w *bodyRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// loggableBody returns the redacted JSON of b, or a description of its size
+// when it is empty, truncated or not JSON
+func loggableBody(b *cappedBuffer, keys map[string]struct{}) string {
+	if b.total == 0 {
+		return ""
+	}
+	if b.total > b.Len() {
+		return fmt.Sprintf("%d bytes, too large to log", b.total)
+	}
+
+	var doc any
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		return fmt.Sprintf("%d bytes, not JSON", b.total)
+	}
+	redacted, err := json.Marshal(redactJSON(doc, keys))
+	if err != nil {
+		return fmt.Sprintf("%d bytes", b.total)
+	}
+	return string(redacted)
+}
+
+// redactJSON masks the values of the object fields of doc named by keys
+func redactJSON(doc any, keys map[string]struct{}) any {
+	switch v := doc.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if _, ok := keys[strings.ToLower(key)]; ok {
+				v[key] = logger.RedactedValue
+				continue
+			}
+			v[key] = redactJSON(value, keys)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactJSON(item, keys)
+		}
+	}
+	return doc
+}
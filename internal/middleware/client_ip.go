@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/g3offrey/idiomapi/internal/audit"
+	"github.com/gin-gonic/gin"
+)
+
+// RecordClientIP returns a gin middleware storing the client IP in the
+// request context, for the audit trail. Behind trusted proxies it is the
+// IP they forwarded.
+func RecordClientIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(audit.NewContext(c.Request.Context(), c.ClientIP()))
+		c.Next()
+	}
+}
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compressedContentTypes lists content type prefixes that are already
+// compressed and gain nothing from gzip
+var compressedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/gzip",
+	"application/zip",
+	"application/x-gzip",
+}
+
+// Compress returns a gin middleware that gzips responses for clients that
+// send Accept-Encoding: gzip. Bodies are buffered until they reach
+// minLength bytes, so smaller responses are sent uncompressed. Responses
+// that already carry a Content-Encoding or an already compressed content
+// type are passed through. A level outside the range accepted by
+// compress/gzip, or 0, selects gzip.DefaultCompression.
+func Compress(minLength, level int) gin.HandlerFunc {
+	if level == 0 || level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+
+	pool := &sync.Pool{
+		New: func() any {
+			gz, _ := gzip.NewWriterLevel(nil, level) //nolint:errcheck // level is validated above
+			return gz
+		},
+	}
+
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Encoding")
+
+		if c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: c.Writer, minLength: minLength, pool: pool}
+		c.Writer = gw
+
+		// The deferred call also runs when a handler panics, so an outer
+		// Recovery writes its error to the client's writer rather than into
+		// a gzip stream nobody closes
+		completed := false
+		defer func() {
+			if !completed {
+				gw.discard()
+			}
+			gw.finish()
+			c.Writer = gw.ResponseWriter
+		}()
+
+		c.Next()
+		completed = true
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			return err != nil || weight > 0
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter buffers the start of a response until it knows whether the
+// body is large enough to compress, then either gzips or passes it through.
+// Only the status code is recorded on the underlying writer until then, so
+// headers can still change and middleware reading Status keeps working.
+type gzipWriter struct {
+	gin.ResponseWriter
+	minLength int
+	pool      *sync.Pool
+	buf       []byte
+	gz        *gzip.Writer
+	decided   bool
+}
+
+// Write buffers or compresses data
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buf = append(w.buf, data...)
+	if len(w.buf) >= w.minLength {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// WriteString buffers or compresses s
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow is deferred until the encoding is decided
+func (w *gzipWriter) WriteHeaderNow() {
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Written reports whether any part of the body has been written
+func (w *gzipWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// Flush sends everything written so far to the client
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(len(w.buf) >= w.minLength); err != nil {
+			return
+		}
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush() //nolint:errcheck // Flush has no way to report errors
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide picks the encoding, compressing when compress is true and the
+// response is eligible, and writes out the buffered body
+func (w *gzipWriter) decide(compress bool) error {
+	w.decided = true
+
+	header := w.Header()
+	if compress && header.Get("Content-Encoding") == "" && !isCompressedType(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+
+		w.gz = w.pool.Get().(*gzip.Writer) //nolint:errcheck // the pool only holds *gzip.Writer
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.gz != nil {
+		_, err := w.gz.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// discard drops a body that is still buffered, so the response written
+// after a panic is not prefixed with the handler's partial output
+func (w *gzipWriter) discard() {
+	if !w.decided {
+		w.buf = nil
+	}
+}
+
+// finish flushes a short buffered body uncompressed and closes the gzip
+// stream if one was started
+func (w *gzipWriter) finish() {
+	if !w.decided {
+		_ = w.decide(false) //nolint:errcheck // the client is gone if this fails
+	}
+	if w.gz != nil {
+		_ = w.gz.Close() //nolint:errcheck // the client is gone if this fails
+		w.pool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// isCompressedType reports whether contentType is already compressed
+func isCompressedType(contentType string) bool {
+	for _, prefix := range compressedContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireJSON returns a gin middleware that rejects POST, PUT, PATCH and
+// DELETE requests whose body is not declared as application/json with 415.
+// Parameters such as charset are accepted, and requests without a body
+// are let through.
+func RequireJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength == 0 {
+			c.Next()
+			return
+		}
+
+		mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, dto.ErrorResponse{
+				Error:   "unsupported_media_type",
+				Message: "Content-Type must be application/json",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers a reverse proxy sets to describe the URL the client requested
+const (
+	ForwardedHostHeader  = "X-Forwarded-Host"
+	ForwardedProtoHeader = "X-Forwarded-Proto"
+)
+
+// ForwardedHeaders returns a gin middleware that keeps X-Forwarded-Host and
+// X-Forwarded-Proto only on requests coming from one of trustedProxies, IP
+// addresses or CIDR ranges. Kept headers are reduced to their first, valid,
+// value and the others are removed, so the URLs derived from them cannot be
+// spoofed by clients.
+func ForwardedHeaders(trustedProxies []string) (gin.HandlerFunc, error) {
+	prefixes := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		prefix, err := parseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return func(c *gin.Context) {
+		header := c.Request.Header
+		if !trusted(prefixes, c.Request.RemoteAddr) {
+			header.Del(ForwardedHostHeader)
+			header.Del(ForwardedProtoHeader)
+			c.Next()
+			return
+		}
+
+		if host, ok := forwardedHost(header.Get(ForwardedHostHeader)); ok {
+			header.Set(ForwardedHostHeader, host)
+		} else {
+			header.Del(ForwardedHostHeader)
+		}
+		if proto, ok := forwardedProto(header.Get(ForwardedProtoHeader)); ok {
+			header.Set(ForwardedProtoHeader, proto)
+		} else {
+			header.Del(ForwardedProtoHeader)
+		}
+		c.Next()
+	}, nil
+}
+
+// parseProxy parses an IP address or a CIDR range
+func parseProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// trusted reports whether remoteAddr, a host:port, is in one of prefixes
+func trusted(prefixes []netip.Prefix, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHost returns the first host of an X-Forwarded-Host value, and
+// false when it is not a bare host with an optional port
+func forwardedHost(value string) (string, bool) {
+	host, _, _ := strings.Cut(value, ",")
+	host = strings.TrimSpace(host)
+	if host == "" || strings.ContainsAny(host, "/\\@?# \t") {
+		return "", false
+	}
+	return host, true
+}
+
+// forwardedProto returns the first scheme of an X-Forwarded-Proto value, and
+// false when it is neither http nor https
+func forwardedProto(value string) (string, bool) {
+	proto, _, _ := strings.Cut(value, ",")
+	proto = strings.ToLower(strings.TrimSpace(proto))
+	if proto != "http" && proto != "https" {
+		return "", false
+	}
+	return proto, true
+}
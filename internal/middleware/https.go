@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForceHTTPS returns a gin middleware that redirects plain HTTP requests to
+// HTTPS with 308 and, when hstsMaxAge is positive, sets a
+// Strict-Transport-Security header on HTTPS responses. Requests count as
+// HTTPS when they arrived over TLS or when the TLS-terminating proxy set
+// X-Forwarded-Proto to https. Paths in exempt, such as health checks, are
+// served over either scheme.
+func ForceHTTPS(hstsMaxAge time.Duration, exempt ...string) gin.HandlerFunc {
+	hsts := "max-age=" + strconv.FormatInt(int64(hstsMaxAge.Seconds()), 10)
+
+	return func(c *gin.Context) {
+		for _, path := range exempt {
+			if c.Request.URL.Path == path {
+				c.Next()
+				return
+			}
+		}
+
+		if !isHTTPS(c.Request) {
+			target := "https://" + c.Request.Host + c.Request.URL.RequestURI()
+			c.Redirect(http.StatusPermanentRedirect, target)
+			c.Abort()
+			return
+		}
+
+		if hstsMaxAge > 0 {
+			c.Header("Strict-Transport-Security", hsts)
+		}
+		c.Next()
+	}
+}
+
+// isHTTPS reports whether r reached the client facing server over HTTPS
+func isHTTPS(r *http.Request) bool {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return strings.EqualFold(proto, "https")
+	}
+	return r.TLS != nil
+}
+
+// RedirectToHTTPS returns an http.Handler serving the plain HTTP listener
+// of a server terminating TLS itself, which redirects every request to
+// the same URL over HTTPS, on httpsPort, with 308
+func RedirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,274 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header carrying the idempotency key
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// maxIdempotencyKeyLength bounds the size of client supplied keys
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency returns a gin middleware that replays the first successful
+// response for a repeated Idempotency-Key instead of running the handler
+// again. Responses are kept in memory for ttl, up to maxKeys entries. A
+// reused key with a different body is answered with 422 rather than
+// replayed; JSON bodies are compared regardless of key order and
+// whitespace, so a client re-serializing its retry still matches.
+// Concurrent requests with the same key are serialized so only one of them
+// reaches the handler. Requests without the header pass through untouched,
+// as do all requests when ttl is not positive.
+func Idempotency(ttl time.Duration, maxKeys int) gin.HandlerFunc {
+	store := newIdempotencyStore(ttl, maxKeys)
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if ttl <= 0 || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "invalid_idempotency_key",
+				Message: "Idempotency key is too long",
+			})
+			return
+		}
+
+		// The handler reads the body again. Failing to read it, such as
+		// when it is too large, it gets the same error.
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		// Keys are per user, so one user cannot replay another's response,
+		// and per route, so the same key can be used on different endpoints
+		ownerID, _ := owner.FromContext(c.Request.Context())
+		scopedKey := ownerID + " " + c.Request.Method + " " + c.Request.URL.Path + " " + key
+		bodyHash := hashRequestBody(body)
+
+		resp, done, ok := store.acquire(c.Request.Context(), scopedKey)
+		if !ok {
+			// The request context ended while waiting on a concurrent request
+			c.Abort()
+			return
+		}
+		if resp != nil {
+			if resp.bodyHash != bodyHash {
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, dto.ErrorResponse{
+					Error:   "idempotency_key_reused",
+					Message: "Idempotency key was already used with a different request body",
+				})
+				return
+			}
+			resp.replay(c)
+			return
+		}
+
+		// Released even when the handler panics, so retries do not wait on
+		// the key forever
+		var stored *storedResponse
+		defer func() { store.release(scopedKey, stored, done) }()
+
+		rec := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = rec
+
+		c.Next()
+
+		c.Writer = rec.ResponseWriter
+
+		// Past the request deadline, the response written is the timeout
+		// error rather than the one the handler recorded
+		if errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) || !rec.Written() {
+			return
+		}
+		if status := rec.Status(); status >= 200 && status < 300 {
+			stored = &storedResponse{
+				status:      status,
+				contentType: rec.Header().Get("Content-Type"),
+				location:    rec.Header().Get("Location"),
+				body:        rec.body.Bytes(),
+				bodyHash:    bodyHash,
+			}
+		}
+	}
+}
+
+// storedResponse is a captured response that can be replayed
+type storedResponse struct {
+	status      int
+	contentType string
+	location    string
+	body        []byte
+	bodyHash    string
+	expiresAt   time.Time
+}
+
+// hashRequestBody returns a digest of body identifying the request
+// payload. JSON bodies are hashed in a canonical form, with sorted object
+// keys and no insignificant whitespace.
+func hashRequestBody(body []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err == nil && !dec.More() {
+		if canonical, err := json.Marshal(value); err == nil {
+			body = canonical
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// replay writes the stored response to c
+func (r *storedResponse) replay(c *gin.Context) {
+	c.Header("Idempotent-Replayed", "true")
+	if r.location != "" {
+		c.Header("Location", r.location)
+	}
+	c.Data(r.status, r.contentType, r.body)
+	c.Abort()
+}
+
+// idempotencyStore is an in-memory LRU of completed responses plus the set
+// of keys currently being processed
+type idempotencyStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	maxKeys  int
+	entries  map[string]*list.Element
+	order    *list.List
+	inflight map[string]chan struct{}
+}
+
+// lruEntry is a stored response tracked in the LRU order
+type lruEntry struct {
+	key      string
+	response *storedResponse
+}
+
+func newIdempotencyStore(ttl time.Duration, maxKeys int) *idempotencyStore {
+	return &idempotencyStore{
+		ttl:      ttl,
+		maxKeys:  maxKeys,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		inflight: make(map[string]chan struct{}),
+	}
+}
+
+// acquire returns the stored response for key if there is one. Otherwise it
+// marks key as in flight and returns a channel the caller must pass to
+// release. It waits while another request holds the key, and returns false
+// if ctx ends first.
+func (s *idempotencyStore) acquire(ctx context.Context, key string) (*storedResponse, chan struct{}, bool) {
+	for {
+		s.mu.Lock()
+		if resp := s.get(key); resp != nil {
+			s.mu.Unlock()
+			return resp, nil, true
+		}
+
+		wait, busy := s.inflight[key]
+		if !busy {
+			done := make(chan struct{})
+			s.inflight[key] = done
+			s.mu.Unlock()
+			return nil, done, true
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, nil, false
+		}
+	}
+}
+
+// release clears the in-flight marker for key, stores resp if it is not
+// nil, and wakes any requests waiting on the key
+func (s *idempotencyStore) release(key string, resp *storedResponse, done chan struct{}) {
+	s.mu.Lock()
+	delete(s.inflight, key)
+	if resp != nil {
+		s.put(key, resp)
+	}
+	s.mu.Unlock()
+	close(done)
+}
+
+// get returns the unexpired response for key; callers must hold s.mu
+func (s *idempotencyStore) get(key string) *storedResponse {
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+
+	entry := elem.Value.(*lruEntry) //nolint:errcheck // the list only holds *lruEntry
+	if time.Now().After(entry.response.expiresAt) {
+		s.order.Remove(elem)
+		delete(s.entries, key)
+		return nil
+	}
+
+	s.order.MoveToFront(elem)
+	return entry.response
+}
+
+// put stores resp under key, evicting the least recently used entries when
+// the store is full; callers must hold s.mu
+func (s *idempotencyStore) put(key string, resp *storedResponse) {
+	resp.expiresAt = time.Now().Add(s.ttl)
+	s.entries[key] = s.order.PushFront(&lruEntry{key: key, response: resp})
+
+	for s.maxKeys > 0 && s.order.Len() > s.maxKeys {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*lruEntry).key) //nolint:errcheck // the list only holds *lruEntry
+	}
+}
+
+// recordingWriter copies the response body while writing it through
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write writes data to the client and records it
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString writes s to the client and records it
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
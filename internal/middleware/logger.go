@@ -2,17 +2,27 @@ package middleware
 
 import (
 	"log/slog"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/g3offrey/idiomapi/pkg/logger"
 	"github.com/gin-gonic/gin"
 )
 
-// Logger returns a gin middleware that logs requests using slog
-func Logger(logger *slog.Logger) gin.HandlerFunc {
+// Logger returns a gin middleware that logs requests using slog, with the
+// values of the query parameters named by redactKeys, case-insensitively,
+// masked
+func Logger(log *slog.Logger, redactKeys []string) gin.HandlerFunc {
+	keys := make(map[string]struct{}, len(redactKeys))
+	for _, key := range redactKeys {
+		keys[strings.ToLower(key)] = struct{}{}
+	}
+
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
-		query := c.Request.URL.RawQuery
+		query := redactQuery(c.Request.URL.RawQuery, keys)
 
 		// Process request
 		c.Next()
@@ -44,11 +54,30 @@ func Logger(logger *slog.Logger) gin.HandlerFunc {
 		// Log based on status code
 		switch {
 		case statusCode >= 500:
-			logger.Error("server error", attrs...)
+			log.Error("server error", attrs...)
 		case statusCode >= 400:
-			logger.Warn("client error", attrs...)
+			log.Warn("client error", attrs...)
 		default:
-			logger.Info("request processed", attrs...)
+			log.Info("request processed", attrs...)
+		}
+	}
+}
+
+// redactQuery returns the raw query with the values of the parameters
+// named by keys masked, keeping the other parameters as sent
+func redactQuery(query string, keys map[string]struct{}) string {
+	if query == "" || len(keys) == 0 {
+		return query
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if _, ok := keys[strings.ToLower(name)]; ok {
+			params[i] = name + "=" + logger.RedactedValue
 		}
 	}
+	return strings.Join(params, "&")
 }
@@ -0,0 +1,808 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Timeout(20*time.Millisecond, 0, nil))
+
+	router.GET("/slow", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cancelled"})
+	})
+	router.GET("/fast", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "handler exceeds deadline", path: "/slow", expectedStatus: http.StatusServiceUnavailable},
+		{name: "handler within deadline", path: "/fast", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, http.NoBody)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestTimeoutUnboundedPaths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Timeout(20*time.Millisecond, 0, Paths("/events")))
+
+	wait := func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+			c.Status(http.StatusInternalServerError)
+		case <-time.After(50 * time.Millisecond):
+			c.Status(http.StatusOK)
+		}
+	}
+	router.GET("/events", wait)
+	router.DELETE("/todos", wait)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{name: "stream route is unbounded", method: "GET", path: "/events", expectedStatus: http.StatusOK},
+		{name: "other route accepting a stream is bounded", method: "DELETE", path: "/todos", expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, http.NoBody)
+			req.Header.Set("Accept", "text/event-stream")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestTimeoutHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Timeout(time.Minute, 5*time.Second, nil))
+
+	var remaining time.Duration
+	router.GET("/deadline", func(c *gin.Context) {
+		deadline, ok := c.Request.Context().Deadline()
+		assert.True(t, ok)
+		remaining = time.Until(deadline)
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		header   string
+		expected time.Duration
+	}{
+		{name: "valid header shortens the deadline", header: "2s", expected: 2 * time.Second},
+		{name: "header above the maximum is clamped", header: "1h", expected: 5 * time.Second},
+		{name: "invalid header is ignored", header: "soon", expected: time.Minute},
+		{name: "negative header is ignored", header: "-1s", expected: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/deadline", http.NoBody)
+			req.Header.Set(RequestTimeoutHeader, tt.header)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.InDelta(t, tt.expected.Seconds(), remaining.Seconds(), 0.5)
+		})
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MaxBodySize(8))
+
+	router.POST("/echo", func(c *gin.Context) {
+		if _, err := io.ReadAll(c.Request.Body); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		body           string
+		chunked        bool
+		expectedStatus int
+	}{
+		{name: "within limit", body: "small", expectedStatus: http.StatusOK},
+		{name: "declared length over limit", body: "this body is too large", expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "undeclared length over limit", body: "this body is too large", chunked: true, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/echo", bytes.NewBufferString(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Idempotency(time.Minute, 100))
+
+	var calls atomic.Int32
+	router.POST("/todos", func(c *gin.Context) {
+		n := calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		c.Header("Location", fmt.Sprintf("/todos/%d", n))
+		c.JSON(http.StatusCreated, gin.H{"id": n})
+	})
+
+	postWith := func(key, body, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/todos", bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		req.Header.Set("Accept", accept)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	post := func(key string) *httptest.ResponseRecorder {
+		return postWith(key, `{"title":"Test"}`, "application/json")
+	}
+
+	t.Run("repeated key replays the first response", func(t *testing.T) {
+		calls.Store(0)
+		first := post("key-1")
+		second := post("key-1")
+
+		assert.Equal(t, http.StatusCreated, first.Code)
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, first.Header().Get("Location"), second.Header().Get("Location"))
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("repeated key with a re-serialized body or another Accept replays", func(t *testing.T) {
+		calls.Store(0)
+		first := postWith("key-2", `{"title":"Test","priority":"high"}`, "application/json")
+		reordered := postWith("key-2", "{ \"priority\": \"high\",\n  \"title\": \"Test\" }", "application/json")
+		otherAccept := postWith("key-2", `{"title":"Test","priority":"high"}`, "application/msgpack")
+
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Equal(t, first.Body.String(), reordered.Body.String())
+		assert.Equal(t, "true", reordered.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, first.Body.String(), otherAccept.Body.String())
+	})
+
+	t.Run("repeated key with another body is rejected", func(t *testing.T) {
+		calls.Store(0)
+		postWith("key-3", `{"title":"Test"}`, "application/json")
+		w := postWith("key-3", `{"title":"Other"}`, "application/json")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "idempotency_key_reused")
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("requests without a key are not deduplicated", func(t *testing.T) {
+		calls.Store(0)
+		post("")
+		post("")
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("concurrent requests with the same key create once", func(t *testing.T) {
+		calls.Store(0)
+
+		var wg sync.WaitGroup
+		bodies := make([]string, 5)
+		for i := range bodies {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				bodies[i] = post("key-concurrent").Body.String()
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), calls.Load())
+		for _, body := range bodies {
+			assert.Equal(t, bodies[0], body)
+		}
+	})
+}
+
+func TestIdempotencyFailures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	post := func(router *gin.Engine) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/todos", bytes.NewBufferString(`{"title":"Test"}`))
+		req.Header.Set(IdempotencyKeyHeader, "key")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("panic releases the key", func(t *testing.T) {
+		router := gin.New()
+		router.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}))
+		var calls atomic.Int32
+		router.POST("/todos", Idempotency(time.Minute, 100), func(c *gin.Context) {
+			if calls.Add(1) == 1 {
+				panic("boom")
+			}
+			c.JSON(http.StatusCreated, gin.H{"id": 1})
+		})
+
+		assert.Equal(t, http.StatusInternalServerError, post(router).Code)
+
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- post(router) }()
+		select {
+		case w := <-done:
+			assert.Equal(t, http.StatusCreated, w.Code)
+		case <-time.After(time.Second):
+			t.Fatal("retry waited on the key of the panicked request")
+		}
+	})
+
+	t.Run("timed out responses are not replayed", func(t *testing.T) {
+		router := gin.New()
+		var calls atomic.Int32
+		router.POST("/todos", Timeout(10*time.Millisecond, 0, nil), Idempotency(time.Minute, 100), func(c *gin.Context) {
+			if calls.Add(1) == 1 {
+				<-c.Request.Context().Done()
+			}
+			c.JSON(http.StatusCreated, gin.H{"id": calls.Load()})
+		})
+
+		assert.Equal(t, http.StatusServiceUnavailable, post(router).Code)
+		w := post(router)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+}
+
+func TestCompress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	large := strings.Repeat("todo ", 100)
+
+	var loggedStatus int
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Next()
+		loggedStatus = c.Writer.Status()
+	})
+	router.Use(Compress(64, gzip.BestSpeed))
+
+	router.GET("/large", func(c *gin.Context) {
+		c.String(http.StatusCreated, large)
+	})
+	router.GET("/small", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	router.GET("/image", func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/png", []byte(large))
+	})
+
+	tests := []struct {
+		name             string
+		path             string
+		acceptEncoding   string
+		expectedStatus   int
+		expectedEncoding string
+		expectedBody     string
+	}{
+		{name: "large response is compressed", path: "/large", acceptEncoding: "gzip, deflate", expectedStatus: http.StatusCreated, expectedEncoding: "gzip", expectedBody: large},
+		{name: "client without gzip", path: "/large", acceptEncoding: "deflate", expectedStatus: http.StatusCreated, expectedBody: large},
+		{name: "gzip refused with q=0", path: "/large", acceptEncoding: "gzip;q=0", expectedStatus: http.StatusCreated, expectedBody: large},
+		{name: "small response is not compressed", path: "/small", acceptEncoding: "gzip", expectedStatus: http.StatusOK, expectedBody: "ok"},
+		{name: "compressed content type is skipped", path: "/image", acceptEncoding: "gzip", expectedStatus: http.StatusOK, expectedBody: large},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, http.NoBody)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedStatus, loggedStatus)
+			assert.Equal(t, tt.expectedEncoding, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+
+			body := w.Body.Bytes()
+			if tt.expectedEncoding == "gzip" {
+				gz, err := gzip.NewReader(w.Body)
+				assert.NoError(t, err)
+				body, err = io.ReadAll(gz)
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedBody, string(body))
+		})
+	}
+}
+
+func TestCompressPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Recovery(slog.New(slog.NewJSONHandler(io.Discard, nil)), false))
+	router.Use(Compress(64, gzip.BestSpeed))
+	router.GET("/panic", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		_, _ = c.Writer.WriteString("partial")
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", http.NoBody)
+	req.Header.Set("Accept-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	body := w.Body.Bytes()
+	if w.Header().Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		body, err = io.ReadAll(gz)
+		require.NoError(t, err)
+	}
+	assert.JSONEq(t, `{"error":"internal_server_error","message":"An unexpected error occurred"}`, string(body))
+}
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name     string
+		logStack bool
+	}{
+		{name: "without stack", logStack: false},
+		{name: "with stack", logStack: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(Recovery(slog.New(slog.NewJSONHandler(&logs, nil)), tt.logStack))
+			router.GET("/panic", func(c *gin.Context) {
+				panic("boom")
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/panic", http.NoBody)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.JSONEq(t, `{"error":"internal_server_error","message":"An unexpected error occurred"}`, w.Body.String())
+
+			assert.Contains(t, logs.String(), `"error":"boom"`)
+			if tt.logStack {
+				assert.Contains(t, logs.String(), `"stack":"goroutine`)
+			} else {
+				assert.NotContains(t, logs.String(), `"stack"`)
+			}
+		})
+	}
+}
+
+func TestLoggerClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		expectedIP string
+	}{
+		{name: "forwarded by trusted proxy", remoteAddr: "10.0.0.1:4000", expectedIP: "203.0.113.7"},
+		{name: "forwarded by untrusted hop", remoteAddr: "198.51.100.2:4000", expectedIP: "198.51.100.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			assert.NoError(t, router.SetTrustedProxies([]string{"10.0.0.0/8"}))
+			router.Use(Logger(slog.New(slog.NewJSONHandler(&logs, nil)), nil))
+			router.GET("/ping", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/ping", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			router.ServeHTTP(w, req)
+
+			assert.Contains(t, logs.String(), `"ip":"`+tt.expectedIP+`"`)
+		})
+	}
+}
+
+func TestLoggerRedactsQuery(t *testing.T) {
+	var logs bytes.Buffer
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Logger(slog.New(slog.NewJSONHandler(&logs, nil)), []string{"code"}))
+	router.GET("/callback", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/callback?state=abc&Code=secret-code&code=other", http.NoBody)
+	router.ServeHTTP(w, req)
+
+	assert.Contains(t, logs.String(), `"query":"state=abc&Code=****&code=****"`)
+	assert.NotContains(t, logs.String(), "secret-code")
+}
+
+func TestRequireAdminToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const token = "0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name           string
+		configured     string
+		header         string
+		expectedStatus int
+	}{
+		{name: "valid token", configured: token, header: token, expectedStatus: http.StatusOK},
+		{name: "missing header", configured: token, expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", configured: token, header: token + "x", expectedStatus: http.StatusUnauthorized},
+		{name: "no token configured", configured: "", header: "", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(RequireAdminToken(tt.configured))
+			router.GET("/admin", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/admin", http.NoBody)
+			if tt.header != "" {
+				req.Header.Set(AdminTokenHeader, tt.header)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestRequireOwner(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequireOwner())
+	router.GET("/todos", func(c *gin.Context) {
+		ownerID, _ := owner.FromContext(c.Request.Context())
+		c.String(http.StatusOK, ownerID)
+	})
+
+	tests := []struct {
+		name           string
+		userID         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "user ID stored in context", userID: "alice", expectedStatus: http.StatusOK, expectedBody: "alice"},
+		{name: "missing header", userID: "", expectedStatus: http.StatusUnauthorized},
+		{name: "blank header", userID: "   ", expectedStatus: http.StatusUnauthorized},
+		{name: "too long", userID: strings.Repeat("a", 256), expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/todos", http.NoBody)
+			if tt.userID != "" {
+				req.Header.Set(UserIDHeader, tt.userID)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequireJSON())
+	router.Any("/api/v1/todos", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{name: "json", method: http.MethodPost, contentType: "application/json", body: "{}", expectedStatus: http.StatusOK},
+		{name: "json with charset", method: http.MethodPut, contentType: "application/json; charset=utf-8", body: "{}", expectedStatus: http.StatusOK},
+		{name: "missing content type", method: http.MethodPost, body: "{}", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "form", method: http.MethodPatch, contentType: "application/x-www-form-urlencoded", body: "a=b", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "malformed content type", method: http.MethodPost, contentType: "application/json; charset", body: "{}", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "no body", method: http.MethodPost, expectedStatus: http.StatusOK},
+		{name: "bulk delete", method: http.MethodDelete, contentType: "application/json", body: `{"ids":[1]}`, expectedStatus: http.StatusOK},
+		{name: "bulk delete as text", method: http.MethodDelete, contentType: "text/plain", body: `{"ids":[1]}`, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "bulk delete as form", method: http.MethodDelete, contentType: "application/x-www-form-urlencoded", body: "ids=1", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "delete without body", method: http.MethodDelete, expectedStatus: http.StatusOK},
+		{name: "not a write", method: http.MethodGet, contentType: "text/plain", body: "x", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "/api/v1/todos", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestForceHTTPS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ForceHTTPS(24*time.Hour, "/health"))
+	router.GET("/health", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/api/v1/todos", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name             string
+		path             string
+		forwardedProto   string
+		expectedStatus   int
+		expectedLocation string
+		expectedHSTS     string
+	}{
+		{
+			name:             "plain HTTP is redirected",
+			path:             "/api/v1/todos?page=2",
+			forwardedProto:   "http",
+			expectedStatus:   http.StatusPermanentRedirect,
+			expectedLocation: "https://example.com/api/v1/todos?page=2",
+		},
+		{
+			name:             "request without TLS is redirected",
+			path:             "/api/v1/todos",
+			expectedStatus:   http.StatusPermanentRedirect,
+			expectedLocation: "https://example.com/api/v1/todos",
+		},
+		{
+			name:           "HTTPS gets HSTS",
+			path:           "/api/v1/todos",
+			forwardedProto: "https",
+			expectedStatus: http.StatusOK,
+			expectedHSTS:   "max-age=86400",
+		},
+		{
+			name:           "health check is exempt",
+			path:           "/health",
+			forwardedProto: "http",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "http://example.com"+tt.path, http.NoBody)
+			if tt.forwardedProto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+			assert.Equal(t, tt.expectedHSTS, w.Header().Get("Strict-Transport-Security"))
+		})
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name             string
+		httpsPort        int
+		host             string
+		expectedLocation string
+	}{
+		{"default port", 443, "example.com:80", "https://example.com/api/v1/todos?page=2"},
+		{"other port", 8443, "example.com:8080", "https://example.com:8443/api/v1/todos?page=2"},
+		{"host without port", 8443, "example.com", "https://example.com:8443/api/v1/todos?page=2"},
+		{"IPv6", 443, "[::1]:80", "https://[::1]/api/v1/todos?page=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/todos?page=2", http.NoBody)
+			req.Host = tt.host
+			RedirectToHTTPS(tt.httpsPort).ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	forwarded, err := ForwardedHeaders([]string{"10.0.0.0/8", "::1"})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(forwarded)
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetHeader(ForwardedProtoHeader)+" "+c.GetHeader(ForwardedHostHeader))
+	})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		proto        string
+		host         string
+		expectedBody string
+	}{
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:4567", proto: "https", host: "api.example.com", expectedBody: "https api.example.com"},
+		{name: "trusted IPv6 proxy", remoteAddr: "[::1]:4567", proto: "HTTPS", host: "api.example.com:8443", expectedBody: "https api.example.com:8443"},
+		{name: "first of several values", remoteAddr: "10.1.2.3:4567", proto: "https, http", host: "api.example.com, internal", expectedBody: "https api.example.com"},
+		{name: "untrusted client", remoteAddr: "192.0.2.1:4567", proto: "https", host: "evil.example.com", expectedBody: " "},
+		{name: "invalid values", remoteAddr: "10.1.2.3:4567", proto: "ftp", host: "evil.example.com/path", expectedBody: " "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(ForwardedProtoHeader, tt.proto)
+			req.Header.Set(ForwardedHostHeader, tt.host)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+		})
+	}
+
+	_, err = ForwardedHeaders([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
+
+func TestLogBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	router := gin.New()
+	router.Use(LogBodies(log, 64, []string{"password"}))
+	router.POST("/login", func(c *gin.Context) {
+		var body struct {
+			User     string `json:"user"`
+			Password string `json:"password"`
+		}
+		// Binding still sees the whole body
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user": body.User, "session": map[string]string{"Password": body.Password}})
+	})
+	router.POST("/large", func(c *gin.Context) {
+		_, _ = io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, strings.Repeat("x", 100))
+	})
+
+	logged := func(path, body string) map[string]any {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		return record
+	}
+
+	record := logged("/login", `{"user":"alice","password":"hunter2"}`)
+	assert.JSONEq(t, `{"user":"alice","password":"****"}`, record["request_body"].(string))
+	assert.JSONEq(t, `{"user":"alice","session":{"Password":"****"}}`, record["response_body"].(string))
+	assert.NotContains(t, buf.String(), "hunter2")
+
+	record = logged("/large", `not json`)
+	assert.Equal(t, "8 bytes, not JSON", record["request_body"])
+	assert.Equal(t, "100 bytes, too large to log", record["response_body"])
+}
+
+// TestWritersUnwrap checks that handlers behind the recording middlewares
+// still reach the connection, as streams clearing their write deadline do
+func TestWritersUnwrap(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(LogBodies(slog.New(slog.DiscardHandler), 64, nil), Idempotency(time.Minute, 100))
+	router.POST("/stream", func(c *gin.Context) {
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/stream", http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set(IdempotencyKeyHeader, "stream")
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+}
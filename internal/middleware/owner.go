@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// UserIDHeader is the request header identifying the user whose todos
+	// the request acts on
+	UserIDHeader = "X-User-ID"
+
+	// maxUserIDLength matches the size of the owner_id column
+	maxUserIDLength = 255
+)
+
+// RequireOwner returns a gin middleware that rejects requests without an
+// X-User-ID header with 401, and stores the user ID in the request context
+// of the others so repositories only see that user's todos
+func RequireOwner() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := strings.TrimSpace(c.GetHeader(UserIDHeader))
+		if userID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
+				Error:   "missing_user_id",
+				Message: "The X-User-ID header is required",
+			})
+			return
+		}
+		if len(userID) > maxUserIDLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "invalid_user_id",
+				Message: "User ID is too long",
+			})
+			return
+		}
+
+		c.Request = c.Request.WithContext(owner.NewContext(c.Request.Context(), userID))
+		c.Next()
+	}
+}
@@ -3,21 +3,27 @@ package middleware
 import (
 	"log/slog"
 	"net/http"
+	"runtime/debug"
 
 	"github.com/g3offrey/idiomapi/internal/dto"
 	"github.com/gin-gonic/gin"
 )
 
-// Recovery returns a gin middleware that recovers from panics and logs them using slog
-func Recovery(logger *slog.Logger) gin.HandlerFunc {
+// Recovery returns a gin middleware that recovers from panics and logs them using slog.
+// When logStack is true the log includes the stack trace of the panic.
+func Recovery(logger *slog.Logger, logStack bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				logger.Error("panic recovered",
+				attrs := []any{
 					"error", err,
 					"path", c.Request.URL.Path,
 					"method", c.Request.Method,
-				)
+				}
+				if logStack {
+					attrs = append(attrs, "stack", string(debug.Stack()))
+				}
+				logger.Error("panic recovered", attrs...)
 
 				c.AbortWithStatusJSON(http.StatusInternalServerError, dto.ErrorResponse{
 					Error:   "internal_server_error",
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestTimeoutHeader is the request header a client can use to ask for a
+// shorter deadline, written as a Go duration such as "2s"
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// Timeout returns a gin middleware that bounds each request with a deadline.
+// The deadline is attached to the request context so that downstream calls
+// (such as database queries) are cancelled when it expires. If the handler
+// runs past the deadline, whatever it tries to write is discarded and a 503
+// response is returned instead.
+//
+// When maxHeader is positive, clients may send an X-Request-Timeout header.
+// Its value is clamped to maxHeader and replaces d when shorter; invalid
+// values are ignored.
+//
+// Requests matched by unbounded, when given, are left unbounded, such as
+// event streams staying open until the client leaves and downloads too
+// large to send within the deadline.
+func Timeout(d, maxHeader time.Duration, unbounded Matcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if unbounded != nil && unbounded(c) {
+			c.Next()
+			return
+		}
+
+		timeout := d
+		if requested, ok := headerTimeout(c.GetHeader(RequestTimeoutHeader), maxHeader); ok && (timeout <= 0 || requested < timeout) {
+			timeout = requested
+		}
+
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+
+		original := c.Writer
+		tw := &timeoutWriter{ResponseWriter: original, ctx: ctx}
+		c.Writer = tw
+
+		c.Next()
+
+		c.Writer = original
+
+		if tw.timedOut || (errors.Is(ctx.Err(), context.DeadlineExceeded) && !original.Written()) {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, dto.ErrorResponse{
+				Error:   "timeout",
+				Message: "Request timed out",
+			})
+		}
+	}
+}
+
+// Matcher reports whether a request is one of a kind of requests
+type Matcher func(c *gin.Context) bool
+
+// Paths returns a Matcher of the requests to the routes of paths, as
+// registered
+func Paths(paths ...string) Matcher {
+	return func(c *gin.Context) bool {
+		return slices.Contains(paths, c.FullPath())
+	}
+}
+
+// headerTimeout parses a client requested timeout and clamps it to limit.
+// It returns false when limit is not positive or the value is not a positive
+// duration.
+func headerTimeout(value string, limit time.Duration) (time.Duration, bool) {
+	if limit <= 0 || value == "" {
+		return 0, false
+	}
+
+	requested, err := time.ParseDuration(value)
+	if err != nil || requested <= 0 {
+		return 0, false
+	}
+	return min(requested, limit), true
+}
+
+// timeoutWriter drops writes made after the request deadline has passed
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx      context.Context
+	timedOut bool
+}
+
+// expired reports whether the deadline passed before the response was written
+func (w *timeoutWriter) expired() bool {
+	if w.timedOut {
+		return true
+	}
+	if !w.ResponseWriter.Written() && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.timedOut = true
+	}
+	return w.timedOut
+}
+
+// WriteHeader records the status code unless the deadline has passed
+func (w *timeoutWriter) WriteHeader(code int) {
+	if w.expired() {
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// WriteHeaderNow flushes the status code unless the deadline has passed
+func (w *timeoutWriter) WriteHeaderNow() {
+	if w.expired() {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Write writes the body unless the deadline has passed
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.expired() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString writes the body unless the deadline has passed
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.expired() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
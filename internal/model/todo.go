@@ -1,6 +1,50 @@
 package model
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+// Priority is the urgency of a todo
+type Priority string
+
+// Priority levels, from least to most urgent
+const (
+	PriorityLow    Priority = "low"
+	PriorityMedium Priority = "medium"
+	PriorityHigh   Priority = "high"
+)
+
+// Priorities lists the valid priority levels, from least to most urgent
+var Priorities = []Priority{PriorityLow, PriorityMedium, PriorityHigh}
+
+// Valid reports whether p is one of the known priority levels
+func (p Priority) Valid() bool {
+	for _, valid := range Priorities {
+		if p == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Rank orders priorities, higher values being more urgent. Unknown
+// priorities rank below low.
+func (p Priority) Rank() int {
+	for i, valid := range Priorities {
+		if p == valid {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Maximum lengths of the text fields of a todo, in characters. The binding
+// tags of the request DTOs and the database schema enforce the same limits.
+const (
+	MaxTitleLength       = 255
+	MaxDescriptionLength = 1000
+)
 
 // Todo represents a todo item domain model
 type Todo struct {
@@ -8,6 +52,25 @@ type Todo struct {
 	Title       string
 	Description string
 	Completed   bool
+	Priority    Priority
+	OwnerID     string
+	Position    int
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+
+	// CompletedAt is when the todo was last marked completed, nil while it
+	// is not completed
+	CompletedAt *time.Time
+
+	// ExternalID identifies the todo in the external system it is synced
+	// from, nil for todos created through the API
+	ExternalID *string
+
+	// ArchivedAt is when the todo was archived, nil while it is not
+	ArchivedAt *time.Time
+}
+
+// ETag returns a weak entity tag that changes whenever the todo is updated
+func (t *Todo) ETag() string {
+	return fmt.Sprintf(`W/"%d-%d"`, t.ID, t.UpdatedAt.UnixNano())
 }
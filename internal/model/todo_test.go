@@ -25,3 +25,24 @@ func TestTodoModel(t *testing.T) {
 	assert.Equal(t, now, todo.CreatedAt)
 	assert.Equal(t, now, todo.UpdatedAt)
 }
+
+func TestPriority(t *testing.T) {
+	assert.True(t, PriorityHigh.Valid())
+	assert.False(t, Priority("urgent").Valid())
+	assert.False(t, Priority("").Valid())
+
+	assert.Greater(t, PriorityHigh.Rank(), PriorityMedium.Rank())
+	assert.Greater(t, PriorityMedium.Rank(), PriorityLow.Rank())
+	assert.Greater(t, PriorityLow.Rank(), Priority("urgent").Rank())
+}
+
+func TestTodoETag(t *testing.T) {
+	updated := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	todo := Todo{ID: 7, UpdatedAt: updated}
+
+	assert.Equal(t, `W/"7-1704164645000006000"`, todo.ETag())
+
+	changed := todo
+	changed.UpdatedAt = updated.Add(time.Microsecond)
+	assert.NotEqual(t, todo.ETag(), changed.ETag())
+}
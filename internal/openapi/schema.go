@@ -0,0 +1,117 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+)
+
+// schemaRefPrefix is the JSON pointer prefix of component schemas
+const schemaRefPrefix = "#/components/schemas/"
+
+// timeType is rendered as an RFC 3339 string rather than an object
+var timeType = reflect.TypeOf(time.Time{})
+
+// Schema is an OpenAPI schema object
+type Schema struct {
+	Ref        string             `json:"$ref,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	MinLength  *int               `json:"minLength,omitempty"`
+	MaxLength  *int               `json:"maxLength,omitempty"`
+	Minimum    *int               `json:"minimum,omitempty"`
+	Maximum    *int               `json:"maximum,omitempty"`
+	MinItems   *int               `json:"minItems,omitempty"`
+	MaxItems   *int               `json:"maxItems,omitempty"`
+	Enum       []string           `json:"enum,omitempty"`
+}
+
+// schemaGenerator derives schemas from Go types, collecting every struct
+// it visits as a named component schema
+type schemaGenerator struct {
+	schemas map[string]*Schema
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{schemas: make(map[string]*Schema)}
+}
+
+// ref returns the schema of obj, a reference for struct types
+func (g *schemaGenerator) ref(obj any) *Schema {
+	return g.schemaFor(reflect.TypeOf(obj))
+}
+
+// schemaFor returns the schema of t
+func (g *schemaGenerator) schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = nil // reserve the name while visiting fields
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return &Schema{Ref: schemaRefPrefix + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schemaFor(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	default:
+		return &Schema{Type: "object"}
+	}
+}
+
+// structSchema builds an object schema from the json tags of t. Required
+// fields and length or range limits come from its binding tags, through
+// dto.Constraints, so the spec matches what the handlers enforce.
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	constraints := make(map[string]dto.FieldConstraint)
+	for _, c := range dto.Constraints(reflect.New(t).Interface()) {
+		constraints[c.Field] = c
+	}
+
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		property := g.schemaFor(field.Type)
+		if c, ok := constraints[name]; ok {
+			if c.Required {
+				schema.Required = append(schema.Required, name)
+			}
+			property.Enum = c.Enum
+			switch property.Type {
+			case "string":
+				property.MinLength, property.MaxLength = c.Min, c.Max
+			case "integer", "number":
+				property.Minimum, property.Maximum = c.Min, c.Max
+			case "array":
+				property.MinItems, property.MaxItems = c.Min, c.Max
+			}
+		}
+		schema.Properties[name] = property
+	}
+
+	return schema
+}
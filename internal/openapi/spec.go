@@ -0,0 +1,689 @@
+// Package openapi describes the HTTP API as an OpenAPI 3 document.
+package openapi
+
+import (
+	_ "embed" // for SwaggerUI
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+)
+
+// SwaggerUI is an HTML page rendering the document served at /openapi.json
+//
+//go:embed swagger.html
+var SwaggerUI []byte
+
+// Version is the OpenAPI version of the generated document
+const Version = "3.0.3"
+
+// todosPath prefixes the routes scoped to the user named by X-User-ID
+const todosPath = "/api/v1/todos"
+
+// adminPath prefixes the routes requiring the admin token
+const adminPath = "/api/v1/admin"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Components holds the reusable schemas referenced from operations
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// PathItem maps lower case HTTP methods to the operations on a path
+type PathItem map[string]*Operation
+
+// Operation describes a single API operation
+type Operation struct {
+	Summary     string              `json:"summary"`
+	OperationID string              `json:"operationId"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter describes a path, query or header parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes a JSON request body
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a response and its JSON body, if any
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header describes a response header
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// route documents one operation exposed by the API
+type route struct {
+	method     string
+	path       string
+	id         string
+	summary    string
+	parameters []Parameter
+	request    any
+	responses  []response
+
+	// headers lists the headers set on the responses of a status
+	headers map[int]map[string]Header
+}
+
+// response pairs a status code with the DTO written for it; body is nil
+// for responses without content
+type response struct {
+	status      int
+	description string
+	body        any
+}
+
+var (
+	idParam = Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer"}}
+
+	// exportIDParam is the ID of an export job
+	exportIDParam = Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}
+
+	userIDParam = Parameter{Name: "X-User-ID", In: "header", Required: true, Description: "User whose todos the request acts on", Schema: &Schema{Type: "string"}}
+
+	adminTokenParam = Parameter{Name: "X-Admin-Token", In: "header", Required: true, Description: "The admin.token of the configuration", Schema: &Schema{Type: "string"}}
+
+	fieldsParam = Parameter{Name: "fields", In: "query", Description: "Comma separated todo fields to return: id, title, description, completed, priority, created_at, updated_at", Schema: &Schema{Type: "string"}}
+
+	linksParam = Parameter{Name: "links", In: "query", Description: "Include _links with the URL of each todo", Schema: &Schema{Type: "boolean"}}
+
+	dryRunParam = Parameter{Name: "dry_run", In: "query", Description: "true only counts the todos the operation would change", Schema: &Schema{Type: "boolean"}}
+
+	dateFormatParams = []Parameter{
+		{Name: "date_format", In: "query", Description: "Render timestamps as strings in this format: rfc3339, rfc1123, date, datetime, us or eu", Schema: &Schema{Type: "string"}},
+		{Name: "timezone", In: "query", Description: "IANA time zone for date_format, the configured one by default", Schema: &Schema{Type: "string"}},
+	}
+
+	// ownerResponses apply to the todos routes, which require X-User-ID, or
+	// a bearer token with auth.enabled, unless given an X-API-Key
+	ownerResponses = []response{
+		{http.StatusUnauthorized, "Missing X-User-ID header, missing or invalid bearer token with auth.enabled, or invalid X-API-Key", dto.ErrorResponse{}},
+		{http.StatusForbidden, "X-API-Key lacks the todos:read or todos:write scope of the route, or X-CSRF-Token does not repeat the csrf_token cookie with auth.cookie_sessions", dto.ErrorResponse{}},
+	}
+
+	// apiKeyOwnerResponse applies to the API key and export routes, which
+	// require X-User-ID, or a bearer token with auth.enabled
+	apiKeyOwnerResponse = response{http.StatusUnauthorized, "Missing X-User-ID header, or missing or invalid bearer token with auth.enabled", dto.ErrorResponse{}}
+
+	// adminResponse applies to the admin routes, which are only served
+	// with admin.token
+	adminResponse = response{http.StatusUnauthorized, "Missing or invalid X-Admin-Token header", dto.ErrorResponse{}}
+
+	errorResponses = []response{
+		{http.StatusInternalServerError, "Internal error", dto.ErrorResponse{}},
+		{http.StatusServiceUnavailable, "Database unavailable", dto.ErrorResponse{}},
+	}
+)
+
+// routes lists the documented operations. Keep it in sync with
+// setupRoutes in cmd/api.
+var routes = []route{
+	{
+		method:  http.MethodPost,
+		path:    "/api/v1/todos",
+		id:      "createTodo",
+		summary: "Create a new todo",
+		parameters: []Parameter{
+			{Name: "Idempotency-Key", In: "header", Description: "Replay the original response for a repeated key; a reused key with another body is answered with 422", Schema: &Schema{Type: "string"}},
+			linksParam,
+		},
+		request: dto.CreateTodoRequest{},
+		responses: []response{
+			{http.StatusCreated, "Todo created", dto.TodoResponse{}},
+			{http.StatusBadRequest, "Invalid request", dto.ValidationErrorResponse{}},
+			{http.StatusUnprocessableEntity, "Well formed request breaking a business rule", dto.ValidationErrorResponse{}},
+			{http.StatusConflict, "Title already used, with todos.unique_titles", dto.ErrorResponse{}},
+		},
+		headers: map[int]map[string]Header{
+			http.StatusCreated: {
+				"Location": {Description: "Absolute URL of the new todo", Schema: &Schema{Type: "string", Format: "uri"}},
+			},
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/todos",
+		id:      "listTodos",
+		summary: "List todos with pagination",
+		parameters: append([]Parameter{
+			{Name: "page", In: "query", Schema: &Schema{Type: "integer"}},
+			{Name: "page_size", In: "query", Schema: &Schema{Type: "integer"}},
+			{Name: "completed", In: "query", Schema: &Schema{Type: "boolean"}},
+			{Name: "priority", In: "query", Schema: &Schema{Type: "string", Enum: []string{"low", "medium", "high"}}},
+			{Name: "sort", In: "query", Description: "priority lists the most urgent todos first, position lists todos in their manual order", Schema: &Schema{Type: "string", Enum: []string{"priority", "position"}}},
+			{Name: "created_after", In: "query", Description: "Only todos created at or after this time", Schema: &Schema{Type: "string", Format: "date-time"}},
+			{Name: "created_before", In: "query", Description: "Only todos created at or before this time", Schema: &Schema{Type: "string", Format: "date-time"}},
+			{Name: "include_archived", In: "query", Description: "Also select archived todos", Schema: &Schema{Type: "boolean"}},
+			{Name: "format", In: "query", Description: "csv downloads every matching todo as CSV, like Accept: text/csv", Schema: &Schema{Type: "string", Enum: []string{"csv"}}},
+			{Name: "view", In: "query", Description: "compact returns only id, title, completed and updated_at, without links nor date formatting", Schema: &Schema{Type: "string", Enum: []string{"compact"}}},
+			fieldsParam,
+			linksParam,
+		}, dateFormatParams...),
+		responses: []response{
+			{http.StatusOK, "A page of todos, trimmed with view=compact, or every matching todo as text/csv when requested", dto.TodoListResponse{}},
+			{http.StatusBadRequest, "Invalid filter", dto.ValidationErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodHead,
+		path:    "/api/v1/todos",
+		id:      "countTodos",
+		summary: "Count todos without listing them, in X-Total-Count",
+		parameters: []Parameter{
+			{Name: "completed", In: "query", Schema: &Schema{Type: "boolean"}},
+			{Name: "priority", In: "query", Schema: &Schema{Type: "string", Enum: []string{"low", "medium", "high"}}},
+			{Name: "created_after", In: "query", Description: "Only todos created at or after this time", Schema: &Schema{Type: "string", Format: "date-time"}},
+			{Name: "created_before", In: "query", Description: "Only todos created at or before this time", Schema: &Schema{Type: "string", Format: "date-time"}},
+			{Name: "include_archived", In: "query", Description: "Also select archived todos", Schema: &Schema{Type: "boolean"}},
+		},
+		responses: []response{
+			{http.StatusOK, "The number of matching todos is in X-Total-Count", nil},
+			{http.StatusBadRequest, "Invalid filter", nil},
+		},
+	},
+	{
+		method:  http.MethodDelete,
+		path:    "/api/v1/todos",
+		id:      "deleteTodos",
+		summary: "Delete todos by ID, by completion status, or all of them",
+		parameters: []Parameter{
+			{Name: "completed", In: "query", Schema: &Schema{Type: "boolean"}},
+			{Name: "all", In: "query", Description: "Must be true to delete every todo without a filter", Schema: &Schema{Type: "boolean"}},
+			dryRunParam,
+		},
+		request: dto.BulkDeleteRequest{},
+		responses: []response{
+			{http.StatusOK, "Todos deleted, or with dry_run=true how many would be, as {\"would_affect\": n}", dto.BulkDeleteResponse{}},
+			{http.StatusBadRequest, "Missing or invalid filter", dto.ValidationErrorResponse{}},
+		},
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/api/v1/todos/complete-all",
+		id:         "completeAllTodos",
+		summary:    "Mark every todo as completed",
+		parameters: []Parameter{dryRunParam},
+		responses: []response{
+			{http.StatusOK, "Todos completed, or with dry_run=true how many would be, as {\"would_affect\": n}", dto.BulkUpdateResponse{}},
+			{http.StatusBadRequest, "Invalid dry_run", dto.ValidationErrorResponse{}},
+		},
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/api/v1/todos/batch-get",
+		id:         "batchGetTodos",
+		summary:    "Get several todos by ID",
+		parameters: []Parameter{linksParam},
+		request:    dto.BatchGetRequest{},
+		responses: []response{
+			{http.StatusOK, "The todos found, in the order of the requested IDs", dto.BatchGetResponse{}},
+			{http.StatusBadRequest, "Invalid request", dto.ValidationErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/todos/version",
+		id:      "getTodosVersion",
+		summary: "Get a token that changes whenever any todo changes",
+		responses: []response{
+			{http.StatusOK, "The current version token", dto.VersionResponse{}},
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/todos/events",
+		id:      "streamTodoEvents",
+		summary: "Stream todo.created, todo.updated, todo.deleted and todos.changed server-sent events",
+		responses: []response{
+			{http.StatusOK, "An event stream that stays open until the client disconnects", nil},
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/todos/stats/dow",
+		id:      "getWeekdayStats",
+		summary: "Count todos created on each day of the week",
+		responses: []response{
+			{http.StatusOK, "Counts from Sunday to Saturday", dto.WeekdayStatsResponse{}},
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/todos/stats/completion-time",
+		id:      "getCompletionTimeStats",
+		summary: "Average the time completed todos took from creation to completion",
+		parameters: []Parameter{
+			{Name: "from", In: "query", Description: "Only todos completed at or after this time", Schema: &Schema{Type: "string", Format: "date-time"}},
+			{Name: "to", In: "query", Description: "Only todos completed at or before this time", Schema: &Schema{Type: "string", Format: "date-time"}},
+		},
+		responses: []response{
+			{http.StatusOK, "The average, null when no todo was completed", dto.CompletionTimeResponse{}},
+			{http.StatusBadRequest, "Invalid date range", dto.ValidationErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/todos/{id}",
+		id:      "getTodo",
+		summary: "Get a specific todo",
+		parameters: append([]Parameter{
+			idParam,
+			{Name: "If-None-Match", In: "header", Description: "Return 304 when the todo still has this ETag, unless fields or date_format is set", Schema: &Schema{Type: "string"}},
+			fieldsParam,
+			linksParam,
+		}, dateFormatParams...),
+		responses: []response{
+			{http.StatusOK, "The todo", dto.TodoResponse{}},
+			{http.StatusNotModified, "The todo is unchanged", nil},
+			{http.StatusBadRequest, "Invalid todo ID", dto.ErrorResponse{}},
+			{http.StatusNotFound, "Todo not found", dto.ErrorResponse{}},
+		},
+	},
+	{
+		method:     http.MethodHead,
+		path:       "/api/v1/todos/{id}",
+		id:         "todoExists",
+		summary:    "Check whether a todo exists",
+		parameters: []Parameter{idParam},
+		responses: []response{
+			{http.StatusOK, "The todo exists", nil},
+			{http.StatusBadRequest, "Invalid todo ID", nil},
+			{http.StatusNotFound, "Todo not found", nil},
+		},
+	},
+	{
+		method:  http.MethodPut,
+		path:    "/api/v1/todos/by-external/{externalID}",
+		id:      "upsertTodoByExternalID",
+		summary: "Create or replace the todo synced from an external system",
+		parameters: []Parameter{
+			{Name: "externalID", In: "path", Required: true, Description: "ID of the todo in the external system", Schema: &Schema{Type: "string"}},
+			linksParam,
+		},
+		request: dto.CreateTodoRequest{},
+		responses: []response{
+			{http.StatusOK, "Todo replaced", dto.TodoResponse{}},
+			{http.StatusCreated, "Todo created", dto.TodoResponse{}},
+			{http.StatusBadRequest, "Invalid request", dto.ValidationErrorResponse{}},
+			{http.StatusUnprocessableEntity, "Well formed request breaking a business rule", dto.ValidationErrorResponse{}},
+			{http.StatusConflict, "Title already used, with todos.unique_titles", dto.ErrorResponse{}},
+		},
+		headers: map[int]map[string]Header{
+			http.StatusCreated: {
+				"Location": {Description: "Absolute URL of the new todo", Schema: &Schema{Type: "string", Format: "uri"}},
+			},
+		},
+	},
+	{
+		method:  http.MethodPut,
+		path:    "/api/v1/todos/{id}",
+		id:      "updateTodo",
+		summary: "Update a todo",
+		parameters: []Parameter{
+			idParam,
+			{Name: "If-Match", In: "header", Description: "Only update if the todo still has this ETag", Schema: &Schema{Type: "string"}},
+			linksParam,
+		},
+		request: dto.UpdateTodoRequest{},
+		responses: []response{
+			{http.StatusOK, "Todo updated", dto.TodoResponse{}},
+			{http.StatusBadRequest, "Invalid request", dto.ValidationErrorResponse{}},
+			{http.StatusUnprocessableEntity, "Well formed request breaking a business rule", dto.ValidationErrorResponse{}},
+			{http.StatusNotFound, "Todo not found", dto.ErrorResponse{}},
+			{http.StatusConflict, "Title already used, with todos.unique_titles", dto.ErrorResponse{}},
+			{http.StatusPreconditionFailed, "Todo has been modified", dto.ErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodPut,
+		path:    "/api/v1/todos/reorder",
+		id:      "reorderTodos",
+		summary: "Move the listed todos, in order, to the top of the manual order",
+		request: dto.ReorderTodosRequest{},
+		responses: []response{
+			{http.StatusNoContent, "Todos reordered", nil},
+			{http.StatusBadRequest, "Invalid request", dto.ValidationErrorResponse{}},
+			{http.StatusNotFound, "One of the todos was not found", dto.ErrorResponse{}},
+		},
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/api/v1/todos/{id}/archive",
+		id:         "archiveTodo",
+		summary:    "Archive a todo, hiding it from lists unless include_archived=true",
+		parameters: []Parameter{idParam, linksParam},
+		responses: []response{
+			{http.StatusOK, "Todo archived, or already archived", dto.TodoResponse{}},
+			{http.StatusBadRequest, "Invalid todo ID", dto.ErrorResponse{}},
+			{http.StatusNotFound, "Todo not found", dto.ErrorResponse{}},
+		},
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/api/v1/todos/{id}/unarchive",
+		id:         "unarchiveTodo",
+		summary:    "Bring an archived todo back into lists",
+		parameters: []Parameter{idParam, linksParam},
+		responses: []response{
+			{http.StatusOK, "Todo unarchived, or not archived", dto.TodoResponse{}},
+			{http.StatusBadRequest, "Invalid todo ID", dto.ErrorResponse{}},
+			{http.StatusNotFound, "Todo not found", dto.ErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodDelete,
+		path:    "/api/v1/todos/{id}",
+		id:      "deleteTodo",
+		summary: "Delete a todo",
+		parameters: []Parameter{
+			idParam,
+			{Name: "If-Match", In: "header", Description: "Only delete if the todo still has this ETag", Schema: &Schema{Type: "string"}},
+		},
+		responses: []response{
+			{http.StatusNoContent, "Todo deleted", nil},
+			{http.StatusBadRequest, "Invalid todo ID", dto.ErrorResponse{}},
+			{http.StatusNotFound, "Todo not found", dto.ErrorResponse{}},
+			{http.StatusPreconditionFailed, "Todo has been modified", dto.ErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/api/v1/auth/register",
+		id:      "register",
+		summary: "Register a user, with auth.enabled unless auth.disable_passwords",
+		request: dto.RegisterRequest{},
+		responses: []response{
+			{http.StatusCreated, "User registered", dto.UserResponse{}},
+			{http.StatusBadRequest, "Invalid request", dto.ValidationErrorResponse{}},
+			{http.StatusConflict, "Email already registered", dto.ErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/api/v1/auth/login",
+		id:      "login",
+		summary: "Exchange an email and password for a bearer token, with auth.enabled unless auth.disable_passwords",
+		request: dto.LoginRequest{},
+		responses: []response{
+			{http.StatusOK, "Logged in", dto.TokenResponse{}},
+			{http.StatusBadRequest, "Invalid request", dto.ValidationErrorResponse{}},
+			{http.StatusUnauthorized, "Unknown email or wrong password", dto.ErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/api/v1/auth/refresh",
+		id:      "refreshToken",
+		summary: "Exchange a refresh token, which stops working, for new tokens, with auth.enabled",
+		request: dto.RefreshRequest{},
+		responses: []response{
+			{http.StatusOK, "Tokens refreshed", dto.TokenResponse{}},
+			{http.StatusBadRequest, "Invalid request", dto.ValidationErrorResponse{}},
+			{http.StatusUnauthorized, "Refresh token unknown, expired or already used", dto.ErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/api/v1/auth/logout",
+		id:      "logout",
+		summary: "End the session of a refresh token, with auth.enabled",
+		request: dto.RefreshRequest{},
+		responses: []response{
+			{http.StatusNoContent, "Session ended", nil},
+			{http.StatusBadRequest, "Invalid request", dto.ValidationErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/auth/oidc/login",
+		id:      "oidcLogin",
+		summary: "Start logging in with the OIDC provider, with auth.oidc.enabled",
+		responses: []response{
+			{http.StatusFound, "Redirect to the provider", nil},
+		},
+		headers: map[int]map[string]Header{
+			http.StatusFound: {
+				"Location":   {Description: "Authorization URL of the provider", Schema: &Schema{Type: "string", Format: "uri"}},
+				"Set-Cookie": {Description: "Login state, sent back to the callback", Schema: &Schema{Type: "string"}},
+			},
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/auth/oidc/callback",
+		id:      "oidcCallback",
+		summary: "Finish logging in with the OIDC provider, which redirects here, for a bearer token",
+		parameters: []Parameter{
+			{Name: "code", In: "query", Description: "Authorization code from the provider", Schema: &Schema{Type: "string"}},
+			{Name: "state", In: "query", Required: true, Description: "State sent to the provider at login", Schema: &Schema{Type: "string"}},
+		},
+		responses: []response{
+			{http.StatusOK, "Logged in", dto.TokenResponse{}},
+			{http.StatusBadRequest, "Login state missing or mismatched", dto.ErrorResponse{}},
+			{http.StatusUnauthorized, "Provider did not authenticate the user", dto.ErrorResponse{}},
+			{http.StatusForbidden, "User outside auth.oidc.allowed_domain or without a verified email", dto.ErrorResponse{}},
+		},
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/api/v1/apikeys",
+		id:         "createAPIKey",
+		summary:    "Create an API key for machine clients, returning its secret once",
+		parameters: []Parameter{userIDParam},
+		request:    dto.CreateAPIKeyRequest{},
+		responses: []response{
+			{http.StatusCreated, "API key created", dto.CreatedAPIKeyResponse{}},
+			{http.StatusBadRequest, "Invalid request", dto.ValidationErrorResponse{}},
+			apiKeyOwnerResponse,
+		},
+	},
+	{
+		method:     http.MethodGet,
+		path:       "/api/v1/apikeys",
+		id:         "listAPIKeys",
+		summary:    "List the API keys of the user, without their secrets",
+		parameters: []Parameter{userIDParam},
+		responses: []response{
+			{http.StatusOK, "API keys", dto.APIKeyListResponse{}},
+			apiKeyOwnerResponse,
+		},
+	},
+	{
+		method:     http.MethodDelete,
+		path:       "/api/v1/apikeys/{id}",
+		id:         "deleteAPIKey",
+		summary:    "Revoke an API key",
+		parameters: []Parameter{userIDParam, idParam},
+		responses: []response{
+			{http.StatusNoContent, "API key revoked", nil},
+			{http.StatusNotFound, "API key not found", dto.ErrorResponse{}},
+			apiKeyOwnerResponse,
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/users/me/export",
+		id:      "exportUserData",
+		summary: "Download every todo and recorded change of the user, or start building the archive in the background for large accounts",
+		parameters: []Parameter{
+			userIDParam,
+			{Name: "format", In: "query", Description: "json (default) or zip", Schema: &Schema{Type: "string", Enum: []string{"json", "zip"}}},
+			{Name: "async", In: "query", Description: "Build the archive in the background whatever the size of the account", Schema: &Schema{Type: "boolean"}},
+		},
+		responses: []response{
+			{http.StatusOK, "Archive, as an attachment", nil},
+			{http.StatusAccepted, "Archive being built, at the Location of the export", dto.ExportJobResponse{}},
+			{http.StatusBadRequest, "Invalid format or async", dto.ValidationErrorResponse{}},
+			{http.StatusTooManyRequests, "Too many archives being built in the background", dto.ErrorResponse{}},
+			apiKeyOwnerResponse,
+		},
+	},
+	{
+		method:     http.MethodGet,
+		path:       "/api/v1/users/me/exports/{id}",
+		id:         "getUserDataExport",
+		summary:    "Get the status of an archive being built in the background",
+		parameters: []Parameter{userIDParam, exportIDParam},
+		responses: []response{
+			{http.StatusOK, "Export", dto.ExportJobResponse{}},
+			{http.StatusNotFound, "Export not found or expired", dto.ErrorResponse{}},
+			apiKeyOwnerResponse,
+		},
+	},
+	{
+		method:     http.MethodGet,
+		path:       "/api/v1/users/me/exports/{id}/download",
+		id:         "downloadUserDataExport",
+		summary:    "Download an archive built in the background",
+		parameters: []Parameter{userIDParam, exportIDParam},
+		responses: []response{
+			{http.StatusOK, "Archive, as an attachment", nil},
+			{http.StatusNotFound, "Export not found or expired", dto.ErrorResponse{}},
+			{http.StatusConflict, "Export still pending, or failed", dto.ErrorResponse{}},
+			apiKeyOwnerResponse,
+		},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/api/v1/admin/db/maintenance",
+		id:      "runDatabaseMaintenance",
+		summary: "Refresh the todos table statistics, PostgreSQL only",
+		responses: []response{
+			{http.StatusOK, "Maintenance completed", dto.MaintenanceResponse{}},
+			{http.StatusTooManyRequests, "Maintenance ran too recently", dto.ErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/api/v1/admin/log-level",
+		id:      "setLogLevel",
+		summary: "Change the logging level without restarting",
+		request: dto.LogLevelRequest{},
+		responses: []response{
+			{http.StatusOK, "Level changed", dto.LogLevelResponse{}},
+			{http.StatusBadRequest, "Unknown level", dto.ValidationErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/admin/audit",
+		id:      "listAuditEvents",
+		summary: "List the recorded todo changes, oldest first, with audit.enabled",
+		parameters: []Parameter{
+			{Name: "actor", In: "query", Description: "Only changes made by this user", Schema: &Schema{Type: "string"}},
+			{Name: "action", In: "query", Description: "Only this action, e.g. update", Schema: &Schema{Type: "string"}},
+			{Name: "entity", In: "query", Description: "Only changes of this kind of entity, e.g. todo", Schema: &Schema{Type: "string"}},
+			{Name: "entity_id", In: "query", Description: "Only changes of the entity with this ID", Schema: &Schema{Type: "string"}},
+			{Name: "after_id", In: "query", Description: "Only events after this one, the next_after_id of the previous page", Schema: &Schema{Type: "integer"}},
+			{Name: "limit", In: "query", Description: "Events per page, 1 to 1000, 100 by default", Schema: &Schema{Type: "integer"}},
+		},
+		responses: []response{
+			{http.StatusOK, "Audit events", dto.AuditEventListResponse{}},
+			{http.StatusBadRequest, "Invalid after_id or limit", dto.ValidationErrorResponse{}},
+		},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/api/v1/admin/audit/verify",
+		id:      "verifyAuditEvents",
+		summary: "Check that no audit event was altered, inserted or removed since recorded",
+		responses: []response{
+			{http.StatusOK, "Verification result", dto.AuditVerificationResponse{}},
+		},
+	},
+}
+
+// Spec builds the OpenAPI document for the todos API from the route table
+// and the DTO types
+func Spec() *Document {
+	gen := newSchemaGenerator()
+	paths := make(map[string]PathItem)
+
+	for _, r := range routes {
+		parameters, responses := r.parameters, r.responses
+		if strings.HasPrefix(r.path, todosPath) {
+			parameters = append([]Parameter{userIDParam}, parameters...)
+			responses = append(responses[:len(responses):len(responses)], ownerResponses...)
+		}
+		if strings.HasPrefix(r.path, adminPath) {
+			parameters = append([]Parameter{adminTokenParam}, parameters...)
+			responses = append(responses[:len(responses):len(responses)], adminResponse)
+		}
+
+		op := &Operation{
+			Summary:     r.summary,
+			OperationID: r.id,
+			Parameters:  parameters,
+			Responses:   make(map[string]Response),
+		}
+
+		if r.request != nil {
+			op.RequestBody = &RequestBody{
+				Required: r.method != http.MethodDelete,
+				Content:  jsonContent(gen.ref(r.request)),
+			}
+		}
+
+		for _, resp := range append(responses, errorResponses...) {
+			doc := Response{Description: resp.description, Headers: r.headers[resp.status]}
+			if resp.body != nil && r.method != http.MethodHead {
+				doc.Content = jsonContent(gen.ref(resp.body))
+			}
+			op.Responses[strconv.Itoa(resp.status)] = doc
+		}
+
+		if paths[r.path] == nil {
+			paths[r.path] = make(PathItem)
+		}
+		paths[r.path][strings.ToLower(r.method)] = op
+	}
+
+	return &Document{
+		OpenAPI:    Version,
+		Info:       Info{Title: "idiomapi", Version: "1.0.0"},
+		Paths:      paths,
+		Components: Components{Schemas: gen.schemas},
+	}
+}
+
+// jsonContent wraps schema as an application/json body
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
@@ -0,0 +1,75 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpec(t *testing.T) {
+	doc := Spec()
+
+	assert.Equal(t, Version, doc.OpenAPI)
+	assert.Contains(t, doc.Paths, "/api/v1/todos")
+	assert.Contains(t, doc.Paths, "/api/v1/todos/{id}")
+	assert.Len(t, doc.Paths["/api/v1/todos"], 4)
+	assert.Len(t, doc.Paths["/api/v1/todos/{id}"], 4)
+
+	create := doc.Paths["/api/v1/todos"]["post"]
+	require.NotNil(t, create)
+	assert.Equal(t, "#/components/schemas/CreateTodoRequest", create.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Contains(t, create.Responses, "201")
+	assert.Contains(t, create.Responses["201"].Headers, "Location")
+	assert.Contains(t, create.Responses, "500")
+
+	bulkDelete := doc.Paths["/api/v1/todos"]["delete"]
+	require.NotNil(t, bulkDelete)
+	assert.False(t, bulkDelete.RequestBody.Required)
+
+	head := doc.Paths["/api/v1/todos/{id}"]["head"]
+	require.NotNil(t, head)
+	for _, resp := range head.Responses {
+		assert.Nil(t, resp.Content)
+	}
+}
+
+func TestSpecSchemasFollowBindingTags(t *testing.T) {
+	schemas := Spec().Components.Schemas
+
+	create := schemas["CreateTodoRequest"]
+	require.NotNil(t, create)
+	assert.Equal(t, []string{"title"}, create.Required)
+	assert.Equal(t, 1, *create.Properties["title"].MinLength)
+	assert.Equal(t, 255, *create.Properties["title"].MaxLength)
+	assert.Equal(t, 1000, *create.Properties["description"].MaxLength)
+	assert.Equal(t, "boolean", create.Properties["completed"].Type)
+
+	update := schemas["UpdateTodoRequest"]
+	require.NotNil(t, update)
+	assert.Empty(t, update.Required)
+	assert.Equal(t, 255, *update.Properties["title"].MaxLength)
+
+	todo := schemas["TodoResponse"]
+	require.NotNil(t, todo)
+	assert.Equal(t, "date-time", todo.Properties["created_at"].Format)
+
+	list := schemas["TodoListResponse"]
+	require.NotNil(t, list)
+	assert.Equal(t, "#/components/schemas/TodoResponse", list.Properties["todos"].Items.Ref)
+}
+
+func TestSpecReferencesResolve(t *testing.T) {
+	doc := Spec()
+
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+
+	for _, part := range strings.Split(string(data), `"$ref":"`)[1:] {
+		ref, _, _ := strings.Cut(part, `"`)
+		name := strings.TrimPrefix(ref, schemaRefPrefix)
+		assert.NotNil(t, doc.Components.Schemas[name], ref)
+	}
+}
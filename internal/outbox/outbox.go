@@ -0,0 +1,77 @@
+// Package outbox implements a transactional outbox for todo events. The
+// repository writes an event in the same transaction as the change it
+// describes, and a Poller later publishes the events that were committed.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Event types
+const (
+	EventTodoCreated = "todo.created"
+	EventTodoUpdated = "todo.updated"
+	EventTodoDeleted = "todo.deleted"
+)
+
+// Event is a change to a todo waiting in the outbox
+type Event struct {
+	ID        int64
+	Type      string
+	TodoID    int
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// Execer runs SQL statements; pgx.Tx implements it
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// Write adds an event of type eventType about the todo todoID to the
+// outbox, with payload encoded as JSON. Call it with the transaction
+// changing the todo so the event is committed along with the change.
+func Write(ctx context.Context, db Execer, eventType string, todoID int, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	_, err = db.Exec(ctx, "INSERT INTO todo_events (type, todo_id, payload) VALUES ($1, $2, $3)", eventType, todoID, data)
+	if err != nil {
+		return fmt.Errorf("failed to write %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// Publisher delivers events to their consumers
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// LogPublisher is a Publisher that only logs events. It stands in for the
+// delivery to the notification service.
+type LogPublisher struct {
+	logger *slog.Logger
+}
+
+// NewLogPublisher creates a LogPublisher writing to logger
+func NewLogPublisher(logger *slog.Logger) *LogPublisher {
+	return &LogPublisher{logger: logger}
+}
+
+// Publish logs event
+func (p *LogPublisher) Publish(ctx context.Context, event Event) error {
+	p.logger.InfoContext(ctx, "todo event published",
+		"event_id", event.ID,
+		"type", event.Type,
+		"todo_id", event.TodoID,
+		"payload", string(event.Payload))
+	return nil
+}
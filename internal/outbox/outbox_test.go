@@ -0,0 +1,200 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTx is a transaction over events, recording the statements it runs
+type fakeTx struct {
+	pgx.Tx
+	events    []Event
+	execs     []string
+	execArgs  [][]any
+	committed bool
+}
+
+func (tx *fakeTx) Query(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
+	return &fakeRows{events: tx.events}, nil
+}
+
+func (tx *fakeTx) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	tx.execs = append(tx.execs, sql)
+	tx.execArgs = append(tx.execArgs, args)
+	return pgconn.NewCommandTag("UPDATE"), nil
+}
+
+func (tx *fakeTx) Commit(_ context.Context) error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback(_ context.Context) error { return nil }
+
+// fakeRows yields events
+type fakeRows struct {
+	pgx.Rows
+	events []Event
+	read   int
+}
+
+func (r *fakeRows) Next() bool {
+	r.read++
+	return r.read <= len(r.events)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	event := r.events[r.read-1]
+	*dest[0].(*int64) = event.ID
+	*dest[1].(*string) = event.Type
+	*dest[2].(*int) = event.TodoID
+	*dest[3].(*json.RawMessage) = event.Payload
+	*dest[4].(*time.Time) = event.CreatedAt
+	return nil
+}
+
+func (r *fakeRows) Err() error { return nil }
+
+func (r *fakeRows) Close() {}
+
+// fakeBeginner hands out tx
+type fakeBeginner struct {
+	tx *fakeTx
+}
+
+func (b *fakeBeginner) Begin(_ context.Context) (pgx.Tx, error) {
+	return b.tx, nil
+}
+
+// recordingPublisher records the events it publishes, failing with err
+type recordingPublisher struct {
+	published []Event
+	err       error
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event Event) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, event)
+	return nil
+}
+
+func TestWrite(t *testing.T) {
+	tx := &fakeTx{}
+
+	err := Write(context.Background(), tx, EventTodoCreated, 7, map[string]string{"title": "Test"})
+	require.NoError(t, err)
+
+	require.Len(t, tx.execs, 1)
+	assert.Contains(t, tx.execs[0], "INSERT INTO todo_events")
+	assert.Equal(t, []any{EventTodoCreated, 7, []byte(`{"title":"Test"}`)}, tx.execArgs[0])
+}
+
+func TestPollerPoll(t *testing.T) {
+	events := []Event{
+		{ID: 1, Type: EventTodoCreated, TodoID: 7, Payload: json.RawMessage(`{}`)},
+		{ID: 2, Type: EventTodoUpdated, TodoID: 7, Payload: json.RawMessage(`{}`)},
+	}
+
+	t.Run("publishes and marks events", func(t *testing.T) {
+		tx := &fakeTx{events: events}
+		publisher := &recordingPublisher{}
+		poller := NewPoller(&fakeBeginner{tx: tx}, publisher, time.Second, 10, 0, slog.New(slog.DiscardHandler))
+
+		published, err := poller.Poll(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, published)
+		assert.Equal(t, events, publisher.published)
+
+		require.Len(t, tx.execs, 1)
+		assert.Contains(t, tx.execs[0], "SET published_at")
+		assert.Equal(t, []any{[]int64{1, 2}}, tx.execArgs[0])
+		assert.True(t, tx.committed)
+	})
+
+	t.Run("leaves events unpublished when publishing fails", func(t *testing.T) {
+		tx := &fakeTx{events: events}
+		poller := NewPoller(&fakeBeginner{tx: tx}, &recordingPublisher{err: errors.New("unreachable")}, time.Second, 10, 0, slog.New(slog.DiscardHandler))
+
+		_, err := poller.Poll(context.Background())
+		require.Error(t, err)
+		assert.Empty(t, tx.execs)
+		assert.False(t, tx.committed)
+	})
+
+	t.Run("nothing to publish", func(t *testing.T) {
+		tx := &fakeTx{}
+		poller := NewPoller(&fakeBeginner{tx: tx}, &recordingPublisher{}, time.Second, 10, 0, slog.New(slog.DiscardHandler))
+
+		published, err := poller.Poll(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, published)
+		assert.False(t, tx.committed)
+	})
+}
+
+func TestPollerPrune(t *testing.T) {
+	t.Run("deletes events published before the retention", func(t *testing.T) {
+		tx := &fakeTx{}
+		poller := NewPoller(&fakeBeginner{tx: tx}, &recordingPublisher{}, time.Second, 10, time.Hour, slog.New(slog.DiscardHandler))
+
+		_, err := poller.Prune(context.Background())
+		require.NoError(t, err)
+		require.Len(t, tx.execs, 1)
+		assert.Contains(t, tx.execs[0], "DELETE FROM todo_events")
+		assert.Contains(t, tx.execs[0], "published_at < $1")
+		cutoff := tx.execArgs[0][0].(time.Time)
+		assert.WithinDuration(t, time.Now().Add(-time.Hour), cutoff, time.Minute)
+		assert.Equal(t, 10, tx.execArgs[0][1])
+		assert.True(t, tx.committed)
+	})
+
+	t.Run("keeps events without retention", func(t *testing.T) {
+		tx := &fakeTx{}
+		poller := NewPoller(&fakeBeginner{tx: tx}, &recordingPublisher{}, time.Second, 10, 0, slog.New(slog.DiscardHandler))
+
+		deleted, err := poller.Prune(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+		assert.Empty(t, tx.execs)
+	})
+}
+
+func TestPollerRunStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	poller := NewPoller(&fakeBeginner{tx: &fakeTx{}}, &recordingPublisher{}, time.Millisecond, 10, 0, slog.New(slog.DiscardHandler))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		poller.Run(ctx)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("poller did not stop")
+	}
+}
+
+func TestLogPublisher(t *testing.T) {
+	var buf bytes.Buffer
+	publisher := NewLogPublisher(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	err := publisher.Publish(context.Background(), Event{ID: 3, Type: EventTodoUpdated, TodoID: 7, Payload: json.RawMessage(`{"id":7}`)})
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "type=todo.updated")
+	assert.Contains(t, buf.String(), "todo_id=7")
+}
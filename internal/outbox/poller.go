@@ -0,0 +1,198 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Defaults applied by NewPoller to non-positive settings
+const (
+	defaultPollInterval = 5 * time.Second
+	defaultBatchSize    = 100
+)
+
+// Beginner starts transactions; *pgxpool.Pool implements it
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Poller periodically publishes the unpublished events of the outbox and
+// marks them published, then deletes the events published longer than
+// retention ago
+type Poller struct {
+	db        Beginner
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+	retention time.Duration
+	logger    *slog.Logger
+
+	// cancel and done control the Run started by Start
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPoller creates a Poller publishing up to batchSize events through
+// publisher every interval. Published events are kept retention long, or
+// forever when retention is not positive.
+func NewPoller(db Beginner, publisher Publisher, interval time.Duration, batchSize int, retention time.Duration, logger *slog.Logger) *Poller {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	return &Poller{db: db, publisher: publisher, interval: interval, batchSize: batchSize, retention: retention, logger: logger}
+}
+
+// Start runs the poller in the background until Stop is called
+func (p *Poller) Start(ctx context.Context) error {
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		p.Run(runCtx)
+	}()
+	return nil
+}
+
+// Stop stops the poller started by Start and waits until it returns or ctx
+// ends. A batch being published is rolled back and published again later.
+func (p *Poller) Stop(ctx context.Context) error {
+	if p.cancel == nil {
+		return nil
+	}
+	p.cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run polls the outbox until ctx ends. Failures are logged and retried at
+// the next tick.
+func (p *Poller) Run(ctx context.Context) {
+	p.logger.Info("outbox poller started", "interval", p.interval, "batch_size", p.batchSize, "retention", p.retention)
+	defer p.logger.Info("outbox poller stopped")
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Drain the backlog a batch at a time before waiting again
+		for {
+			published, err := p.Poll(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					p.logger.Error("failed to publish outbox events", "error", err)
+				}
+				break
+			}
+			if published < p.batchSize {
+				break
+			}
+		}
+
+		if _, err := p.Prune(ctx); err != nil && ctx.Err() == nil {
+			p.logger.Error("failed to prune outbox events", "error", err)
+		}
+	}
+}
+
+// Poll publishes the oldest batch of unpublished events and returns how
+// many were published. The events are locked while publishing so several
+// pollers never publish the same event, and they are only marked
+// published if every one of them was.
+func (p *Poller) Poll(ctx context.Context) (int, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // no-op once committed
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, type, todo_id, payload, created_at
+		FROM todo_events
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, p.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read events: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Event, error) {
+		var event Event
+		err := row.Scan(&event.ID, &event.Type, &event.TodoID, &event.Payload, &event.CreatedAt)
+		return event, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read events: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int64, len(events))
+	for i, event := range events {
+		if err := p.publisher.Publish(ctx, event); err != nil {
+			return 0, fmt.Errorf("failed to publish event %d: %w", event.ID, err)
+		}
+		ids[i] = event.ID
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE todo_events SET published_at = NOW() WHERE id = ANY($1)", ids); err != nil {
+		return 0, fmt.Errorf("failed to mark events published: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit published events: %w", err)
+	}
+
+	return len(events), nil
+}
+
+// Prune deletes up to a batch of the events published longer than the
+// retention ago and returns how many were deleted. Nothing is deleted when
+// the retention is not positive.
+func (p *Poller) Prune(ctx context.Context) (int64, error) {
+	if p.retention <= 0 {
+		return 0, nil
+	}
+
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // no-op once committed
+
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM todo_events
+		WHERE id IN (
+			SELECT id FROM todo_events
+			WHERE published_at < $1
+			ORDER BY id
+			LIMIT $2
+		)
+	`, time.Now().Add(-p.retention), p.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete published events: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit deleted events: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,36 @@
+// Package owner carries the ID of the user whose todos a request acts on.
+// The HTTP layer stores it in the request context and the repositories
+// scope every query to it.
+package owner
+
+import "context"
+
+// ctxKey is the context key of the owner ID
+type ctxKey struct{}
+
+// unscopedKey is the context key marking work on every owner's todos
+type unscopedKey struct{}
+
+// NewContext returns a copy of ctx carrying the owner ID id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the owner ID carried by ctx, if any
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok
+}
+
+// NewUnscopedContext returns a copy of ctx acting on the todos of every
+// owner, for administration and maintenance. Repositories match nothing
+// for a context carrying neither an owner nor this opt-out.
+func NewUnscopedContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+// Unscoped reports whether ctx was made by NewUnscopedContext
+func Unscoped(ctx context.Context) bool {
+	unscoped, _ := ctx.Value(unscopedKey{}).(bool)
+	return unscoped
+}
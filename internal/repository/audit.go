@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// Audited actions on todos
+const (
+	auditCreate      = "create"
+	auditUpdate      = "update"
+	auditArchive     = "archive"
+	auditUnarchive   = "unarchive"
+	auditDelete      = "delete"
+	auditReorder     = "reorder"
+	auditCompleteAll = "complete_all"
+)
+
+// auditEntity is the entity todo changes are recorded on
+const auditEntity = "todo"
+
+// Auditor records who changed which entity, from what to what. Repositories
+// call it in tx, the transaction making the change, so a change is never
+// committed without its record: failing to record fails the change. tx is
+// nil for repositories without transactions.
+type Auditor interface {
+	RecordTx(ctx context.Context, tx pgx.Tx, action, entity, entityID string, before, after any) error
+}
+
+// recordTodo records action on todo with auditor, when not nil, changing it
+// from before to after, either being nil when the todo did not exist
+func recordTodo(ctx context.Context, auditor Auditor, tx pgx.Tx, action string, id int, before, after *model.Todo) error {
+	if auditor == nil {
+		return nil
+	}
+	var beforeState, afterState any
+	if before != nil {
+		beforeState = before
+	}
+	if after != nil {
+		afterState = after
+	}
+	return auditor.RecordTx(ctx, tx, action, auditEntity, strconv.Itoa(id), beforeState, afterState)
+}
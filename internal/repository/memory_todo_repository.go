@@ -0,0 +1,723 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/g3offrey/idiomapi/internal/owner"
+)
+
+// InMemoryTodoRepository is a TodoRepository that keeps todos in memory.
+// It is meant for tests and local development without PostgreSQL; data is
+// lost when the process exits.
+type InMemoryTodoRepository struct {
+	mu     sync.RWMutex
+	todos  map[int]model.Todo
+	nextID atomic.Int64
+
+	// uniqueTitles is set by EnableUniqueTitles, and uniqueIDs holds the
+	// todos created since then, whose titles must be unique per owner
+	uniqueTitles bool
+	uniqueIDs    map[int]bool
+
+	// auditor, set by RecordAudit, records each change before it is made
+	auditor Auditor
+}
+
+// NewInMemoryTodoRepository creates a new, empty InMemoryTodoRepository
+func NewInMemoryTodoRepository() *InMemoryTodoRepository {
+	return &InMemoryTodoRepository{todos: make(map[int]model.Todo), uniqueIDs: make(map[int]bool)}
+}
+
+// EnableUniqueTitles makes the todos created from now on require a title
+// their owner does not use on another such todo. Creating or renaming a
+// todo to a taken title fails with ErrConflict.
+func (r *InMemoryTodoRepository) EnableUniqueTitles() {
+	r.mu.Lock()
+	r.uniqueTitles = true
+	r.mu.Unlock()
+}
+
+// RecordAudit makes the repository record every change it makes to todos
+// with auditor. A change is not made when recording it fails.
+func (r *InMemoryTodoRepository) RecordAudit(auditor Auditor) {
+	r.mu.Lock()
+	r.auditor = auditor
+	r.mu.Unlock()
+}
+
+// titleTaken reports whether a todo of ownerID other than id, created with
+// unique titles, has title. The caller must hold r.mu.
+func (r *InMemoryTodoRepository) titleTaken(ownerID, title string, id int) bool {
+	for otherID := range r.uniqueIDs {
+		other := r.todos[otherID]
+		if otherID != id && other.OwnerID == ownerID && other.Title == title {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLengths returns a TooLongError when title or description is longer
+// than the database allows
+func checkLengths(title, description string) error {
+	if utf8.RuneCountInString(title) > model.MaxTitleLength {
+		return &TooLongError{Field: "title", Max: model.MaxTitleLength}
+	}
+	if utf8.RuneCountInString(description) > model.MaxDescriptionLength {
+		return &TooLongError{Field: "description", Max: model.MaxDescriptionLength}
+	}
+	return nil
+}
+
+// nextPosition returns the position placing a new todo of ownerID after
+// all the others. The caller must hold r.mu.
+func (r *InMemoryTodoRepository) nextPosition(ownerID string) int {
+	last := 0
+	for _, todo := range r.todos {
+		if todo.OwnerID == ownerID {
+			last = max(last, todo.Position)
+		}
+	}
+	return last + 1
+}
+
+// Create creates a new todo at the end of the manual order
+func (r *InMemoryTodoRepository) Create(ctx context.Context, req dto.CreateTodoRequest) (*model.Todo, error) {
+	if err := checkLengths(req.Title, req.Description); err != nil {
+		return nil, err
+	}
+
+	ownerID, err := creator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	todo := model.Todo{
+		ID:          int(r.nextID.Add(1)),
+		Title:       req.Title,
+		Description: req.Description,
+		Completed:   req.Completed,
+		Priority:    req.Priority,
+		OwnerID:     ownerID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if todo.Completed {
+		todo.CompletedAt = &now
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.uniqueTitles && r.titleTaken(ownerID, todo.Title, todo.ID) {
+		return nil, ErrConflict
+	}
+	todo.Position = r.nextPosition(ownerID)
+	if err := recordTodo(ctx, r.auditor, nil, auditCreate, todo.ID, nil, &todo); err != nil {
+		return nil, err
+	}
+	if r.uniqueTitles {
+		r.uniqueIDs[todo.ID] = true
+	}
+	r.todos[todo.ID] = todo
+
+	return &todo, nil
+}
+
+// GetByID retrieves a todo by its ID
+func (r *InMemoryTodoRepository) GetByID(ctx context.Context, id int) (*model.Todo, error) {
+	r.mu.RLock()
+	todo, ok := r.todos[id]
+	r.mu.RUnlock()
+
+	if !ok || !visible(ctx, todo) {
+		return nil, ErrNotFound
+	}
+	return &todo, nil
+}
+
+// GetByIDs retrieves the todos with the given IDs in the order of ids.
+// Missing IDs are skipped and repeated ones are returned once.
+func (r *InMemoryTodoRepository) GetByIDs(ctx context.Context, ids []int) ([]model.Todo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	todos := make([]model.Todo, 0, len(ids))
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		todo, ok := r.todos[id]
+		if !ok || seen[id] || !visible(ctx, todo) {
+			continue
+		}
+		seen[id] = true
+		todos = append(todos, todo)
+	}
+	return todos, nil
+}
+
+// Exists reports whether a todo with the given ID exists
+func (r *InMemoryTodoRepository) Exists(ctx context.Context, id int) (bool, error) {
+	r.mu.RLock()
+	todo, ok := r.todos[id]
+	r.mu.RUnlock()
+
+	return ok && visible(ctx, todo), nil
+}
+
+// List retrieves a paginated list of todos matching filter, newest first. page and pageSize
+// must be at least 1; the service normalizes them.
+func (r *InMemoryTodoRepository) List(ctx context.Context, page, pageSize int, filter ListFilter) ([]model.Todo, int, error) {
+	matched := r.matching(ctx, filter)
+
+	total := len(matched)
+	if pastLastPage(page, pageSize, total) {
+		return []model.Todo{}, total, nil
+	}
+
+	offset := (page - 1) * pageSize
+	end := min(offset+pageSize, total)
+	todos := matched[offset:end]
+	if filter.Compact {
+		for i, todo := range todos {
+			todos[i] = model.Todo{ID: todo.ID, Title: todo.Title, Completed: todo.Completed, UpdatedAt: todo.UpdatedAt}
+		}
+	}
+	return todos, total, nil
+}
+
+// Count returns the number of todos matching filter
+func (r *InMemoryTodoRepository) Count(ctx context.Context, filter ListFilter) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	total := 0
+	for _, todo := range r.todos {
+		if visible(ctx, todo) && filter.matches(todo) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+// Each calls fn with every todo matching filter, in List order, stopping
+// at the first error fn returns
+func (r *InMemoryTodoRepository) Each(ctx context.Context, filter ListFilter, fn func(model.Todo) error) error {
+	for _, todo := range r.matching(ctx, filter) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matching returns the todos of the owner in ctx matching filter, sorted
+// as List returns them
+func (r *InMemoryTodoRepository) matching(ctx context.Context, filter ListFilter) []model.Todo {
+	r.mu.RLock()
+	var matched []model.Todo
+	for _, todo := range r.todos {
+		if !visible(ctx, todo) || !filter.matches(todo) {
+			continue
+		}
+		matched = append(matched, todo)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if filter.SortByPosition {
+			return positionOrder(matched[i], matched[j])
+		}
+		if filter.SortByPriority && matched[i].Priority != matched[j].Priority {
+			return matched[i].Priority.Rank() > matched[j].Priority.Rank()
+		}
+		if !matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].CreatedAt.After(matched[j].CreatedAt)
+		}
+		return matched[i].ID > matched[j].ID
+	})
+	return matched
+}
+
+// positionOrder reports whether a comes before b in the manual order
+func positionOrder(a, b model.Todo) bool {
+	if a.Position != b.Position {
+		return a.Position < b.Position
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+// visible reports whether todo belongs to the owner carried by ctx. Every
+// todo is visible with owner.NewUnscopedContext, and none with neither.
+func visible(ctx context.Context, todo model.Todo) bool {
+	if ownerID, ok := owner.FromContext(ctx); ok {
+		return todo.OwnerID == ownerID
+	}
+	return owner.Unscoped(ctx)
+}
+
+// matches reports whether todo passes every condition of f
+func (f ListFilter) matches(todo model.Todo) bool {
+	if f.IDs != nil && !slices.Contains(f.IDs, todo.ID) {
+		return false
+	}
+	if f.Completed != nil && todo.Completed != *f.Completed {
+		return false
+	}
+	if f.Priority != "" && todo.Priority != f.Priority {
+		return false
+	}
+	if f.CreatedAfter != nil && todo.CreatedAt.Before(*f.CreatedAfter) {
+		return false
+	}
+	if f.CreatedBefore != nil && todo.CreatedAt.After(*f.CreatedBefore) {
+		return false
+	}
+	if !f.IncludeArchived && todo.ArchivedAt != nil {
+		return false
+	}
+	return true
+}
+
+// AverageRowSize returns the average size in bytes of a todo's text fields
+func (r *InMemoryTodoRepository) AverageRowSize(ctx context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var size, count int64
+	for _, todo := range r.todos {
+		if !visible(ctx, todo) {
+			continue
+		}
+		size += int64(len(todo.Title) + len(todo.Description))
+		count++
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+	return size / count, nil
+}
+
+// Version returns the number of todos and the latest time any of them was
+// updated, the zero time when there are none
+func (r *InMemoryTodoRepository) Version(ctx context.Context) (int, time.Time, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int
+	var lastUpdated time.Time
+	for _, todo := range r.todos {
+		if !visible(ctx, todo) {
+			continue
+		}
+		count++
+		if todo.UpdatedAt.After(lastUpdated) {
+			lastUpdated = todo.UpdatedAt
+		}
+	}
+	return count, lastUpdated, nil
+}
+
+// CountByWeekday returns how many todos were created on each day of the
+// week in loc, indexed by time.Weekday
+func (r *InMemoryTodoRepository) CountByWeekday(ctx context.Context, loc *time.Location) ([7]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var counts [7]int
+	for _, todo := range r.todos {
+		if visible(ctx, todo) {
+			counts[todo.CreatedAt.In(loc).Weekday()]++
+		}
+	}
+	return counts, nil
+}
+
+// AverageCompletionTime returns the average time completed todos took from
+// creation to completion, along with how many were counted. from and to,
+// when set, bound the completion time. The average is zero when no todo
+// was counted.
+func (r *InMemoryTodoRepository) AverageCompletionTime(ctx context.Context, from, to *time.Time) (time.Duration, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var total time.Duration
+	var count int
+	for _, todo := range r.todos {
+		if !todo.Completed || todo.CompletedAt == nil || !visible(ctx, todo) {
+			continue
+		}
+		if (from != nil && todo.CompletedAt.Before(*from)) || (to != nil && todo.CompletedAt.After(*to)) {
+			continue
+		}
+		total += todo.CompletedAt.Sub(todo.CreatedAt)
+		count++
+	}
+
+	if count == 0 {
+		return 0, 0, nil
+	}
+	return total / time.Duration(count), count, nil
+}
+
+// Update applies the fields of req that differ from the todo and returns
+// it along with the JSON names of the changed fields
+func (r *InMemoryTodoRepository) Update(ctx context.Context, id int, req dto.UpdateTodoRequest) (*model.Todo, []string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todo, ok := r.todos[id]
+	if !ok || !visible(ctx, todo) {
+		return nil, nil, ErrNotFound
+	}
+	if err := checkPrecondition(ctx, &todo); err != nil {
+		return nil, nil, err
+	}
+	before := todo
+
+	changed := changedFields(&todo, req)
+	if len(changed) == 0 {
+		return &todo, changed, nil
+	}
+
+	title, description := todo.Title, todo.Description
+	if req.Title != nil {
+		title = *req.Title
+	}
+	if req.Description != nil {
+		description = *req.Description
+	}
+	if err := checkLengths(title, description); err != nil {
+		return nil, nil, err
+	}
+
+	if req.Title != nil {
+		if r.uniqueIDs[id] && r.titleTaken(todo.OwnerID, *req.Title, id) {
+			return nil, nil, ErrConflict
+		}
+		todo.Title = *req.Title
+	}
+	if req.Description != nil {
+		todo.Description = *req.Description
+	}
+	if req.Priority != nil {
+		todo.Priority = *req.Priority
+	}
+	now := time.Now()
+	todo.UpdatedAt = now
+	if req.Completed != nil {
+		todo.Completed = *req.Completed
+		switch {
+		case !todo.Completed:
+			todo.CompletedAt = nil
+		case todo.CompletedAt == nil:
+			todo.CompletedAt = &now
+		}
+	}
+
+	if err := recordTodo(ctx, r.auditor, nil, auditUpdate, id, &before, &todo); err != nil {
+		return nil, nil, err
+	}
+	r.todos[id] = todo
+	return &todo, changed, nil
+}
+
+// Upsert creates the todo of the owner with externalID from req, or
+// replaces its fields with those of req when it exists. It reports whether
+// the todo was created. Created todos go at the end of the manual order.
+func (r *InMemoryTodoRepository) Upsert(ctx context.Context, externalID string, req dto.CreateTodoRequest) (*model.Todo, bool, error) {
+	if err := checkLengths(req.Title, req.Description); err != nil {
+		return nil, false, err
+	}
+
+	ownerID, err := creator(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todo, found := model.Todo{}, false
+	for _, existing := range r.todos {
+		if existing.OwnerID == ownerID && existing.ExternalID != nil && *existing.ExternalID == externalID {
+			todo, found = existing, true
+			break
+		}
+	}
+	if !found {
+		todo = model.Todo{
+			ID:         int(r.nextID.Add(1)),
+			OwnerID:    ownerID,
+			CreatedAt:  now,
+			ExternalID: &externalID,
+			Position:   r.nextPosition(ownerID),
+		}
+		if r.uniqueTitles {
+			r.uniqueIDs[todo.ID] = true
+		}
+	}
+
+	if r.uniqueIDs[todo.ID] && r.titleTaken(ownerID, req.Title, todo.ID) {
+		if !found {
+			delete(r.uniqueIDs, todo.ID)
+		}
+		return nil, false, ErrConflict
+	}
+	var before *model.Todo
+	if found {
+		existing := todo
+		before = &existing
+	}
+
+	todo.Title = req.Title
+	todo.Description = req.Description
+	todo.Priority = req.Priority
+	todo.UpdatedAt = now
+	switch {
+	case !req.Completed:
+		todo.CompletedAt = nil
+	case !todo.Completed || todo.CompletedAt == nil:
+		todo.CompletedAt = &now
+	}
+	todo.Completed = req.Completed
+
+	action := auditUpdate
+	if !found {
+		action = auditCreate
+	}
+	if err := recordTodo(ctx, r.auditor, nil, action, todo.ID, before, &todo); err != nil {
+		if !found {
+			delete(r.uniqueIDs, todo.ID)
+		}
+		return nil, false, err
+	}
+	r.todos[todo.ID] = todo
+	return &todo, !found, nil
+}
+
+// Archive archives a todo and returns it, reporting whether it was not
+// archived yet
+func (r *InMemoryTodoRepository) Archive(ctx context.Context, id int) (*model.Todo, bool, error) {
+	return r.setArchived(ctx, id, true)
+}
+
+// Unarchive brings an archived todo back into lists and returns it,
+// reporting whether it was archived
+func (r *InMemoryTodoRepository) Unarchive(ctx context.Context, id int) (*model.Todo, bool, error) {
+	return r.setArchived(ctx, id, false)
+}
+
+// setArchived archives or unarchives the todo id unless it already is
+func (r *InMemoryTodoRepository) setArchived(ctx context.Context, id int, archived bool) (*model.Todo, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todo, ok := r.todos[id]
+	if !ok || !visible(ctx, todo) {
+		return nil, false, ErrNotFound
+	}
+	if (todo.ArchivedAt != nil) == archived {
+		return &todo, false, nil
+	}
+
+	before := todo
+	now := time.Now()
+	todo.ArchivedAt = nil
+	if archived {
+		todo.ArchivedAt = &now
+	}
+	todo.UpdatedAt = now
+
+	action := auditUnarchive
+	if archived {
+		action = auditArchive
+	}
+	if err := recordTodo(ctx, r.auditor, nil, action, id, &before, &todo); err != nil {
+		return nil, false, err
+	}
+	r.todos[id] = todo
+	return &todo, true, nil
+}
+
+// Reorder moves the todos ids, which must be distinct, to the top of the
+// manual order, in order, followed by the other todos in their current
+// order. Nothing changes and ErrNotFound is returned when one of ids is
+// not found.
+func (r *InMemoryTodoRepository) Reorder(ctx context.Context, ids []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rank := make(map[int]int, len(ids))
+	for i, id := range ids {
+		todo, ok := r.todos[id]
+		if !ok || !visible(ctx, todo) {
+			return ErrNotFound
+		}
+		rank[id] = i
+	}
+
+	var todos []model.Todo
+	for _, todo := range r.todos {
+		if visible(ctx, todo) {
+			todos = append(todos, todo)
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		rankI, listedI := rank[todos[i].ID]
+		rankJ, listedJ := rank[todos[j].ID]
+		switch {
+		case listedI && listedJ:
+			return rankI < rankJ
+		case listedI != listedJ:
+			return listedI
+		}
+		return positionOrder(todos[i], todos[j])
+	})
+
+	now := time.Now()
+	var before, after []model.Todo
+	for i, todo := range todos {
+		if todo.Position == i+1 {
+			continue
+		}
+		before = append(before, todo)
+		todo.Position = i + 1
+		todo.UpdatedAt = now
+		after = append(after, todo)
+	}
+	for i := range before {
+		if err := recordTodo(ctx, r.auditor, nil, auditReorder, before[i].ID, &before[i], &after[i]); err != nil {
+			return err
+		}
+	}
+
+	for _, todo := range after {
+		r.todos[todo.ID] = todo
+	}
+	return nil
+}
+
+// Delete deletes a todo by ID
+func (r *InMemoryTodoRepository) Delete(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todo, ok := r.todos[id]
+	if !ok || !visible(ctx, todo) {
+		return ErrNotFound
+	}
+	if err := checkPrecondition(ctx, &todo); err != nil {
+		return err
+	}
+	if err := recordTodo(ctx, r.auditor, nil, auditDelete, id, &todo, nil); err != nil {
+		return err
+	}
+	delete(r.todos, id)
+	delete(r.uniqueIDs, id)
+	return nil
+}
+
+// DeleteMany deletes the todos with the given IDs and returns how many were
+// deleted
+func (r *InMemoryTodoRepository) DeleteMany(ctx context.Context, ids []int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	filter := DeleteManyFilter(ids)
+	var matched []model.Todo
+	for _, todo := range r.todos {
+		if visible(ctx, todo) && filter.matches(todo) {
+			matched = append(matched, todo)
+		}
+	}
+	for i := range matched {
+		if err := recordTodo(ctx, r.auditor, nil, auditDelete, matched[i].ID, &matched[i], nil); err != nil {
+			return 0, err
+		}
+	}
+	for _, todo := range matched {
+		delete(r.todos, todo.ID)
+		delete(r.uniqueIDs, todo.ID)
+	}
+	return int64(len(matched)), nil
+}
+
+// DeleteWhere deletes the todos matching the completion filter, or every
+// todo when completed is nil, and returns how many were deleted. At most
+// limit todos are deleted when limit is positive.
+func (r *InMemoryTodoRepository) DeleteWhere(ctx context.Context, completed *bool, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	filter := DeleteWhereFilter(completed)
+	var matched []model.Todo
+	for _, todo := range r.todos {
+		if limit > 0 && len(matched) == limit {
+			break
+		}
+		if visible(ctx, todo) && filter.matches(todo) {
+			matched = append(matched, todo)
+		}
+	}
+	for i := range matched {
+		if err := recordTodo(ctx, r.auditor, nil, auditDelete, matched[i].ID, &matched[i], nil); err != nil {
+			return 0, err
+		}
+	}
+	for _, todo := range matched {
+		delete(r.todos, todo.ID)
+		delete(r.uniqueIDs, todo.ID)
+	}
+	return int64(len(matched)), nil
+}
+
+// MarkAllCompleted completes every todo that is not completed yet and
+// returns how many were updated
+func (r *InMemoryTodoRepository) MarkAllCompleted(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	filter := MarkAllCompletedFilter()
+	now := time.Now()
+	var before, after []model.Todo
+	for _, todo := range r.todos {
+		if visible(ctx, todo) && filter.matches(todo) {
+			before = append(before, todo)
+			todo.Completed = true
+			todo.CompletedAt = &now
+			todo.UpdatedAt = now
+			after = append(after, todo)
+		}
+	}
+	for i := range before {
+		if err := recordTodo(ctx, r.auditor, nil, auditCompleteAll, before[i].ID, &before[i], &after[i]); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, todo := range after {
+		r.todos[todo.ID] = todo
+	}
+	return int64(len(after)), nil
+}
+
+// Health always succeeds; there is no connection to check
+func (r *InMemoryTodoRepository) Health(_ context.Context) error {
+	return nil
+}
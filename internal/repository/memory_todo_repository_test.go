@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryCountByWeekday(t *testing.T) {
+	repo := NewInMemoryTodoRepository()
+	ctx := owner.NewUnscopedContext(context.Background())
+	for i, createdAt := range []time.Time{
+		time.Date(2025, time.June, 2, 2, 0, 0, 0, time.UTC),  // Monday, Sunday evening in New York
+		time.Date(2025, time.June, 2, 15, 0, 0, 0, time.UTC), // Monday
+		time.Date(2025, time.June, 4, 12, 0, 0, 0, time.UTC), // Wednesday
+		time.Date(2025, time.June, 7, 12, 0, 0, 0, time.UTC), // Saturday
+	} {
+		repo.todos[i+1] = model.Todo{ID: i + 1, Title: "todo", CreatedAt: createdAt, UpdatedAt: createdAt}
+	}
+
+	counts, err := repo.CountByWeekday(ctx, time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, [7]int{time.Monday: 2, time.Wednesday: 1, time.Saturday: 1}, counts)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	counts, err = repo.CountByWeekday(ctx, newYork)
+	require.NoError(t, err)
+	assert.Equal(t, [7]int{time.Sunday: 1, time.Monday: 1, time.Wednesday: 1, time.Saturday: 1}, counts)
+}
+
+func TestInMemoryAverageCompletionTime(t *testing.T) {
+	repo := NewInMemoryTodoRepository()
+	ctx := owner.NewUnscopedContext(context.Background())
+
+	average, count, err := repo.AverageCompletionTime(ctx, nil, nil)
+	require.NoError(t, err)
+	assert.Zero(t, average)
+	assert.Zero(t, count)
+
+	createdAt := time.Date(2025, time.June, 2, 12, 0, 0, 0, time.UTC)
+	for i, took := range []time.Duration{time.Hour, 3 * time.Hour, 8 * time.Hour} {
+		completedAt := createdAt.Add(took)
+		repo.todos[i+1] = model.Todo{ID: i + 1, Title: "todo", Completed: true, CreatedAt: createdAt, UpdatedAt: completedAt, CompletedAt: &completedAt}
+	}
+	repo.todos[4] = model.Todo{ID: 4, Title: "open", CreatedAt: createdAt, UpdatedAt: createdAt}
+
+	average, count, err = repo.AverageCompletionTime(ctx, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 4*time.Hour, average)
+	assert.Equal(t, 3, count)
+
+	from, to := createdAt.Add(2*time.Hour), createdAt.Add(4*time.Hour)
+	average, count, err = repo.AverageCompletionTime(ctx, &from, &to)
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Hour, average)
+	assert.Equal(t, 1, count)
+}
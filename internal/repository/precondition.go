@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/g3offrey/idiomapi/internal/model"
+)
+
+// ErrVersionConflict is returned when the todo to change fails the
+// precondition carried by the context
+var ErrVersionConflict = errors.New("todo version conflict")
+
+// preconditionKey is the context key of the precondition
+type preconditionKey struct{}
+
+// WithPrecondition returns a copy of ctx making Update and Delete change a
+// todo only when match accepts it, checked on the todo as locked for the
+// change, and return ErrVersionConflict otherwise
+func WithPrecondition(ctx context.Context, match func(*model.Todo) bool) context.Context {
+	return context.WithValue(ctx, preconditionKey{}, match)
+}
+
+// hasPrecondition reports whether ctx carries a precondition
+func hasPrecondition(ctx context.Context) bool {
+	_, ok := ctx.Value(preconditionKey{}).(func(*model.Todo) bool)
+	return ok
+}
+
+// checkPrecondition returns ErrVersionConflict when todo fails the
+// precondition carried by ctx, if any
+func checkPrecondition(ctx context.Context, todo *model.Todo) error {
+	match, ok := ctx.Value(preconditionKey{}).(func(*model.Todo) bool)
+	if ok && !match(todo) {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/puddle/v2"
+)
+
+// RetryPolicy controls how operations failing with transient database
+// errors are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, including the first one.
+	// Values below 1 mean a single try.
+	MaxAttempts int
+
+	// Backoff is the wait before the second try; it doubles after every
+	// further failure
+	Backoff time.Duration
+}
+
+// withRetry runs fn until it succeeds, fails with an error that is not
+// transient, the attempts are exhausted, or ctx ends. Errors caused by a
+// closed pool are marked with ErrUnavailable.
+func (p RetryPolicy) withRetry(ctx context.Context, fn func() error) error {
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if errors.Is(err, puddle.ErrClosedPool) {
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		if err == nil || attempt >= p.MaxAttempts || !isRetryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryable reports whether err is a transient database error: a
+// serialization failure, a deadlock, a connection exception (class 08) or a
+// failure that happened before anything was sent to the server
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01" || strings.HasPrefix(pgErr.Code, "08")
+	}
+
+	return pgconn.SafeToRetry(err)
+}
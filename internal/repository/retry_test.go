@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyOperation fails with err for the first failures calls
+type flakyOperation struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyOperation) run() error {
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func TestWithRetry(t *testing.T) {
+	serialization := fmt.Errorf("failed to update todo: %w", &pgconn.PgError{Code: "40001"})
+	connection := &pgconn.PgError{Code: "08006"}
+	uniqueViolation := &pgconn.PgError{Code: "23505"}
+
+	tests := []struct {
+		name          string
+		failures      int
+		err           error
+		expectedCalls int
+		expectedErr   error
+	}{
+		{name: "succeeds first time", failures: 0, err: serialization, expectedCalls: 1},
+		{name: "retries serialization failures", failures: 2, err: serialization, expectedCalls: 3},
+		{name: "retries connection errors", failures: 1, err: connection, expectedCalls: 2},
+		{name: "gives up after max attempts", failures: 5, err: serialization, expectedCalls: 3, expectedErr: serialization},
+		{name: "constraint violations pass through", failures: 1, err: uniqueViolation, expectedCalls: 1, expectedErr: uniqueViolation},
+		{name: "not found passes through", failures: 1, err: ErrNotFound, expectedCalls: 1, expectedErr: ErrNotFound},
+	}
+
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &flakyOperation{failures: tt.failures, err: tt.err}
+
+			err := policy.withRetry(context.Background(), op.run)
+
+			assert.Equal(t, tt.expectedCalls, op.calls)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestWithRetry_StopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	op := &flakyOperation{failures: 5, err: &pgconn.PgError{Code: "40001"}}
+	err := RetryPolicy{MaxAttempts: 5, Backoff: time.Hour}.withRetry(ctx, op.run)
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, op.calls)
+}
+
+func TestWithRetry_ZeroAttemptsTriesOnce(t *testing.T) {
+	op := &flakyOperation{failures: 1, err: &pgconn.PgError{Code: "40001"}}
+	err := RetryPolicy{}.withRetry(context.Background(), op.run)
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, op.calls)
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/model"
+)
+
+// SlowQueryRepository is a TodoRepository that logs a warning whenever a
+// call to the repository it wraps takes longer than a threshold. The call
+// itself is never failed.
+type SlowQueryRepository struct {
+	next      TodoRepository
+	threshold time.Duration
+	logger    *slog.Logger
+}
+
+// NewSlowQueryRepository wraps next, warning through logger about calls
+// slower than threshold
+func NewSlowQueryRepository(next TodoRepository, threshold time.Duration, logger *slog.Logger) *SlowQueryRepository {
+	return &SlowQueryRepository{next: next, threshold: threshold, logger: logger}
+}
+
+// observe logs a warning when operation, started at start, exceeded the
+// threshold. Call it deferred.
+func (r *SlowQueryRepository) observe(ctx context.Context, operation string, start time.Time) {
+	if elapsed := time.Since(start); elapsed > r.threshold {
+		r.logger.WarnContext(ctx, "slow repository call",
+			"operation", operation,
+			"duration", elapsed,
+			"threshold", r.threshold)
+	}
+}
+
+// Create creates a new todo
+func (r *SlowQueryRepository) Create(ctx context.Context, req dto.CreateTodoRequest) (*model.Todo, error) {
+	defer r.observe(ctx, "Create", time.Now())
+	return r.next.Create(ctx, req)
+}
+
+// Upsert creates or replaces the todo with externalID
+func (r *SlowQueryRepository) Upsert(ctx context.Context, externalID string, req dto.CreateTodoRequest) (*model.Todo, bool, error) {
+	defer r.observe(ctx, "Upsert", time.Now())
+	return r.next.Upsert(ctx, externalID, req)
+}
+
+// GetByID retrieves a todo by its ID
+func (r *SlowQueryRepository) GetByID(ctx context.Context, id int) (*model.Todo, error) {
+	defer r.observe(ctx, "GetByID", time.Now())
+	return r.next.GetByID(ctx, id)
+}
+
+// GetByIDs retrieves the todos with the given IDs in the order of ids
+func (r *SlowQueryRepository) GetByIDs(ctx context.Context, ids []int) ([]model.Todo, error) {
+	defer r.observe(ctx, "GetByIDs", time.Now())
+	return r.next.GetByIDs(ctx, ids)
+}
+
+// Exists reports whether a todo with the given ID exists
+func (r *SlowQueryRepository) Exists(ctx context.Context, id int) (bool, error) {
+	defer r.observe(ctx, "Exists", time.Now())
+	return r.next.Exists(ctx, id)
+}
+
+// List retrieves a paginated list of todos matching filter
+func (r *SlowQueryRepository) List(ctx context.Context, page, pageSize int, filter ListFilter) ([]model.Todo, int, error) {
+	defer r.observe(ctx, "List", time.Now())
+	return r.next.List(ctx, page, pageSize, filter)
+}
+
+// Count returns the number of todos matching filter
+func (r *SlowQueryRepository) Count(ctx context.Context, filter ListFilter) (int, error) {
+	defer r.observe(ctx, "Count", time.Now())
+	return r.next.Count(ctx, filter)
+}
+
+// Each calls fn with every todo matching filter. The time spent in fn
+// counts towards the threshold.
+func (r *SlowQueryRepository) Each(ctx context.Context, filter ListFilter, fn func(model.Todo) error) error {
+	defer r.observe(ctx, "Each", time.Now())
+	return r.next.Each(ctx, filter, fn)
+}
+
+// AverageRowSize returns the average size in bytes of a todo's text fields
+func (r *SlowQueryRepository) AverageRowSize(ctx context.Context) (int64, error) {
+	defer r.observe(ctx, "AverageRowSize", time.Now())
+	return r.next.AverageRowSize(ctx)
+}
+
+// Version returns the number of todos and the latest time any of them was
+// updated
+func (r *SlowQueryRepository) Version(ctx context.Context) (int, time.Time, error) {
+	defer r.observe(ctx, "Version", time.Now())
+	return r.next.Version(ctx)
+}
+
+// CountByWeekday returns how many todos were created on each day of the
+// week in loc
+func (r *SlowQueryRepository) CountByWeekday(ctx context.Context, loc *time.Location) ([7]int, error) {
+	defer r.observe(ctx, "CountByWeekday", time.Now())
+	return r.next.CountByWeekday(ctx, loc)
+}
+
+// AverageCompletionTime returns the average time completed todos took from
+// creation to completion, along with how many were counted
+func (r *SlowQueryRepository) AverageCompletionTime(ctx context.Context, from, to *time.Time) (time.Duration, int, error) {
+	defer r.observe(ctx, "AverageCompletionTime", time.Now())
+	return r.next.AverageCompletionTime(ctx, from, to)
+}
+
+// Update updates a todo
+func (r *SlowQueryRepository) Update(ctx context.Context, id int, req dto.UpdateTodoRequest) (*model.Todo, []string, error) {
+	defer r.observe(ctx, "Update", time.Now())
+	return r.next.Update(ctx, id, req)
+}
+
+// Archive archives a todo, reporting whether it was not archived yet
+func (r *SlowQueryRepository) Archive(ctx context.Context, id int) (*model.Todo, bool, error) {
+	defer r.observe(ctx, "Archive", time.Now())
+	return r.next.Archive(ctx, id)
+}
+
+// Unarchive unarchives a todo, reporting whether it was archived
+func (r *SlowQueryRepository) Unarchive(ctx context.Context, id int) (*model.Todo, bool, error) {
+	defer r.observe(ctx, "Unarchive", time.Now())
+	return r.next.Unarchive(ctx, id)
+}
+
+// Reorder moves the todos ids to the top of the manual order
+func (r *SlowQueryRepository) Reorder(ctx context.Context, ids []int) error {
+	defer r.observe(ctx, "Reorder", time.Now())
+	return r.next.Reorder(ctx, ids)
+}
+
+// Delete deletes a todo by ID
+func (r *SlowQueryRepository) Delete(ctx context.Context, id int) error {
+	defer r.observe(ctx, "Delete", time.Now())
+	return r.next.Delete(ctx, id)
+}
+
+// DeleteMany deletes the todos with the given IDs and returns how many were
+// deleted
+func (r *SlowQueryRepository) DeleteMany(ctx context.Context, ids []int) (int64, error) {
+	defer r.observe(ctx, "DeleteMany", time.Now())
+	return r.next.DeleteMany(ctx, ids)
+}
+
+// DeleteWhere deletes the todos matching the completion filter and returns
+// how many were deleted
+func (r *SlowQueryRepository) DeleteWhere(ctx context.Context, completed *bool, limit int) (int64, error) {
+	defer r.observe(ctx, "DeleteWhere", time.Now())
+	return r.next.DeleteWhere(ctx, completed, limit)
+}
+
+// MarkAllCompleted completes every todo that is not completed yet and
+// returns how many were updated
+func (r *SlowQueryRepository) MarkAllCompleted(ctx context.Context) (int64, error) {
+	defer r.observe(ctx, "MarkAllCompleted", time.Now())
+	return r.next.MarkAllCompleted(ctx)
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// delayedRepository is a TodoRepository whose GetByID takes delay
+type delayedRepository struct {
+	TodoRepository
+	delay time.Duration
+}
+
+func (r *delayedRepository) GetByID(_ context.Context, id int) (*model.Todo, error) {
+	time.Sleep(r.delay)
+	return &model.Todo{ID: id}, nil
+}
+
+func TestSlowQueryRepository(t *testing.T) {
+	tests := []struct {
+		name        string
+		delay       time.Duration
+		expectedLog bool
+	}{
+		{name: "slower than the threshold", delay: 30 * time.Millisecond, expectedLog: true},
+		{name: "faster than the threshold", delay: 0, expectedLog: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, nil))
+			repo := NewSlowQueryRepository(&delayedRepository{delay: tt.delay}, 20*time.Millisecond, logger)
+
+			todo, err := repo.GetByID(context.Background(), 7)
+			require.NoError(t, err)
+			assert.Equal(t, 7, todo.ID)
+
+			if tt.expectedLog {
+				assert.Contains(t, buf.String(), "level=WARN")
+				assert.Contains(t, buf.String(), "operation=GetByID")
+				assert.Contains(t, buf.String(), "threshold=20ms")
+			} else {
+				assert.Empty(t, buf.String())
+			}
+		})
+	}
+}
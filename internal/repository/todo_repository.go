@@ -4,69 +4,399 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/g3offrey/idiomapi/internal/dto"
 	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/g3offrey/idiomapi/internal/outbox"
+	"github.com/g3offrey/idiomapi/internal/owner"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	// ErrNotFound is returned when a todo is not found
 	ErrNotFound = errors.New("todo not found")
+
+	// ErrUnavailable is returned when the database cannot serve queries,
+	// such as after its connection pool has been closed
+	ErrUnavailable = errors.New("database unavailable")
+
+	// ErrConflict is returned when a todo would take a title its owner
+	// already uses while unique titles are enabled
+	ErrConflict = errors.New("todo title already exists")
+
+	// ErrNoOwner is returned when creating todos with a context carrying
+	// no owner to create them for
+	ErrNoOwner = errors.New("no owner to create todos for")
 )
 
-// TodoRepository handles todo data operations
-type TodoRepository struct {
-	pool *pgxpool.Pool
+// uniqueTitleIndex is the partial unique index on the titles of todos
+// created with unique titles enabled
+const uniqueTitleIndex = "idx_todos_unique_title"
+
+// descriptionLengthCheck is the check constraint limiting descriptions to
+// model.MaxDescriptionLength characters
+const descriptionLengthCheck = "todos_description_length"
+
+// TooLongError is returned when a text field of a todo is longer than the
+// database allows
+type TooLongError struct {
+	// Field is the JSON name of the field
+	Field string
+	Max   int
 }
 
-// NewTodoRepository creates a new TodoRepository
-func NewTodoRepository(pool *pgxpool.Pool) *TodoRepository {
-	return &TodoRepository{pool: pool}
+// Error describes the field and its limit
+func (e *TooLongError) Error() string {
+	return fmt.Sprintf("todo %s longer than %d characters", e.Field, e.Max)
 }
 
-// Create creates a new todo
-func (r *TodoRepository) Create(ctx context.Context, req dto.CreateTodoRequest) (*model.Todo, error) {
-	query := `
-		INSERT INTO todos (title, description, completed)
-		VALUES ($1, $2, $3)
-		RETURNING id, title, description, completed, created_at, updated_at
-	`
+// tracer starts spans for database queries
+var tracer = otel.Tracer("github.com/g3offrey/idiomapi/internal/repository")
 
-	var todo model.Todo
-	err := r.pool.QueryRow(ctx, query, req.Title, req.Description, req.Completed).Scan(
+// ListFilter narrows, orders and trims the todos returned by List. Zero
+// fields do not filter.
+type ListFilter struct {
+	// IDs, when not nil, selects only the todos with these IDs
+	IDs []int
+
+	Completed     *bool
+	Priority      model.Priority
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+
+	// IncludeArchived also selects archived todos, which are left out
+	// otherwise
+	IncludeArchived bool
+
+	// SortByPriority lists the most urgent todos first instead of the
+	// newest ones
+	SortByPriority bool
+
+	// SortByPosition lists todos in their manual order instead of newest
+	// first
+	SortByPosition bool
+
+	// Compact only loads the fields listed by compactTodoColumns, leaving
+	// the others zero
+	Compact bool
+}
+
+// DeleteManyFilter selects the todos DeleteMany deletes, archived or not
+func DeleteManyFilter(ids []int) ListFilter {
+	if ids == nil {
+		ids = []int{}
+	}
+	return ListFilter{IDs: ids, IncludeArchived: true}
+}
+
+// DeleteWhereFilter selects the todos DeleteWhere deletes, archived or not
+func DeleteWhereFilter(completed *bool) ListFilter {
+	return ListFilter{Completed: completed, IncludeArchived: true}
+}
+
+// MarkAllCompletedFilter selects the todos MarkAllCompleted completes,
+// archived or not
+func MarkAllCompletedFilter() ListFilter {
+	completed := false
+	return ListFilter{Completed: &completed, IncludeArchived: true}
+}
+
+// todoColumns lists the columns scanned by todoFields, in order
+const todoColumns = "id, title, description, completed, priority, owner_id, created_at, updated_at, completed_at, external_id, archived_at, position"
+
+// todoFields returns the scan destinations for todoColumns
+func todoFields(todo *model.Todo) []interface{} {
+	return []interface{}{
 		&todo.ID,
 		&todo.Title,
 		&todo.Description,
 		&todo.Completed,
+		&todo.Priority,
+		&todo.OwnerID,
 		&todo.CreatedAt,
 		&todo.UpdatedAt,
-	)
+		&todo.CompletedAt,
+		&todo.ExternalID,
+		&todo.ArchivedAt,
+		&todo.Position,
+	}
+}
+
+// compactTodoColumns lists the columns scanned by compactTodoFields, in
+// order
+const compactTodoColumns = "id, title, completed, updated_at"
+
+// compactTodoFields returns the scan destinations for compactTodoColumns
+func compactTodoFields(todo *model.Todo) []interface{} {
+	return []interface{}{
+		&todo.ID,
+		&todo.Title,
+		&todo.Completed,
+		&todo.UpdatedAt,
+	}
+}
+
+// TodoRepository handles todo data operations
+type TodoRepository interface {
+	Create(ctx context.Context, req dto.CreateTodoRequest) (*model.Todo, error)
+	GetByID(ctx context.Context, id int) (*model.Todo, error)
+	GetByIDs(ctx context.Context, ids []int) ([]model.Todo, error)
+	Exists(ctx context.Context, id int) (bool, error)
+	List(ctx context.Context, page, pageSize int, filter ListFilter) ([]model.Todo, int, error)
+	Count(ctx context.Context, filter ListFilter) (int, error)
+	Each(ctx context.Context, filter ListFilter, fn func(model.Todo) error) error
+	AverageRowSize(ctx context.Context) (int64, error)
+	Version(ctx context.Context) (int, time.Time, error)
+	CountByWeekday(ctx context.Context, loc *time.Location) ([7]int, error)
+	AverageCompletionTime(ctx context.Context, from, to *time.Time) (time.Duration, int, error)
+	Update(ctx context.Context, id int, req dto.UpdateTodoRequest) (*model.Todo, []string, error)
+	Upsert(ctx context.Context, externalID string, req dto.CreateTodoRequest) (*model.Todo, bool, error)
+	Archive(ctx context.Context, id int) (*model.Todo, bool, error)
+	Unarchive(ctx context.Context, id int) (*model.Todo, bool, error)
+	Reorder(ctx context.Context, ids []int) error
+	Delete(ctx context.Context, id int) error
+	DeleteMany(ctx context.Context, ids []int) (int64, error)
+	DeleteWhere(ctx context.Context, completed *bool, limit int) (int64, error)
+	MarkAllCompleted(ctx context.Context) (int64, error)
+}
+
+// PostgresTodoRepository is a TodoRepository backed by PostgreSQL
+type PostgresTodoRepository struct {
+	pool         *pgxpool.Pool
+	readPool     *pgxpool.Pool
+	retry        RetryPolicy
+	uniqueTitles bool
+	auditor      Auditor
+}
+
+// NewPostgresTodoRepository creates a new PostgresTodoRepository. Queries
+// failing with transient errors are retried according to retry.
+func NewPostgresTodoRepository(pool *pgxpool.Pool, retry RetryPolicy) *PostgresTodoRepository {
+	return NewPostgresTodoRepositoryWithReadPool(pool, pool, retry)
+}
+
+// NewPostgresTodoRepositoryWithReadPool creates a PostgresTodoRepository
+// that runs read-only queries on readPool, typically a replica, and writes
+// on pool
+func NewPostgresTodoRepositoryWithReadPool(pool, readPool *pgxpool.Pool, retry RetryPolicy) *PostgresTodoRepository {
+	return &PostgresTodoRepository{pool: pool, readPool: readPool, retry: retry}
+}
+
+// EnableUniqueTitles makes the todos created from now on require a title
+// their owner does not use on another such todo. Creating or renaming a
+// todo to a taken title fails with ErrConflict.
+func (r *PostgresTodoRepository) EnableUniqueTitles() {
+	r.uniqueTitles = true
+}
+
+// RecordAudit makes the repository record every change it makes to todos
+// with auditor, in the transaction making it
+func (r *PostgresTodoRepository) RecordAudit(auditor Auditor) {
+	r.auditor = auditor
+}
+
+// nextPosition is the SQL expression placing a new todo of the owner in $5
+// after all the others. The transaction must hold lockPositions so
+// concurrent creations never share a position.
+const nextPosition = "(SELECT COALESCE(MAX(position), 0) + 1 FROM todos WHERE owner_id = $5)"
+
+// lockPositions waits until no other transaction places todos of ownerID
+// in the manual order, then keeps them waiting until tx ends
+func lockPositions(ctx context.Context, tx pgx.Tx, ownerID string) error {
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", ownerID)
+	return err
+}
+
+// Create creates a new todo, at the end of the manual order, along with its
+// todo.created event
+func (r *PostgresTodoRepository) Create(ctx context.Context, req dto.CreateTodoRequest) (*model.Todo, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.Create", "INSERT")
+	defer span.End()
+
+	query := `
+		INSERT INTO todos (title, description, completed, priority, owner_id, unique_title, completed_at, position)
+		VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $3 THEN NOW() END, ` + nextPosition + `)
+		RETURNING ` + todoColumns
+
+	ownerID, err := creator(ctx)
 	if err != nil {
+		return nil, err
+	}
+
+	var todo model.Todo
+	err = r.retry.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			if err := lockPositions(ctx, tx, ownerID); err != nil {
+				return err
+			}
+			err := tx.QueryRow(ctx, query, req.Title, req.Description, req.Completed, req.Priority, ownerID, r.uniqueTitles).Scan(todoFields(&todo)...)
+			if err != nil {
+				return err
+			}
+			if err := outbox.Write(ctx, tx, outbox.EventTodoCreated, todo.ID, eventPayload(&todo)); err != nil {
+				return err
+			}
+			return recordTodo(ctx, r.auditor, tx, auditCreate, todo.ID, nil, &todo)
+		})
+	})
+	if err != nil {
+		if isUniqueTitleViolation(err) {
+			return nil, ErrConflict
+		}
+		if tooLong := tooLongError(err); tooLong != nil {
+			return nil, tooLong
+		}
 		return nil, fmt.Errorf("failed to create todo: %w", err)
 	}
 
 	return &todo, nil
 }
 
-// GetByID retrieves a todo by its ID
-func (r *TodoRepository) GetByID(ctx context.Context, id int) (*model.Todo, error) {
+// Upsert creates the todo of the owner with externalID from req, or
+// replaces its fields with those of req when it exists. It reports whether
+// the todo was created. Created todos go at the end of the manual order.
+func (r *PostgresTodoRepository) Upsert(ctx context.Context, externalID string, req dto.CreateTodoRequest) (*model.Todo, bool, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.Upsert", "INSERT")
+	defer span.End()
+
+	// xmax is only set on rows an UPDATE wrote, so it tells the two apart
 	query := `
-		SELECT id, title, description, completed, created_at, updated_at
-		FROM todos
-		WHERE id = $1
-	`
+		INSERT INTO todos (title, description, completed, priority, owner_id, external_id, unique_title, completed_at, position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $3 THEN NOW() END, ` + nextPosition + `)
+		ON CONFLICT (owner_id, external_id) DO UPDATE SET
+			title = EXCLUDED.title,
+			description = EXCLUDED.description,
+			completed = EXCLUDED.completed,
+			priority = EXCLUDED.priority,
+			completed_at = CASE WHEN EXCLUDED.completed THEN COALESCE(todos.completed_at, NOW()) END
+		RETURNING ` + todoColumns + `, xmax = 0`
+	selectQuery := "SELECT " + todoColumns + " FROM todos WHERE owner_id = $1 AND external_id = $2 FOR UPDATE"
+
+	ownerID, err := creator(ctx)
+	if err != nil {
+		return nil, false, err
+	}
 
 	var todo model.Todo
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&todo.ID,
-		&todo.Title,
-		&todo.Description,
-		&todo.Completed,
-		&todo.CreatedAt,
-		&todo.UpdatedAt,
-	)
+	var created bool
+	err = r.retry.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			if err := lockPositions(ctx, tx, ownerID); err != nil {
+				return err
+			}
+
+			// The todo replaced is recorded as it was, locked until then
+			var before *model.Todo
+			if r.auditor != nil {
+				var existing model.Todo
+				err := tx.QueryRow(ctx, selectQuery, ownerID, externalID).Scan(todoFields(&existing)...)
+				switch {
+				case err == nil:
+					before = &existing
+				case !errors.Is(err, pgx.ErrNoRows):
+					return err
+				}
+			}
+
+			err := tx.QueryRow(ctx, query, req.Title, req.Description, req.Completed, req.Priority, ownerID, externalID, r.uniqueTitles).
+				Scan(append(todoFields(&todo), &created)...)
+			if err != nil {
+				return err
+			}
+			event, action := outbox.EventTodoUpdated, auditUpdate
+			if created {
+				event, action = outbox.EventTodoCreated, auditCreate
+			}
+			if err := outbox.Write(ctx, tx, event, todo.ID, eventPayload(&todo)); err != nil {
+				return err
+			}
+			return recordTodo(ctx, r.auditor, tx, action, todo.ID, before, &todo)
+		})
+	})
+	if err != nil {
+		if isUniqueTitleViolation(err) {
+			return nil, false, ErrConflict
+		}
+		if tooLong := tooLongError(err); tooLong != nil {
+			return nil, false, tooLong
+		}
+		return nil, false, fmt.Errorf("failed to upsert todo: %w", err)
+	}
+
+	return &todo, created, nil
+}
+
+// CreateBatch inserts reqs with a single COPY, in one transaction, and
+// returns how many todos were created: all of them or none. Meant for bulk
+// loads such as seeding, it writes no events and does not check unique
+// titles.
+func (r *PostgresTodoRepository) CreateBatch(ctx context.Context, reqs []dto.CreateTodoRequest) (int64, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.CreateBatch", "COPY")
+	defer span.End()
+
+	ownerID, err := creator(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	columns := []string{"title", "description", "completed", "priority", "owner_id", "completed_at", "position"}
+
+	var created int64
+	err = r.retry.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			if err := lockPositions(ctx, tx, ownerID); err != nil {
+				return err
+			}
+			var last int
+			err := tx.QueryRow(ctx, "SELECT COALESCE(MAX(position), 0) FROM todos WHERE owner_id = $1", ownerID).Scan(&last)
+			if err != nil {
+				return err
+			}
+
+			rows := make([][]interface{}, len(reqs))
+			for i, req := range reqs {
+				var completedAt *time.Time
+				if req.Completed {
+					completedAt = &now
+				}
+				rows[i] = []interface{}{req.Title, req.Description, req.Completed, string(req.Priority), ownerID, completedAt, last + i + 1}
+			}
+
+			created, err = tx.CopyFrom(ctx, pgx.Identifier{"todos"}, columns, pgx.CopyFromRows(rows))
+			return err
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create todos: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetByID retrieves a todo by its ID
+func (r *PostgresTodoRepository) GetByID(ctx context.Context, id int) (*model.Todo, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.GetByID", "SELECT")
+	defer span.End()
+
+	return r.getByID(ctx, r.readPool, id)
+}
+
+// getByID retrieves a todo by its ID from pool
+func (r *PostgresTodoRepository) getByID(ctx context.Context, pool *pgxpool.Pool, id int) (*model.Todo, error) {
+	where, args := scopeWhere(ctx, " WHERE id = $1", []interface{}{id})
+	query := "SELECT " + todoColumns + " FROM todos" + where
+
+	var todo model.Todo
+	err := r.retry.withRetry(ctx, func() error {
+		return pool.QueryRow(ctx, query, args...).Scan(todoFields(&todo)...)
+	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrNotFound
@@ -77,160 +407,924 @@ func (r *TodoRepository) GetByID(ctx context.Context, id int) (*model.Todo, erro
 	return &todo, nil
 }
 
-// List retrieves a paginated list of todos
-func (r *TodoRepository) List(ctx context.Context, page, pageSize int, completed *bool) ([]model.Todo, int, error) {
-	if page < 1 {
-		page = 1
+// GetByIDs retrieves the todos with the given IDs in the order of ids.
+// Missing IDs are skipped and repeated ones are returned once.
+func (r *PostgresTodoRepository) GetByIDs(ctx context.Context, ids []int) ([]model.Todo, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.GetByIDs", "SELECT")
+	defer span.End()
+
+	where, args := scopeWhere(ctx, " WHERE id = ANY($1)", []interface{}{ids})
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM todos%s
+		ORDER BY array_position($1, id)
+	`, todoColumns, where)
+
+	var todos []model.Todo
+	err := r.retry.withRetry(ctx, func() error {
+		var err error
+		todos, err = r.queryTodos(ctx, query, todoFields, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 10
+
+	return todos, nil
+}
+
+// Exists reports whether a todo with the given ID exists
+func (r *PostgresTodoRepository) Exists(ctx context.Context, id int) (bool, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.Exists", "SELECT")
+	defer span.End()
+
+	where, args := scopeWhere(ctx, " WHERE id = $1", []interface{}{id})
+	query := "SELECT EXISTS(SELECT 1 FROM todos" + where + ")"
+
+	var exists bool
+	err := r.retry.withRetry(ctx, func() error {
+		return r.readPool.QueryRow(ctx, query, args...).Scan(&exists)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check todo existence: %w", err)
 	}
 
+	return exists, nil
+}
+
+// List retrieves a paginated list of todos matching filter. page and
+// pageSize must be at least 1; the service normalizes them.
+func (r *PostgresTodoRepository) List(ctx context.Context, page, pageSize int, filter ListFilter) ([]model.Todo, int, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.List", "SELECT")
+	defer span.End()
+
+	where, args := filter.sql()
+	where, args = scopeWhere(ctx, where, args)
+
+	// Get total count
+	countQuery := "SELECT COUNT(*) FROM todos" + where
+
+	var total int
+	err := r.retry.withRetry(ctx, func() error {
+		return r.readPool.QueryRow(ctx, countQuery, args...).Scan(&total)
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count todos: %w", err)
+	}
+	// A page past the end would scan up to its offset only to return
+	// nothing
+	if pastLastPage(page, pageSize, total) {
+		return []model.Todo{}, total, nil
+	}
 	offset := (page - 1) * pageSize
 
-	// Build query based on filters
-	var countQuery, listQuery string
-	var args []interface{}
+	// Get todos
+	columns, fields := filter.columns()
+	listQuery := fmt.Sprintf(`
+		SELECT %s
+		FROM todos%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, columns, where, filter.orderBy(), len(args)+1, len(args)+2)
+	args = append(args, pageSize, offset)
 
-	if completed != nil {
-		countQuery = "SELECT COUNT(*) FROM todos WHERE completed = $1"
-		listQuery = `
-			SELECT id, title, description, completed, created_at, updated_at
-			FROM todos
-			WHERE completed = $1
-			ORDER BY created_at DESC
-			LIMIT $2 OFFSET $3
-		`
-		args = append(args, *completed, pageSize, offset)
-	} else {
-		countQuery = "SELECT COUNT(*) FROM todos"
-		listQuery = `
-			SELECT id, title, description, completed, created_at, updated_at
-			FROM todos
-			ORDER BY created_at DESC
-			LIMIT $1 OFFSET $2
-		`
-		args = append(args, pageSize, offset)
+	var todos []model.Todo
+	err = r.retry.withRetry(ctx, func() error {
+		var err error
+		todos, err = r.queryTodos(ctx, listQuery, fields, args...)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
 	}
 
-	// Get total count
+	return todos, total, nil
+}
+
+// pastLastPage reports whether page starts after the last of total todos.
+// It divides rather than computing the offset, which could overflow.
+func pastLastPage(page, pageSize, total int) bool {
+	return page-1 >= (total+pageSize-1)/pageSize
+}
+
+// Count returns the number of todos matching filter, without loading them
+func (r *PostgresTodoRepository) Count(ctx context.Context, filter ListFilter) (int, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.Count", "SELECT")
+	defer span.End()
+
+	where, args := filter.sql()
+	where, args = scopeWhere(ctx, where, args)
+	query := "SELECT COUNT(*) FROM todos" + where
+
 	var total int
-	if completed != nil {
-		err := r.pool.QueryRow(ctx, countQuery, *completed).Scan(&total)
-		if err != nil {
-			return nil, 0, fmt.Errorf("failed to count todos: %w", err)
-		}
+	err := r.retry.withRetry(ctx, func() error {
+		return r.readPool.QueryRow(ctx, query, args...).Scan(&total)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count todos: %w", err)
+	}
+
+	return total, nil
+}
+
+// Each calls fn with every todo matching filter, in List order, scanning
+// rows as they arrive instead of loading the whole result. It stops at the
+// first error returned by fn.
+func (r *PostgresTodoRepository) Each(ctx context.Context, filter ListFilter, fn func(model.Todo) error) error {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.Each", "SELECT")
+	defer span.End()
+
+	where, args := filter.sql()
+	where, args = scopeWhere(ctx, where, args)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM todos%s
+		ORDER BY %s
+	`, todoColumns, where, filter.orderBy())
+
+	// Only the query is retried: once rows were handed to fn, starting over
+	// would repeat them
+	var rows pgx.Rows
+	err := r.retry.withRetry(ctx, func() error {
+		var err error
+		rows, err = r.readPool.Query(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list todos: %w", err)
+	}
+	defer rows.Close()
+
+	return eachTodo(ctx, rows, todoFields, fn)
+}
+
+// columns returns the columns List selects for f and their scan
+// destinations
+func (f ListFilter) columns() (string, func(*model.Todo) []interface{}) {
+	if f.Compact {
+		return compactTodoColumns, compactTodoFields
+	}
+	return todoColumns, todoFields
+}
+
+// orderBy returns the ORDER BY expression listing todos newest first, in
+// manual order, or by decreasing priority first when f asks for it
+func (f ListFilter) orderBy() string {
+	if f.SortByPosition {
+		return "position, created_at, id"
+	}
+	orderBy := "created_at DESC"
+	if f.SortByPriority {
+		orderBy = "CASE priority WHEN 'high' THEN 0 WHEN 'medium' THEN 1 ELSE 2 END, " + orderBy
+	}
+	return orderBy
+}
+
+// sql returns the WHERE clause selecting the todos matching f, empty when
+// f does not filter, along with its positional arguments
+func (f ListFilter) sql() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if f.IDs != nil {
+		args = append(args, f.IDs)
+		conditions = append(conditions, fmt.Sprintf("id = ANY($%d)", len(args)))
+	}
+	if f.Completed != nil {
+		args = append(args, *f.Completed)
+		conditions = append(conditions, fmt.Sprintf("completed = $%d", len(args)))
+	}
+	if f.Priority != "" {
+		args = append(args, f.Priority)
+		conditions = append(conditions, fmt.Sprintf("priority = $%d", len(args)))
+	}
+	if f.CreatedAfter != nil {
+		args = append(args, *f.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if f.CreatedBefore != nil {
+		args = append(args, *f.CreatedBefore)
+		conditions = append(conditions, fmt.Sprintf("created_at <= $%d", len(args)))
+	}
+	if !f.IncludeArchived {
+		conditions = append(conditions, "archived_at IS NULL")
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + joinStrings(conditions, " AND "), args
+}
+
+// creator returns the owner carried by ctx, which todos are created for,
+// or ErrNoOwner
+func creator(ctx context.Context) (string, error) {
+	ownerID, ok := owner.FromContext(ctx)
+	if !ok {
+		return "", ErrNoOwner
+	}
+	return ownerID, nil
+}
+
+// scopeWhere restricts the WHERE clause where, possibly empty, to the
+// todos of the owner carried by ctx, appending the owner ID to args.
+// Queries made with owner.NewUnscopedContext are not scoped, and those
+// made with neither match nothing.
+func scopeWhere(ctx context.Context, where string, args []interface{}) (string, []interface{}) {
+	var condition string
+	if ownerID, ok := owner.FromContext(ctx); ok {
+		args = append(args, ownerID)
+		condition = fmt.Sprintf("owner_id = $%d", len(args))
+	} else if owner.Unscoped(ctx) {
+		return where, args
 	} else {
-		err := r.pool.QueryRow(ctx, countQuery).Scan(&total)
-		if err != nil {
-			return nil, 0, fmt.Errorf("failed to count todos: %w", err)
-		}
+		condition = "FALSE"
 	}
 
-	// Get todos
-	rows, err := r.pool.Query(ctx, listQuery, args...)
+	if where == "" {
+		return " WHERE " + condition, args
+	}
+	return where + " AND " + condition, args
+}
+
+// queryTodos runs query and scans every returned row into a todo through
+// fields
+func (r *PostgresTodoRepository) queryTodos(ctx context.Context, query string, fields func(*model.Todo) []interface{}, args ...interface{}) ([]model.Todo, error) {
+	rows, err := r.readPool.Query(ctx, query, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to list todos: %w", err)
+		return nil, fmt.Errorf("failed to list todos: %w", err)
 	}
 	defer rows.Close()
 
+	return scanTodos(ctx, rows, fields)
+}
+
+// scanTodos scans every row into a todo through fields. It stops as soon as
+// ctx ends so a client that went away does not keep the server reading a
+// large result.
+func scanTodos(ctx context.Context, rows pgx.Rows, fields func(*model.Todo) []interface{}) ([]model.Todo, error) {
 	var todos []model.Todo
+	err := eachTodo(ctx, rows, fields, func(todo model.Todo) error {
+		todos = append(todos, todo)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// eachTodo scans every row into a todo through fields and calls fn with
+// it, stopping at the first error fn returns or as soon as ctx ends
+func eachTodo(ctx context.Context, rows pgx.Rows, fields func(*model.Todo) []interface{}, fn func(model.Todo) error) error {
 	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("listing todos aborted: %w", err)
+		}
+
 		var todo model.Todo
-		err := rows.Scan(
-			&todo.ID,
-			&todo.Title,
-			&todo.Description,
-			&todo.Completed,
-			&todo.CreatedAt,
-			&todo.UpdatedAt,
-		)
+		err := rows.Scan(fields(&todo)...)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to scan todo: %w", err)
+			return fmt.Errorf("failed to scan todo: %w", err)
+		}
+		if err := fn(todo); err != nil {
+			return err
 		}
-		todos = append(todos, todo)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("error iterating todos: %w", err)
+		return fmt.Errorf("error iterating todos: %w", err)
 	}
 
-	return todos, total, nil
+	return nil
 }
 
-// Update updates a todo
-func (r *TodoRepository) Update(ctx context.Context, id int, req dto.UpdateTodoRequest) (*model.Todo, error) {
-	// First check if todo exists
-	existing, err := r.GetByID(ctx, id)
+// AverageRowSize returns the average size in bytes of a todo's text columns
+func (r *PostgresTodoRepository) AverageRowSize(ctx context.Context) (int64, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.AverageRowSize", "SELECT")
+	defer span.End()
+
+	where, args := scopeWhere(ctx, "", nil)
+	query := `
+		SELECT COALESCE(AVG(octet_length(title) + COALESCE(octet_length(description), 0)), 0)::bigint
+		FROM todos` + where
+
+	var size int64
+	err := r.retry.withRetry(ctx, func() error {
+		return r.readPool.QueryRow(ctx, query, args...).Scan(&size)
+	})
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("failed to compute average todo size: %w", err)
+	}
+
+	return size, nil
+}
+
+// Version returns the number of todos and the latest time any of them was
+// updated, the zero time when there are none
+func (r *PostgresTodoRepository) Version(ctx context.Context) (int, time.Time, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.Version", "SELECT")
+	defer span.End()
+
+	where, args := scopeWhere(ctx, "", nil)
+	query := "SELECT COUNT(*), MAX(updated_at) FROM todos" + where
+
+	var (
+		count       int
+		lastUpdated *time.Time
+	)
+	err := r.retry.withRetry(ctx, func() error {
+		return r.readPool.QueryRow(ctx, query, args...).Scan(&count, &lastUpdated)
+	})
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to get todos version: %w", err)
+	}
+
+	if lastUpdated == nil {
+		return count, time.Time{}, nil
+	}
+	return count, *lastUpdated, nil
+}
+
+// CountByWeekday returns how many todos were created on each day of the
+// week in loc, indexed by time.Weekday
+func (r *PostgresTodoRepository) CountByWeekday(ctx context.Context, loc *time.Location) ([7]int, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.CountByWeekday", "SELECT")
+	defer span.End()
+
+	where, args := scopeWhere(ctx, "", []interface{}{loc.String()})
+	query := fmt.Sprintf(`
+		SELECT EXTRACT(DOW FROM created_at AT TIME ZONE $1)::int AS dow, COUNT(*)
+		FROM todos%s
+		GROUP BY dow
+	`, where)
+
+	var counts [7]int
+	err := r.retry.withRetry(ctx, func() error {
+		counts = [7]int{}
+		rows, err := r.readPool.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var dow, count int
+			if err := rows.Scan(&dow, &count); err != nil {
+				return err
+			}
+			counts[dow] = count
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return [7]int{}, fmt.Errorf("failed to count todos by weekday: %w", err)
+	}
+
+	return counts, nil
+}
+
+// AverageCompletionTime returns the average time completed todos took from
+// creation to completion, along with how many were counted. from and to,
+// when set, bound the completion time. The average is zero when no todo
+// was counted.
+func (r *PostgresTodoRepository) AverageCompletionTime(ctx context.Context, from, to *time.Time) (time.Duration, int, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.AverageCompletionTime", "SELECT")
+	defer span.End()
+
+	where := " WHERE completed AND completed_at IS NOT NULL"
+	var args []interface{}
+	if from != nil {
+		args = append(args, *from)
+		where += fmt.Sprintf(" AND completed_at >= $%d", len(args))
+	}
+	if to != nil {
+		args = append(args, *to)
+		where += fmt.Sprintf(" AND completed_at <= $%d", len(args))
+	}
+	where, args = scopeWhere(ctx, where, args)
+	query := `
+		SELECT COUNT(*), COALESCE(EXTRACT(EPOCH FROM AVG(completed_at - created_at)), 0)::float8
+		FROM todos` + where
+
+	var (
+		count   int
+		seconds float64
+	)
+	err := r.retry.withRetry(ctx, func() error {
+		return r.readPool.QueryRow(ctx, query, args...).Scan(&count, &seconds)
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to compute average completion time: %w", err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), count, nil
+}
+
+// Update applies the fields of req that differ from the todo and returns
+// it along with the JSON names of the changed fields. Nothing is written,
+// not even an event, when no field changes.
+func (r *PostgresTodoRepository) Update(ctx context.Context, id int, req dto.UpdateTodoRequest) (*model.Todo, []string, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.Update", "UPDATE")
+	defer span.End()
+
+	where, args := scopeWhere(ctx, " WHERE id = $1", []interface{}{id})
+	selectQuery := "SELECT " + todoColumns + " FROM todos" + where + " FOR UPDATE"
+
+	var todo model.Todo
+	var changed []string
+	err := r.retry.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			// Lock the row so it cannot change or be deleted between the
+			// comparison and the update
+			var existing model.Todo
+			if err := tx.QueryRow(ctx, selectQuery, args...).Scan(todoFields(&existing)...); err != nil {
+				return err
+			}
+			if err := checkPrecondition(ctx, &existing); err != nil {
+				return err
+			}
+
+			changed = changedFields(&existing, req)
+			if len(changed) == 0 {
+				todo = existing
+				return nil
+			}
+
+			query, updateArgs := updateQuery(ctx, id, req, changed)
+			if err := tx.QueryRow(ctx, query, updateArgs...).Scan(todoFields(&todo)...); err != nil {
+				return err
+			}
+			if err := outbox.Write(ctx, tx, outbox.EventTodoUpdated, todo.ID, eventPayload(&todo)); err != nil {
+				return err
+			}
+			return recordTodo(ctx, r.auditor, tx, auditUpdate, todo.ID, &existing, &todo)
+		})
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, ErrNotFound
+		}
+		if isUniqueTitleViolation(err) {
+			return nil, nil, ErrConflict
+		}
+		if tooLong := tooLongError(err); tooLong != nil {
+			return nil, nil, tooLong
+		}
+		return nil, nil, fmt.Errorf("failed to update todo: %w", err)
 	}
 
-	// Build dynamic update query
-	query := "UPDATE todos SET "
+	return &todo, changed, nil
+}
+
+// updateQuery builds the UPDATE writing the changed fields of req to the
+// todo id and returning it
+func updateQuery(ctx context.Context, id int, req dto.UpdateTodoRequest, changed []string) (string, []interface{}) {
 	args := []interface{}{}
 	argPosition := 1
 	updates := []string{}
 
-	if req.Title != nil {
-		updates = append(updates, fmt.Sprintf("title = $%d", argPosition))
-		args = append(args, *req.Title)
+	for _, field := range changed {
+		switch field {
+		case "title":
+			updates = append(updates, fmt.Sprintf("title = $%d", argPosition))
+			args = append(args, *req.Title)
+		case "description":
+			updates = append(updates, fmt.Sprintf("description = $%d", argPosition))
+			args = append(args, *req.Description)
+		case "completed":
+			updates = append(updates,
+				fmt.Sprintf("completed = $%d", argPosition),
+				fmt.Sprintf("completed_at = CASE WHEN $%d THEN NOW() END", argPosition))
+			args = append(args, *req.Completed)
+		case "priority":
+			updates = append(updates, fmt.Sprintf("priority = $%d", argPosition))
+			args = append(args, *req.Priority)
+		}
 		argPosition++
 	}
 
-	if req.Description != nil {
-		updates = append(updates, fmt.Sprintf("description = $%d", argPosition))
-		args = append(args, *req.Description)
-		argPosition++
-	}
+	args = append(args, id)
+	where, args := scopeWhere(ctx, fmt.Sprintf(" WHERE id = $%d", argPosition), args)
+	return fmt.Sprintf("UPDATE todos SET %s%s RETURNING %s", joinStrings(updates, ", "), where, todoColumns), args
+}
 
-	if req.Completed != nil {
-		updates = append(updates, fmt.Sprintf("completed = $%d", argPosition))
-		args = append(args, *req.Completed)
-		argPosition++
+// changedFields returns the JSON names of the fields req sets to a value
+// todo does not have, in declaration order
+func changedFields(todo *model.Todo, req dto.UpdateTodoRequest) []string {
+	changed := []string{}
+	if req.Title != nil && *req.Title != todo.Title {
+		changed = append(changed, "title")
 	}
-
-	if len(updates) == 0 {
-		// No fields to update, return existing
-		return existing, nil
+	if req.Description != nil && *req.Description != todo.Description {
+		changed = append(changed, "description")
+	}
+	if req.Completed != nil && *req.Completed != todo.Completed {
+		changed = append(changed, "completed")
+	}
+	if req.Priority != nil && *req.Priority != todo.Priority {
+		changed = append(changed, "priority")
 	}
+	return changed
+}
 
-	query += fmt.Sprintf("%s WHERE id = $%d RETURNING id, title, description, completed, created_at, updated_at",
-		joinStrings(updates, ", "), argPosition)
-	args = append(args, id)
+// Archive archives a todo and returns it, reporting whether it was not
+// archived yet. Nothing is written, not even an event, when it was.
+func (r *PostgresTodoRepository) Archive(ctx context.Context, id int) (*model.Todo, bool, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.Archive", "UPDATE")
+	defer span.End()
+	return r.setArchived(ctx, id, true)
+}
+
+// Unarchive brings an archived todo back into lists and returns it,
+// reporting whether it was archived. Nothing is written, not even an
+// event, when it was not.
+func (r *PostgresTodoRepository) Unarchive(ctx context.Context, id int) (*model.Todo, bool, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.Unarchive", "UPDATE")
+	defer span.End()
+	return r.setArchived(ctx, id, false)
+}
+
+// setArchived archives or unarchives the todo id, along with its
+// todo.updated event, unless it already is
+func (r *PostgresTodoRepository) setArchived(ctx context.Context, id int, archived bool) (*model.Todo, bool, error) {
+	where, args := scopeWhere(ctx, " WHERE id = $1", []interface{}{id})
+	selectQuery := "SELECT " + todoColumns + " FROM todos" + where + " FOR UPDATE"
+	updateWhere, updateArgs := scopeWhere(ctx, " WHERE id = $2", []interface{}{archived, id})
+	updateQuery := "UPDATE todos SET archived_at = CASE WHEN $1 THEN NOW() END" + updateWhere + " RETURNING " + todoColumns
 
 	var todo model.Todo
-	err = r.pool.QueryRow(ctx, query, args...).Scan(
-		&todo.ID,
-		&todo.Title,
-		&todo.Description,
-		&todo.Completed,
-		&todo.CreatedAt,
-		&todo.UpdatedAt,
-	)
+	var changed bool
+	err := r.retry.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			if err := tx.QueryRow(ctx, selectQuery, args...).Scan(todoFields(&todo)...); err != nil {
+				return err
+			}
+
+			changed = (todo.ArchivedAt != nil) != archived
+			if !changed {
+				return nil
+			}
+
+			before := todo
+			if err := tx.QueryRow(ctx, updateQuery, updateArgs...).Scan(todoFields(&todo)...); err != nil {
+				return err
+			}
+			if err := outbox.Write(ctx, tx, outbox.EventTodoUpdated, todo.ID, eventPayload(&todo)); err != nil {
+				return err
+			}
+			action := auditUnarchive
+			if archived {
+				action = auditArchive
+			}
+			return recordTodo(ctx, r.auditor, tx, action, todo.ID, &before, &todo)
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update todo: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, false, ErrNotFound
+		}
+		return nil, false, fmt.Errorf("failed to archive todo: %w", err)
 	}
 
-	return &todo, nil
+	return &todo, changed, nil
+}
+
+// Reorder moves the todos ids, which must be distinct, to the top of the
+// manual order, in order, followed by the other todos in their current
+// order. Nothing changes and ErrNotFound is returned when one of ids is
+// not found.
+func (r *PostgresTodoRepository) Reorder(ctx context.Context, ids []int) error {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.Reorder", "UPDATE")
+	defer span.End()
+
+	// Every todo of the owner may move, so they are all locked
+	lockWhere, lockArgs := scopeWhere(ctx, "", nil)
+	lockQuery := "SELECT " + todoColumns + " FROM todos" + lockWhere + " FOR UPDATE"
+
+	where, args := scopeWhere(ctx, "", []interface{}{ids})
+	query := `
+		UPDATE todos SET position = ordered.position
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (
+				ORDER BY array_position($1::bigint[], id::bigint) NULLS LAST, position, created_at, id
+			) AS position
+			FROM todos` + where + `
+		) ordered
+		WHERE todos.id = ordered.id AND todos.position <> ordered.position
+		RETURNING ` + qualifiedTodoColumns("todos")
+
+	err := r.retry.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, lockQuery, lockArgs...)
+			if err != nil {
+				return err
+			}
+			locked, err := pgx.CollectRows(rows, scanTodo)
+			if err != nil {
+				return err
+			}
+			before := make(map[int]model.Todo, len(locked))
+			existing := make([]int, len(locked))
+			for i, todo := range locked {
+				before[todo.ID] = todo
+				existing[i] = todo.ID
+			}
+			if !containsAll(existing, ids) {
+				return ErrNotFound
+			}
+
+			rows, err = tx.Query(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			moved, err := pgx.CollectRows(rows, scanTodo)
+			if err != nil {
+				return err
+			}
+			for i := range moved {
+				if err := outbox.Write(ctx, tx, outbox.EventTodoUpdated, moved[i].ID, eventPayload(&moved[i])); err != nil {
+					return err
+				}
+				previous := before[moved[i].ID]
+				if err := recordTodo(ctx, r.auditor, tx, auditReorder, moved[i].ID, &previous, &moved[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to reorder todos: %w", err)
+	}
+
+	return nil
+}
+
+// containsAll reports whether every one of ids is in existing
+func containsAll(existing, ids []int) bool {
+	found := make(map[int]bool, len(existing))
+	for _, id := range existing {
+		found[id] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return false
+		}
+	}
+	return true
 }
 
 // Delete deletes a todo by ID
-func (r *TodoRepository) Delete(ctx context.Context, id int) error {
-	query := "DELETE FROM todos WHERE id = $1"
+func (r *PostgresTodoRepository) Delete(ctx context.Context, id int) error {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.Delete", "DELETE")
+	defer span.End()
+
+	where, args := scopeWhere(ctx, " WHERE id = $1", []interface{}{id})
+	query := "DELETE FROM todos" + where
 
-	result, err := r.pool.Exec(ctx, query, id)
+	var affected int64
+	var err error
+	if hasPrecondition(ctx) {
+		affected, err = r.deleteChecked(ctx, "SELECT "+todoColumns+" FROM todos"+where+" FOR UPDATE", query, args...)
+	} else {
+		affected, err = r.deleteAudited(ctx, query, args...)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete todo: %w", err)
 	}
 
-	if result.RowsAffected() == 0 {
+	if affected == 0 {
 		return ErrNotFound
 	}
 
 	return nil
 }
 
+// DeleteMany deletes the todos with the given IDs and returns how many were
+// deleted
+func (r *PostgresTodoRepository) DeleteMany(ctx context.Context, ids []int) (int64, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.DeleteMany", "DELETE")
+	defer span.End()
+
+	where, args := DeleteManyFilter(ids).sql()
+	where, args = scopeWhere(ctx, where, args)
+	query := "DELETE FROM todos" + where
+
+	affected, err := r.deleteAudited(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete todos: %w", err)
+	}
+
+	return affected, nil
+}
+
+// DeleteWhere deletes the todos matching the completion filter, or every
+// todo when completed is nil, and returns how many were deleted. At most
+// limit todos are deleted when limit is positive.
+func (r *PostgresTodoRepository) DeleteWhere(ctx context.Context, completed *bool, limit int) (int64, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.DeleteWhere", "DELETE")
+	defer span.End()
+
+	where, args := DeleteWhereFilter(completed).sql()
+	where, args = scopeWhere(ctx, where, args)
+
+	query := "DELETE FROM todos" + where
+	if limit > 0 {
+		args = append(args, limit)
+		query = fmt.Sprintf("DELETE FROM todos WHERE id IN (SELECT id FROM todos%s LIMIT $%d)", where, len(args))
+	}
+
+	affected, err := r.deleteAudited(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete todos: %w", err)
+	}
+
+	return affected, nil
+}
+
+// MarkAllCompleted completes every todo that is not completed yet and
+// returns how many were updated, writing a todo.updated event for each
+func (r *PostgresTodoRepository) MarkAllCompleted(ctx context.Context) (int64, error) {
+	ctx, span := startSpan(ctx, "PostgresTodoRepository.MarkAllCompleted", "UPDATE")
+	defer span.End()
+
+	where, args := MarkAllCompletedFilter().sql()
+	where, args = scopeWhere(ctx, where, args)
+
+	// The todos are returned as they were, locked until updated, and as
+	// they are
+	query := `
+		UPDATE todos SET completed = true, completed_at = NOW(), updated_at = NOW()
+		FROM (SELECT ` + todoColumns + ` FROM todos` + where + ` FOR UPDATE) previous
+		WHERE todos.id = previous.id
+		RETURNING ` + qualifiedTodoColumns("previous") + ", " + qualifiedTodoColumns("todos")
+
+	var affected int64
+	err := r.retry.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			type change struct{ before, after model.Todo }
+			changes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (change, error) {
+				var c change
+				err := row.Scan(append(todoFields(&c.before), todoFields(&c.after)...)...)
+				return c, err
+			})
+			if err != nil {
+				return err
+			}
+			affected = int64(len(changes))
+			for i := range changes {
+				after := &changes[i].after
+				if err := outbox.Write(ctx, tx, outbox.EventTodoUpdated, after.ID, eventPayload(after)); err != nil {
+					return err
+				}
+				if err := recordTodo(ctx, r.auditor, tx, auditCompleteAll, after.ID, &changes[i].before, after); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to complete todos: %w", err)
+	}
+
+	return affected, nil
+}
+
+// scanTodo scans a row of todoColumns
+func scanTodo(row pgx.CollectableRow) (model.Todo, error) {
+	var todo model.Todo
+	err := row.Scan(todoFields(&todo)...)
+	return todo, err
+}
+
+// qualifiedTodoColumns returns todoColumns, each qualified with table
+func qualifiedTodoColumns(table string) string {
+	columns := strings.Split(todoColumns, ", ")
+	for i, column := range columns {
+		columns[i] = table + "." + column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// tooLongError returns the TooLongError matching err, nil when err is not a
+// length violation. Values too long for their VARCHAR column (22001) are
+// titles: external IDs, the only other such column, are checked before
+// reaching the database.
+func tooLongError(err error) *TooLongError {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+	switch {
+	case pgErr.Code == "22001":
+		return &TooLongError{Field: "title", Max: model.MaxTitleLength}
+	case pgErr.Code == "23514" && pgErr.ConstraintName == descriptionLengthCheck:
+		return &TooLongError{Field: "description", Max: model.MaxDescriptionLength}
+	}
+	return nil
+}
+
+// isUniqueTitleViolation reports whether err is the unique violation
+// (23505) of uniqueTitleIndex
+func isUniqueTitleViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == uniqueTitleIndex
+}
+
+// eventPayload returns the payload of the outbox events about todo: the
+// todo as the API returns it and the user it belongs to
+func eventPayload(todo *model.Todo) any {
+	return struct {
+		dto.TodoResponse
+		OwnerID string `json:"owner_id"`
+	}{dto.ToTodoResponse(todo), todo.OwnerID}
+}
+
+// deleteAudited runs a DELETE, retrying transient failures, and returns
+// the number of todos it removed. A todo.deleted event is written for each
+// of them in its transaction, and their deletion recorded when auditing.
+func (r *PostgresTodoRepository) deleteAudited(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	var affected int64
+	err := r.retry.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, query+" RETURNING "+todoColumns, args...)
+			if err != nil {
+				return err
+			}
+			deleted, err := pgx.CollectRows(rows, scanTodo)
+			if err != nil {
+				return err
+			}
+			affected = int64(len(deleted))
+			for i := range deleted {
+				if err := outbox.Write(ctx, tx, outbox.EventTodoDeleted, deleted[i].ID, eventPayload(&deleted[i])); err != nil {
+					return err
+				}
+				if err := recordTodo(ctx, r.auditor, tx, auditDelete, deleted[i].ID, &deleted[i], nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	return affected, err
+}
+
+// deleteChecked runs the DELETE of a single todo once the todo, locked by
+// selectQuery, passes the precondition of ctx, writing a todo.deleted
+// event and recording its deletion when auditing in the same transaction
+func (r *PostgresTodoRepository) deleteChecked(ctx context.Context, selectQuery, query string, args ...interface{}) (int64, error) {
+	var affected int64
+	err := r.retry.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			var todo model.Todo
+			err := tx.QueryRow(ctx, selectQuery, args...).Scan(todoFields(&todo)...)
+			if errors.Is(err, pgx.ErrNoRows) {
+				affected = 0
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := checkPrecondition(ctx, &todo); err != nil {
+				return err
+			}
+
+			result, err := tx.Exec(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			affected = result.RowsAffected()
+			if err := outbox.Write(ctx, tx, outbox.EventTodoDeleted, todo.ID, eventPayload(&todo)); err != nil {
+				return err
+			}
+			return recordTodo(ctx, r.auditor, tx, auditDelete, todo.ID, &todo, nil)
+		})
+	})
+	return affected, err
+}
+
+// startSpan starts a client span for a query on the todos table
+func startSpan(ctx context.Context, name, operation string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.collection.name", "todos"),
+		),
+	)
+}
+
 // joinStrings joins strings with a separator
 func joinStrings(strs []string, sep string) string {
 	if len(strs) == 0 {
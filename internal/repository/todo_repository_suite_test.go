@@ -0,0 +1,989 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/database"
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabaseDSNEnv names the environment variable holding the DSN of a
+// disposable PostgreSQL database for the repository suite
+const testDatabaseDSNEnv = "TEST_DATABASE_DSN"
+
+func TestInMemoryTodoRepository(t *testing.T) {
+	runTodoRepositorySuite(t, func(t *testing.T) TodoRepository {
+		return NewInMemoryTodoRepository()
+	})
+}
+
+func TestPostgresTodoRepository(t *testing.T) {
+	dsn := os.Getenv(testDatabaseDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", testDatabaseDSNEnv)
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	require.NoError(t, database.Migrate(ctx, pool))
+
+	runTodoRepositorySuite(t, func(t *testing.T) TodoRepository {
+		_, err := pool.Exec(ctx, "TRUNCATE todos RESTART IDENTITY")
+		require.NoError(t, err)
+		return NewPostgresTodoRepository(pool, RetryPolicy{MaxAttempts: 1})
+	})
+
+	t.Run("concurrent creations take distinct positions", func(t *testing.T) {
+		_, err := pool.Exec(ctx, "TRUNCATE todos RESTART IDENTITY")
+		require.NoError(t, err)
+		repo := NewPostgresTodoRepository(pool, RetryPolicy{MaxAttempts: 1})
+		alice := owner.NewContext(ctx, "alice")
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := range 10 {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				_, err := repo.Create(alice, dto.CreateTodoRequest{Title: fmt.Sprintf("single %d", i)})
+				errs <- err
+			}()
+			go func() {
+				defer wg.Done()
+				_, err := repo.CreateBatch(alice, []dto.CreateTodoRequest{{Title: "batched"}, {Title: "batched"}})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		var total, positions int
+		err = pool.QueryRow(ctx, "SELECT COUNT(*), COUNT(DISTINCT position) FROM todos WHERE owner_id = $1", "alice").Scan(&total, &positions)
+		require.NoError(t, err)
+		assert.Equal(t, 30, total)
+		assert.Equal(t, total, positions)
+	})
+
+	t.Run("events of bulk changes", func(t *testing.T) {
+		_, err := pool.Exec(ctx, "TRUNCATE todos, todo_events RESTART IDENTITY")
+		require.NoError(t, err)
+		repo := NewPostgresTodoRepository(pool, RetryPolicy{MaxAttempts: 1})
+		alice := owner.NewContext(ctx, "alice")
+		first, err := repo.Create(alice, dto.CreateTodoRequest{Title: "first"})
+		require.NoError(t, err)
+		second, err := repo.Create(alice, dto.CreateTodoRequest{Title: "second"})
+		require.NoError(t, err)
+
+		require.NoError(t, repo.Reorder(alice, []int{second.ID, first.ID}))
+		_, err = repo.MarkAllCompleted(alice)
+		require.NoError(t, err)
+
+		// Both todos moved, then both were completed
+		var ids []int
+		err = pool.QueryRow(ctx, "SELECT array_agg(todo_id ORDER BY id) FROM todo_events WHERE type = $1", "todo.updated").Scan(&ids)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []int{first.ID, second.ID, first.ID, second.ID}, ids)
+
+		third, err := repo.Create(alice, dto.CreateTodoRequest{Title: "third"})
+		require.NoError(t, err)
+		_, err = repo.DeleteMany(alice, []int{first.ID, 999})
+		require.NoError(t, err)
+		require.NoError(t, repo.Delete(alice, second.ID))
+		_, err = repo.DeleteWhere(alice, nil, 0)
+		require.NoError(t, err)
+
+		// Each todo removed has its event, whichever way it was deleted
+		err = pool.QueryRow(ctx, "SELECT array_agg(todo_id ORDER BY id) FROM todo_events WHERE type = $1", "todo.deleted").Scan(&ids)
+		require.NoError(t, err)
+		assert.Equal(t, []int{first.ID, second.ID, third.ID}, ids)
+	})
+}
+
+// runTodoRepositorySuite checks the behavior every TodoRepository must
+// share. newRepo must return an empty repository.
+func runTodoRepositorySuite(t *testing.T, newRepo func(t *testing.T) TodoRepository) {
+	ctx := owner.NewContext(context.Background(), "owner")
+
+	t.Run("create and get", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "Write tests", Description: "Both repositories"})
+		require.NoError(t, err)
+		assert.NotZero(t, created.ID)
+		assert.Equal(t, "Write tests", created.Title)
+		assert.Equal(t, "Both repositories", created.Description)
+		assert.False(t, created.Completed)
+		assert.False(t, created.CreatedAt.IsZero())
+
+		got, err := repo.GetByID(ctx, created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, got.ID)
+		assert.Equal(t, created.Title, got.Title)
+		assert.Equal(t, created.Description, got.Description)
+	})
+
+	t.Run("get missing todo", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, err := repo.GetByID(ctx, 999)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("exists", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "present"})
+		require.NoError(t, err)
+
+		exists, err := repo.Exists(ctx, created.ID)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = repo.Exists(ctx, created.ID+1)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("list paginates newest first", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, title := range []string{"first", "second", "third"} {
+			_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: title})
+			require.NoError(t, err)
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		todos, total, err := repo.List(ctx, 1, 2, ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		require.Len(t, todos, 2)
+		assert.Equal(t, "third", todos[0].Title)
+		assert.Equal(t, "second", todos[1].Title)
+
+		todos, total, err = repo.List(ctx, 2, 2, ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		require.Len(t, todos, 1)
+		assert.Equal(t, "first", todos[0].Title)
+
+		todos, total, err = repo.List(ctx, 3, 2, ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		assert.Empty(t, todos)
+
+		todos, total, err = repo.List(ctx, math.MaxInt, 2, ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		assert.NotNil(t, todos)
+		assert.Empty(t, todos)
+	})
+
+	t.Run("owners only see their own todos", func(t *testing.T) {
+		repo := newRepo(t)
+		alice := owner.NewContext(ctx, "alice")
+		bob := owner.NewContext(ctx, "bob")
+
+		todo, err := repo.Create(alice, dto.CreateTodoRequest{Title: "alice's"})
+		require.NoError(t, err)
+		assert.Equal(t, "alice", todo.OwnerID)
+		_, err = repo.Create(bob, dto.CreateTodoRequest{Title: "bob's"})
+		require.NoError(t, err)
+
+		_, err = repo.GetByID(bob, todo.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		exists, err := repo.Exists(bob, todo.ID)
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		todos, total, err := repo.List(bob, 1, 10, ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		require.Len(t, todos, 1)
+		assert.Equal(t, "bob's", todos[0].Title)
+
+		title := "stolen"
+		_, _, err = repo.Update(bob, todo.ID, dto.UpdateTodoRequest{Title: &title})
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(bob, todo.ID), ErrNotFound)
+
+		deleted, err := repo.DeleteWhere(bob, nil, 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		got, err := repo.GetByID(alice, todo.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "alice's", got.Title)
+	})
+
+	t.Run("no owner matches nothing", func(t *testing.T) {
+		repo := newRepo(t)
+		todo, err := repo.Create(owner.NewContext(ctx, "alice"), dto.CreateTodoRequest{Title: "alice's"})
+		require.NoError(t, err)
+		none := context.Background()
+
+		_, err = repo.Create(none, dto.CreateTodoRequest{Title: "nobody's"})
+		assert.ErrorIs(t, err, ErrNoOwner)
+		_, err = repo.GetByID(none, todo.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		todos, total, err := repo.List(none, 1, 10, ListFilter{})
+		require.NoError(t, err)
+		assert.Zero(t, total)
+		assert.Empty(t, todos)
+		completed, err := repo.MarkAllCompleted(none)
+		require.NoError(t, err)
+		assert.Zero(t, completed)
+		deleted, err := repo.DeleteWhere(none, nil, 0)
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+
+		// Maintenance opts out of the scope explicitly
+		unscoped := owner.NewUnscopedContext(context.Background())
+		got, err := repo.GetByID(unscoped, todo.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "alice's", got.Title)
+		deleted, err = repo.DeleteWhere(unscoped, nil, 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+	})
+
+	t.Run("get by IDs keeps the requested order", func(t *testing.T) {
+		repo := newRepo(t)
+
+		var ids []int
+		for _, title := range []string{"a", "b", "c", "d"} {
+			todo, err := repo.Create(ctx, dto.CreateTodoRequest{Title: title})
+			require.NoError(t, err)
+			ids = append(ids, todo.ID)
+		}
+
+		requested := []int{ids[2], ids[0], ids[3] + 1000, ids[3], ids[1], ids[0]}
+		todos, err := repo.GetByIDs(ctx, requested)
+		require.NoError(t, err)
+
+		var titles []string
+		for _, todo := range todos {
+			titles = append(titles, todo.Title)
+		}
+		assert.Equal(t, []string{"c", "a", "d", "b"}, titles)
+
+		todos, err = repo.GetByIDs(ctx, nil)
+		require.NoError(t, err)
+		assert.Empty(t, todos)
+	})
+
+	t.Run("each visits every matching todo newest first", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, title := range []string{"first", "second", "third"} {
+			_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: title, Completed: title != "second"})
+			require.NoError(t, err)
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		var titles []string
+		completed := true
+		err := repo.Each(ctx, ListFilter{Completed: &completed}, func(todo model.Todo) error {
+			titles = append(titles, todo.Title)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"third", "first"}, titles)
+
+		errStop := errors.New("stop")
+		visited := 0
+		err = repo.Each(ctx, ListFilter{}, func(model.Todo) error {
+			visited++
+			return errStop
+		})
+		assert.ErrorIs(t, err, errStop)
+		assert.Equal(t, 1, visited)
+	})
+
+	t.Run("unique titles", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.(interface{ EnableUniqueTitles() }).EnableUniqueTitles()
+
+		aliceCtx := owner.NewContext(ctx, "alice")
+		first, err := repo.Create(aliceCtx, dto.CreateTodoRequest{Title: "Groceries"})
+		require.NoError(t, err)
+
+		_, err = repo.Create(aliceCtx, dto.CreateTodoRequest{Title: "Groceries"})
+		assert.ErrorIs(t, err, ErrConflict)
+
+		_, err = repo.Create(owner.NewContext(ctx, "bob"), dto.CreateTodoRequest{Title: "Groceries"})
+		assert.NoError(t, err, "titles are unique per owner")
+
+		second, err := repo.Create(aliceCtx, dto.CreateTodoRequest{Title: "Laundry"})
+		require.NoError(t, err)
+
+		title := first.Title
+		_, _, err = repo.Update(aliceCtx, second.ID, dto.UpdateTodoRequest{Title: &title})
+		assert.ErrorIs(t, err, ErrConflict)
+
+		require.NoError(t, repo.Delete(aliceCtx, first.ID))
+		_, _, err = repo.Update(aliceCtx, second.ID, dto.UpdateTodoRequest{Title: &title})
+		assert.NoError(t, err)
+	})
+
+	t.Run("duplicate titles are allowed by default", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for range 2 {
+			_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "Groceries"})
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("list compact view", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "Poll me", Description: "Not sent", Completed: true, Priority: model.PriorityHigh})
+		require.NoError(t, err)
+
+		todos, total, err := repo.List(ctx, 1, 10, ListFilter{Compact: true})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		require.Len(t, todos, 1)
+		assert.Equal(t, created.ID, todos[0].ID)
+		assert.Equal(t, "Poll me", todos[0].Title)
+		assert.True(t, todos[0].Completed)
+		assert.True(t, todos[0].UpdatedAt.Equal(created.UpdatedAt))
+		assert.Empty(t, todos[0].Description)
+		assert.Empty(t, todos[0].Priority)
+		assert.True(t, todos[0].CreatedAt.IsZero())
+
+		got, err := repo.GetByID(ctx, created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Not sent", got.Description)
+	})
+
+	t.Run("list filters by completion", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "open"})
+		require.NoError(t, err)
+		_, err = repo.Create(ctx, dto.CreateTodoRequest{Title: "done", Completed: true})
+		require.NoError(t, err)
+
+		completed := true
+		todos, total, err := repo.List(ctx, 1, 10, ListFilter{Completed: &completed})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		require.Len(t, todos, 1)
+		assert.Equal(t, "done", todos[0].Title)
+	})
+
+	t.Run("count matches the list filters", func(t *testing.T) {
+		repo := newRepo(t)
+		alice := owner.NewContext(ctx, "alice")
+		bob := owner.NewContext(ctx, "bob")
+
+		_, err := repo.Create(alice, dto.CreateTodoRequest{Title: "open"})
+		require.NoError(t, err)
+		_, err = repo.Create(alice, dto.CreateTodoRequest{Title: "done", Completed: true})
+		require.NoError(t, err)
+		_, err = repo.Create(bob, dto.CreateTodoRequest{Title: "bob's"})
+		require.NoError(t, err)
+
+		total, err := repo.Count(alice, ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, total)
+
+		completed := true
+		total, err = repo.Count(alice, ListFilter{Completed: &completed})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+	})
+
+	t.Run("list filters by creation date", func(t *testing.T) {
+		repo := newRepo(t)
+
+		var created []time.Time
+		for _, completed := range []bool{false, true, false, true} {
+			todo, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "todo", Completed: completed})
+			require.NoError(t, err)
+			created = append(created, todo.CreatedAt)
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		todos, total, err := repo.List(ctx, 1, 10, ListFilter{CreatedAfter: &created[1], CreatedBefore: &created[2]})
+		require.NoError(t, err)
+		assert.Equal(t, 2, total)
+		assert.Len(t, todos, 2)
+
+		_, total, err = repo.List(ctx, 1, 10, ListFilter{CreatedAfter: &created[1]})
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+
+		completed := true
+		todos, total, err = repo.List(ctx, 1, 1, ListFilter{Completed: &completed, CreatedAfter: &created[1]})
+		require.NoError(t, err)
+		assert.Equal(t, 2, total)
+		require.Len(t, todos, 1)
+		assert.True(t, todos[0].CreatedAt.Equal(created[3]))
+	})
+
+	t.Run("list filters and sorts by priority", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, priority := range []model.Priority{model.PriorityMedium, model.PriorityHigh, model.PriorityLow, model.PriorityHigh} {
+			_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: string(priority), Priority: priority})
+			require.NoError(t, err)
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		todos, total, err := repo.List(ctx, 1, 10, ListFilter{Priority: model.PriorityHigh})
+		require.NoError(t, err)
+		assert.Equal(t, 2, total)
+		for _, todo := range todos {
+			assert.Equal(t, model.PriorityHigh, todo.Priority)
+		}
+
+		todos, _, err = repo.List(ctx, 1, 10, ListFilter{SortByPriority: true})
+		require.NoError(t, err)
+		var priorities []model.Priority
+		for _, todo := range todos {
+			priorities = append(priorities, todo.Priority)
+		}
+		assert.Equal(t, []model.Priority{model.PriorityHigh, model.PriorityHigh, model.PriorityMedium, model.PriorityLow}, priorities)
+	})
+
+	t.Run("update priority", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "todo", Priority: model.PriorityLow})
+		require.NoError(t, err)
+		assert.Equal(t, model.PriorityLow, created.Priority)
+
+		high := model.PriorityHigh
+		updated, _, err := repo.Update(ctx, created.ID, dto.UpdateTodoRequest{Priority: &high})
+		require.NoError(t, err)
+		assert.Equal(t, model.PriorityHigh, updated.Priority)
+	})
+
+	t.Run("average row size", func(t *testing.T) {
+		repo := newRepo(t)
+
+		size, err := repo.AverageRowSize(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), size)
+
+		_, err = repo.Create(ctx, dto.CreateTodoRequest{Title: "abcd", Description: "efgh"})
+		require.NoError(t, err)
+		_, err = repo.Create(ctx, dto.CreateTodoRequest{Title: "ab"})
+		require.NoError(t, err)
+
+		size, err = repo.AverageRowSize(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), size)
+	})
+
+	t.Run("version", func(t *testing.T) {
+		repo := newRepo(t)
+
+		count, lastUpdated, err := repo.Version(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+		assert.True(t, lastUpdated.IsZero())
+
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "todo"})
+		require.NoError(t, err)
+
+		count, lastUpdated, err = repo.Version(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		assert.True(t, created.UpdatedAt.Equal(lastUpdated))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "old", Description: "keep"})
+		require.NoError(t, err)
+
+		title := "new"
+		completed := true
+		updated, _, err := repo.Update(ctx, created.ID, dto.UpdateTodoRequest{Title: &title, Completed: &completed})
+		require.NoError(t, err)
+		assert.Equal(t, "new", updated.Title)
+		assert.Equal(t, "keep", updated.Description)
+		assert.True(t, updated.Completed)
+
+		unchanged, _, err := repo.Update(ctx, created.ID, dto.UpdateTodoRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "new", unchanged.Title)
+	})
+
+	t.Run("update reports changed fields", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "same", Description: "old"})
+		require.NoError(t, err)
+
+		title := "same"
+		description := "new"
+		completed := false
+		updated, changed, err := repo.Update(ctx, created.ID, dto.UpdateTodoRequest{Title: &title, Description: &description, Completed: &completed})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"description"}, changed)
+		assert.Equal(t, "new", updated.Description)
+
+		unchanged, changed, err := repo.Update(ctx, created.ID, dto.UpdateTodoRequest{Title: &title, Description: &description})
+		require.NoError(t, err)
+		assert.Empty(t, changed)
+		assert.True(t, unchanged.UpdatedAt.Equal(updated.UpdatedAt), "no-op updates are not written")
+	})
+
+	t.Run("update missing todo", func(t *testing.T) {
+		repo := newRepo(t)
+
+		title := "new"
+		_, _, err := repo.Update(ctx, 999, dto.UpdateTodoRequest{Title: &title})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("precondition", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "old"})
+		require.NoError(t, err)
+		stale := created.UpdatedAt.Add(-time.Second)
+		matchStale := WithPrecondition(ctx, func(todo *model.Todo) bool { return todo.UpdatedAt.Equal(stale) })
+		matchCurrent := WithPrecondition(ctx, func(todo *model.Todo) bool { return todo.UpdatedAt.Equal(created.UpdatedAt) })
+
+		title := "new"
+		_, _, err = repo.Update(matchStale, created.ID, dto.UpdateTodoRequest{Title: &title})
+		assert.ErrorIs(t, err, ErrVersionConflict)
+		assert.ErrorIs(t, repo.Delete(matchStale, created.ID), ErrVersionConflict)
+		got, err := repo.GetByID(ctx, created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "old", got.Title, "nothing changed")
+
+		updated, _, err := repo.Update(matchCurrent, created.ID, dto.UpdateTodoRequest{Title: &title})
+		require.NoError(t, err)
+		assert.Equal(t, "new", updated.Title)
+
+		// The update moved the todo past the version matched
+		assert.ErrorIs(t, repo.Delete(matchCurrent, created.ID), ErrVersionConflict)
+		matchUpdated := WithPrecondition(ctx, func(todo *model.Todo) bool { return todo.UpdatedAt.Equal(updated.UpdatedAt) })
+		require.NoError(t, repo.Delete(matchUpdated, created.ID))
+		assert.ErrorIs(t, repo.Delete(matchUpdated, created.ID), ErrNotFound)
+	})
+
+	t.Run("upsert by external id", func(t *testing.T) {
+		repo := newRepo(t)
+		alice := owner.NewContext(ctx, "alice")
+		bob := owner.NewContext(ctx, "bob")
+
+		created, isNew, err := repo.Upsert(alice, "ext-1", dto.CreateTodoRequest{Title: "Synced", Priority: model.PriorityLow})
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		require.NotNil(t, created.ExternalID)
+		assert.Equal(t, "ext-1", *created.ExternalID)
+
+		updated, isNew, err := repo.Upsert(alice, "ext-1", dto.CreateTodoRequest{Title: "Resynced", Completed: true, Priority: model.PriorityHigh})
+		require.NoError(t, err)
+		assert.False(t, isNew)
+		assert.Equal(t, created.ID, updated.ID)
+		assert.Equal(t, "Resynced", updated.Title)
+		assert.True(t, updated.Completed)
+		assert.NotNil(t, updated.CompletedAt)
+		assert.Equal(t, model.PriorityHigh, updated.Priority)
+
+		// External IDs are scoped to their owner
+		other, isNew, err := repo.Upsert(bob, "ext-1", dto.CreateTodoRequest{Title: "Bob's", Priority: model.PriorityLow})
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		assert.NotEqual(t, created.ID, other.ID)
+
+		got, err := repo.GetByID(alice, created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Resynced", got.Title)
+		require.NotNil(t, got.ExternalID)
+		assert.Equal(t, "ext-1", *got.ExternalID)
+	})
+
+	t.Run("update deleted todo", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "doomed"})
+		require.NoError(t, err)
+		require.NoError(t, repo.Delete(ctx, created.ID))
+
+		title := "new"
+		_, _, err = repo.Update(ctx, created.ID, dto.UpdateTodoRequest{Title: &title})
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, _, err = repo.Update(ctx, created.ID, dto.UpdateTodoRequest{})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("text lengths", func(t *testing.T) {
+		repo := newRepo(t)
+
+		// Limits count characters, not bytes
+		title := strings.Repeat("é", model.MaxTitleLength)
+		description := strings.Repeat("é", model.MaxDescriptionLength)
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: title, Description: description})
+		require.NoError(t, err)
+
+		var tooLong *TooLongError
+		_, err = repo.Create(ctx, dto.CreateTodoRequest{Title: title + "é"})
+		require.ErrorAs(t, err, &tooLong)
+		assert.Equal(t, "title", tooLong.Field)
+
+		longer := description + "é"
+		_, _, err = repo.Update(ctx, created.ID, dto.UpdateTodoRequest{Description: &longer})
+		require.ErrorAs(t, err, &tooLong)
+		assert.Equal(t, "description", tooLong.Field)
+
+		_, _, err = repo.Upsert(ctx, "ext-1", dto.CreateTodoRequest{Title: "upserted", Description: longer})
+		require.ErrorAs(t, err, &tooLong)
+		assert.Equal(t, "description", tooLong.Field)
+	})
+
+	t.Run("reorder", func(t *testing.T) {
+		repo := newRepo(t)
+
+		var ids []int
+		for _, title := range []string{"first", "second", "third"} {
+			created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: title})
+			require.NoError(t, err)
+			assert.Equal(t, len(ids)+1, created.Position)
+			ids = append(ids, created.ID)
+		}
+
+		positions := func() []int {
+			todos, _, err := repo.List(ctx, 1, 10, ListFilter{SortByPosition: true})
+			require.NoError(t, err)
+			listed := make([]int, len(todos))
+			for i, todo := range todos {
+				listed[i] = todo.ID
+			}
+			return listed
+		}
+
+		require.NoError(t, repo.Reorder(ctx, []int{ids[2], ids[0]}))
+		assert.Equal(t, []int{ids[2], ids[0], ids[1]}, positions())
+
+		assert.ErrorIs(t, repo.Reorder(ctx, []int{ids[1], 999}), ErrNotFound)
+		assert.Equal(t, []int{ids[2], ids[0], ids[1]}, positions())
+
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "fourth"})
+		require.NoError(t, err)
+		assert.Equal(t, []int{ids[2], ids[0], ids[1], created.ID}, positions())
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		repo := newRepo(t)
+
+		kept, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "kept"})
+		require.NoError(t, err)
+		old, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "old"})
+		require.NoError(t, err)
+
+		archived, changed, err := repo.Archive(ctx, old.ID)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		require.NotNil(t, archived.ArchivedAt)
+
+		again, changed, err := repo.Archive(ctx, old.ID)
+		require.NoError(t, err)
+		assert.False(t, changed)
+		assert.True(t, archived.ArchivedAt.Equal(*again.ArchivedAt))
+
+		todos, total, err := repo.List(ctx, 1, 10, ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		require.Len(t, todos, 1)
+		assert.Equal(t, kept.ID, todos[0].ID)
+
+		count, err := repo.Count(ctx, ListFilter{IncludeArchived: true})
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		unarchived, changed, err := repo.Unarchive(ctx, old.ID)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		assert.Nil(t, unarchived.ArchivedAt)
+
+		count, err = repo.Count(ctx, ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("archive missing todo", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, _, err := repo.Archive(ctx, 999)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, _, err = repo.Unarchive(ctx, 999)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "doomed"})
+		require.NoError(t, err)
+
+		require.NoError(t, repo.Delete(ctx, created.ID))
+
+		_, err = repo.GetByID(ctx, created.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(ctx, created.ID), ErrNotFound)
+	})
+
+	t.Run("delete many", func(t *testing.T) {
+		repo := newRepo(t)
+
+		first, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "first"})
+		require.NoError(t, err)
+		second, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "second"})
+		require.NoError(t, err)
+		kept, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "kept"})
+		require.NoError(t, err)
+
+		deleted, err := repo.DeleteMany(ctx, []int{first.ID, second.ID, 999})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), deleted)
+
+		_, total, err := repo.List(ctx, 1, 10, ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+
+		exists, err := repo.Exists(ctx, kept.ID)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("mark all completed", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, completed := range []bool{true, false, false} {
+			_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "todo", Completed: completed})
+			require.NoError(t, err)
+		}
+
+		updated, err := repo.MarkAllCompleted(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), updated)
+
+		completed := true
+		_, total, err := repo.List(ctx, 1, 10, ListFilter{Completed: &completed})
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+
+		updated, err = repo.MarkAllCompleted(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), updated)
+	})
+
+	t.Run("completion time", func(t *testing.T) {
+		repo := newRepo(t)
+
+		open, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "open"})
+		require.NoError(t, err)
+		assert.Nil(t, open.CompletedAt)
+
+		done, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "done", Completed: true})
+		require.NoError(t, err)
+		require.NotNil(t, done.CompletedAt)
+
+		completed := true
+		updated, _, err := repo.Update(ctx, open.ID, dto.UpdateTodoRequest{Completed: &completed})
+		require.NoError(t, err)
+		require.NotNil(t, updated.CompletedAt)
+		assert.False(t, updated.CompletedAt.Before(updated.CreatedAt))
+
+		average, count, err := repo.AverageCompletionTime(ctx, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+		assert.GreaterOrEqual(t, average, time.Duration(0))
+
+		completed = false
+		reopened, _, err := repo.Update(ctx, done.ID, dto.UpdateTodoRequest{Completed: &completed})
+		require.NoError(t, err)
+		assert.Nil(t, reopened.CompletedAt)
+
+		future := time.Now().Add(time.Hour)
+		_, count, err = repo.AverageCompletionTime(ctx, &future, nil)
+		require.NoError(t, err)
+		assert.Zero(t, count)
+	})
+
+	t.Run("delete where", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, completed := range []bool{true, true, false} {
+			_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "todo", Completed: completed})
+			require.NoError(t, err)
+		}
+
+		completed := true
+		deleted, err := repo.DeleteWhere(ctx, &completed, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		deleted, err = repo.DeleteWhere(ctx, &completed, 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		deleted, err = repo.DeleteWhere(ctx, nil, 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		_, total, err := repo.List(ctx, 1, 10, ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, total)
+	})
+	t.Run("audit", func(t *testing.T) {
+		repo := newRepo(t).(auditedRepository)
+		auditor := &fakeAuditor{}
+		repo.RecordAudit(auditor)
+
+		todo, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "draft"})
+		require.NoError(t, err)
+		title := "final"
+		_, _, err = repo.Update(ctx, todo.ID, dto.UpdateTodoRequest{Title: &title})
+		require.NoError(t, err)
+		_, _, err = repo.Update(ctx, todo.ID, dto.UpdateTodoRequest{Title: &title})
+		require.NoError(t, err)
+		_, _, err = repo.Archive(ctx, todo.ID)
+		require.NoError(t, err)
+		require.NoError(t, repo.Delete(ctx, todo.ID))
+		deleted, err := repo.DeleteWhere(ctx, nil, 0)
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+
+		actions := make([]string, 0, len(auditor.changes))
+		for _, change := range auditor.changes {
+			actions = append(actions, change.action)
+		}
+		require.Equal(t, []string{"create", "update", "archive", "delete"}, actions, "changes of nothing are not recorded")
+		assert.Nil(t, auditor.changes[0].before)
+		assert.Equal(t, "draft", auditor.changes[1].before.(*model.Todo).Title)
+		assert.Equal(t, "final", auditor.changes[1].after.(*model.Todo).Title)
+		assert.Nil(t, auditor.changes[2].before.(*model.Todo).ArchivedAt)
+		assert.NotNil(t, auditor.changes[3].before.(*model.Todo).ArchivedAt)
+		assert.Nil(t, auditor.changes[3].after)
+	})
+
+	t.Run("audit bulk changes", func(t *testing.T) {
+		repo := newRepo(t).(auditedRepository)
+		first, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "first"})
+		require.NoError(t, err)
+		second, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "second"})
+		require.NoError(t, err)
+		auditor := &fakeAuditor{}
+		repo.RecordAudit(auditor)
+
+		require.NoError(t, repo.Reorder(ctx, []int{second.ID, first.ID}))
+		_, err = repo.MarkAllCompleted(ctx)
+		require.NoError(t, err)
+		_, err = repo.DeleteWhere(ctx, nil, 0)
+		require.NoError(t, err)
+
+		// Each todo changed is recorded on its own, with its states
+		ids := []string{strconv.Itoa(first.ID), strconv.Itoa(second.ID)}
+		byAction := make(map[string][]recordedChange)
+		for _, change := range auditor.changes {
+			byAction[change.action] = append(byAction[change.action], change)
+		}
+		assert.Len(t, byAction, 3)
+		for action, changes := range byAction {
+			entityIDs := make([]string, 0, len(changes))
+			for _, change := range changes {
+				entityIDs = append(entityIDs, change.entityID)
+			}
+			assert.ElementsMatch(t, ids, entityIDs, action)
+		}
+		for _, change := range byAction["reorder"] {
+			assert.NotEqual(t, change.before.(*model.Todo).Position, change.after.(*model.Todo).Position)
+		}
+		for _, change := range byAction["complete_all"] {
+			assert.False(t, change.before.(*model.Todo).Completed)
+			assert.True(t, change.after.(*model.Todo).Completed)
+		}
+		for _, change := range byAction["delete"] {
+			assert.True(t, change.before.(*model.Todo).Completed)
+			assert.Nil(t, change.after)
+		}
+	})
+
+	t.Run("audit failure", func(t *testing.T) {
+		repo := newRepo(t).(auditedRepository)
+		todo, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "kept"})
+		require.NoError(t, err)
+		repo.RecordAudit(&fakeAuditor{err: errors.New("audit store down")})
+
+		_, err = repo.Create(ctx, dto.CreateTodoRequest{Title: "lost"})
+		assert.Error(t, err)
+		title := "changed"
+		_, _, err = repo.Update(ctx, todo.ID, dto.UpdateTodoRequest{Title: &title})
+		assert.Error(t, err)
+		assert.Error(t, repo.Delete(ctx, todo.ID))
+		_, err = repo.DeleteMany(ctx, []int{todo.ID})
+		assert.Error(t, err)
+		_, err = repo.MarkAllCompleted(ctx)
+		assert.Error(t, err)
+
+		todos, total, err := repo.List(ctx, 1, 10, ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total, "no change is made without its record")
+		if assert.Len(t, todos, 1) {
+			assert.Equal(t, "kept", todos[0].Title)
+			assert.False(t, todos[0].Completed)
+		}
+	})
+}
+
+// auditedRepository is a TodoRepository recording its changes
+type auditedRepository interface {
+	TodoRepository
+	RecordAudit(auditor Auditor)
+}
+
+// recordedChange is a change given to a fakeAuditor
+type recordedChange struct {
+	action   string
+	entityID string
+	before   any
+	after    any
+}
+
+// fakeAuditor keeps the changes it is given, or fails with err when set
+type fakeAuditor struct {
+	changes []recordedChange
+	err     error
+}
+
+func (a *fakeAuditor) RecordTx(_ context.Context, _ pgx.Tx, action, _, entityID string, before, after any) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.changes = append(a.changes, recordedChange{action: action, entityID: entityID, before: before, after: after})
+	return nil
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/repository"
+)
+
+// AppError is an error that knows how it should be reported to API
+// clients: the HTTP status, a machine readable code and a user message.
+// The underlying cause, if any, is kept for logging and errors.Is.
+type AppError struct {
+	Status  int
+	Code    string
+	Message string
+	Err     error
+
+	// Fields details the fields a request got wrong, if known
+	Fields []dto.FieldError
+}
+
+// Error returns the user message, followed by the cause when there is one
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying cause
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an AppError with the same code, so wrapped
+// copies of a sentinel still match it
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && t.Code == e.Code
+}
+
+// wrap returns a copy of e carrying err as its cause
+func (e *AppError) wrap(err error) *AppError {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+var (
+	// ErrTodoNotFound is returned when the requested todo does not exist
+	ErrTodoNotFound = &AppError{Status: http.StatusNotFound, Code: "not_found", Message: "Todo not found"}
+
+	// ErrInvalidID is returned when a todo ID is not a valid integer
+	ErrInvalidID = &AppError{Status: http.StatusBadRequest, Code: "invalid_id", Message: "Invalid todo ID"}
+
+	// ErrValidation is returned when a request fails validation
+	ErrValidation = &AppError{Status: http.StatusBadRequest, Code: "validation_error", Message: "Request validation failed"}
+
+	// ErrUnprocessable is returned when a well formed request breaks a
+	// business rule
+	ErrUnprocessable = &AppError{Status: http.StatusUnprocessableEntity, Code: "unprocessable_entity", Message: "Request breaks a business rule"}
+
+	// ErrControlCharacters is returned when a text field contains control
+	// characters and todos.control_characters is "reject"
+	ErrControlCharacters = &AppError{Status: http.StatusBadRequest, Code: "invalid_characters", Message: "Text fields must not contain control characters"}
+
+	// ErrTitleFormat is returned when a title does not match
+	// todos.title_pattern
+	ErrTitleFormat = &AppError{Status: http.StatusBadRequest, Code: "invalid_title", Message: "Title does not match the required format"}
+
+	// ErrEmptyUpdate is returned when an update sets none of the todo fields
+	ErrEmptyUpdate = &AppError{Status: http.StatusBadRequest, Code: "empty_update", Message: "no updatable fields provided"}
+
+	// ErrUnavailable is returned when the database cannot serve requests
+	ErrUnavailable = &AppError{Status: http.StatusServiceUnavailable, Code: "service_unavailable", Message: "Service temporarily unavailable"}
+
+	// ErrTimeout is returned when an operation outlives its configured
+	// timeout
+	ErrTimeout = &AppError{Status: http.StatusServiceUnavailable, Code: "timeout", Message: "Request timed out"}
+
+	// ErrTitleConflict is returned when todos.unique_titles is on and the
+	// owner already has a todo with the title
+	ErrTitleConflict = &AppError{Status: http.StatusConflict, Code: "conflict", Message: "A todo with this title already exists"}
+
+	// ErrEmailTaken is returned when registering an email another user
+	// already has
+	ErrEmailTaken = &AppError{Status: http.StatusConflict, Code: "email_taken", Message: "This email is already registered"}
+
+	// ErrInvalidCredentials is returned when logging in with an unknown
+	// email or a wrong password
+	ErrInvalidCredentials = &AppError{Status: http.StatusUnauthorized, Code: "invalid_credentials", Message: "Invalid email or password"}
+
+	// ErrInvalidRefreshToken is returned when refreshing with a token that
+	// is unknown, expired or already used
+	ErrInvalidRefreshToken = &AppError{Status: http.StatusUnauthorized, Code: "invalid_refresh_token", Message: "Refresh token is invalid or expired, log in again"}
+
+	// ErrLoginState is returned when an OIDC callback does not match the
+	// login started by the client
+	ErrLoginState = &AppError{Status: http.StatusBadRequest, Code: "invalid_login_state", Message: "Login state is missing or does not match, start the login again"}
+
+	// ErrOIDCLogin is returned when the OIDC provider does not authenticate
+	// the user
+	ErrOIDCLogin = &AppError{Status: http.StatusUnauthorized, Code: "oidc_login_failed", Message: "The identity provider did not authenticate you"}
+
+	// ErrIdentityRejected is returned when the OIDC provider authenticated
+	// a user who may not log in
+	ErrIdentityRejected = &AppError{Status: http.StatusForbidden, Code: "identity_rejected", Message: "Your account may not log in"}
+
+	// ErrAPIKeyNotFound is returned when the user has no API key with the
+	// requested ID
+	ErrAPIKeyNotFound = &AppError{Status: http.StatusNotFound, Code: "api_key_not_found", Message: "API key not found"}
+
+	// ErrExportNotFound is returned when the user has no export with the
+	// requested ID, or it expired
+	ErrExportNotFound = &AppError{Status: http.StatusNotFound, Code: "export_not_found", Message: "Export not found or expired"}
+
+	// ErrExportNotReady is returned when downloading an export that is not
+	// built yet, or failed
+	ErrExportNotReady = &AppError{Status: http.StatusConflict, Code: "export_not_ready", Message: "Export is not ready"}
+
+	// ErrExportBusy is returned when export.max_pending_jobs archives are
+	// already being built
+	ErrExportBusy = &AppError{Status: http.StatusTooManyRequests, Code: "export_busy", Message: "Too many exports are being built, try again later"}
+
+	// ErrVersionConflict is returned when a todo changed since the version
+	// the client based its request on
+	ErrVersionConflict = &AppError{Status: http.StatusPreconditionFailed, Code: "precondition_failed", Message: "Todo has been modified"}
+)
+
+// limitError returns the error reported when a request asks for count
+// items of what, more than limit. Its message states both numbers.
+func limitError(what string, count, limit int) *AppError {
+	return &AppError{
+		Status:  http.StatusBadRequest,
+		Code:    "limit_exceeded",
+		Message: fmt.Sprintf("%s %d exceeds maximum %d", what, count, limit),
+	}
+}
+
+// invalid returns ErrValidation detailing fields
+func invalid(fields []dto.FieldError) *AppError {
+	appErr := *ErrValidation
+	appErr.Fields = fields
+	return &appErr
+}
+
+// unprocessable returns ErrUnprocessable detailing fields
+func unprocessable(fields []dto.FieldError) *AppError {
+	appErr := *ErrUnprocessable
+	appErr.Fields = fields
+	return &appErr
+}
+
+// translateError maps repository errors to AppErrors, leaving unknown
+// errors untouched
+func translateError(err error) error {
+	var tooLong *repository.TooLongError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return ErrTodoNotFound.wrap(err)
+	case errors.Is(err, repository.ErrUnavailable):
+		return ErrUnavailable.wrap(err)
+	case errors.Is(err, repository.ErrConflict):
+		return ErrTitleConflict.wrap(err)
+	case errors.Is(err, repository.ErrVersionConflict):
+		return ErrVersionConflict.wrap(err)
+	case errors.As(err, &tooLong):
+		// Only requests skipping validation get here, the database
+		// enforcing the limits of the binding tags
+		return invalid([]dto.FieldError{{
+			Field:   tooLong.Field,
+			Rule:    "max",
+			Message: fmt.Sprintf("%s must be at most %d characters", tooLong.Field, tooLong.Max),
+		}}).wrap(err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout.wrap(err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateError(t *testing.T) {
+	t.Run("not found becomes ErrTodoNotFound", func(t *testing.T) {
+		err := translateError(fmt.Errorf("get: %w", repository.ErrNotFound))
+
+		var appErr *AppError
+		assert.True(t, errors.As(err, &appErr))
+		assert.Equal(t, http.StatusNotFound, appErr.Status)
+		assert.ErrorIs(t, err, ErrTodoNotFound)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("unavailable becomes ErrUnavailable", func(t *testing.T) {
+		err := translateError(fmt.Errorf("list: %w", repository.ErrUnavailable))
+
+		var appErr *AppError
+		assert.True(t, errors.As(err, &appErr))
+		assert.Equal(t, http.StatusServiceUnavailable, appErr.Status)
+		assert.Equal(t, "service_unavailable", appErr.Code)
+	})
+
+	t.Run("version conflict becomes ErrVersionConflict", func(t *testing.T) {
+		err := translateError(fmt.Errorf("update: %w", repository.ErrVersionConflict))
+
+		var appErr *AppError
+		assert.True(t, errors.As(err, &appErr))
+		assert.Equal(t, http.StatusPreconditionFailed, appErr.Status)
+		assert.ErrorIs(t, err, ErrVersionConflict)
+	})
+
+	t.Run("deadline becomes ErrTimeout", func(t *testing.T) {
+		err := translateError(fmt.Errorf("update: %w", context.DeadlineExceeded))
+
+		var appErr *AppError
+		assert.True(t, errors.As(err, &appErr))
+		assert.Equal(t, http.StatusServiceUnavailable, appErr.Status)
+		assert.Equal(t, "timeout", appErr.Code)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("too long becomes ErrValidation", func(t *testing.T) {
+		err := translateError(&repository.TooLongError{Field: "description", Max: 1000})
+
+		var appErr *AppError
+		assert.True(t, errors.As(err, &appErr))
+		assert.Equal(t, http.StatusBadRequest, appErr.Status)
+		assert.ErrorIs(t, err, ErrValidation)
+		assert.Equal(t, []dto.FieldError{{Field: "description", Rule: "max", Message: "description must be at most 1000 characters"}}, appErr.Fields)
+	})
+
+	t.Run("unknown errors are kept", func(t *testing.T) {
+		cause := errors.New("connection refused")
+		err := translateError(cause)
+
+		assert.Equal(t, cause, err)
+		var appErr *AppError
+		assert.False(t, errors.As(err, &appErr))
+	})
+}
+
+func TestAppErrorIs(t *testing.T) {
+	err := ErrVersionConflict.wrap(errors.New("etag mismatch"))
+
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.NotErrorIs(t, err, ErrTodoNotFound)
+	assert.Equal(t, "Todo has been modified: etag mismatch", err.Error())
+}
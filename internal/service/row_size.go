@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/owner"
+)
+
+// rowSizeTTL is how long the average todo size of an owner is reused
+// before being estimated again
+const rowSizeTTL = time.Minute
+
+// rowSizeEstimate is an average todo size and when it stops being reused
+type rowSizeEstimate struct {
+	size    int64
+	expires time.Time
+}
+
+// rowSizes caches the average todo size of each owner for rowSizeTTL, so
+// listings do not scan every todo of their owner to estimate it
+type rowSizes struct {
+	mu        sync.Mutex
+	estimates map[string]rowSizeEstimate
+	now       func() time.Time
+}
+
+// newRowSizes creates an empty rowSizes
+func newRowSizes() *rowSizes {
+	return &rowSizes{estimates: make(map[string]rowSizeEstimate), now: time.Now}
+}
+
+// get returns the average todo size of the owner in ctx, calling estimate
+// when it is not cached or has expired. Expired estimates of other owners
+// are dropped along the way.
+func (c *rowSizes) get(ctx context.Context, estimate func(ctx context.Context) (int64, error)) (int64, error) {
+	ownerID, _ := owner.FromContext(ctx)
+	now := c.now()
+
+	c.mu.Lock()
+	cached, ok := c.estimates[ownerID]
+	c.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.size, nil
+	}
+
+	size, err := estimate(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, e := range c.estimates {
+		if !now.Before(e.expires) {
+			delete(c.estimates, id)
+		}
+	}
+	c.estimates[ownerID] = rowSizeEstimate{size: size, expires: now.Add(rowSizeTTL)}
+	return size, nil
+}
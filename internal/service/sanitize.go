@@ -0,0 +1,106 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/g3offrey/idiomapi/internal/dto"
+)
+
+// Values of config.TodosConfig.ControlCharacters. The others config.Load
+// accepts, "allow" and empty, keep control characters unchanged.
+const (
+	controlCharsReject = "reject"
+	controlCharsStrip  = "strip"
+)
+
+// isDisallowed reports whether r is a control character not allowed in a
+// text field. Multiline fields keep tabs and line breaks.
+func isDisallowed(r rune, multiline bool) bool {
+	if multiline && (r == '\t' || r == '\n' || r == '\r') {
+		return false
+	}
+	return unicode.IsControl(r)
+}
+
+// cleanText applies the configured control character policy to the value
+// of field, returning the value to store
+func (s *TodoService) cleanText(field, value string, multiline bool) (string, error) {
+	disallowed := func(r rune) bool { return isDisallowed(r, multiline) }
+
+	switch s.cfg.ControlCharacters {
+	case controlCharsReject:
+		if strings.IndexFunc(value, disallowed) >= 0 {
+			return "", ErrControlCharacters.wrap(fmt.Errorf("%s contains control characters", field))
+		}
+	case controlCharsStrip:
+		cleaned := strings.Map(func(r rune) rune {
+			if disallowed(r) {
+				return -1
+			}
+			return r
+		}, value)
+		if cleaned == "" && value != "" {
+			return "", ErrControlCharacters.wrap(fmt.Errorf("%s only contains control characters", field))
+		}
+		return cleaned, nil
+	}
+	return value, nil
+}
+
+// checkTitle returns ErrTitleFormat, naming the expected pattern, when
+// title does not match the configured title pattern
+func (s *TodoService) checkTitle(title string) error {
+	if s.titleErr != nil {
+		return s.titleErr
+	}
+	re := s.titlePattern
+	if re == nil || re.MatchString(title) {
+		return nil
+	}
+
+	appErr := ErrTitleFormat.wrap(fmt.Errorf("title %q does not match %s", title, re))
+	appErr.Message = fmt.Sprintf("Title must match the pattern %s", re)
+	return appErr
+}
+
+// cleanCreate applies the control character policy and the title pattern
+// to a create request
+func (s *TodoService) cleanCreate(req dto.CreateTodoRequest) (dto.CreateTodoRequest, error) {
+	var err error
+	if req.Title, err = s.cleanText("title", req.Title, false); err != nil {
+		return req, err
+	}
+	if err := s.checkTitle(req.Title); err != nil {
+		return req, err
+	}
+	if req.Description, err = s.cleanText("description", req.Description, true); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// cleanUpdate applies the control character policy and the title pattern
+// to the fields set by an update request, leaving the caller's values
+// untouched
+func (s *TodoService) cleanUpdate(req dto.UpdateTodoRequest) (dto.UpdateTodoRequest, error) {
+	if req.Title != nil {
+		title, err := s.cleanText("title", *req.Title, false)
+		if err != nil {
+			return req, err
+		}
+		if err := s.checkTitle(title); err != nil {
+			return req, err
+		}
+		req.Title = &title
+	}
+	if req.Description != nil {
+		description, err := s.cleanText("description", *req.Description, true)
+		if err != nil {
+			return req, err
+		}
+		req.Description = &description
+	}
+	return req, nil
+}
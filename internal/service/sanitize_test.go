@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/g3offrey/idiomapi/internal/config"
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/g3offrey/idiomapi/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlCharacters(t *testing.T) {
+	tests := []struct {
+		name                string
+		mode                string
+		req                 dto.CreateTodoRequest
+		expectedErr         error
+		expectedTitle       string
+		expectedDescription string
+	}{
+		{
+			name:          "null byte in title is accepted by default",
+			mode:          "",
+			req:           dto.CreateTodoRequest{Title: "buy\x00milk"},
+			expectedTitle: "buy\x00milk",
+		},
+		{
+			name:        "null byte in title is rejected",
+			mode:        controlCharsReject,
+			req:         dto.CreateTodoRequest{Title: "buy\x00milk"},
+			expectedErr: ErrControlCharacters,
+		},
+		{
+			name:          "null byte in title is stripped",
+			mode:          controlCharsStrip,
+			req:           dto.CreateTodoRequest{Title: "buy\x00milk"},
+			expectedTitle: "buymilk",
+		},
+		{
+			name:        "tab in title is rejected",
+			mode:        controlCharsReject,
+			req:         dto.CreateTodoRequest{Title: "buy\tmilk"},
+			expectedErr: ErrControlCharacters,
+		},
+		{
+			name:                "tab and newline in description are kept when rejecting",
+			mode:                controlCharsReject,
+			req:                 dto.CreateTodoRequest{Title: "groceries", Description: "milk\teggs\nbread"},
+			expectedTitle:       "groceries",
+			expectedDescription: "milk\teggs\nbread",
+		},
+		{
+			name:                "tab in description is kept when stripping",
+			mode:                controlCharsStrip,
+			req:                 dto.CreateTodoRequest{Title: "groceries", Description: "milk\teggs\x07"},
+			expectedTitle:       "groceries",
+			expectedDescription: "milk\teggs",
+		},
+		{
+			name:        "title made only of control characters is rejected when stripping",
+			mode:        controlCharsStrip,
+			req:         dto.CreateTodoRequest{Title: "\x00\x01"},
+			expectedErr: ErrControlCharacters,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewTodoService(
+				repository.NewInMemoryTodoRepository(),
+				config.TodosConfig{ControlCharacters: tt.mode},
+				config.PaginationConfig{}, config.LimitsConfig{},
+				slog.New(slog.DiscardHandler),
+			)
+
+			todo, err := svc.CreateTodo(owner.NewContext(context.Background(), "alice"), tt.req)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedTitle, todo.Title)
+			assert.Equal(t, tt.expectedDescription, todo.Description)
+		})
+	}
+}
+
+func TestControlCharactersOnUpdate(t *testing.T) {
+	ctx := owner.NewContext(context.Background(), "alice")
+	repo := repository.NewInMemoryTodoRepository()
+	svc := NewTodoService(repo, config.TodosConfig{ControlCharacters: controlCharsStrip}, config.PaginationConfig{}, config.LimitsConfig{}, slog.New(slog.DiscardHandler))
+
+	created, err := svc.CreateTodo(ctx, dto.CreateTodoRequest{Title: "todo"})
+	require.NoError(t, err)
+
+	title := "new\x00title"
+	updated, _, err := svc.UpdateTodo(ctx, created.ID, dto.UpdateTodoRequest{Title: &title})
+	require.NoError(t, err)
+	assert.Equal(t, "newtitle", updated.Title)
+	assert.Equal(t, "new\x00title", title)
+}
+
+func TestTitlePattern(t *testing.T) {
+	ctx := owner.NewContext(context.Background(), "alice")
+	svc := NewTodoService(
+		repository.NewInMemoryTodoRepository(),
+		config.TodosConfig{TitlePattern: `^[A-Z][a-z]`},
+		config.PaginationConfig{}, config.LimitsConfig{},
+		slog.New(slog.DiscardHandler),
+	)
+
+	created, err := svc.CreateTodo(ctx, dto.CreateTodoRequest{Title: "Buy milk"})
+	require.NoError(t, err)
+	assert.Equal(t, "Buy milk", created.Title)
+
+	_, err = svc.CreateTodo(ctx, dto.CreateTodoRequest{Title: "BUY MILK"})
+	assert.ErrorIs(t, err, ErrTitleFormat)
+
+	var appErr *AppError
+	require.ErrorAs(t, err, &appErr)
+	assert.Equal(t, "Title must match the pattern ^[A-Z][a-z]", appErr.Message)
+
+	title := "buy eggs"
+	_, _, err = svc.UpdateTodo(ctx, created.ID, dto.UpdateTodoRequest{Title: &title})
+	assert.ErrorIs(t, err, ErrTitleFormat)
+
+	invalid := NewTodoService(
+		repository.NewInMemoryTodoRepository(),
+		config.TodosConfig{TitlePattern: `[`},
+		config.PaginationConfig{}, config.LimitsConfig{},
+		slog.New(slog.DiscardHandler),
+	)
+	_, err = invalid.CreateTodo(ctx, dto.CreateTodoRequest{Title: "Buy milk"})
+	assert.ErrorContains(t, err, "invalid todos title pattern")
+}
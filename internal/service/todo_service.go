@@ -2,83 +2,639 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
 	"log/slog"
+	"regexp"
+	"strconv"
+	"time"
 
+	"github.com/g3offrey/idiomapi/internal/config"
 	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/events"
 	"github.com/g3offrey/idiomapi/internal/model"
+	"github.com/g3offrey/idiomapi/internal/owner"
 	"github.com/g3offrey/idiomapi/internal/repository"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// estimatedRowOverhead approximates the serialized size of a todo's
+// non-text fields (id, flags, timestamps and JSON keys) in bytes
+const estimatedRowOverhead = 128
+
+// maxExternalIDLength matches the size of the external_id column
+const maxExternalIDLength = 255
+
+// tracer starts spans for service operations
+var tracer = otel.Tracer("github.com/g3offrey/idiomapi/internal/service")
+
 // TodoService handles business logic for todos
 type TodoService struct {
-	repo   *repository.TodoRepository
-	logger *slog.Logger
+	repo       repository.TodoRepository
+	cfg        config.TodosConfig
+	pagination config.PaginationConfig
+	limits     config.LimitsConfig
+	events     *events.Hub
+	rowSizes   *rowSizes
+	logger     *slog.Logger
+
+	// titlePattern is the compiled cfg.TitlePattern, and titleErr the
+	// error compiling it
+	titlePattern *regexp.Regexp
+	titleErr     error
+}
+
+// TodoPage is a page of todos along with the pagination actually applied
+type TodoPage struct {
+	Todos           []model.Todo
+	Total           int
+	Page            int
+	PageSize        int
+	PageSizeReduced bool
 }
 
-// NewTodoService creates a new TodoService
-func NewTodoService(repo *repository.TodoRepository, logger *slog.Logger) *TodoService {
+// NewTodoService creates a new TodoService. An invalid title pattern fails
+// every creation and update of a title.
+func NewTodoService(repo repository.TodoRepository, cfg config.TodosConfig, pagination config.PaginationConfig, limits config.LimitsConfig, logger *slog.Logger) *TodoService {
+	titlePattern, titleErr := cfg.TitleRegexp()
 	return &TodoService{
-		repo:   repo,
-		logger: logger,
+		repo:         repo,
+		cfg:          cfg,
+		pagination:   pagination,
+		limits:       limits,
+		rowSizes:     newRowSizes(),
+		logger:       logger,
+		titlePattern: titlePattern,
+		titleErr:     titleErr,
+	}
+}
+
+// PublishEvents makes the service publish to hub the todos it creates,
+// updates and deletes one at a time, and one event for each bulk change
+func (s *TodoService) PublishEvents(hub *events.Hub) {
+	s.events = hub
+}
+
+// publish sends an event of type eventType for the todo id, owned by the
+// user in ctx. todo is nil for deletions.
+func (s *TodoService) publish(ctx context.Context, eventType string, id int, todo *model.Todo) {
+	ownerID, _ := owner.FromContext(ctx)
+	s.events.Publish(events.Event{Type: eventType, OwnerID: ownerID, TodoID: id, Todo: todo})
+}
+
+// publishBulk sends a TodosChanged event for a bulk operation that changed
+// count todos of the user in ctx. Nothing is sent when none changed.
+func (s *TodoService) publishBulk(ctx context.Context, operation string, count int64) {
+	if count == 0 {
+		return
 	}
+	ownerID, _ := owner.FromContext(ctx)
+	s.events.Publish(events.Event{Type: events.TodosChanged, OwnerID: ownerID, Operation: operation, Count: count})
 }
 
 // CreateTodo creates a new todo
 func (s *TodoService) CreateTodo(ctx context.Context, req dto.CreateTodoRequest) (*model.Todo, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.CreateTodo")
+	defer span.End()
+
+	req, err := s.cleanCreate(req)
+	if err != nil {
+		return nil, err
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		return nil, unprocessable(fields)
+	}
+	if req.Priority == "" {
+		req.Priority = model.PriorityMedium
+	}
+
 	s.logger.Debug("creating todo", "title", req.Title)
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Create)
+	defer cancel()
 	todo, err := s.repo.Create(ctx, req)
 	if err != nil {
 		s.logger.Error("failed to create todo", "error", err)
-		return nil, err
+		recordError(span, err)
+		return nil, translateError(err)
 	}
 	s.logger.Info("todo created", "id", todo.ID, "title", todo.Title)
+	s.publish(ctx, events.TodoCreated, todo.ID, todo)
 	return todo, nil
 }
 
 // GetTodo retrieves a todo by ID
 func (s *TodoService) GetTodo(ctx context.Context, id int) (*model.Todo, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.GetTodo")
+	defer span.End()
+
 	s.logger.Debug("getting todo", "id", id)
 	todo, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		s.logger.Error("failed to get todo", "id", id, "error", err)
-		return nil, err
+		recordError(span, err)
+		return nil, translateError(err)
 	}
 	return todo, nil
 }
 
-// ListTodos retrieves a paginated list of todos
-func (s *TodoService) ListTodos(ctx context.Context, page, pageSize int, completed *bool) ([]model.Todo, int, error) {
+// GetTodos retrieves the todos with the given IDs in the order of ids,
+// leaving out the missing ones. More IDs than limits.max_batch_size are
+// rejected.
+func (s *TodoService) GetTodos(ctx context.Context, ids []int) ([]model.Todo, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.GetTodos")
+	defer span.End()
+
+	if limit := s.limits.MaxBatchSize; limit > 0 && len(ids) > limit {
+		return nil, limitError("batch size", len(ids), limit)
+	}
+
+	s.logger.Debug("getting todos", "ids", ids)
+	todos, err := s.repo.GetByIDs(ctx, ids)
+	if err != nil {
+		s.logger.Error("failed to get todos", "error", err)
+		recordError(span, err)
+		return nil, translateError(err)
+	}
+	return todos, nil
+}
+
+// TodoExists reports whether a todo with the given ID exists
+func (s *TodoService) TodoExists(ctx context.Context, id int) (bool, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.TodoExists")
+	defer span.End()
+
+	s.logger.Debug("checking todo existence", "id", id)
+	exists, err := s.repo.Exists(ctx, id)
+	if err != nil {
+		s.logger.Error("failed to check todo existence", "id", id, "error", err)
+		recordError(span, err)
+		return false, translateError(err)
+	}
+	return exists, nil
+}
+
+// ListTodos retrieves a paginated list of todos matching filter. Missing or invalid page
+// sizes get the configured default and larger ones are clamped to the
+// configured maximum. When a list byte budget is configured, the page size
+// is reduced further so the estimated response fits it, estimated from
+// the average todo size of the owner measured at most a minute ago.
+func (s *TodoService) ListTodos(ctx context.Context, page, pageSize int, filter repository.ListFilter) (*TodoPage, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.ListTodos")
+	defer span.End()
+
+	page, pageSize = normalizePagination(page, pageSize, s.pagination.DefaultPageSize, s.limits.MaxPageSize)
+
 	s.logger.Debug("listing todos", "page", page, "pageSize", pageSize)
 
-	todos, total, err := s.repo.List(ctx, page, pageSize, completed)
+	reduced := false
+	if s.cfg.ListByteBudget > 0 {
+		avgRowSize, err := s.rowSizes.get(ctx, s.repo.AverageRowSize)
+		if err != nil {
+			s.logger.Error("failed to estimate todo size", "error", err)
+			recordError(span, err)
+			return nil, translateError(err)
+		}
+		if limited, ok := limitPageSize(pageSize, avgRowSize, s.cfg.ListByteBudget); ok {
+			s.logger.Warn("page size reduced to fit list byte budget",
+				"requested", pageSize,
+				"effective", limited,
+				"avg_row_size", avgRowSize)
+			pageSize = limited
+			reduced = true
+		}
+	}
+
+	todos, total, err := s.repo.List(ctx, page, pageSize, filter)
 	if err != nil {
 		s.logger.Error("failed to list todos", "error", err)
-		return nil, 0, err
+		recordError(span, err)
+		return nil, translateError(err)
 	}
 
-	return todos, total, nil
+	return &TodoPage{
+		Todos:           todos,
+		Total:           total,
+		Page:            page,
+		PageSize:        pageSize,
+		PageSizeReduced: reduced,
+	}, nil
 }
 
-// UpdateTodo updates a todo
-func (s *TodoService) UpdateTodo(ctx context.Context, id int, req dto.UpdateTodoRequest) (*model.Todo, error) {
+// CountTodos returns the number of todos matching filter
+func (s *TodoService) CountTodos(ctx context.Context, filter repository.ListFilter) (int, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.CountTodos")
+	defer span.End()
+
+	s.logger.Debug("counting todos")
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to count todos", "error", err)
+		recordError(span, err)
+		return 0, translateError(err)
+	}
+	return total, nil
+}
+
+// ExportTodos calls fn with every todo matching filter, without pagination,
+// stopping at the first error fn returns
+func (s *TodoService) ExportTodos(ctx context.Context, filter repository.ListFilter, fn func(model.Todo) error) error {
+	ctx, span := tracer.Start(ctx, "TodoService.ExportTodos")
+	defer span.End()
+
+	s.logger.Debug("exporting todos")
+	if err := s.repo.Each(ctx, filter, fn); err != nil {
+		s.logger.Error("failed to export todos", "error", err)
+		recordError(span, err)
+		return translateError(err)
+	}
+	return nil
+}
+
+// CollectionVersion returns an opaque token that changes whenever a todo
+// is created, updated or deleted. It is derived from the number of todos
+// and the latest update time, so it is cheap to compute but weak: it only
+// tells clients that something may have changed.
+func (s *TodoService) CollectionVersion(ctx context.Context) (string, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.CollectionVersion")
+	defer span.End()
+
+	count, lastUpdated, err := s.repo.Version(ctx)
+	if err != nil {
+		s.logger.Error("failed to get todos version", "error", err)
+		recordError(span, err)
+		return "", translateError(err)
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d-%d", count, lastUpdated.UnixNano())
+	return strconv.FormatUint(h.Sum64(), 16), nil
+}
+
+// CompleteAll marks every todo that is not completed yet as completed and
+// returns how many were updated
+func (s *TodoService) CompleteAll(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.CompleteAll")
+	defer span.End()
+
+	s.logger.Debug("completing all todos")
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.CompleteAll)
+	defer cancel()
+	updated, err := s.repo.MarkAllCompleted(ctx)
+	if err != nil {
+		s.logger.Error("failed to complete todos", "error", err)
+		recordError(span, err)
+		return 0, translateError(err)
+	}
+	s.logger.Info("todos completed", "count", updated)
+	s.publishBulk(ctx, events.OperationCompleteAll, updated)
+	return updated, nil
+}
+
+// Location returns the configured time zone todos are presented in
+func (s *TodoService) Location() (*time.Location, error) {
+	return s.cfg.Location()
+}
+
+// WeekdayStats returns how many todos were created on each day of the
+// week, indexed by time.Weekday, along with the configured time zone the
+// days are computed in
+func (s *TodoService) WeekdayStats(ctx context.Context) ([7]int, *time.Location, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.WeekdayStats")
+	defer span.End()
+
+	loc, err := s.cfg.Location()
+	if err != nil {
+		recordError(span, err)
+		return [7]int{}, nil, err
+	}
+
+	counts, err := s.repo.CountByWeekday(ctx, loc)
+	if err != nil {
+		s.logger.Error("failed to count todos by weekday", "error", err)
+		recordError(span, err)
+		return [7]int{}, nil, translateError(err)
+	}
+	return counts, loc, nil
+}
+
+// CompletionTimeStats returns the average time completed todos took from
+// creation to completion and how many were counted, optionally limited to
+// todos completed between from and to
+func (s *TodoService) CompletionTimeStats(ctx context.Context, from, to *time.Time) (time.Duration, int, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.CompletionTimeStats")
+	defer span.End()
+
+	average, count, err := s.repo.AverageCompletionTime(ctx, from, to)
+	if err != nil {
+		s.logger.Error("failed to compute average completion time", "error", err)
+		recordError(span, err)
+		return 0, 0, translateError(err)
+	}
+	return average, count, nil
+}
+
+// UpsertTodo creates the todo with externalID from req, or replaces its
+// fields with those of req when it exists, and reports whether it was
+// created
+func (s *TodoService) UpsertTodo(ctx context.Context, externalID string, req dto.CreateTodoRequest) (*model.Todo, bool, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.UpsertTodo")
+	defer span.End()
+
+	if externalID == "" || len(externalID) > maxExternalIDLength {
+		return nil, false, ErrValidation.wrap(fmt.Errorf("external id must be 1 to %d bytes", maxExternalIDLength))
+	}
+	req, err := s.cleanCreate(req)
+	if err != nil {
+		return nil, false, err
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		return nil, false, unprocessable(fields)
+	}
+	if req.Priority == "" {
+		req.Priority = model.PriorityMedium
+	}
+
+	s.logger.Debug("upserting todo", "external_id", externalID)
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Create)
+	defer cancel()
+	todo, created, err := s.repo.Upsert(ctx, externalID, req)
+	if err != nil {
+		s.logger.Error("failed to upsert todo", "external_id", externalID, "error", err)
+		recordError(span, err)
+		return nil, false, translateError(err)
+	}
+
+	s.logger.Info("todo upserted", "id", todo.ID, "external_id", externalID, "created", created)
+	if created {
+		s.publish(ctx, events.TodoCreated, todo.ID, todo)
+	} else {
+		s.publish(ctx, events.TodoUpdated, todo.ID, todo)
+	}
+	return todo, created, nil
+}
+
+// UpdateTodo updates a todo and returns it along with the JSON names of the
+// fields that changed, empty when the update changed nothing
+func (s *TodoService) UpdateTodo(ctx context.Context, id int, req dto.UpdateTodoRequest) (*model.Todo, []string, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.UpdateTodo")
+	defer span.End()
+
+	req, err := s.cleanUpdate(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		return nil, nil, unprocessable(fields)
+	}
+
 	s.logger.Debug("updating todo", "id", id)
-	todo, err := s.repo.Update(ctx, id, req)
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Update)
+	defer cancel()
+	todo, changed, err := s.repo.Update(ctx, id, req)
 	if err != nil {
 		s.logger.Error("failed to update todo", "id", id, "error", err)
-		return nil, err
+		recordError(span, err)
+		return nil, nil, translateError(err)
+	}
+	s.logger.Info("todo updated", "id", todo.ID, "fields", changed)
+	if len(changed) > 0 {
+		s.publish(ctx, events.TodoUpdated, todo.ID, todo)
+	}
+	return todo, changed, nil
+}
+
+// ArchiveTodo archives a todo, hiding it from lists, and returns it
+func (s *TodoService) ArchiveTodo(ctx context.Context, id int) (*model.Todo, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.ArchiveTodo")
+	defer span.End()
+
+	s.logger.Debug("archiving todo", "id", id)
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Update)
+	defer cancel()
+	todo, changed, err := s.repo.Archive(ctx, id)
+	if err != nil {
+		s.logger.Error("failed to archive todo", "id", id, "error", err)
+		recordError(span, err)
+		return nil, translateError(err)
+	}
+	s.logger.Info("todo archived", "id", id, "changed", changed)
+	if changed {
+		s.publish(ctx, events.TodoUpdated, todo.ID, todo)
+	}
+	return todo, nil
+}
+
+// UnarchiveTodo brings an archived todo back into lists and returns it
+func (s *TodoService) UnarchiveTodo(ctx context.Context, id int) (*model.Todo, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.UnarchiveTodo")
+	defer span.End()
+
+	s.logger.Debug("unarchiving todo", "id", id)
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Update)
+	defer cancel()
+	todo, changed, err := s.repo.Unarchive(ctx, id)
+	if err != nil {
+		s.logger.Error("failed to unarchive todo", "id", id, "error", err)
+		recordError(span, err)
+		return nil, translateError(err)
+	}
+	s.logger.Info("todo unarchived", "id", id, "changed", changed)
+	if changed {
+		s.publish(ctx, events.TodoUpdated, todo.ID, todo)
 	}
-	s.logger.Info("todo updated", "id", todo.ID)
 	return todo, nil
 }
 
+// ReorderTodos moves the todos ids to the top of the manual order, in
+// order. More IDs than limits.max_ids_per_request are rejected.
+func (s *TodoService) ReorderTodos(ctx context.Context, ids []int) error {
+	ctx, span := tracer.Start(ctx, "TodoService.ReorderTodos")
+	defer span.End()
+
+	if limit := s.limits.MaxIDsPerRequest; limit > 0 && len(ids) > limit {
+		return limitError("ids count", len(ids), limit)
+	}
+
+	s.logger.Debug("reordering todos", "ids", ids)
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Update)
+	defer cancel()
+	if err := s.repo.Reorder(ctx, ids); err != nil {
+		s.logger.Error("failed to reorder todos", "error", err)
+		recordError(span, err)
+		return translateError(err)
+	}
+	s.logger.Info("todos reordered", "count", len(ids))
+	s.publishBulk(ctx, events.OperationReorder, int64(len(ids)))
+	return nil
+}
+
 // DeleteTodo deletes a todo
 func (s *TodoService) DeleteTodo(ctx context.Context, id int) error {
+	ctx, span := tracer.Start(ctx, "TodoService.DeleteTodo")
+	defer span.End()
+
 	s.logger.Debug("deleting todo", "id", id)
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Delete)
+	defer cancel()
 	err := s.repo.Delete(ctx, id)
 	if err != nil {
 		s.logger.Error("failed to delete todo", "id", id, "error", err)
-		return err
+		recordError(span, err)
+		return translateError(err)
 	}
 	s.logger.Info("todo deleted", "id", id)
+	s.publish(ctx, events.TodoDeleted, id, nil)
 	return nil
 }
+
+// DeleteTodos deletes the todos with the given IDs and returns how many were
+// deleted. More IDs than limits.max_ids_per_request are rejected.
+func (s *TodoService) DeleteTodos(ctx context.Context, ids []int) (int64, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.DeleteTodos")
+	defer span.End()
+
+	if limit := s.limits.MaxIDsPerRequest; limit > 0 && len(ids) > limit {
+		return 0, limitError("ids count", len(ids), limit)
+	}
+
+	s.logger.Debug("deleting todos", "ids", ids)
+	ctx, cancel := withTimeout(ctx, s.cfg.Timeouts.Delete)
+	defer cancel()
+	deleted, err := s.repo.DeleteMany(ctx, ids)
+	if err != nil {
+		s.logger.Error("failed to delete todos", "error", err)
+		recordError(span, err)
+		return 0, translateError(err)
+	}
+	s.logger.Info("todos deleted", "count", deleted)
+	s.publishBulk(ctx, events.OperationDelete, deleted)
+	return deleted, nil
+}
+
+// DeleteTodosWhere deletes the todos matching the completion filter, or
+// every todo when completed is nil, and returns how many were deleted.
+// With todos.delete_batch_size set, todos are deleted in batches of that
+// size until none match or ctx ends; the count deleted so far is returned
+// along with any error.
+func (s *TodoService) DeleteTodosWhere(ctx context.Context, completed *bool) (int64, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.DeleteTodosWhere")
+	defer span.End()
+
+	batchSize := s.cfg.DeleteBatchSize
+	s.logger.Debug("deleting todos by filter", "all", completed == nil, "batch_size", batchSize)
+
+	// Todos deleted by earlier batches stay deleted when a later one fails
+	var total int64
+	defer func() { s.publishBulk(ctx, events.OperationDelete, total) }()
+	for {
+		batchCtx, cancel := withTimeout(ctx, s.cfg.Timeouts.Delete)
+		deleted, err := s.repo.DeleteWhere(batchCtx, completed, batchSize)
+		cancel()
+		total += deleted
+		if err != nil {
+			s.logger.Error("failed to delete todos", "deleted", total, "error", err)
+			recordError(span, err)
+			return total, translateError(err)
+		}
+		if batchSize < 1 || deleted < int64(batchSize) {
+			break
+		}
+
+		s.logger.Debug("todo batch deleted", "deleted", total)
+		if err := ctx.Err(); err != nil {
+			s.logger.Warn("todo deletion interrupted", "deleted", total, "error", err)
+			recordError(span, err)
+			return total, err
+		}
+	}
+	s.logger.Info("todos deleted", "count", total)
+	return total, nil
+}
+
+// PreviewDeleteTodos returns how many todos DeleteTodos would delete,
+// without deleting any
+func (s *TodoService) PreviewDeleteTodos(ctx context.Context, ids []int) (int64, error) {
+	if limit := s.limits.MaxIDsPerRequest; limit > 0 && len(ids) > limit {
+		return 0, limitError("ids count", len(ids), limit)
+	}
+	return s.countAffected(ctx, "TodoService.PreviewDeleteTodos", repository.DeleteManyFilter(ids))
+}
+
+// PreviewDeleteTodosWhere returns how many todos DeleteTodosWhere would
+// delete, without deleting any
+func (s *TodoService) PreviewDeleteTodosWhere(ctx context.Context, completed *bool) (int64, error) {
+	return s.countAffected(ctx, "TodoService.PreviewDeleteTodosWhere", repository.DeleteWhereFilter(completed))
+}
+
+// PreviewCompleteAll returns how many todos CompleteAll would complete,
+// without completing any
+func (s *TodoService) PreviewCompleteAll(ctx context.Context) (int64, error) {
+	return s.countAffected(ctx, "TodoService.PreviewCompleteAll", repository.MarkAllCompletedFilter())
+}
+
+// countAffected counts the todos a bulk operation selecting them with
+// filter would change
+func (s *TodoService) countAffected(ctx context.Context, name string, filter repository.ListFilter) (int64, error) {
+	ctx, span := tracer.Start(ctx, name)
+	defer span.End()
+
+	count, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to count affected todos", "error", err)
+		recordError(span, err)
+		return 0, translateError(err)
+	}
+	s.logger.Info("bulk operation previewed", "operation", name, "count", count)
+	return int64(count), nil
+}
+
+// normalizePagination replaces page numbers below 1 with the first page
+// and applies the default and maximum page sizes
+func normalizePagination(page, pageSize, defaultSize, maxSize int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultSize
+	}
+	if maxSize > 0 && pageSize > maxSize {
+		pageSize = maxSize
+	}
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	return page, pageSize
+}
+
+// limitPageSize returns the largest page size whose estimated response size
+// fits within budget, and whether it is smaller than the requested one.
+// At least one row is always allowed.
+func limitPageSize(pageSize int, avgRowSize, budget int64) (int, bool) {
+	rowSize := avgRowSize + estimatedRowOverhead
+	if int64(pageSize)*rowSize <= budget {
+		return pageSize, false
+	}
+
+	limited := int(budget / rowSize)
+	if limited < 1 {
+		limited = 1
+	}
+	return limited, limited < pageSize
+}
+
+// withTimeout bounds ctx by timeout, the configured timeout of an
+// operation, returning ctx unchanged when it is not positive
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// recordError marks span as failed with err
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
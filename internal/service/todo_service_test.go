@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/g3offrey/idiomapi/internal/audit"
+	"github.com/g3offrey/idiomapi/internal/config"
+	"github.com/g3offrey/idiomapi/internal/dto"
+	"github.com/g3offrey/idiomapi/internal/events"
+	"github.com/g3offrey/idiomapi/internal/owner"
+	"github.com/g3offrey/idiomapi/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitPageSize(t *testing.T) {
+	tests := []struct {
+		name            string
+		pageSize        int
+		avgRowSize      int64
+		budget          int64
+		expectedSize    int
+		expectedReduced bool
+	}{
+		{
+			name:            "small rows fit the budget",
+			pageSize:        100,
+			avgRowSize:      200,
+			budget:          1 << 20,
+			expectedSize:    100,
+			expectedReduced: false,
+		},
+		{
+			name:            "large rows reduce the page size",
+			pageSize:        100,
+			avgRowSize:      64*1024 - estimatedRowOverhead,
+			budget:          1 << 20,
+			expectedSize:    16,
+			expectedReduced: true,
+		},
+		{
+			name:            "rows larger than the budget still return one",
+			pageSize:        10,
+			avgRowSize:      4 << 20,
+			budget:          1 << 20,
+			expectedSize:    1,
+			expectedReduced: true,
+		},
+		{
+			name:            "single row is never reported as reduced",
+			pageSize:        1,
+			avgRowSize:      4 << 20,
+			budget:          1 << 20,
+			expectedSize:    1,
+			expectedReduced: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, reduced := limitPageSize(tt.pageSize, tt.avgRowSize, tt.budget)
+			assert.Equal(t, tt.expectedSize, size)
+			assert.Equal(t, tt.expectedReduced, reduced)
+		})
+	}
+}
+
+func TestNormalizePagination(t *testing.T) {
+
+	tests := []struct {
+		name             string
+		page             int
+		pageSize         int
+		expectedPage     int
+		expectedPageSize int
+	}{
+		{name: "valid values are kept", page: 2, pageSize: 30, expectedPage: 2, expectedPageSize: 30},
+		{name: "missing page size uses the default", page: 1, pageSize: 0, expectedPage: 1, expectedPageSize: 20},
+		{name: "negative page size uses the default", page: 1, pageSize: -5, expectedPage: 1, expectedPageSize: 20},
+		{name: "page below 1 becomes the first page", page: 0, pageSize: 10, expectedPage: 1, expectedPageSize: 10},
+		{name: "negative page becomes the first page", page: -3, pageSize: 10, expectedPage: 1, expectedPageSize: 10},
+		{name: "page size at the max is kept", page: 1, pageSize: 50, expectedPage: 1, expectedPageSize: 50},
+		{name: "page size above the max is clamped", page: 1, pageSize: 51, expectedPage: 1, expectedPageSize: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, pageSize := normalizePagination(tt.page, tt.pageSize, 20, 50)
+			assert.Equal(t, tt.expectedPage, page)
+			assert.Equal(t, tt.expectedPageSize, pageSize)
+		})
+	}
+}
+
+func TestListTodosClampsPageSize(t *testing.T) {
+	ctx := owner.NewContext(context.Background(), "alice")
+	repo := repository.NewInMemoryTodoRepository()
+	for range 8 {
+		_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "todo"})
+		require.NoError(t, err)
+	}
+
+	svc := NewTodoService(repo, config.TodosConfig{}, config.PaginationConfig{DefaultPageSize: 3}, config.LimitsConfig{MaxPageSize: 5}, slog.New(slog.DiscardHandler))
+
+	result, err := svc.ListTodos(ctx, 1, 500, repository.ListFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.PageSize)
+	assert.Len(t, result.Todos, 5)
+	assert.Equal(t, 8, result.Total)
+
+	result, err = svc.ListTodos(ctx, 1, 0, repository.ListFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.PageSize)
+	assert.Len(t, result.Todos, 3)
+}
+
+// sizeCountingRepository is a TodoRepository counting its AverageRowSize
+// calls
+type sizeCountingRepository struct {
+	*repository.InMemoryTodoRepository
+	estimates int
+}
+
+func (r *sizeCountingRepository) AverageRowSize(ctx context.Context) (int64, error) {
+	r.estimates++
+	return r.InMemoryTodoRepository.AverageRowSize(ctx)
+}
+
+func TestListTodosCachesRowSize(t *testing.T) {
+	repo := &sizeCountingRepository{InMemoryTodoRepository: repository.NewInMemoryTodoRepository()}
+	svc := NewTodoService(repo, config.TodosConfig{ListByteBudget: 1 << 20}, config.PaginationConfig{}, config.LimitsConfig{}, slog.New(slog.DiscardHandler))
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	svc.rowSizes.now = func() time.Time { return now }
+
+	alice := owner.NewContext(context.Background(), "alice")
+	bob := owner.NewContext(context.Background(), "bob")
+	list := func(ctx context.Context) {
+		_, err := svc.ListTodos(ctx, 1, 10, repository.ListFilter{})
+		require.NoError(t, err)
+	}
+
+	list(alice)
+	list(alice)
+	assert.Equal(t, 1, repo.estimates, "the estimate is reused")
+
+	list(bob)
+	assert.Equal(t, 2, repo.estimates, "each owner has its own estimate")
+
+	now = now.Add(rowSizeTTL)
+	list(alice)
+	assert.Equal(t, 3, repo.estimates, "an expired estimate is measured again")
+}
+
+// countCountingRepository is a TodoRepository counting its Count calls
+type countCountingRepository struct {
+	*repository.InMemoryTodoRepository
+	counts int
+}
+
+func (r *countCountingRepository) Count(ctx context.Context, filter repository.ListFilter) (int, error) {
+	r.counts++
+	return r.InMemoryTodoRepository.Count(ctx, filter)
+}
+
+func TestListTodosPastLastPage(t *testing.T) {
+	ctx := owner.NewContext(context.Background(), "alice")
+	repo := &countCountingRepository{InMemoryTodoRepository: repository.NewInMemoryTodoRepository()}
+	for range 5 {
+		_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "todo"})
+		require.NoError(t, err)
+	}
+
+	svc := NewTodoService(repo, config.TodosConfig{}, config.PaginationConfig{DefaultPageSize: 2}, config.LimitsConfig{}, slog.New(slog.DiscardHandler))
+
+	result, err := svc.ListTodos(ctx, 999999999, 0, repository.ListFilter{})
+	require.NoError(t, err)
+	assert.NotNil(t, result.Todos)
+	assert.Empty(t, result.Todos)
+	assert.Equal(t, 5, result.Total)
+	assert.Equal(t, 999999999, result.Page)
+
+	result, err = svc.ListTodos(ctx, 3, 0, repository.ListFilter{})
+	require.NoError(t, err)
+	assert.Len(t, result.Todos, 1)
+
+	result, err = svc.ListTodos(ctx, -1, 0, repository.ListFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Page)
+	assert.Len(t, result.Todos, 2)
+
+	// List counts the todos itself, so they are counted once per page
+	assert.Zero(t, repo.counts)
+}
+
+func TestDeleteTodosWhereInBatches(t *testing.T) {
+	ctx := owner.NewContext(context.Background(), "alice")
+	repo := repository.NewInMemoryTodoRepository()
+	for i := range 7 {
+		_, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "todo", Completed: i < 5})
+		require.NoError(t, err)
+	}
+
+	svc := NewTodoService(repo, config.TodosConfig{DeleteBatchSize: 2}, config.PaginationConfig{}, config.LimitsConfig{}, slog.New(slog.DiscardHandler))
+
+	completed := true
+	deleted, err := svc.DeleteTodosWhere(ctx, &completed)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), deleted)
+
+	_, total, err := repo.List(ctx, 1, 10, repository.ListFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+}
+
+func TestDeleteTodosWhereStopsWhenContextEnds(t *testing.T) {
+	repo := repository.NewInMemoryTodoRepository()
+	for range 5 {
+		_, err := repo.Create(owner.NewContext(context.Background(), "alice"), dto.CreateTodoRequest{Title: "todo"})
+		require.NoError(t, err)
+	}
+
+	svc := NewTodoService(repo, config.TodosConfig{DeleteBatchSize: 2}, config.PaginationConfig{}, config.LimitsConfig{}, slog.New(slog.DiscardHandler))
+
+	ctx, cancel := context.WithCancel(owner.NewContext(context.Background(), "alice"))
+	cancel()
+
+	deleted, err := svc.DeleteTodosWhere(ctx, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int64(2), deleted)
+}
+
+func TestBulkOperationsPublishEvents(t *testing.T) {
+	ctx := owner.NewContext(context.Background(), "alice")
+	repo := repository.NewInMemoryTodoRepository()
+	var ids []int
+	for range 4 {
+		todo, err := repo.Create(ctx, dto.CreateTodoRequest{Title: "todo"})
+		require.NoError(t, err)
+		ids = append(ids, todo.ID)
+	}
+
+	hub := events.NewHub(8)
+	stream, unsubscribe := hub.Subscribe("alice")
+	defer unsubscribe()
+	svc := NewTodoService(repo, config.TodosConfig{}, config.PaginationConfig{}, config.LimitsConfig{}, slog.New(slog.DiscardHandler))
+	svc.PublishEvents(hub)
+
+	bulk := func(operation string, count int64) events.Event {
+		return events.Event{Type: events.TodosChanged, OwnerID: "alice", Operation: operation, Count: count}
+	}
+
+	require.NoError(t, svc.ReorderTodos(ctx, []int{ids[2], ids[0]}))
+	assert.Equal(t, bulk(events.OperationReorder, 2), <-stream)
+
+	_, err := svc.CompleteAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, bulk(events.OperationCompleteAll, 4), <-stream)
+
+	_, err = svc.CompleteAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, stream, "a bulk operation changing nothing is not published")
+
+	_, err = svc.DeleteTodos(ctx, []int{ids[0], 999})
+	require.NoError(t, err)
+	assert.Equal(t, bulk(events.OperationDelete, 1), <-stream)
+
+	_, err = svc.DeleteTodosWhere(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, bulk(events.OperationDelete, 3), <-stream)
+	assert.Empty(t, stream)
+}
+
+// blockingRepository is a TodoRepository whose MarkAllCompleted runs until
+// its context ends, like a query pgx cancels
+type blockingRepository struct {
+	*repository.InMemoryTodoRepository
+}
+
+func (r blockingRepository) MarkAllCompleted(ctx context.Context) (int64, error) {
+	<-ctx.Done()
+	return 0, fmt.Errorf("failed to complete todos: %w", ctx.Err())
+}
+
+func TestCompleteAllTimeout(t *testing.T) {
+	repo := blockingRepository{repository.NewInMemoryTodoRepository()}
+	cfg := config.TodosConfig{Timeouts: config.TimeoutsConfig{CompleteAll: 10 * time.Millisecond}}
+	svc := NewTodoService(repo, cfg, config.PaginationConfig{}, config.LimitsConfig{}, slog.New(slog.DiscardHandler))
+
+	_, err := svc.CompleteAll(context.Background())
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRecordAudit(t *testing.T) {
+	ctx := owner.NewContext(audit.NewContext(context.Background(), "192.0.2.1"), "alice")
+	repo := repository.NewInMemoryTodoRepository()
+	store := audit.NewInMemoryStore()
+	repo.RecordAudit(audit.NewLog(store))
+	svc := NewTodoService(repo, config.TodosConfig{}, config.PaginationConfig{}, config.LimitsConfig{}, slog.New(slog.DiscardHandler))
+
+	todo, err := svc.CreateTodo(ctx, dto.CreateTodoRequest{Title: "write report"})
+	require.NoError(t, err)
+	title := "write the report"
+	_, _, err = svc.UpdateTodo(ctx, todo.ID, dto.UpdateTodoRequest{Title: &title})
+	require.NoError(t, err)
+	_, _, err = svc.UpdateTodo(ctx, todo.ID, dto.UpdateTodoRequest{Title: &title})
+	require.NoError(t, err)
+	require.NoError(t, svc.DeleteTodo(ctx, todo.ID))
+
+	events, err := store.List(ctx, audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 3, "the update changing nothing is not recorded")
+
+	id := strconv.Itoa(todo.ID)
+	assert.Equal(t, "create", events[0].Action)
+	assert.Nil(t, events[0].Before)
+	assert.Contains(t, string(events[0].After), `"write report"`)
+
+	assert.Equal(t, "update", events[1].Action)
+	assert.Equal(t, id, events[1].EntityID)
+	assert.Contains(t, string(events[1].Before), `"write report"`)
+	assert.Contains(t, string(events[1].After), `"write the report"`)
+
+	assert.Equal(t, "delete", events[2].Action)
+	assert.Contains(t, string(events[2].Before), `"write the report"`)
+	assert.Nil(t, events[2].After)
+
+	for _, e := range events {
+		assert.Equal(t, "alice", e.Actor)
+		assert.Equal(t, "todo", e.Entity)
+		assert.Equal(t, "192.0.2.1", e.IP)
+	}
+}
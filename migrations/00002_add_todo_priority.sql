@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE todos
+    ADD COLUMN priority VARCHAR(10) NOT NULL DEFAULT 'medium'
+    CHECK (priority IN ('low', 'medium', 'high'));
+
+-- Create index on priority for filtering
+CREATE INDEX idx_todos_priority ON todos(priority);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_todos_priority;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS priority;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Todos created before owners existed belong to no user
+ALTER TABLE todos ADD COLUMN owner_id VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Create index on owner_id for scoping every query
+CREATE INDEX idx_todos_owner_id ON todos(owner_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_todos_owner_id;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS owner_id;
+-- +goose StatementEnd
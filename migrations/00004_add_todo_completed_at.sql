@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Todos completed before completion times were recorded count as completed
+-- when they were last updated
+ALTER TABLE todos ADD COLUMN completed_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE todos DISABLE TRIGGER update_todos_updated_at;
+UPDATE todos SET completed_at = updated_at WHERE completed;
+ALTER TABLE todos ENABLE TRIGGER update_todos_updated_at;
+
+-- Create index on completed_at for completion time statistics
+CREATE INDEX idx_todos_completed_at ON todos(completed_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_todos_completed_at;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS completed_at;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Create the outbox of todo events, written in the transaction changing
+-- the todo and published asynchronously
+CREATE TABLE IF NOT EXISTS todo_events (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    todo_id INTEGER NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create partial index on the events still to publish
+CREATE INDEX idx_todo_events_unpublished ON todo_events(id) WHERE published_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_todo_events_unpublished;
+
+DROP TABLE IF EXISTS todo_events;
+-- +goose StatementEnd
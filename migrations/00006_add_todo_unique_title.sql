@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Todos created while todos.unique_titles is on must have a title unique
+-- among them for their owner
+ALTER TABLE todos ADD COLUMN unique_title BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX idx_todos_unique_title ON todos(owner_id, title) WHERE unique_title;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_todos_unique_title;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS unique_title;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Todos synced from an external system are identified by its ID, unique
+-- per owner
+ALTER TABLE todos ADD COLUMN external_id VARCHAR(255);
+
+CREATE UNIQUE INDEX idx_todos_external_id ON todos(owner_id, external_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_todos_external_id;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS external_id;
+-- +goose StatementEnd
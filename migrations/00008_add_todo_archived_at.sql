@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Archived todos are hidden from lists unless asked for, without being
+-- deleted
+ALTER TABLE todos ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE todos DROP COLUMN IF EXISTS archived_at;
+-- +goose StatementEnd
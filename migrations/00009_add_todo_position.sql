@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Todos are ordered manually by position, per owner. Existing todos keep
+-- the order they were created in.
+ALTER TABLE todos ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE todos DISABLE TRIGGER update_todos_updated_at;
+UPDATE todos SET position = ranked.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY owner_id ORDER BY created_at, id) AS position
+    FROM todos
+) ranked
+WHERE todos.id = ranked.id;
+ALTER TABLE todos ENABLE TRIGGER update_todos_updated_at;
+
+-- Create index on owner_id and position for manual ordering
+CREATE INDEX idx_todos_owner_position ON todos(owner_id, position);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_todos_owner_position;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS position;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Descriptions are limited like the API limits them, to
+-- model.MaxDescriptionLength characters. Titles already are, by their type.
+ALTER TABLE todos ADD CONSTRAINT todos_description_length CHECK (char_length(description) <= 1000);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS todos_description_length;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Create sessions table for refresh tokens. Session IDs are random, so
+-- they cannot be guessed. Each refresh replaces the token hash of the
+-- session, so only the latest token of a session works, and keeps the
+-- previous hash to tell a replayed token from a wrong one.
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash BYTEA NOT NULL,
+    previous_token_hash BYTEA,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sessions;
+-- +goose StatementEnd
@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Create audit_events table, the trail of every change. Each hash covers
+-- the event and the hash before it; before and after are JSON rather than
+-- JSONB to keep the exact bytes that were hashed.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    entity VARCHAR(64) NOT NULL,
+    entity_id VARCHAR(255) NOT NULL,
+    before JSON,
+    after JSON,
+    ip VARCHAR(45) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    prev_hash BYTEA,
+    hash BYTEA NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor);
+CREATE INDEX IF NOT EXISTS idx_audit_events_entity ON audit_events(entity, entity_id);
+
+-- The trail is append-only
+CREATE OR REPLACE FUNCTION reject_audit_event_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION reject_audit_event_change();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION reject_audit_event_change();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS audit_events;
+DROP FUNCTION IF EXISTS reject_audit_event_change();
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Create partial index on the published events, deleted once old enough
+CREATE INDEX IF NOT EXISTS idx_todo_events_published ON todo_events(published_at) WHERE published_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_todo_events_published;
+-- +goose StatementEnd
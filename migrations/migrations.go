@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL schema migrations applied by goose.
+package migrations
+
+import "embed"
+
+// FS holds the SQL migration files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,52 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// HTTPServer is a Component serving srv, over TLS when certFile and
+// keyFile are set or srv.TLSConfig provides the certificates
+type HTTPServer struct {
+	srv      *http.Server
+	certFile string
+	keyFile  string
+	onError  func(error)
+}
+
+// NewHTTPServer creates an HTTPServer for srv. onError is called when srv
+// stops serving for any other reason than Stop.
+func NewHTTPServer(srv *http.Server, certFile, keyFile string, onError func(error)) *HTTPServer {
+	return &HTTPServer{srv: srv, certFile: certFile, keyFile: keyFile, onError: onError}
+}
+
+// Start listens on the address of the server, so a port already in use is
+// reported right away, and serves in the background
+func (s *HTTPServer) Start(ctx context.Context) error {
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		var err error
+		if s.certFile != "" && s.keyFile != "" || s.srv.TLSConfig != nil {
+			err = s.srv.ServeTLS(ln, s.certFile, s.keyFile)
+		} else {
+			err = s.srv.Serve(ln)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			s.onError(err)
+		}
+	}()
+	return nil
+}
+
+// Stop gracefully shuts the server down, waiting for active requests
+// until ctx ends
+func (s *HTTPServer) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
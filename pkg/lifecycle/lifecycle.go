@@ -0,0 +1,108 @@
+// Package lifecycle starts the components of the application in order and
+// stops them in reverse order on shutdown.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Component is a part of the application with a lifetime: a server, a
+// background worker or a resource to release
+type Component interface {
+	// Start starts the component without blocking
+	Start(ctx context.Context) error
+
+	// Stop stops the component, waiting for its background work to end
+	// until ctx ends
+	Stop(ctx context.Context) error
+}
+
+// Hook is a Component made of functions; nil ones do nothing
+type Hook struct {
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Start calls OnStart
+func (h Hook) Start(ctx context.Context) error {
+	if h.OnStart == nil {
+		return nil
+	}
+	return h.OnStart(ctx)
+}
+
+// Stop calls OnStop
+func (h Hook) Stop(ctx context.Context) error {
+	if h.OnStop == nil {
+		return nil
+	}
+	return h.OnStop(ctx)
+}
+
+// named is a Component added to a Group
+type named struct {
+	name      string
+	component Component
+}
+
+// Group starts components in the order they were added and stops them in
+// reverse order, so a component can rely on the ones added before it for
+// its whole lifetime
+type Group struct {
+	components []named
+	logger     *slog.Logger
+}
+
+// New creates an empty Group logging to logger
+func New(logger *slog.Logger) *Group {
+	return &Group{logger: logger}
+}
+
+// Add appends c, identified by name in logs and errors
+func (g *Group) Add(name string, c Component) {
+	g.components = append(g.components, named{name: name, component: c})
+}
+
+// Run starts every component, waits until ctx ends, and then stops the
+// started components, giving them timeout altogether. When a component
+// fails to start, the ones started before it are stopped and its error is
+// returned. Otherwise the errors of the components failing to stop are
+// returned joined.
+func (g *Group) Run(ctx context.Context, timeout time.Duration) error {
+	started := 0
+	var startErr error
+	for _, n := range g.components {
+		if err := n.component.Start(ctx); err != nil {
+			startErr = fmt.Errorf("failed to start %s: %w", n.name, err)
+			break
+		}
+		started++
+	}
+
+	if startErr == nil {
+		<-ctx.Done()
+	}
+
+	// Stop even when ctx is done, within a deadline of its own
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var stopErrs []error
+	for i := started - 1; i >= 0; i-- {
+		n := g.components[i]
+		g.logger.Info("stopping component", "component", n.name)
+		if err := n.component.Stop(stopCtx); err != nil {
+			g.logger.Error("failed to stop component", "component", n.name, "error", err)
+			stopErrs = append(stopErrs, fmt.Errorf("failed to stop %s: %w", n.name, err))
+		}
+	}
+
+	if startErr != nil {
+		return startErr
+	}
+	return errors.Join(stopErrs...)
+}
@@ -0,0 +1,128 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder returns a Hook appending "start name" and "stop name" to events
+func recorder(events *[]string, name string, startErr error) Hook {
+	return Hook{
+		OnStart: func(context.Context) error {
+			*events = append(*events, "start "+name)
+			return startErr
+		},
+		OnStop: func(context.Context) error {
+			*events = append(*events, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestGroup_Run(t *testing.T) {
+	t.Run("stops in reverse order", func(t *testing.T) {
+		var events []string
+		g := New(discardLogger())
+		g.Add("database", recorder(&events, "database", nil))
+		g.Add("worker", recorder(&events, "worker", nil))
+		g.Add("http", recorder(&events, "http", nil))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		require.NoError(t, g.Run(ctx, time.Second))
+		assert.Equal(t, []string{
+			"start database", "start worker", "start http",
+			"stop http", "stop worker", "stop database",
+		}, events)
+	})
+
+	t.Run("start failure stops started components", func(t *testing.T) {
+		var events []string
+		g := New(discardLogger())
+		g.Add("database", recorder(&events, "database", nil))
+		g.Add("worker", recorder(&events, "worker", errors.New("boom")))
+		g.Add("http", recorder(&events, "http", nil))
+
+		err := g.Run(context.Background(), time.Second)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to start worker")
+		assert.Equal(t, []string{"start database", "start worker", "stop database"}, events)
+	})
+
+	t.Run("stop errors are joined", func(t *testing.T) {
+		g := New(discardLogger())
+		g.Add("first", Hook{OnStop: func(context.Context) error { return errors.New("first failed") }})
+		g.Add("second", Hook{OnStop: func(context.Context) error { return errors.New("second failed") }})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := g.Run(ctx, time.Second)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to stop first")
+		assert.Contains(t, err.Error(), "failed to stop second")
+	})
+
+	t.Run("stop is bounded by the timeout", func(t *testing.T) {
+		g := New(discardLogger())
+		g.Add("slow", Hook{OnStop: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := g.Run(ctx, 10*time.Millisecond)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestHTTPServer(t *testing.T) {
+	// Reserve a free port, released for the server to listen on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	srv := &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}
+	s := NewHTTPServer(srv, "", "", func(err error) {
+		t.Errorf("unexpected serve error: %v", err)
+	})
+	require.NoError(t, s.Start(context.Background()))
+
+	resp, err := http.Get("http://" + addr)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// A port already in use is reported by Start
+	busy := NewHTTPServer(&http.Server{Addr: addr}, "", "", func(error) {})
+	assert.Error(t, busy.Start(context.Background()))
+
+	require.NoError(t, s.Stop(context.Background()))
+	_, err = http.Get("http://" + addr)
+	assert.Error(t, err)
+}
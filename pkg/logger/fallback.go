@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// FallbackHandler is a slog.Handler that passes records to a primary
+// handler and, when it fails to write them, to a fallback handler instead.
+// Panics raised while writing, such as those from a broken writer, are
+// recovered so logging never takes the application down.
+type FallbackHandler struct {
+	primary  slog.Handler
+	fallback slog.Handler
+}
+
+// NewFallbackHandler wraps primary so records it fails to write go to
+// fallback. With a nil fallback those records are dropped.
+func NewFallbackHandler(primary, fallback slog.Handler) *FallbackHandler {
+	return &FallbackHandler{primary: primary, fallback: fallback}
+}
+
+// Enabled reports whether the primary handler handles records at level
+func (h *FallbackHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.primary.Enabled(ctx, level)
+}
+
+// Handle writes r with the primary handler, then with the fallback one if
+// that failed. It returns an error only when no handler wrote r.
+func (h *FallbackHandler) Handle(ctx context.Context, r slog.Record) error {
+	err := safeHandle(ctx, h.primary, r)
+	if err == nil || h.fallback == nil {
+		return err
+	}
+	if fallbackErr := safeHandle(ctx, h.fallback, r); fallbackErr != nil {
+		return fmt.Errorf("%w; fallback: %w", err, fallbackErr)
+	}
+	return nil
+}
+
+// WithAttrs returns a FallbackHandler whose handlers both include attrs
+func (h *FallbackHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	wrapped := &FallbackHandler{primary: h.primary.WithAttrs(attrs)}
+	if h.fallback != nil {
+		wrapped.fallback = h.fallback.WithAttrs(attrs)
+	}
+	return wrapped
+}
+
+// WithGroup returns a FallbackHandler whose handlers both open the group
+func (h *FallbackHandler) WithGroup(name string) slog.Handler {
+	wrapped := &FallbackHandler{primary: h.primary.WithGroup(name)}
+	if h.fallback != nil {
+		wrapped.fallback = h.fallback.WithGroup(name)
+	}
+	return wrapped
+}
+
+// safeHandle passes r to handler, turning a panic into an error
+func safeHandle(ctx context.Context, handler slog.Handler, r slog.Record) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("log handler panicked: %v", recovered)
+		}
+	}()
+	return handler.Handle(ctx, r)
+}
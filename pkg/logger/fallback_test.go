@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/g3offrey/idiomapi/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingWriter fails every write, panicking instead when panics is set
+type failingWriter struct {
+	panics bool
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	if w.panics {
+		panic("broken output")
+	}
+	return 0, errors.New("broken output")
+}
+
+func TestFallbackHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		output failingWriter
+	}{
+		{name: "write error", output: failingWriter{}},
+		{name: "write panic", output: failingWriter{panics: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fallback bytes.Buffer
+			logger := newLogger(config.LoggingConfig{Format: "json"}, tt.output, &fallback)
+
+			assert.NotPanics(t, func() {
+				logger.With("request_id", "abc").Info("todo created", "id", 1)
+			})
+			assert.Contains(t, fallback.String(), `msg="todo created"`)
+			assert.Contains(t, fallback.String(), "request_id=abc")
+		})
+	}
+}
+
+func TestFallbackHandlerWithoutFallback(t *testing.T) {
+	logger := newLogger(config.LoggingConfig{Format: "json"}, failingWriter{panics: true}, nil)
+
+	assert.NotPanics(t, func() {
+		logger.Info("todo created")
+	})
+}
+
+func TestFallbackHandlerUsesPrimary(t *testing.T) {
+	var primary, fallback bytes.Buffer
+	logger := slog.New(NewFallbackHandler(slog.NewJSONHandler(&primary, nil), slog.NewTextHandler(&fallback, nil)))
+
+	logger.Info("todo created")
+
+	assert.Contains(t, primary.String(), `"msg":"todo created"`)
+	assert.Empty(t, fallback.String())
+}
@@ -1,18 +1,99 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"strings"
 
 	"github.com/g3offrey/idiomapi/internal/config"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// Level is the minimum level of a logger, which can change while it is in
+// use
+type Level struct {
+	v *slog.LevelVar
+}
+
+// Set changes the level to name: debug, info, warn or error
+func (l *Level) Set(name string) error {
+	level, ok := lookupLevel(name)
+	if !ok {
+		return fmt.Errorf("unknown log level %q", name)
+	}
+	l.v.Set(level)
+	return nil
+}
+
+// String returns the name of the level in lower case
+func (l *Level) String() string {
+	return strings.ToLower(l.v.Level().String())
+}
+
 // New creates a new configured slog.Logger instance
-func New(cfg config.LoggingConfig) *slog.Logger {
+func New(cfg config.LoggingConfig) (*slog.Logger, error) {
+	log, _, err := NewWithLevel(cfg)
+	return log, err
+}
+
+// NewWithLevel is New also returning the Level of the logger, to change it
+// at runtime
+func NewWithLevel(cfg config.LoggingConfig) (*slog.Logger, *Level, error) {
+	w, err := newWriter(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var fallback io.Writer
+	if cfg.FallbackToStderr {
+		fallback = os.Stderr
+	}
+	log, level := newLeveledLogger(cfg, w, fallback)
+	return log, level, nil
+}
+
+// newWriter returns the destination selected by cfg.Output: standard
+// output by default, standard error, or a file that is rotated by size when
+// cfg.MaxSize is set
+func newWriter(cfg config.LoggingConfig) (io.Writer, error) {
+	switch strings.ToLower(cfg.Output) {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+
+	if cfg.MaxSize > 0 {
+		return &lumberjack.Logger{
+			Filename:   cfg.Output,
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+		}, nil
+	}
+
+	file, err := os.OpenFile(cfg.Output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	return file, nil
+}
+
+// newLogger creates a logger writing to w. Records that cannot be written
+// to w go to fallback as text, or are dropped when fallback is nil.
+func newLogger(cfg config.LoggingConfig, w, fallback io.Writer) *slog.Logger {
+	log, _ := newLeveledLogger(cfg, w, fallback)
+	return log
+}
+
+// newLeveledLogger is newLogger also returning the Level of the logger
+func newLeveledLogger(cfg config.LoggingConfig, w, fallback io.Writer) (*slog.Logger, *Level) {
 	var handler slog.Handler
 
-	level := parseLevel(cfg.Level)
+	level := &slog.LevelVar{}
+	level.Set(parseLevel(cfg.Level))
 	opts := &slog.HandlerOptions{
 		Level:     level,
 		AddSource: cfg.AddSource,
@@ -20,26 +101,61 @@ func New(cfg config.LoggingConfig) *slog.Logger {
 
 	switch strings.ToLower(cfg.Format) {
 	case "json":
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+		handler = slog.NewJSONHandler(w, opts)
 	default:
-		handler = slog.NewTextHandler(os.Stdout, opts)
+		handler = slog.NewTextHandler(w, opts)
+	}
+
+	var fallbackHandler slog.Handler
+	if fallback != nil {
+		fallbackHandler = slog.NewTextHandler(fallback, opts)
 	}
+	handler = NewFallbackHandler(handler, fallbackHandler)
 
-	return slog.New(handler)
+	if len(cfg.RedactKeys) > 0 {
+		handler = NewRedactHandler(handler, cfg.RedactKeys)
+	}
+
+	return slog.New(handler).With(constantAttrs(cfg)...), &Level{v: level}
+}
+
+// constantAttrs returns the attributes identifying the emitting instance,
+// leaving out those not configured
+func constantAttrs(cfg config.LoggingConfig) []any {
+	var attrs []any
+	for _, attr := range []slog.Attr{
+		slog.String("service", cfg.ServiceName),
+		slog.String("env", cfg.Environment),
+		slog.String("instance", cfg.Instance),
+	} {
+		if attr.Value.String() != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
 }
 
-// parseLevel converts string level to slog.Level
+// parseLevel converts string level to slog.Level, info when it is unknown
 func parseLevel(level string) slog.Level {
+	if l, ok := lookupLevel(level); ok {
+		return l
+	}
+	return slog.LevelInfo
+}
+
+// lookupLevel returns the slog.Level named level, and false when there is
+// none
+func lookupLevel(level string) (slog.Level, bool) {
 	switch strings.ToLower(level) {
 	case "debug":
-		return slog.LevelDebug
+		return slog.LevelDebug, true
 	case "info":
-		return slog.LevelInfo
+		return slog.LevelInfo, true
 	case "warn", "warning":
-		return slog.LevelWarn
+		return slog.LevelWarn, true
 	case "error":
-		return slog.LevelError
+		return slog.LevelError, true
 	default:
-		return slog.LevelInfo
+		return 0, false
 	}
 }
@@ -1,11 +1,17 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/g3offrey/idiomapi/internal/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 func TestNew(t *testing.T) {
@@ -63,12 +69,45 @@ func TestNew(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			logger := New(tt.cfg)
+			logger, err := New(tt.cfg)
+			require.NoError(t, err)
 			assert.NotNil(t, logger)
 		})
 	}
 }
 
+func TestNewWriter(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := newWriter(config.LoggingConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, os.Stdout, w)
+
+	w, err = newWriter(config.LoggingConfig{Output: "stdout"})
+	require.NoError(t, err)
+	assert.Equal(t, os.Stdout, w)
+
+	w, err = newWriter(config.LoggingConfig{Output: "stderr"})
+	require.NoError(t, err)
+	assert.Equal(t, os.Stderr, w)
+
+	path := filepath.Join(dir, "app.log")
+	w, err = newWriter(config.LoggingConfig{Output: path})
+	require.NoError(t, err)
+	file, ok := w.(*os.File)
+	require.True(t, ok)
+	assert.Equal(t, path, file.Name())
+	require.NoError(t, file.Close())
+
+	rotatedPath := filepath.Join(dir, "rotated.log")
+	w, err = newWriter(config.LoggingConfig{Output: rotatedPath, MaxSize: 10, MaxBackups: 3, MaxAge: 7})
+	require.NoError(t, err)
+	assert.Equal(t, &lumberjack.Logger{Filename: rotatedPath, MaxSize: 10, MaxBackups: 3, MaxAge: 7}, w)
+
+	_, err = newWriter(config.LoggingConfig{Output: filepath.Join(dir, "missing", "app.log")})
+	assert.Error(t, err)
+}
+
 func TestParseLevel(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -94,3 +133,39 @@ func TestParseLevel(t *testing.T) {
 		})
 	}
 }
+
+func TestNewLoggerConstantAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := config.LoggingConfig{Format: "json", ServiceName: "idiomapi", Environment: "production"}
+
+	// Loggers derived for a request keep the constant attributes
+	newLogger(cfg, &buf, nil).With("request_id", "abc").Info("request processed")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "idiomapi", record["service"])
+	assert.Equal(t, "production", record["env"])
+	assert.Equal(t, "abc", record["request_id"])
+	assert.NotContains(t, record, "instance")
+}
+
+func TestLevelSet(t *testing.T) {
+	var buf bytes.Buffer
+	log, level := newLeveledLogger(config.LoggingConfig{Level: "info", Format: "json"}, &buf, nil)
+
+	log.Debug("hidden")
+	assert.Empty(t, buf.String())
+
+	require.NoError(t, level.Set("debug"))
+	assert.Equal(t, "debug", level.String())
+	log.With("request_id", "abc").Debug("shown")
+	assert.Contains(t, buf.String(), "shown")
+
+	buf.Reset()
+	require.NoError(t, level.Set("WARN"))
+	log.Info("hidden again")
+	assert.Empty(t, buf.String())
+
+	assert.Error(t, level.Set("verbose"))
+	assert.Equal(t, "warn", level.String())
+}
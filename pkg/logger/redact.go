@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// RedactedValue replaces the values of sensitive attributes
+const RedactedValue = "****"
+
+// RedactHandler is a slog.Handler that masks the values of sensitive
+// attributes, at any group depth, before passing records to the wrapped
+// handler. Keys are matched case-insensitively.
+type RedactHandler struct {
+	next slog.Handler
+	keys map[string]struct{}
+}
+
+// NewRedactHandler wraps next so the values of attributes named by keys
+// are replaced with RedactedValue
+func NewRedactHandler(next slog.Handler, keys []string) *RedactHandler {
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		set[strings.ToLower(key)] = struct{}{}
+	}
+	return &RedactHandler{next: next, keys: set}
+}
+
+// Enabled reports whether the wrapped handler handles records at level
+func (h *RedactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle redacts the attributes of r and passes it to the wrapped handler
+func (h *RedactHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redact(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+// WithAttrs returns a RedactHandler whose wrapped handler includes the
+// redacted attrs
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redact(a)
+	}
+	return &RedactHandler{next: h.next.WithAttrs(redacted), keys: h.keys}
+}
+
+// WithGroup returns a RedactHandler whose wrapped handler opens the group
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	return &RedactHandler{next: h.next.WithGroup(name), keys: h.keys}
+}
+
+// redact masks a if its key is sensitive, or the sensitive attributes
+// nested in it when it is a group
+func (h *RedactHandler) redact(a slog.Attr) slog.Attr {
+	if _, ok := h.keys[strings.ToLower(a.Key)]; ok {
+		return slog.String(a.Key, RedactedValue)
+	}
+
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		return a
+	}
+
+	group := a.Value.Group()
+	redacted := make([]slog.Attr, len(group))
+	for i, nested := range group {
+		redacted[i] = h.redact(nested)
+	}
+	return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+}
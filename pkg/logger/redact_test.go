@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/g3offrey/idiomapi/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(logger *slog.Logger)
+	}{
+		{
+			name: "top level attribute",
+			log: func(logger *slog.Logger) {
+				logger.Info("login", "password", "hunter2")
+			},
+		},
+		{
+			name: "case insensitive key",
+			log: func(logger *slog.Logger) {
+				logger.Info("request", "Authorization", "hunter2")
+			},
+		},
+		{
+			name: "nested group",
+			log: func(logger *slog.Logger) {
+				logger.Info("request", slog.Group("headers", slog.String("token", "hunter2")))
+			},
+		},
+		{
+			name: "with attrs",
+			log: func(logger *slog.Logger) {
+				logger.With("token", "hunter2").Info("request")
+			},
+		},
+		{
+			name: "with group",
+			log: func(logger *slog.Logger) {
+				logger.WithGroup("user").Info("login", "password", "hunter2")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(slog.New(NewRedactHandler(slog.NewJSONHandler(&buf, nil), []string{"password", "token", "authorization"})))
+
+			assert.Contains(t, buf.String(), RedactedValue)
+			assert.NotContains(t, buf.String(), "hunter2")
+		})
+	}
+}
+
+func TestRedactHandlerKeepsOtherAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewRedactHandler(slog.NewTextHandler(&buf, nil), []string{"password"}))
+
+	logger.Info("login", "user", "alice", "password", "hunter2")
+
+	assert.Contains(t, buf.String(), "user=alice")
+	assert.Contains(t, buf.String(), "password="+RedactedValue)
+	assert.NotContains(t, buf.String(), "hunter2")
+}
+
+func TestNewRedactsConfiguredKeys(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(config.LoggingConfig{Format: "json", RedactKeys: []string{"token"}}, &buf, nil)
+
+	logger.Info("request", "token", "hunter2")
+
+	assert.Contains(t, buf.String(), RedactedValue)
+	assert.NotContains(t, buf.String(), "hunter2")
+}
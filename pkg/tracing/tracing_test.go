@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/g3offrey/idiomapi/internal/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+func TestNew_Disabled(t *testing.T) {
+	ctx := context.Background()
+
+	shutdown, err := New(ctx, config.TracingConfig{Enabled: false})
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(ctx))
+
+	_, span := otel.Tracer("test").Start(ctx, "span")
+	defer span.End()
+	assert.False(t, span.SpanContext().IsValid())
+}
+
+func TestNew_Enabled(t *testing.T) {
+	ctx := context.Background()
+
+	shutdown, err := New(ctx, config.TracingConfig{
+		Enabled:     true,
+		Endpoint:    "localhost:4318",
+		Insecure:    true,
+		SampleRatio: 1,
+		ServiceName: "idiomapi-test",
+	})
+	assert.NoError(t, err)
+	defer shutdown(ctx) //nolint:errcheck // nothing is listening on the endpoint
+
+	_, span := otel.Tracer("test").Start(ctx, "span")
+	defer span.End()
+	assert.True(t, span.SpanContext().IsValid())
+	assert.True(t, span.SpanContext().IsSampled())
+}